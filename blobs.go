@@ -80,6 +80,10 @@ type Descriptor struct {
 	// This should only be used when referring to a manifest.
 	Platform *v1.Platform `json:"platform,omitempty"`
 
+	// ArtifactType is the type of an artifact when the descriptor points to
+	// an artifact manifest, as reported by the referrers API.
+	ArtifactType string `json:"artifactType,omitempty"`
+
 	// NOTE: Before adding a field here, please ensure that all
 	// other options have been exhausted. Much of the type relationships
 	// depend on the simplicity of this type.
@@ -57,6 +57,21 @@ type Configuration struct {
 	// used to gate requests.
 	Auth Auth `yaml:"auth,omitempty"`
 
+	// TokenIssuer configures a token endpoint served by the registry
+	// itself, issuing tokens trusted by the token access controller.
+	TokenIssuer TokenIssuer `yaml:"tokenissuer,omitempty"`
+
+	// Robots configures robot accounts, credentials for automation stored
+	// in the registry and managed through its API.
+	Robots Robots `yaml:"robots,omitempty"`
+
+	// Audit configures the audit log, recording who accessed what in the
+	// registry and whether the access was allowed.
+	Audit Audit `yaml:"audit,omitempty"`
+
+	// RateLimit limits the rate at which clients use the registry.
+	RateLimit RateLimit `yaml:"ratelimit,omitempty"`
+
 	// Middleware lists all middlewares to be used by the registry.
 	Middleware map[string][]Middleware `yaml:"middleware,omitempty"`
 
@@ -114,6 +129,11 @@ type Configuration struct {
 			// Specifies a list of cipher suites allowed
 			CipherSuites []string `yaml:"ciphersuites,omitempty"`
 
+			// ReloadInterval is how often the certificate, key and client
+			// CAs are checked for changes and reloaded, 30 seconds by
+			// default. They are also reloaded on SIGHUP.
+			ReloadInterval time.Duration `yaml:"reloadinterval,omitempty"`
+
 			// LetsEncrypt is used to configuration setting up TLS through
 			// Let's Encrypt instead of manually specifying certificate and
 			// key. If a TLS certificate is specified, the Let's Encrypt
@@ -232,9 +252,39 @@ type Configuration struct {
 				// that URLs in pushed manifests must not match.
 				Deny []string `yaml:"deny,omitempty"`
 			} `yaml:"urls,omitempty"`
+			// Limits bounds the size and shape of pushed manifests. Zero
+			// values leave the corresponding property unbounded.
+			Limits struct {
+				// PayloadSize is the maximum size in bytes of a manifest.
+				PayloadSize int64 `yaml:"payloadsize,omitempty"`
+				// Layers is the maximum number of layers of an image.
+				Layers int `yaml:"layers,omitempty"`
+				// IndexEntries is the maximum number of manifests of a
+				// manifest list or image index.
+				IndexEntries int `yaml:"indexentries,omitempty"`
+				// ImageSize is the maximum total size in bytes of the
+				// config and layers of an image.
+				ImageSize int64 `yaml:"imagesize,omitempty"`
+			} `yaml:"limits,omitempty"`
+			// MediaTypes restricts the media types of the blobs
+			// referenced by pushed image manifests. Empty lists allow any
+			// media type.
+			MediaTypes struct {
+				// Layers lists the allowed layer media types.
+				Layers []string `yaml:"layers,omitempty"`
+				// Configs lists the allowed config media types.
+				Configs []string `yaml:"configs,omitempty"`
+			} `yaml:"mediatypes,omitempty"`
 		} `yaml:"manifests,omitempty"`
 	} `yaml:"validation,omitempty"`
 
+	// Quota configures storage quotas for repositories and namespaces.
+	Quota struct {
+		// Limits lists the quotas to enforce. A repository may be covered
+		// by several limits, all of which must be satisfied.
+		Limits []QuotaLimit `yaml:"limits,omitempty"`
+	} `yaml:"quota,omitempty"`
+
 	// Policy configures registry policy options.
 	Policy struct {
 		// Repository configures policies for repositories
@@ -246,9 +296,68 @@ type Configuration struct {
 			// the class in authorized resources.
 			Classes []string `yaml:"classes"`
 		} `yaml:"repository,omitempty"`
+
+		// ImmutableTags lists the tags which may not be moved or deleted
+		// once pushed.
+		ImmutableTags []ImmutableTagRule `yaml:"immutabletags,omitempty"`
+
+		// Admission lists the webhooks asked to admit manifests before
+		// they are stored.
+		Admission []AdmissionHook `yaml:"admission,omitempty"`
+
+		// Signatures lists the repositories whose tags must be signed by
+		// trusted keys.
+		Signatures []SignaturePolicy `yaml:"signatures,omitempty"`
 	} `yaml:"policy,omitempty"`
 }
 
+// QuotaLimit limits the storage used by a repository or a namespace.
+type QuotaLimit struct {
+	// Repository is the name of a repository, or a namespace prefix ending
+	// in "/" to limit the repositories beneath it as a whole.
+	Repository string `yaml:"repository"`
+
+	// Size is the maximum number of bytes of unique blob data that may be
+	// linked into the repository or namespace.
+	Size int64 `yaml:"size"`
+}
+
+// ImmutableTagRule makes the tags matching any of Tags immutable in the
+// repositories matching Repository. Both are regular expressions which must
+// match the whole name.
+type ImmutableTagRule struct {
+	// Repository matches the names of the repositories the rule applies to.
+	Repository string `yaml:"repository"`
+
+	// Tags match the names of the immutable tags.
+	Tags []string `yaml:"tags"`
+}
+
+// AdmissionHook configures a webhook which admits or denies manifest pushes.
+type AdmissionHook struct {
+	Name         string        `yaml:"name"`         // identifies the hook in logs and errors
+	URL          string        `yaml:"url"`          // post url for the hook
+	Headers      http.Header   `yaml:"headers"`      // static headers that should be added to all requests
+	Timeout      time.Duration `yaml:"timeout"`      // HTTP timeout
+	FailOpen     bool          `yaml:"failopen"`     // admit manifests when the hook cannot be reached
+	Repositories []string      `yaml:"repositories"` // regular expressions matching the repositories to check, all when empty
+}
+
+// SignaturePolicy requires the manifests tagged in the repositories matching
+// Repositories to be signed by one of Keys.
+type SignaturePolicy struct {
+	// Repositories are regular expressions matching the whole name of the
+	// repositories the policy applies to.
+	Repositories []string `yaml:"repositories"`
+
+	// Keys are paths to PEM encoded ECDSA or ed25519 public keys.
+	Keys []string `yaml:"keys"`
+
+	// VerifyOnPull checks the signature when a manifest is pulled by tag,
+	// in addition to when it is tagged.
+	VerifyOnPull bool `yaml:"verifyonpull"`
+}
+
 // LogHook is composed of hook Level and Type.
 // After hooks configuration, it can execute the next handling automatically,
 // when defined levels of log message emitted.
@@ -560,6 +669,131 @@ func (auth Auth) MarshalYAML() (interface{}, error) {
 	return map[string]Parameters(auth), nil
 }
 
+// TokenIssuer configures the token endpoint served by the registry.
+type TokenIssuer struct {
+	// Enabled serves the token endpoint.
+	Enabled bool `yaml:"enabled,omitempty"`
+
+	// Path is the path of the token endpoint, /auth/token by default.
+	Path string `yaml:"path,omitempty"`
+
+	// Issuer is the issuer name inserted into tokens.
+	Issuer string `yaml:"issuer,omitempty"`
+
+	// Service is the only service tokens are issued for, that of the token
+	// access controller by default.
+	Service string `yaml:"service,omitempty"`
+
+	// SigningKey is the path to the private key tokens are signed with. A
+	// key is generated at startup when empty.
+	SigningKey string `yaml:"signingkey,omitempty"`
+
+	// Expiration is how long issued tokens are valid, 5 minutes by default.
+	Expiration time.Duration `yaml:"expiration,omitempty"`
+
+	// Authenticator configures the access controller, such as htpasswd,
+	// which authenticates the credentials of token requests and decides
+	// which access to grant.
+	Authenticator Auth `yaml:"authenticator,omitempty"`
+}
+
+// Robots configures robot accounts.
+type Robots struct {
+	// Enabled serves the robot accounts API and accepts robot account
+	// credentials with any access controller.
+	Enabled bool `yaml:"enabled,omitempty"`
+}
+
+// Audit configures the audit log and its sinks. The audit log is enabled
+// when at least one sink is configured.
+type Audit struct {
+	// Exclude filters out noisy records.
+	Exclude AuditExclude `yaml:"exclude,omitempty"`
+
+	// File writes records as lines of JSON to a rotated file.
+	File AuditFile `yaml:"file,omitempty"`
+
+	// Syslog sends records as JSON messages to syslog.
+	Syslog AuditSyslog `yaml:"syslog,omitempty"`
+}
+
+// AuditExclude lists the records left out of the audit log.
+type AuditExclude struct {
+	// Methods lists HTTP methods, such as HEAD, whose requests are not
+	// recorded.
+	Methods []string `yaml:"methods,omitempty"`
+
+	// Actions lists actions, such as pull, which are not recorded.
+	Actions []string `yaml:"actions,omitempty"`
+
+	// Decisions lists decisions, allowed or denied, which are not recorded.
+	Decisions []string `yaml:"decisions,omitempty"`
+}
+
+// AuditFile configures the audit log file.
+type AuditFile struct {
+	// Path is the path of the file. The file sink is disabled when empty.
+	Path string `yaml:"path,omitempty"`
+
+	// MaxSize is the size in bytes past which the file is rotated. The file
+	// is never rotated when zero.
+	MaxSize int64 `yaml:"maxsize,omitempty"`
+
+	// MaxBackups is the number of rotated files kept.
+	MaxBackups int `yaml:"maxbackups,omitempty"`
+}
+
+// AuditSyslog configures the syslog audit sink.
+type AuditSyslog struct {
+	// Enabled sends records to syslog.
+	Enabled bool `yaml:"enabled,omitempty"`
+
+	// Network and Address locate the syslog daemon, such as "udp" and
+	// "localhost:514". The local syslog daemon is used when Network is
+	// empty.
+	Network string `yaml:"network,omitempty"`
+	Address string `yaml:"address,omitempty"`
+
+	// Tag tags the messages, "registry" by default.
+	Tag string `yaml:"tag,omitempty"`
+}
+
+// RateLimit configures the token buckets limiting the rate at which clients
+// use the registry.
+type RateLimit struct {
+	// Store keeps the state of the buckets: "memory", the default, or
+	// "redis" to share it between the replicas of the registry, using the
+	// redis configuration.
+	Store string `yaml:"store,omitempty"`
+
+	// TrustedProxies is the number of proxies in front of the registry
+	// whose X-Forwarded-For entries are trusted to give the client IP. The
+	// client IP is that of the connection by default.
+	TrustedProxies int `yaml:"trustedproxies,omitempty"`
+
+	// Limits lists the limits to enforce. A request may be covered by
+	// several limits, all of which must be satisfied.
+	Limits []RateLimitRule `yaml:"limits,omitempty"`
+}
+
+// RateLimitRule gives each user, client IP or repository a token bucket for
+// a budget.
+type RateLimitRule struct {
+	// Key is what the buckets are kept by: user, ip or repository.
+	Key string `yaml:"key"`
+
+	// Budget is what the tokens pay for: manifests, one token per manifest
+	// request, blobbytes, one token per byte of blob downloaded or
+	// uploaded, or uploads, one token per blob upload started.
+	Budget string `yaml:"budget"`
+
+	// Rate is the number of tokens added to a bucket per second.
+	Rate float64 `yaml:"rate"`
+
+	// Burst is the capacity of a bucket, which starts full.
+	Burst float64 `yaml:"burst"`
+}
+
 // Notifications configures multiple http endpoints.
 type Notifications struct {
 	// EventConfig is the configuration for the event format that is sent to each Endpoint.
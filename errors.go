@@ -33,6 +33,17 @@ func (err ErrTagUnknown) Error() string {
 	return fmt.Sprintf("unknown tag=%s", err.Tag)
 }
 
+// ErrTagImmutable is returned when an immutable tag would be moved to a
+// manifest other than the one it points to.
+type ErrTagImmutable struct {
+	Tag    string
+	Digest digest.Digest
+}
+
+func (err ErrTagImmutable) Error() string {
+	return fmt.Sprintf("tag %s is immutable and already points to %s", err.Tag, err.Digest)
+}
+
 // ErrRepositoryUnknown is returned if the named repository is not known by
 // the registry.
 type ErrRepositoryUnknown struct {
@@ -43,6 +54,16 @@ func (err ErrRepositoryUnknown) Error() string {
 	return fmt.Sprintf("unknown repository name=%s", err.Name)
 }
 
+// ErrRepositoryExists is returned if a repository cannot be created under a
+// name because a repository with that name is already known by the registry.
+type ErrRepositoryExists struct {
+	Name string
+}
+
+func (err ErrRepositoryExists) Error() string {
+	return fmt.Sprintf("repository name=%s already exists", err.Name)
+}
+
 // ErrRepositoryNameInvalid should be used to denote an invalid repository
 // name. Reason may set, indicating the cause of invalidity.
 type ErrRepositoryNameInvalid struct {
@@ -117,3 +138,58 @@ type ErrManifestNameInvalid struct {
 func (err ErrManifestNameInvalid) Error() string {
 	return fmt.Sprintf("manifest name %q invalid: %v", err.Name, err.Reason)
 }
+
+// ErrManifestSubjectInvalid is returned when the subject of a manifest is
+// not a valid manifest descriptor.
+type ErrManifestSubjectInvalid struct {
+	Reason string
+}
+
+func (err ErrManifestSubjectInvalid) Error() string {
+	return fmt.Sprintf("invalid subject on manifest: %s", err.Reason)
+}
+
+// ErrManifestLimitExceeded is returned when a manifest exceeds one of the
+// size or shape limits of the registry.
+type ErrManifestLimitExceeded struct {
+	// Limit names the exceeded limit, such as "layers".
+	Limit string
+	// Max is the configured limit.
+	Max int64
+	// Value is the value found in the manifest.
+	Value int64
+}
+
+func (err ErrManifestLimitExceeded) Error() string {
+	return fmt.Sprintf("manifest exceeds the %s limit: %d is more than %d", err.Limit, err.Value, err.Max)
+}
+
+// ErrManifestMediaTypeInvalid is returned when a manifest references a blob
+// with a media type the registry does not allow.
+type ErrManifestMediaTypeInvalid struct {
+	// Kind is the kind of the referenced blob, "layer" or "config".
+	Kind string
+	// MediaType is the disallowed media type.
+	MediaType string
+}
+
+func (err ErrManifestMediaTypeInvalid) Error() string {
+	return fmt.Sprintf("%s media type %q is not allowed", err.Kind, err.MediaType)
+}
+
+// ErrQuotaExceeded is returned when storing content would take a repository
+// or namespace over its configured storage quota.
+type ErrQuotaExceeded struct {
+	// Scope is the repository name or namespace prefix the quota applies to.
+	Scope string
+	// Limit is the size of the quota in bytes.
+	Limit int64
+	// Usage is the number of bytes already stored within the scope.
+	Usage int64
+	// Size is the number of bytes that were to be added.
+	Size int64
+}
+
+func (err ErrQuotaExceeded) Error() string {
+	return fmt.Sprintf("storage quota exceeded for %s: %d bytes used, %d bytes requested, limit is %d bytes", err.Scope, err.Usage, err.Size, err.Limit)
+}
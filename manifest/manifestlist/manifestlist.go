@@ -119,8 +119,19 @@ type ManifestDescriptor struct {
 type ManifestList struct {
 	manifest.Versioned
 
+	// ArtifactType is the type of an artifact when the image index is used
+	// for an artifact. It is only valid for OCI image indexes.
+	ArtifactType string `json:"artifactType,omitempty"`
+
 	// Manifests references a list of manifests
 	Manifests []ManifestDescriptor `json:"manifests"`
+
+	// Subject is an optional link from the image index to another manifest.
+	// It is only valid for OCI image indexes.
+	Subject *distribution.Descriptor `json:"subject,omitempty"`
+
+	// Annotations contains arbitrary metadata for the image index.
+	Annotations map[string]string `json:"annotations,omitempty"`
 }
 
 // References returns the distribution descriptors for the referenced image
@@ -44,6 +44,10 @@ func init() {
 type Manifest struct {
 	manifest.Versioned
 
+	// ArtifactType is the type of an artifact when the manifest is used for
+	// an artifact rather than an image.
+	ArtifactType string `json:"artifactType,omitempty"`
+
 	// Config references the image configuration as a blob.
 	Config distribution.Descriptor `json:"config"`
 
@@ -51,6 +55,11 @@ type Manifest struct {
 	// configuration.
 	Layers []distribution.Descriptor `json:"layers"`
 
+	// Subject is an optional link from the image manifest to another
+	// manifest forming an association between the image manifest and the
+	// other manifest.
+	Subject *distribution.Descriptor `json:"subject,omitempty"`
+
 	// Annotations contains arbitrary metadata for the image manifest.
 	Annotations map[string]string `json:"annotations,omitempty"`
 }
@@ -214,3 +214,38 @@ func TestValidateManifest(t *testing.T) {
 		}
 	})
 }
+
+func TestManifestSubject(t *testing.T) {
+	manifest := makeTestManifest(v1.MediaTypeImageManifest)
+	manifest.ArtifactType = "application/vnd.example.sbom"
+	manifest.Subject = &distribution.Descriptor{
+		MediaType: v1.MediaTypeImageManifest,
+		Size:      1234,
+		Digest:    "sha256:5b0bcabd1ed22e9fb1310cf6c2dec7cdef19f0ad69efa1f392e94a4333501270",
+	}
+
+	deserialized, err := FromStruct(manifest)
+	if err != nil {
+		t.Fatalf("error creating DeserializedManifest: %v", err)
+	}
+
+	unmarshalled, _, err := distribution.UnmarshalManifest(v1.MediaTypeImageManifest, deserialized.canonical)
+	if err != nil {
+		t.Fatalf("error unmarshaling manifest: %v", err)
+	}
+
+	asManifest := unmarshalled.(*DeserializedManifest)
+	if asManifest.ArtifactType != manifest.ArtifactType {
+		t.Fatalf("unexpected artifact type: %s", asManifest.ArtifactType)
+	}
+	if !reflect.DeepEqual(asManifest.Subject, manifest.Subject) {
+		t.Fatalf("unexpected subject: %v != %v", asManifest.Subject, manifest.Subject)
+	}
+
+	// the subject is not a dependency of the manifest
+	for _, reference := range asManifest.References() {
+		if reference.Digest == manifest.Subject.Digest {
+			t.Fatalf("subject should not be referenced")
+		}
+	}
+}
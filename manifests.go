@@ -69,6 +69,14 @@ type ManifestEnumerator interface {
 	Enumerate(ctx context.Context, ingester func(digest.Digest) error) error
 }
 
+// ManifestReferrersLister lists the manifests which refer to another
+// manifest through their subject field.
+type ManifestReferrersLister interface {
+	// Referrers returns descriptors of the manifests with the given subject.
+	// If artifactType is not empty, only referrers of that type are returned.
+	Referrers(ctx context.Context, subject digest.Digest, artifactType string) ([]Descriptor, error)
+}
+
 // Describable is an interface for descriptors
 type Describable interface {
 	Descriptor() Descriptor
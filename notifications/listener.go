@@ -3,6 +3,7 @@ package notifications
 import (
 	"context"
 	"net/http"
+	"time"
 
 	"github.com/distribution/distribution/v3"
 
@@ -125,6 +126,16 @@ func (msl *manifestServiceListener) Put(ctx context.Context, sm distribution.Man
 	return dgst, err
 }
 
+// Referrers passes through to the wrapped manifest service, if it supports
+// listing referrers.
+func (msl *manifestServiceListener) Referrers(ctx context.Context, subject digest.Digest, artifactType string) ([]distribution.Descriptor, error) {
+	lister, ok := msl.ManifestService.(distribution.ManifestReferrersLister)
+	if !ok {
+		return nil, distribution.ErrUnsupported
+	}
+	return lister.Referrers(ctx, subject, artifactType)
+}
+
 type blobServiceListener struct {
 	distribution.BlobStore
 	parent *repositoryListener
@@ -261,3 +272,23 @@ func (tagSL *tagServiceListener) Untag(ctx context.Context, tag string) error {
 	}
 	return nil
 }
+
+// List passes through to the wrapped tag service, if it supports listing
+// tags a page at a time.
+func (tagSL *tagServiceListener) List(ctx context.Context, last string, n int) ([]string, error) {
+	lister, ok := tagSL.TagService.(distribution.TagLister)
+	if !ok {
+		return nil, distribution.ErrUnsupported
+	}
+	return lister.List(ctx, last, n)
+}
+
+// ModTime passes through to the wrapped tag service, if it supports
+// reporting the time at which tags were updated.
+func (tagSL *tagServiceListener) ModTime(ctx context.Context, tag string) (time.Time, error) {
+	provider, ok := tagSL.TagService.(distribution.TagModTimeProvider)
+	if !ok {
+		return time.Time{}, distribution.ErrUnsupported
+	}
+	return provider.ModTime(ctx, tag)
+}
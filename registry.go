@@ -49,6 +49,13 @@ type Namespace interface {
 	BlobStatter() BlobStatter
 }
 
+// RepositoryPrefixLister lists the repositories within part of the namespace.
+type RepositoryPrefixLister interface {
+	// RepositoriesWithPrefix behaves like Namespace.Repositories, only
+	// listing the repositories whose name starts with prefix.
+	RepositoriesWithPrefix(ctx context.Context, prefix string, repos []string, last string) (n int, err error)
+}
+
 // RepositoryEnumerator describes an operation to enumerate repositories
 type RepositoryEnumerator interface {
 	Enumerate(ctx context.Context, ingester func(string) error) error
@@ -59,6 +66,12 @@ type RepositoryRemover interface {
 	Remove(ctx context.Context, name reference.Named) error
 }
 
+// RepositoryRenamer moves a repository, with its manifests, tags and layers,
+// to a new name
+type RepositoryRenamer interface {
+	Rename(ctx context.Context, from, to reference.Named) error
+}
+
 // ManifestServiceOption is a function argument for Manifest Service methods
 type ManifestServiceOption interface {
 	Apply(ManifestService) error
@@ -26,6 +26,14 @@ var (
 		Description: `Tag or digest of the target manifest.`,
 	}
 
+	robotParameterDescriptor = ParameterDescriptor{
+		Name:        "robot",
+		Type:        "string",
+		Format:      "<robot name>",
+		Required:    true,
+		Description: `Name of the target robot account.`,
+	}
+
 	uuidParameterDescriptor = ParameterDescriptor{
 		Name:        "uuid",
 		Type:        "opaque",
@@ -155,6 +163,19 @@ var (
 		},
 	}
 
+	robotNotFoundResponseDescriptor = ResponseDescriptor{
+		Name:        "No Such Robot Account Error",
+		StatusCode:  http.StatusNotFound,
+		Description: "The robot account is not known to the registry.",
+		Body: BodyDescriptor{
+			ContentType: "application/json",
+			Format:      errorsBody,
+		},
+		ErrorCodes: []errcode.ErrorCode{
+			ErrorCodeRobotUnknown,
+		},
+	}
+
 	deniedResponseDescriptor = ResponseDescriptor{
 		Name:        "Access Denied",
 		StatusCode:  http.StatusForbidden,
@@ -1591,6 +1612,700 @@ var routeDescriptors = []RouteDescriptor{
 							},
 						},
 					},
+					{
+						Name:        "Catalog Fetch Filtered",
+						Description: "Return the repositories whose name starts with the given prefix, such as all repositories of a namespace when the prefix ends with `/`. The prefix is kept in pagination links.",
+						QueryParameters: append([]ParameterDescriptor{
+							{
+								Name:        "prefix",
+								Type:        "string",
+								Description: "Only return repositories whose name starts with prefix.",
+								Format:      "<prefix>",
+								Required:    true,
+							},
+						}, paginationParameters...),
+						Successes: []ResponseDescriptor{
+							{
+								StatusCode: http.StatusOK,
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format: `{
+	"repositories": [
+		<name>,
+		...
+	]
+}`,
+								},
+								Headers: []ParameterDescriptor{
+									{
+										Name:        "Content-Length",
+										Type:        "integer",
+										Description: "Length of the JSON response body.",
+										Format:      "<length>",
+									},
+									linkHeader,
+								},
+							},
+						},
+						Failures: []ResponseDescriptor{
+							{
+								Name:        "Invalid Prefix",
+								Description: "The namespace part of the prefix is not a valid repository name.",
+								StatusCode:  http.StatusBadRequest,
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format:      errorsBody,
+								},
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeNameInvalid,
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	},
+	{
+		Name:        RouteNameQuota,
+		Path:        "/v2/{name:" + reference.NameRegexp.String() + "}/_ext/quota",
+		Entity:      "Quota",
+		Description: "Report the storage quotas applying to a repository. This is a registry extension and is only meaningful when quotas are configured.",
+		Methods: []MethodDescriptor{
+			{
+				Method:      "GET",
+				Description: "Fetch the quotas covering the repository identified by `name`, along with their current usage.",
+				Requests: []RequestDescriptor{
+					{
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+						},
+						PathParameters: []ParameterDescriptor{
+							nameParameterDescriptor,
+						},
+						Successes: []ResponseDescriptor{
+							{
+								StatusCode:  http.StatusOK,
+								Description: "The quotas covering the named repository. Sizes are in bytes. A scope ending in `/` is a namespace quota shared by every repository beneath it.",
+								Headers: []ParameterDescriptor{
+									{
+										Name:        "Content-Length",
+										Type:        "integer",
+										Description: "Length of the JSON response body.",
+										Format:      "<length>",
+									},
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format: `{
+    "name": <name>,
+    "quotas": [
+        {
+            "scope": <repository or namespace prefix>,
+            "limit": <bytes>,
+            "usage": <bytes>
+        },
+        ...
+    ]
+}`,
+								},
+							},
+						},
+						Failures: []ResponseDescriptor{
+							unauthorizedResponseDescriptor,
+							deniedResponseDescriptor,
+							tooManyRequestsDescriptor,
+						},
+					},
+				},
+			},
+		},
+	},
+	{
+		Name:        RouteNameReferrers,
+		Path:        "/v2/{name:" + reference.NameRegexp.String() + "}/referrers/{digest:" + digest.DigestRegexp.String() + "}",
+		Entity:      "Referrers",
+		Description: "List the manifests referring to another manifest through their `subject` field, such as signatures and software bills of materials.",
+		Methods: []MethodDescriptor{
+			{
+				Method:      "GET",
+				Description: "Fetch the referrers of the manifest identified by `name` and `digest`. The manifest itself need not exist.",
+				Requests: []RequestDescriptor{
+					{
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+						},
+						PathParameters: []ParameterDescriptor{
+							nameParameterDescriptor,
+							digestPathParameter,
+						},
+						QueryParameters: []ParameterDescriptor{
+							{
+								Name:        "artifactType",
+								Type:        "string",
+								Format:      "<artifact type>",
+								Required:    false,
+								Description: "Only return referrers of the given artifact type.",
+							},
+						},
+						Successes: []ResponseDescriptor{
+							{
+								StatusCode:  http.StatusOK,
+								Description: "An OCI image index with a descriptor for each referrer. The index is empty if the manifest has no referrers.",
+								Headers: []ParameterDescriptor{
+									{
+										Name:        "Content-Length",
+										Type:        "integer",
+										Description: "Length of the JSON response body.",
+										Format:      "<length>",
+									},
+									{
+										Name:        "OCI-Filters-Applied",
+										Type:        "string",
+										Description: "Set to `artifactType` when the referrers were filtered by artifact type.",
+										Format:      "artifactType",
+									},
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/vnd.oci.image.index.v1+json",
+									Format: `{
+    "schemaVersion": 2,
+    "mediaType": "application/vnd.oci.image.index.v1+json",
+    "manifests": [
+        {
+            "mediaType": <media type>,
+            "size": <size>,
+            "digest": <digest>,
+            "artifactType": <artifact type>,
+            "annotations": <annotations>
+        },
+        ...
+    ]
+}`,
+								},
+							},
+						},
+						Failures: []ResponseDescriptor{
+							{
+								Name:        "Invalid Digest",
+								StatusCode:  http.StatusBadRequest,
+								Description: "The digest is not valid.",
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeDigestInvalid,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format:      errorsBody,
+								},
+							},
+							unauthorizedResponseDescriptor,
+							repositoryNotFoundResponseDescriptor,
+							deniedResponseDescriptor,
+							tooManyRequestsDescriptor,
+						},
+					},
+				},
+			},
+		},
+	},
+	{
+		Name:        RouteNameTagMetadata,
+		Path:        "/v2/{name:" + reference.NameRegexp.String() + "}/_ext/tags",
+		Entity:      "Tag Metadata",
+		Description: "Retrieve tags along with the manifests they point to. This is a registry extension.",
+		Methods: []MethodDescriptor{
+			{
+				Method:      "GET",
+				Description: "Fetch the tags under the repository identified by `name`, with the digest, media type and total size of the manifest each tag points to and the time the tag was last updated.",
+				Requests: []RequestDescriptor{
+					{
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+						},
+						PathParameters: []ParameterDescriptor{
+							nameParameterDescriptor,
+						},
+						QueryParameters: append([]ParameterDescriptor{
+							{
+								Name:        "sort",
+								Type:        "string",
+								Format:      "name|time",
+								Required:    false,
+								Description: "Order tags by name, which is the default, or by the time they were last updated, most recent first. Pagination with `last` follows the same order.",
+							},
+							{
+								Name:        "lastmodtime",
+								Type:        "string",
+								Format:      "<RFC 3339 time>",
+								Required:    false,
+								Description: "When sorting by time, the modification time of the `last` tag, as given in the `Link` header, so that the page resumes where that tag sorted even if it was removed or updated since.",
+							},
+						}, paginationParameters...),
+						Successes: []ResponseDescriptor{
+							{
+								StatusCode:  http.StatusOK,
+								Description: "The tags of the named repository. The size is that of the manifest and every blob it references, including those of the manifests in an index.",
+								Headers: []ParameterDescriptor{
+									{
+										Name:        "Content-Length",
+										Type:        "integer",
+										Description: "Length of the JSON response body.",
+										Format:      "<length>",
+									},
+									linkHeader,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format: `{
+    "name": <name>,
+    "tags": [
+        {
+            "name": <tag>,
+            "digest": <digest>,
+            "mediaType": <media type>,
+            "size": <bytes>,
+            "modTime": <RFC 3339 time>
+        },
+        ...
+    ]
+}`,
+								},
+							},
+						},
+						Failures: []ResponseDescriptor{
+							{
+								Name:        "Invalid pagination number",
+								Description: "The received parameter n was invalid in some way, as described by the error code. The client should resolve the issue and retry the request.",
+								StatusCode:  http.StatusBadRequest,
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format:      errorsBody,
+								},
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodePaginationNumberInvalid,
+								},
+							},
+							unauthorizedResponseDescriptor,
+							repositoryNotFoundResponseDescriptor,
+							deniedResponseDescriptor,
+							tooManyRequestsDescriptor,
+						},
+					},
+				},
+			},
+		},
+	},
+	{
+		Name:        RouteNameCopy,
+		Path:        "/v2/{name:" + reference.NameRegexp.String() + "}/_ext/copy",
+		Entity:      "Copy",
+		Description: "Copy manifests from another repository without transferring their content through a client. This is a registry extension.",
+		Methods: []MethodDescriptor{
+			{
+				Method:      "POST",
+				Description: "Copy the manifest identified by `reference` in the repository `from` into the repository identified by `name`, along with the manifests of an index. The blobs are mounted from the source repository. Pull access to the source repository is required.",
+				Requests: []RequestDescriptor{
+					{
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+						},
+						PathParameters: []ParameterDescriptor{
+							nameParameterDescriptor,
+						},
+						QueryParameters: []ParameterDescriptor{
+							{
+								Name:        "from",
+								Type:        "query",
+								Format:      "<repository name>",
+								Regexp:      reference.NameRegexp,
+								Required:    true,
+								Description: "Name of the repository to copy the manifest from.",
+							},
+							{
+								Name:        "reference",
+								Type:        "query",
+								Format:      "<tag>|<digest>",
+								Required:    true,
+								Description: "Tag or digest of the manifest in the source repository.",
+							},
+							{
+								Name:        "tag",
+								Type:        "query",
+								Format:      "<tag>",
+								Required:    false,
+								Description: "Tag to apply to the copied manifest. Without it, the manifest is only copied by digest.",
+							},
+						},
+						Successes: []ResponseDescriptor{
+							{
+								Description: "The manifest has been copied into the repository and is available at the provided location.",
+								StatusCode:  http.StatusCreated,
+								Headers: []ParameterDescriptor{
+									{
+										Name:        "Location",
+										Type:        "url",
+										Format:      "<url>",
+										Description: "The canonical location url of the copied manifest.",
+									},
+									contentLengthZeroHeader,
+									digestHeader,
+								},
+							},
+						},
+						Failures: []ResponseDescriptor{
+							{
+								Name:        "Invalid Request",
+								Description: "The source repository name, reference or tag is invalid.",
+								StatusCode:  http.StatusBadRequest,
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format:      errorsBody,
+								},
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeNameInvalid,
+									ErrorCodeTagInvalid,
+									ErrorCodeDigestInvalid,
+								},
+							},
+							{
+								Name:        "Unknown Manifest",
+								Description: "The manifest or one of the blobs it references is not known to the source repository.",
+								StatusCode:  http.StatusNotFound,
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format:      errorsBody,
+								},
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeNameUnknown,
+									ErrorCodeManifestUnknown,
+									ErrorCodeBlobUnknown,
+								},
+							},
+							unauthorizedResponseDescriptor,
+							deniedResponseDescriptor,
+							tooManyRequestsDescriptor,
+						},
+					},
+				},
+			},
+		},
+	},
+	{
+		Name:        RouteNameRepository,
+		Path:        "/v2/{name:" + reference.NameRegexp.String() + "}/_ext/repository",
+		Entity:      "Repository",
+		Description: "Remove whole repositories. This is a registry extension.",
+		Methods: []MethodDescriptor{
+			{
+				Method:      "DELETE",
+				Description: "Delete the repository identified by `name`, with all of its tags, manifests and layer links. Repositories nested under the name are kept. Blobs are only reclaimed by garbage collection.",
+				Requests: []RequestDescriptor{
+					{
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+						},
+						PathParameters: []ParameterDescriptor{
+							nameParameterDescriptor,
+						},
+						Successes: []ResponseDescriptor{
+							{
+								StatusCode: http.StatusAccepted,
+								Headers: []ParameterDescriptor{
+									contentLengthZeroHeader,
+								},
+							},
+						},
+						Failures: []ResponseDescriptor{
+							{
+								Name:        "Not allowed",
+								Description: "Repository delete is not allowed because the registry is configured as a pull-through cache or `delete` has been disabled.",
+								StatusCode:  http.StatusMethodNotAllowed,
+								ErrorCodes: []errcode.ErrorCode{
+									errcode.ErrorCodeUnsupported,
+								},
+							},
+							unauthorizedResponseDescriptor,
+							repositoryNotFoundResponseDescriptor,
+							deniedResponseDescriptor,
+							tooManyRequestsDescriptor,
+						},
+					},
+				},
+			},
+		},
+	},
+	{
+		Name:        RouteNameRename,
+		Path:        "/v2/{name:" + reference.NameRegexp.String() + "}/_ext/rename",
+		Entity:      "Repository Rename",
+		Description: "Move repositories to a new name. This is a registry extension.",
+		Methods: []MethodDescriptor{
+			{
+				Method:      "POST",
+				Description: "Move the repository identified by `name`, with all of its tags, manifests and layer links, to the name `to`. Uploads in progress are cancelled. Delete access to the repository and push access to the new name are required.",
+				Requests: []RequestDescriptor{
+					{
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+						},
+						PathParameters: []ParameterDescriptor{
+							nameParameterDescriptor,
+						},
+						QueryParameters: []ParameterDescriptor{
+							{
+								Name:        "to",
+								Type:        "query",
+								Format:      "<repository name>",
+								Regexp:      reference.NameRegexp,
+								Required:    true,
+								Description: "New name of the repository, which must not exist yet.",
+							},
+						},
+						Successes: []ResponseDescriptor{
+							{
+								Description: "The repository has been renamed. The location of its tags is returned.",
+								StatusCode:  http.StatusCreated,
+								Headers: []ParameterDescriptor{
+									{
+										Name:        "Location",
+										Type:        "url",
+										Format:      "<url>",
+										Description: "The url listing the tags of the renamed repository.",
+									},
+									contentLengthZeroHeader,
+								},
+							},
+						},
+						Failures: []ResponseDescriptor{
+							{
+								Name:        "Invalid Name",
+								Description: "The new name of the repository is invalid.",
+								StatusCode:  http.StatusBadRequest,
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format:      errorsBody,
+								},
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeNameInvalid,
+								},
+							},
+							{
+								Name:        "Not allowed",
+								Description: "Repository rename is not allowed because the registry is configured as a pull-through cache or `delete` has been disabled.",
+								StatusCode:  http.StatusMethodNotAllowed,
+								ErrorCodes: []errcode.ErrorCode{
+									errcode.ErrorCodeUnsupported,
+								},
+							},
+							{
+								Name:        "Repository Exists",
+								Description: "A repository with the new name already exists.",
+								StatusCode:  http.StatusForbidden,
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format:      errorsBody,
+								},
+								ErrorCodes: []errcode.ErrorCode{
+									errcode.ErrorCodeDenied,
+								},
+							},
+							unauthorizedResponseDescriptor,
+							repositoryNotFoundResponseDescriptor,
+							deniedResponseDescriptor,
+							tooManyRequestsDescriptor,
+						},
+					},
+				},
+			},
+		},
+	},
+	{
+		Name:        RouteNameRobots,
+		Path:        "/v2/_ext/robots",
+		Entity:      "Robot Accounts",
+		Description: "List and create robot accounts, named credentials limited to matching repositories and actions. This is a registry extension, available when robot accounts are enabled.",
+		Methods: []MethodDescriptor{
+			{
+				Method:      "GET",
+				Description: "List the robot accounts, sorted by name. Secrets are never returned.",
+				Requests: []RequestDescriptor{
+					{
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+						},
+						Successes: []ResponseDescriptor{
+							{
+								StatusCode:  http.StatusOK,
+								Description: "A list of robot accounts.",
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format: `{
+	"robots": [
+		{
+			"name": <name>,
+			"repositories": [<pattern>, ...],
+			"actions": [<action>, ...],
+			"created": <time>,
+			"expires": <time>,
+			"lastUsed": <time>
+		},
+		...
+	]
+}`,
+								},
+							},
+						},
+						Failures: []ResponseDescriptor{
+							unauthorizedResponseDescriptor,
+							deniedResponseDescriptor,
+							tooManyRequestsDescriptor,
+						},
+					},
+				},
+			},
+			{
+				Method:      "POST",
+				Description: "Create a robot account. The secret of the robot account is only returned in the response. Robot accounts authenticate with basic authentication, using their name prefixed with `robot$` as the username.",
+				Requests: []RequestDescriptor{
+					{
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+						},
+						Body: BodyDescriptor{
+							ContentType: "application/json",
+							Format: `{
+	"name": <name>,
+	"repositories": [<pattern>, ...],
+	"actions": [<action>, ...],
+	"expires": <time>
+}`,
+						},
+						Successes: []ResponseDescriptor{
+							{
+								Description: "The robot account has been created.",
+								StatusCode:  http.StatusCreated,
+								Headers: []ParameterDescriptor{
+									{
+										Name:        "Location",
+										Type:        "url",
+										Format:      "<url>",
+										Description: "The url of the robot account.",
+									},
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format: `{
+	"name": <name>,
+	"repositories": [<pattern>, ...],
+	"actions": [<action>, ...],
+	"created": <time>,
+	"expires": <time>,
+	"secret": <secret>
+}`,
+								},
+							},
+						},
+						Failures: []ResponseDescriptor{
+							{
+								Name:        "Invalid Robot Account",
+								Description: "The name, repository patterns or actions of the robot account are invalid, or a robot account with the name exists.",
+								StatusCode:  http.StatusBadRequest,
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format:      errorsBody,
+								},
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeRobotInvalid,
+								},
+							},
+							unauthorizedResponseDescriptor,
+							deniedResponseDescriptor,
+							tooManyRequestsDescriptor,
+						},
+					},
+				},
+			},
+		},
+	},
+	{
+		Name:        RouteNameRobot,
+		Path:        "/v2/_ext/robots/{robot}",
+		Entity:      "Robot Account",
+		Description: "Fetch or revoke a robot account. This is a registry extension, available when robot accounts are enabled.",
+		Methods: []MethodDescriptor{
+			{
+				Method:      "GET",
+				Description: "Fetch the robot account identified by `robot`, including when it was last used. The secret is never returned.",
+				Requests: []RequestDescriptor{
+					{
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+						},
+						PathParameters: []ParameterDescriptor{
+							robotParameterDescriptor,
+						},
+						Successes: []ResponseDescriptor{
+							{
+								StatusCode:  http.StatusOK,
+								Description: "The robot account.",
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format: `{
+	"name": <name>,
+	"repositories": [<pattern>, ...],
+	"actions": [<action>, ...],
+	"created": <time>,
+	"expires": <time>,
+	"lastUsed": <time>
+}`,
+								},
+							},
+						},
+						Failures: []ResponseDescriptor{
+							robotNotFoundResponseDescriptor,
+							unauthorizedResponseDescriptor,
+							deniedResponseDescriptor,
+							tooManyRequestsDescriptor,
+						},
+					},
+				},
+			},
+			{
+				Method:      "DELETE",
+				Description: "Revoke the robot account identified by `robot`. Requests authenticated by the robot account fail from then on.",
+				Requests: []RequestDescriptor{
+					{
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+						},
+						PathParameters: []ParameterDescriptor{
+							robotParameterDescriptor,
+						},
+						Successes: []ResponseDescriptor{
+							{
+								StatusCode: http.StatusAccepted,
+								Headers: []ParameterDescriptor{
+									contentLengthZeroHeader,
+								},
+							},
+						},
+						Failures: []ResponseDescriptor{
+							robotNotFoundResponseDescriptor,
+							unauthorizedResponseDescriptor,
+							deniedResponseDescriptor,
+							tooManyRequestsDescriptor,
+						},
+					},
 				},
 			},
 		},
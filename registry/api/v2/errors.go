@@ -154,4 +154,25 @@ var (
 		to return) is not an integer, or "n" is negative.`,
 		HTTPStatusCode: http.StatusBadRequest,
 	})
+
+	// ErrorCodeRobotUnknown is returned when a robot account is unknown to
+	// the registry.
+	ErrorCodeRobotUnknown = errcode.Register(errGroup, errcode.ErrorDescriptor{
+		Value:   "ROBOT_UNKNOWN",
+		Message: "robot account unknown to registry",
+		Description: `This error is returned when the robot account named in
+		a request to the robot accounts API does not exist.`,
+		HTTPStatusCode: http.StatusNotFound,
+	})
+
+	// ErrorCodeRobotInvalid is returned when a robot account cannot be
+	// created as requested.
+	ErrorCodeRobotInvalid = errcode.Register(errGroup, errcode.ErrorDescriptor{
+		Value:   "ROBOT_INVALID",
+		Message: "invalid robot account",
+		Description: `This error is returned when creating a robot account
+		with an invalid or existing name, invalid repository patterns or
+		unknown actions.`,
+		HTTPStatusCode: http.StatusBadRequest,
+	})
 )
@@ -16,6 +16,14 @@ const (
 	RouteNameBlobUpload      = "blob-upload"
 	RouteNameBlobUploadChunk = "blob-upload-chunk"
 	RouteNameCatalog         = "catalog"
+	RouteNameQuota           = "quota"
+	RouteNameReferrers       = "referrers"
+	RouteNameTagMetadata     = "tag-metadata"
+	RouteNameCopy            = "copy"
+	RouteNameRepository      = "repository"
+	RouteNameRename          = "rename"
+	RouteNameRobots          = "robots"
+	RouteNameRobot           = "robot"
 )
 
 var (
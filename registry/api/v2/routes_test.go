@@ -95,6 +95,61 @@ func TestRouter(t *testing.T) {
 				"digest": "sha256:abcdef0919234",
 			},
 		},
+		{
+			RouteName:  RouteNameQuota,
+			RequestURI: "/v2/foo/bar/_ext/quota",
+			Vars: map[string]string{
+				"name": "foo/bar",
+			},
+		},
+		{
+			RouteName:  RouteNameTagMetadata,
+			RequestURI: "/v2/foo/bar/_ext/tags",
+			Vars: map[string]string{
+				"name": "foo/bar",
+			},
+		},
+		{
+			RouteName:  RouteNameCopy,
+			RequestURI: "/v2/foo/bar/_ext/copy",
+			Vars: map[string]string{
+				"name": "foo/bar",
+			},
+		},
+		{
+			RouteName:  RouteNameRepository,
+			RequestURI: "/v2/foo/bar/_ext/repository",
+			Vars: map[string]string{
+				"name": "foo/bar",
+			},
+		},
+		{
+			RouteName:  RouteNameRename,
+			RequestURI: "/v2/foo/bar/_ext/rename",
+			Vars: map[string]string{
+				"name": "foo/bar",
+			},
+		},
+		{
+			RouteName:  RouteNameRobots,
+			RequestURI: "/v2/_ext/robots",
+			Vars:       map[string]string{},
+		},
+		{
+			RouteName:  RouteNameRobot,
+			RequestURI: "/v2/_ext/robots/ci-builder",
+			Vars: map[string]string{
+				"robot": "ci-builder",
+			},
+		},
+		{
+			RouteName:  RouteNameReferrers,
+			RequestURI: "/v2/foo/bar/referrers/sha256:abcdef0919234",
+			Vars: map[string]string{
+				"name":   "foo/bar",
+				"digest": "sha256:abcdef0919234",
+			},
+		},
 		{
 			RouteName:  RouteNameBlobUpload,
 			RequestURI: "/v2/foo/bar/blobs/uploads/",
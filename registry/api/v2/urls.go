@@ -139,6 +139,106 @@ func (ub *URLBuilder) BuildTagsURL(name reference.Named, values ...url.Values) (
 	return appendValuesURL(tagsURL, values...).String(), nil
 }
 
+// BuildQuotaURL constructs a url to report the storage quotas applying to
+// the named repository.
+func (ub *URLBuilder) BuildQuotaURL(name reference.Named) (string, error) {
+	route := ub.cloneRoute(RouteNameQuota)
+
+	quotaURL, err := route.URL("name", name.Name())
+	if err != nil {
+		return "", err
+	}
+
+	return quotaURL.String(), nil
+}
+
+// BuildTagMetadataURL constructs a url to list the tags of the named
+// repository along with their metadata.
+func (ub *URLBuilder) BuildTagMetadataURL(name reference.Named, values ...url.Values) (string, error) {
+	route := ub.cloneRoute(RouteNameTagMetadata)
+
+	tagsURL, err := route.URL("name", name.Name())
+	if err != nil {
+		return "", err
+	}
+
+	return appendValuesURL(tagsURL, values...).String(), nil
+}
+
+// BuildCopyURL constructs a url to copy a manifest into the named
+// repository.
+func (ub *URLBuilder) BuildCopyURL(name reference.Named, values ...url.Values) (string, error) {
+	route := ub.cloneRoute(RouteNameCopy)
+
+	copyURL, err := route.URL("name", name.Name())
+	if err != nil {
+		return "", err
+	}
+
+	return appendValuesURL(copyURL, values...).String(), nil
+}
+
+// BuildRepositoryURL constructs a url to delete the named repository.
+func (ub *URLBuilder) BuildRepositoryURL(name reference.Named) (string, error) {
+	route := ub.cloneRoute(RouteNameRepository)
+
+	repositoryURL, err := route.URL("name", name.Name())
+	if err != nil {
+		return "", err
+	}
+
+	return repositoryURL.String(), nil
+}
+
+// BuildRenameURL constructs a url to rename the named repository.
+func (ub *URLBuilder) BuildRenameURL(name reference.Named, values ...url.Values) (string, error) {
+	route := ub.cloneRoute(RouteNameRename)
+
+	renameURL, err := route.URL("name", name.Name())
+	if err != nil {
+		return "", err
+	}
+
+	return appendValuesURL(renameURL, values...).String(), nil
+}
+
+// BuildRobotsURL constructs a url to list and create robot accounts.
+func (ub *URLBuilder) BuildRobotsURL() (string, error) {
+	route := ub.cloneRoute(RouteNameRobots)
+
+	robotsURL, err := route.URL()
+	if err != nil {
+		return "", err
+	}
+
+	return robotsURL.String(), nil
+}
+
+// BuildRobotURL constructs a url to fetch or revoke the named robot account.
+func (ub *URLBuilder) BuildRobotURL(name string) (string, error) {
+	route := ub.cloneRoute(RouteNameRobot)
+
+	robotURL, err := route.URL("robot", name)
+	if err != nil {
+		return "", err
+	}
+
+	return robotURL.String(), nil
+}
+
+// BuildReferrersURL constructs a url to list the referrers of the manifest
+// identified by the canonical reference.
+func (ub *URLBuilder) BuildReferrersURL(ref reference.Canonical, values ...url.Values) (string, error) {
+	route := ub.cloneRoute(RouteNameReferrers)
+
+	referrersURL, err := route.URL("name", ref.Name(), "digest", ref.Digest().String())
+	if err != nil {
+		return "", err
+	}
+
+	return appendValuesURL(referrersURL, values...).String(), nil
+}
+
 // BuildManifestURL constructs a url for the manifest identified by name and
 // reference. The argument reference may be either a tag or digest.
 func (ub *URLBuilder) BuildManifestURL(ref reference.Named) (string, error) {
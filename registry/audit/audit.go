@@ -0,0 +1,131 @@
+// Package audit records who accessed what in the registry, and whether the
+// access was allowed, to structured audit logs.
+package audit
+
+import (
+	"strings"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+)
+
+// Decision is the outcome of an access to the registry.
+type Decision string
+
+const (
+	// Allowed is the decision recorded when the access was authorized.
+	Allowed Decision = "allowed"
+
+	// Denied is the decision recorded when the access was refused, either
+	// by the access controller or by a registry policy.
+	Denied Decision = "denied"
+)
+
+// Record is an entry of the audit log, describing an access to a resource of
+// the registry.
+type Record struct {
+	Time      time.Time `json:"time"`
+	RequestID string    `json:"requestid,omitempty"`
+	// User is the authenticated user, or the username of the credentials
+	// which failed to authenticate.
+	User       string `json:"user,omitempty"`
+	RemoteAddr string `json:"remoteaddr"`
+	Method     string `json:"method"`
+
+	// Type, Name and Action describe the access, such as the pull of the
+	// repository "library/alpine".
+	Type   string `json:"type"`
+	Name   string `json:"name"`
+	Action string `json:"action"`
+
+	// Digest and Tag identify the content accessed, when the request names
+	// them.
+	Digest digest.Digest `json:"digest,omitempty"`
+	Tag    string        `json:"tag,omitempty"`
+
+	Decision Decision `json:"decision"`
+	// Reason explains why the access was denied.
+	Reason string `json:"reason,omitempty"`
+	// Status is the status code of the response, when one was served.
+	Status int `json:"status,omitempty"`
+}
+
+// Sink writes records to an audit log. Sinks are safe for concurrent use.
+type Sink interface {
+	Write(record Record) error
+	Close() error
+}
+
+// Filter excludes noisy records, such as those of HEAD requests, from the
+// audit log. Matching is case insensitive.
+type Filter struct {
+	// Methods lists the HTTP methods of the requests not to record.
+	Methods []string
+	// Actions lists the actions not to record, such as pull.
+	Actions []string
+	// Decisions lists the decisions not to record.
+	Decisions []Decision
+}
+
+// Excludes reports whether the record is filtered out.
+func (f Filter) Excludes(record Record) bool {
+	for _, method := range f.Methods {
+		if strings.EqualFold(method, record.Method) {
+			return true
+		}
+	}
+	for _, action := range f.Actions {
+		if strings.EqualFold(action, record.Action) {
+			return true
+		}
+	}
+	for _, decision := range f.Decisions {
+		if strings.EqualFold(string(decision), string(record.Decision)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Logger writes the records which pass its filter to all of its sinks.
+type Logger struct {
+	filter Filter
+	sinks  []Sink
+}
+
+// NewLogger returns a logger writing to sinks the records not excluded by
+// filter.
+func NewLogger(filter Filter, sinks ...Sink) *Logger {
+	return &Logger{filter: filter, sinks: sinks}
+}
+
+// Log writes the record to every sink, unless it is filtered out. A failing
+// sink does not prevent the record from reaching the others; the first error
+// is returned.
+func (l *Logger) Log(record Record) error {
+	if l.filter.Excludes(record) {
+		return nil
+	}
+	if record.Time.IsZero() {
+		record.Time = time.Now().UTC()
+	}
+
+	var firstErr error
+	for _, sink := range l.sinks {
+		if err := sink.Write(record); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// Close closes every sink of the logger.
+func (l *Logger) Close() error {
+	var firstErr error
+	for _, sink := range l.sinks {
+		if err := sink.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
@@ -0,0 +1,148 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type memorySink struct {
+	records []Record
+	err     error
+}
+
+func (s *memorySink) Write(record Record) error {
+	s.records = append(s.records, record)
+	return s.err
+}
+
+func (s *memorySink) Close() error {
+	return nil
+}
+
+func TestLoggerFilter(t *testing.T) {
+	failing := &memorySink{err: errors.New("sink failure")}
+	sink := &memorySink{}
+	logger := NewLogger(Filter{
+		Methods:   []string{"head"},
+		Actions:   []string{"delete"},
+		Decisions: []Decision{Allowed},
+	}, failing, sink)
+
+	for _, record := range []Record{
+		{Method: "GET", Action: "pull", Decision: Denied},
+		{Method: "HEAD", Action: "pull", Decision: Denied},
+		{Method: "DELETE", Action: "delete", Decision: Denied},
+		{Method: "PUT", Action: "push", Decision: Allowed},
+	} {
+		err := logger.Log(record)
+		if len(sink.records) != len(failing.records) {
+			t.Fatal("expected every sink to receive the record")
+		}
+		if err != nil && err != failing.err {
+			t.Fatalf("unexpected error logging record: %v", err)
+		}
+	}
+
+	if len(sink.records) != 1 || sink.records[0].Method != "GET" {
+		t.Fatalf("expected only the GET record to be logged, got %+v", sink.records)
+	}
+	if sink.records[0].Time.IsZero() {
+		t.Fatal("expected the time of the record to be set")
+	}
+}
+
+func readRecords(t *testing.T, path string) []Record {
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	var records []Record
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var record Record
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("error decoding record %q: %v", scanner.Text(), err)
+		}
+		records = append(records, record)
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return records
+}
+
+func TestFileSinkRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	record := Record{User: "alice", Method: "GET", Type: "repository", Name: "foo/bar", Action: "pull", Decision: Allowed, Status: 1}
+	line, err := json.Marshal(record)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// two records fit in a file
+	sink, err := NewFileSink(path, int64(2*(len(line)+1)), 2)
+	if err != nil {
+		t.Fatalf("unexpected error creating file sink: %v", err)
+	}
+	for i := 1; i <= 7; i++ {
+		record.Status = i
+		if err := sink.Write(record); err != nil {
+			t.Fatalf("unexpected error writing record: %v", err)
+		}
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatalf("unexpected error closing file sink: %v", err)
+	}
+	if err := sink.Write(record); err == nil {
+		t.Fatal("expected an error writing to a closed file sink")
+	}
+
+	for file, statuses := range map[string][]int{
+		path:        {7},
+		path + ".1": {5, 6},
+		path + ".2": {3, 4},
+	} {
+		records := readRecords(t, file)
+		if len(records) != len(statuses) {
+			t.Fatalf("expected %d records in %s, got %d", len(statuses), file, len(records))
+		}
+		for i, record := range records {
+			if record.Status != statuses[i] {
+				t.Fatalf("expected record %d of %s to have status %d, got %d", i, file, statuses[i], record.Status)
+			}
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Fatalf("expected only two backups to be kept, got %v", err)
+	}
+
+	// the file is appended to when reopened
+	sink, err = NewFileSink(path, 0, 0)
+	if err != nil {
+		t.Fatalf("unexpected error creating file sink: %v", err)
+	}
+	defer sink.Close()
+	if err := sink.Write(record); err != nil {
+		t.Fatalf("unexpected error writing record: %v", err)
+	}
+	if records := readRecords(t, path); len(records) != 2 {
+		t.Fatalf("expected the record to be appended, got %d records", len(records))
+	}
+}
+
+func TestNewFileSinkErrors(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := NewFileSink(filepath.Join(dir, "missing", "audit.log"), 0, 0); err == nil {
+		t.Fatal("expected an error opening a file in a missing directory")
+	}
+	if _, err := NewFileSink(filepath.Join(dir, "audit.log"), -1, 0); err == nil || !strings.Contains(err.Error(), "rotation") {
+		t.Fatalf("expected a rotation error, got %v", err)
+	}
+}
@@ -0,0 +1,120 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// fileSink writes records as lines of JSON to a file, rotated once it grows
+// past a maximum size.
+type fileSink struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// NewFileSink returns a sink appending records as lines of JSON to the file
+// at path. Once writing a record would grow the file past maxSize bytes, the
+// file is renamed to path.1, previous backups are shifted to path.2 and so
+// on, and a new file is started. Only maxBackups backups are kept. The file
+// is never rotated if maxSize is zero.
+func NewFileSink(path string, maxSize int64, maxBackups int) (Sink, error) {
+	if maxSize < 0 || maxBackups < 0 {
+		return nil, fmt.Errorf("invalid audit file rotation: maximum size %d, maximum backups %d", maxSize, maxBackups)
+	}
+
+	s := &fileSink{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *fileSink) open() error {
+	file, err := os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return fmt.Errorf("unable to open audit file: %v", err)
+	}
+	fi, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("unable to open audit file: %v", err)
+	}
+	s.file = file
+	s.size = fi.Size()
+	return nil
+}
+
+// Write appends the record to the file, rotating it first if needed.
+func (s *fileSink) Write(record Record) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return fmt.Errorf("audit file %q is closed", s.path)
+	}
+	if s.maxSize > 0 && s.size > 0 && s.size+int64(len(line)) > s.maxSize {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := s.file.Write(line)
+	s.size += int64(n)
+	return err
+}
+
+// rotate shifts the backups, moves the file to the first backup and opens a
+// new file. It must be called with the lock held.
+func (s *fileSink) rotate() error {
+	if err := s.file.Close(); err != nil {
+		return fmt.Errorf("unable to rotate audit file: %v", err)
+	}
+	s.file = nil
+
+	if s.maxBackups == 0 {
+		if err := os.Remove(s.path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("unable to rotate audit file: %v", err)
+		}
+	} else {
+		for i := s.maxBackups - 1; i > 0; i-- {
+			if err := os.Rename(s.backup(i), s.backup(i+1)); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("unable to rotate audit file: %v", err)
+			}
+		}
+		if err := os.Rename(s.path, s.backup(1)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("unable to rotate audit file: %v", err)
+		}
+	}
+
+	return s.open()
+}
+
+func (s *fileSink) backup(i int) string {
+	return fmt.Sprintf("%s.%d", s.path, i)
+}
+
+// Close closes the file.
+func (s *fileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
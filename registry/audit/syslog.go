@@ -0,0 +1,45 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/syslog"
+)
+
+// syslogSink sends records as JSON messages to syslog, with the auth
+// facility. Denials are sent with the warning severity, other records with
+// the info severity.
+type syslogSink struct {
+	writer *syslog.Writer
+}
+
+// NewSyslogSink returns a sink sending records to the syslog daemon at
+// address over network, such as "udp" or "tcp", or to the local syslog
+// daemon if network is empty. Messages are tagged with tag.
+func NewSyslogSink(network, address, tag string) (Sink, error) {
+	writer, err := syslog.Dial(network, address, syslog.LOG_AUTH|syslog.LOG_INFO, tag)
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to syslog: %v", err)
+	}
+	return &syslogSink{writer: writer}, nil
+}
+
+// Write sends the record to syslog.
+func (s *syslogSink) Write(record Record) error {
+	message, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	if record.Decision == Denied {
+		return s.writer.Warning(string(message))
+	}
+	return s.writer.Info(string(message))
+}
+
+// Close closes the connection to syslog.
+func (s *syslogSink) Close() error {
+	return s.writer.Close()
+}
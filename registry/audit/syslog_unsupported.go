@@ -0,0 +1,14 @@
+//go:build windows || plan9
+// +build windows plan9
+
+package audit
+
+import (
+	"errors"
+)
+
+// NewSyslogSink returns an error, as syslog is not supported on this
+// platform.
+func NewSyslogSink(network, address, tag string) (Sink, error) {
+	return nil, errors.New("syslog is not supported on this platform")
+}
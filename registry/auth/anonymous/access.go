@@ -0,0 +1,120 @@
+// Package anonymous wraps an access controller to let clients without
+// credentials pull from the registry, while every other request, and every
+// request carrying credentials, is still authorized by the wrapped access
+// controller.
+//
+// Anonymous access is configured with the "anonymous" option of the access
+// controller:
+//
+//	auth:
+//	  htpasswd:
+//	    realm: basic-realm
+//	    path: /path/to/htpasswd
+//	    anonymous:
+//	      repositories: ["library/**"]
+//	      catalog: true
+package anonymous
+
+import (
+	"context"
+	"fmt"
+
+	dcontext "github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/registry/auth"
+	"github.com/distribution/distribution/v3/registry/auth/policy"
+	"gopkg.in/yaml.v2"
+)
+
+// Username is the user of the requests granted anonymous access, recorded in
+// the logs and as the actor of notifications.
+const Username = "anonymous"
+
+// Config is the YAML representation of the "anonymous" option.
+type Config struct {
+	// Repositories lists glob patterns of the repositories anonymous clients
+	// may pull from, with the syntax of policy rules. All repositories may
+	// be pulled from when empty.
+	Repositories []string `yaml:"repositories"`
+	// Catalog lets anonymous clients list the repositories of the registry.
+	Catalog bool `yaml:"catalog"`
+}
+
+type accessController struct {
+	auth.AccessController
+	policy *policy.Policy
+}
+
+var _ auth.AccessController = &accessController{}
+
+// ParseConfig decodes the "anonymous" option of an access controller.
+func ParseConfig(option interface{}) (Config, error) {
+	data, err := yaml.Marshal(option)
+	if err != nil {
+		return Config{}, err
+	}
+
+	var config Config
+	if err := yaml.UnmarshalStrict(data, &config); err != nil {
+		return Config{}, fmt.Errorf("invalid anonymous option: %v", err)
+	}
+	return config, nil
+}
+
+// NewAccessController returns an access controller granting anonymous
+// clients the access described by config, and delegating everything else to
+// wrapped.
+func NewAccessController(wrapped auth.AccessController, config Config) (auth.AccessController, error) {
+	repositories := config.Repositories
+	if len(repositories) == 0 {
+		repositories = []string{"**"}
+	}
+
+	rules := []policy.RuleConfig{{
+		Users:        []string{Username},
+		Repositories: repositories,
+		Actions:      []string{"pull"},
+	}}
+	if config.Catalog {
+		rules = append(rules, policy.RuleConfig{
+			Users:   []string{Username},
+			Actions: []string{"catalog"},
+		})
+	}
+
+	p, err := policy.New(policy.Config{Rules: rules})
+	if err != nil {
+		return nil, fmt.Errorf("invalid anonymous option: %v", err)
+	}
+	return &accessController{AccessController: wrapped, policy: p}, nil
+}
+
+// Authorized grants the access to requests without credentials when all of
+// it is allowed anonymously. Requests to the base route, which clients use
+// to discover how to authenticate, are still challenged.
+func (ac *accessController) Authorized(ctx context.Context, accessRecords ...auth.Access) (context.Context, error) {
+	req, err := dcontext.GetRequest(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Header.Get("Authorization") != "" || !ac.allows(accessRecords) {
+		return ac.AccessController.Authorized(ctx, accessRecords...)
+	}
+
+	ctx = auth.WithUser(ctx, auth.UserInfo{Name: Username})
+	ctx = dcontext.WithLogger(ctx, dcontext.GetLogger(ctx, auth.UserNameKey, auth.UserKey))
+
+	return ctx, nil
+}
+
+func (ac *accessController) allows(accessRecords []auth.Access) bool {
+	if len(accessRecords) == 0 {
+		return false
+	}
+	for _, access := range accessRecords {
+		if !ac.policy.Allows(Username, access) {
+			return false
+		}
+	}
+	return true
+}
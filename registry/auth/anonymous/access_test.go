@@ -0,0 +1,121 @@
+package anonymous
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	dcontext "github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/registry/auth"
+)
+
+var errChallenge = errors.New("challenge")
+
+// wrappedController authorizes requests with credentials as "alice" and
+// challenges the others.
+type wrappedController struct{}
+
+func (wrappedController) Authorized(ctx context.Context, access ...auth.Access) (context.Context, error) {
+	req, err := dcontext.GetRequest(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if req.Header.Get("Authorization") == "" {
+		return nil, errChallenge
+	}
+	return auth.WithUser(ctx, auth.UserInfo{Name: "alice"}), nil
+}
+
+func repositoryAccess(name, action string) auth.Access {
+	return auth.Access{Resource: auth.Resource{Type: "repository", Name: name}, Action: action}
+}
+
+var catalogAccess = auth.Access{Resource: auth.Resource{Type: "registry", Name: "catalog"}, Action: "*"}
+
+func TestAccessController(t *testing.T) {
+	config, err := ParseConfig(map[interface{}]interface{}{
+		"repositories": []interface{}{"public/**", "library/*"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error parsing config: %v", err)
+	}
+	accessController, err := NewAccessController(wrappedController{}, config)
+	if err != nil {
+		t.Fatalf("unexpected error creating access controller: %v", err)
+	}
+
+	for _, tc := range []struct {
+		authenticated bool
+		access        []auth.Access
+		expectedUser  string
+	}{
+		{false, []auth.Access{repositoryAccess("public/app", "pull")}, Username},
+		{false, []auth.Access{repositoryAccess("public/team/app", "pull"), repositoryAccess("library/alpine", "pull")}, Username},
+		{true, []auth.Access{repositoryAccess("public/app", "pull")}, "alice"},
+		{true, []auth.Access{repositoryAccess("public/app", "push")}, "alice"},
+		{false, []auth.Access{repositoryAccess("public/app", "push")}, ""},
+		{false, []auth.Access{repositoryAccess("public/app", "pull"), repositoryAccess("public/app", "push")}, ""},
+		{false, []auth.Access{repositoryAccess("library/team/app", "pull")}, ""},
+		{false, []auth.Access{repositoryAccess("private/app", "pull")}, ""},
+		{false, []auth.Access{catalogAccess}, ""},
+		{false, nil, ""},
+	} {
+		req, err := http.NewRequest("GET", "http://example.com/v2/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tc.authenticated {
+			req.SetBasicAuth("alice", "secret")
+		}
+
+		ctx, err := accessController.Authorized(dcontext.WithRequest(context.Background(), req), tc.access...)
+		if tc.expectedUser == "" {
+			if err != errChallenge {
+				t.Errorf("expected %v to be challenged, got %v", tc.access, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("unexpected error authorizing %v: %v", tc.access, err)
+			continue
+		}
+		if user := dcontext.GetStringValue(ctx, auth.UserNameKey); user != tc.expectedUser {
+			t.Errorf("expected %v to be authorized as %q, got %q", tc.access, tc.expectedUser, user)
+		}
+	}
+}
+
+func TestAccessControllerCatalog(t *testing.T) {
+	config, err := ParseConfig(map[interface{}]interface{}{"catalog": true})
+	if err != nil {
+		t.Fatalf("unexpected error parsing config: %v", err)
+	}
+	accessController, err := NewAccessController(wrappedController{}, config)
+	if err != nil {
+		t.Fatalf("unexpected error creating access controller: %v", err)
+	}
+
+	req, err := http.NewRequest("GET", "http://example.com/v2/_catalog", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := dcontext.WithRequest(context.Background(), req)
+	for _, access := range []auth.Access{catalogAccess, repositoryAccess("any/repository", "pull")} {
+		if _, err := accessController.Authorized(ctx, access); err != nil {
+			t.Errorf("unexpected error authorizing %v: %v", access, err)
+		}
+	}
+}
+
+func TestParseConfigErrors(t *testing.T) {
+	for _, option := range []interface{}{
+		"yes",
+		map[interface{}]interface{}{"repository": []interface{}{"public/**"}},
+		map[interface{}]interface{}{"catalog": "always"},
+	} {
+		if _, err := ParseConfig(option); err == nil {
+			t.Errorf("expected an error parsing %v", option)
+		}
+	}
+}
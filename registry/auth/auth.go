@@ -37,6 +37,7 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"time"
 )
 
 const (
@@ -111,6 +112,16 @@ type CredentialAuthenticator interface {
 	AuthenticateUser(username, password string) error
 }
 
+// AccessAuthorizer is an object which is able to decide whether an
+// authenticated user is granted access to a resource
+type AccessAuthorizer interface {
+	AuthorizeUser(username string, access Access) bool
+
+	// HasPolicy reports whether access is decided by a policy, rather than
+	// granted to every authenticated user.
+	HasPolicy() bool
+}
+
 // WithUser returns a context with the authorized user info.
 func WithUser(ctx context.Context, user UserInfo) context.Context {
 	return userInfoContext{
@@ -199,3 +210,23 @@ func GetAccessController(name string, options map[string]interface{}) (AccessCon
 
 	return nil, fmt.Errorf("no access controller registered with name: %s", name)
 }
+
+// DurationOption parses the optional duration option of an access controller
+// with the given key, given either as a duration string or a number of
+// seconds. The default value is returned if the option is not set.
+func DurationOption(options map[string]interface{}, key string, defaultValue time.Duration) (time.Duration, error) {
+	switch v := options[key].(type) {
+	case nil:
+		return defaultValue, nil
+	case string:
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return 0, fmt.Errorf("%q must be a duration: %v", key, err)
+		}
+		return d, nil
+	case int:
+		return time.Duration(v) * time.Second, nil
+	default:
+		return 0, fmt.Errorf("%q must be a duration", key)
+	}
+}
@@ -3,6 +3,10 @@
 // location.
 //
 // This authentication method MUST be used under TLS, as simple token-replay attack is possible.
+//
+// Authenticated users are authorized to access everything, unless a policy
+// file is configured, in which case access is restricted to what the policy
+// grants them.
 package htpasswd
 
 import (
@@ -20,17 +24,29 @@ import (
 
 	dcontext "github.com/distribution/distribution/v3/context"
 	"github.com/distribution/distribution/v3/registry/auth"
+	"github.com/distribution/distribution/v3/registry/auth/policy"
 )
 
+// ErrInsufficientAccess is returned when an authenticated user is not
+// granted the requested access by the policy.
+var ErrInsufficientAccess = policy.ErrInsufficientAccess
+
 type accessController struct {
-	realm    string
-	path     string
-	modtime  time.Time
-	mu       sync.Mutex
-	htpasswd *htpasswd
+	realm         string
+	path          string
+	modtime       time.Time
+	policyPath    string
+	policyModtime time.Time
+	mu            sync.Mutex
+	htpasswd      *htpasswd
+	policy        *policy.Policy
 }
 
-var _ auth.AccessController = &accessController{}
+var (
+	_ auth.AccessController        = &accessController{}
+	_ auth.CredentialAuthenticator = &accessController{}
+	_ auth.AccessAuthorizer        = &accessController{}
+)
 
 func newAccessController(options map[string]interface{}) (auth.AccessController, error) {
 	realm, present := options["realm"]
@@ -46,7 +62,17 @@ func newAccessController(options map[string]interface{}) (auth.AccessController,
 	if err := createHtpasswdFile(path); err != nil {
 		return nil, err
 	}
-	return &accessController{realm: realm.(string), path: path}, nil
+
+	var policyPath string
+	if policyOpt, present := options["policy"]; present {
+		if policyPath, ok = policyOpt.(string); !ok || policyPath == "" {
+			return nil, fmt.Errorf(`"policy" must be a path for htpasswd access controller`)
+		}
+		if _, err := policy.Load(policyPath); err != nil {
+			return nil, err
+		}
+	}
+	return &accessController{realm: realm.(string), path: path, policyPath: policyPath}, nil
 }
 
 func (ac *accessController) Authorized(ctx context.Context, accessRecords ...auth.Access) (context.Context, error) {
@@ -63,10 +89,43 @@ func (ac *accessController) Authorized(ctx context.Context, accessRecords ...aut
 		}
 	}
 
+	if err := ac.AuthenticateUser(username, password); err != nil {
+		dcontext.GetLogger(ctx).Errorf("error authenticating user %q: %v", username, err)
+		if err != auth.ErrAuthenticationFailure {
+			return nil, err
+		}
+		return nil, &challenge{
+			realm: ac.realm,
+			err:   auth.ErrAuthenticationFailure,
+		}
+	}
+
+	if ac.policyPath != "" {
+		localPolicy, err := ac.currentPolicy()
+		if err != nil {
+			return nil, err
+		}
+		for _, access := range accessRecords {
+			if !localPolicy.Allows(username, access) {
+				dcontext.GetLogger(ctx).Warnf("user %q is not allowed to %s %s %q", username, access.Action, access.Type, access.Name)
+				return nil, &challenge{
+					realm: ac.realm,
+					err:   ErrInsufficientAccess,
+				}
+			}
+		}
+	}
+
+	return auth.WithUser(ctx, auth.UserInfo{Name: username}), nil
+}
+
+// AuthenticateUser checks the credential against the htpasswd file, parsing
+// it again if it changed.
+func (ac *accessController) AuthenticateUser(username, password string) error {
 	// Dynamically parsing the latest account list
 	fstat, err := os.Stat(ac.path)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	lastModified := fstat.ModTime()
@@ -77,29 +136,62 @@ func (ac *accessController) Authorized(ctx context.Context, accessRecords ...aut
 		f, err := os.Open(ac.path)
 		if err != nil {
 			ac.mu.Unlock()
-			return nil, err
+			return err
 		}
 		defer f.Close()
 
 		h, err := newHTPasswd(f)
 		if err != nil {
 			ac.mu.Unlock()
-			return nil, err
+			return err
 		}
 		ac.htpasswd = h
 	}
 	localHTPasswd := ac.htpasswd
 	ac.mu.Unlock()
 
-	if err := localHTPasswd.authenticateUser(username, password); err != nil {
-		dcontext.GetLogger(ctx).Errorf("error authenticating user %q: %v", username, err)
-		return nil, &challenge{
-			realm: ac.realm,
-			err:   auth.ErrAuthenticationFailure,
-		}
+	return localHTPasswd.authenticateUser(username, password)
+}
+
+// AuthorizeUser reports whether the policy grants the user the access. All
+// access is granted when no policy is configured.
+func (ac *accessController) AuthorizeUser(username string, access auth.Access) bool {
+	if ac.policyPath == "" {
+		return true
+	}
+	localPolicy, err := ac.currentPolicy()
+	if err != nil {
+		dcontext.GetLogger(context.Background()).Errorf("error loading htpasswd policy: %v", err)
+		return false
+	}
+	return localPolicy.Allows(username, access)
+}
+
+// HasPolicy reports whether a policy file is configured.
+func (ac *accessController) HasPolicy() bool {
+	return ac.policyPath != ""
+}
+
+// currentPolicy returns the policy, parsing the policy file again if it
+// changed.
+func (ac *accessController) currentPolicy() (*policy.Policy, error) {
+	fstat, err := os.Stat(ac.policyPath)
+	if err != nil {
+		return nil, err
 	}
 
-	return auth.WithUser(ctx, auth.UserInfo{Name: username}), nil
+	lastModified := fstat.ModTime()
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+	if ac.policy == nil || !ac.policyModtime.Equal(lastModified) {
+		p, err := policy.Load(ac.policyPath)
+		if err != nil {
+			return nil, err
+		}
+		ac.policy = p
+		ac.policyModtime = lastModified
+	}
+	return ac.policy, nil
 }
 
 // challenge implements the auth.Challenge interface.
@@ -0,0 +1,100 @@
+package htpasswd
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/registry/auth"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const testPolicy = `
+groups:
+  developers: [alice, bob]
+  admins: [carol]
+rules:
+  - groups: [developers]
+    repositories: ["team/**"]
+    actions: [pull, push]
+  - users: ["*"]
+    repositories: ["library/*"]
+    actions: [pull]
+  - groups: [admins]
+    repositories: ["**"]
+    actions: ["*", catalog, robots]
+`
+
+func repositoryAccess(name, action string) auth.Access {
+	return auth.Access{Resource: auth.Resource{Type: "repository", Name: name}, Action: action}
+}
+
+func TestPolicyAccessController(t *testing.T) {
+	dir := t.TempDir()
+	htpasswdPath := filepath.Join(dir, "htpasswd")
+	policyPath := filepath.Join(dir, "policy.yml")
+
+	var htpasswdContent string
+	for _, user := range []string{"alice", "dave"} {
+		hash, err := bcrypt.GenerateFromPassword([]byte(user+"-password"), bcrypt.MinCost)
+		if err != nil {
+			t.Fatal(err)
+		}
+		htpasswdContent += fmt.Sprintf("%s:%s\n", user, hash)
+	}
+	if err := os.WriteFile(htpasswdPath, []byte(htpasswdContent), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(policyPath, []byte(testPolicy), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	accessController, err := newAccessController(map[string]interface{}{
+		"realm":  "test-realm",
+		"path":   htpasswdPath,
+		"policy": policyPath,
+	})
+	if err != nil {
+		t.Fatalf("error creating access controller: %v", err)
+	}
+
+	authorized := func(user string, access ...auth.Access) error {
+		req, err := http.NewRequest("GET", "http://example.com/v2/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.SetBasicAuth(user, user+"-password")
+		_, err = accessController.Authorized(context.WithRequest(context.Background(), req), access...)
+		return err
+	}
+
+	if err := authorized("alice"); err != nil {
+		t.Fatalf("unexpected error authorizing without access records: %v", err)
+	}
+	if err := authorized("alice", repositoryAccess("team/app", "pull"), repositoryAccess("team/app", "push")); err != nil {
+		t.Fatalf("unexpected error authorizing push: %v", err)
+	}
+	err = authorized("dave", repositoryAccess("team/app", "pull"))
+	if ch, ok := err.(*challenge); !ok || ch.err != ErrInsufficientAccess {
+		t.Fatalf("expected insufficient access challenge, got %v", err)
+	}
+
+	// the policy is reloaded when it changes
+	if err := os.WriteFile(policyPath, []byte("rules:\n  - users: [dave]\n    repositories: [\"team/*\"]\n    actions: [pull]\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	future := time.Now().Add(time.Minute)
+	if err := os.Chtimes(policyPath, future, future); err != nil {
+		t.Fatal(err)
+	}
+	if err := authorized("dave", repositoryAccess("team/app", "pull")); err != nil {
+		t.Fatalf("unexpected error after reloading policy: %v", err)
+	}
+	if err := authorized("alice", repositoryAccess("team/app", "pull")); err == nil {
+		t.Fatal("expected access removed from the policy to be denied")
+	}
+}
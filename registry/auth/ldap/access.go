@@ -0,0 +1,388 @@
+// Package ldap provides a simple authentication scheme that checks basic
+// authentication credentials against an LDAP directory, searching for the
+// entry of the user and binding as that entry with the password.
+//
+// This authentication method MUST be used under TLS, as passwords are sent
+// in the basic authentication header, and should reach the directory over
+// LDAPS or StartTLS.
+//
+// Authenticated users are authorized to access everything, unless rules are
+// configured, in which case access is restricted to what the rules grant the
+// user and the directory groups it is a member of.
+package ldap
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	dcontext "github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/registry/auth"
+	"github.com/distribution/distribution/v3/registry/auth/policy"
+	goldap "github.com/go-ldap/ldap/v3"
+)
+
+const (
+	defaultUserFilter     = "(uid=%s)"
+	defaultGroupFilter    = "(member=%s)"
+	defaultGroupAttribute = "cn"
+	defaultCacheTTL       = time.Minute
+	defaultTimeout        = 10 * time.Second
+)
+
+type accessController struct {
+	realm string
+	url   string
+	// startTLS upgrades ldap:// connections to TLS before binding.
+	startTLS  bool
+	tlsConfig *tls.Config
+	timeout   time.Duration
+
+	// bindDN and bindPassword are the credentials of the account searching
+	// the directory. The search is anonymous if bindDN is empty.
+	bindDN       string
+	bindPassword string
+
+	baseDN         string
+	userFilter     string
+	groupBaseDN    string
+	groupFilter    string
+	groupAttribute string
+
+	policy *policy.Policy
+
+	cacheTTL time.Duration
+	salt     []byte
+	mu       sync.Mutex
+	cache    map[string]cachedBind
+}
+
+// cachedBind records a successful bind, so that the directory is not queried
+// for each request of a client.
+type cachedBind struct {
+	passwordHash [sha256.Size]byte
+	groups       []string
+	expires      time.Time
+}
+
+var (
+	_ auth.AccessController        = &accessController{}
+	_ auth.CredentialAuthenticator = &accessController{}
+	_ auth.AccessAuthorizer        = &accessController{}
+)
+
+func newAccessController(options map[string]interface{}) (auth.AccessController, error) {
+	ac := &accessController{
+		userFilter:     defaultUserFilter,
+		groupFilter:    defaultGroupFilter,
+		groupAttribute: defaultGroupAttribute,
+		cache:          make(map[string]cachedBind),
+	}
+
+	for _, opt := range []struct {
+		name     string
+		value    *string
+		required bool
+	}{
+		{"realm", &ac.realm, true},
+		{"url", &ac.url, true},
+		{"basedn", &ac.baseDN, true},
+		{"binddn", &ac.bindDN, false},
+		{"bindpassword", &ac.bindPassword, false},
+		{"userfilter", &ac.userFilter, false},
+		{"groupbasedn", &ac.groupBaseDN, false},
+		{"groupfilter", &ac.groupFilter, false},
+		{"groupattribute", &ac.groupAttribute, false},
+	} {
+		v, present := options[opt.name]
+		if !present {
+			if opt.required {
+				return nil, fmt.Errorf("%q must be set for ldap access controller", opt.name)
+			}
+			continue
+		}
+		s, ok := v.(string)
+		if !ok || s == "" {
+			return nil, fmt.Errorf("%q must be a non-empty string for ldap access controller", opt.name)
+		}
+		*opt.value = s
+	}
+	if ac.groupBaseDN == "" {
+		ac.groupBaseDN = ac.baseDN
+	}
+	u, err := url.Parse(ac.url)
+	if err != nil || (u.Scheme != "ldap" && u.Scheme != "ldaps") {
+		return nil, fmt.Errorf(`"url" must be an ldap:// or ldaps:// url for ldap access controller`)
+	}
+
+	if v, present := options["starttls"]; present {
+		startTLS, ok := v.(bool)
+		if !ok {
+			return nil, fmt.Errorf(`"starttls" must be a bool for ldap access controller`)
+		}
+		ac.startTLS = startTLS
+	}
+
+	// StartTLS needs the server name, which is otherwise taken from the
+	// address dialed for ldaps://
+	ac.tlsConfig = &tls.Config{MinVersion: tls.VersionTLS12, ServerName: u.Hostname()}
+	if v, present := options["tlsca"]; present {
+		path, ok := v.(string)
+		if !ok || path == "" {
+			return nil, fmt.Errorf(`"tlsca" must be a path for ldap access controller`)
+		}
+		pem, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read ldap tlsca: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in ldap tlsca %q", path)
+		}
+		ac.tlsConfig.RootCAs = pool
+	}
+
+	if ac.cacheTTL, err = auth.DurationOption(options, "cachettl", defaultCacheTTL); err != nil {
+		return nil, fmt.Errorf("invalid option for ldap access controller: %v", err)
+	}
+	if ac.timeout, err = auth.DurationOption(options, "timeout", defaultTimeout); err != nil {
+		return nil, fmt.Errorf("invalid option for ldap access controller: %v", err)
+	}
+
+	if _, present := options["rules"]; present {
+		config, err := policy.ConfigFromOptions(options)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rules for ldap access controller: %v", err)
+		}
+		config.ExternalGroups = true
+		if ac.policy, err = policy.New(config); err != nil {
+			return nil, fmt.Errorf("invalid rules for ldap access controller: %v", err)
+		}
+	}
+
+	ac.salt = make([]byte, 16)
+	if _, err := rand.Read(ac.salt); err != nil {
+		return nil, err
+	}
+	return ac, nil
+}
+
+func (ac *accessController) Authorized(ctx context.Context, accessRecords ...auth.Access) (context.Context, error) {
+	req, err := dcontext.GetRequest(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	username, password, ok := req.BasicAuth()
+	if !ok {
+		return nil, &challenge{
+			realm: ac.realm,
+			err:   auth.ErrInvalidCredential,
+		}
+	}
+
+	groups, err := ac.authenticate(username, password)
+	if err != nil {
+		dcontext.GetLogger(ctx).Errorf("error authenticating user %q: %v", username, err)
+		if err != auth.ErrAuthenticationFailure {
+			return nil, err
+		}
+		return nil, &challenge{
+			realm: ac.realm,
+			err:   auth.ErrAuthenticationFailure,
+		}
+	}
+
+	if ac.policy != nil {
+		for _, access := range accessRecords {
+			if !ac.policy.AllowsGroups(username, groups, access) {
+				dcontext.GetLogger(ctx).Warnf("user %q is not allowed to %s %s %q", username, access.Action, access.Type, access.Name)
+				return nil, &challenge{
+					realm: ac.realm,
+					err:   policy.ErrInsufficientAccess,
+				}
+			}
+		}
+	}
+
+	return auth.WithUser(ctx, auth.UserInfo{Name: username}), nil
+}
+
+// AuthenticateUser checks the credentials against the directory.
+func (ac *accessController) AuthenticateUser(username, password string) error {
+	_, err := ac.authenticate(username, password)
+	return err
+}
+
+// AuthorizeUser reports whether the rules grant the access to the user,
+// given the groups found when it last authenticated. All access is granted
+// when no rules are configured.
+func (ac *accessController) AuthorizeUser(username string, access auth.Access) bool {
+	if ac.policy == nil {
+		return true
+	}
+	ac.mu.Lock()
+	groups := ac.cache[username].groups
+	ac.mu.Unlock()
+	return ac.policy.AllowsGroups(username, groups, access)
+}
+
+// HasPolicy reports whether rules are configured.
+func (ac *accessController) HasPolicy() bool {
+	return ac.policy != nil
+}
+
+// authenticate checks the credentials, from the cache of successful binds if
+// possible, and returns the groups of the user.
+func (ac *accessController) authenticate(username, password string) ([]string, error) {
+	if username == "" || password == "" {
+		// an empty password would be an unauthenticated bind
+		return nil, auth.ErrAuthenticationFailure
+	}
+
+	hash := ac.hashPassword(password)
+	now := time.Now()
+	ac.mu.Lock()
+	cached, ok := ac.cache[username]
+	ac.mu.Unlock()
+	if ok && now.Before(cached.expires) && subtle.ConstantTimeCompare(cached.passwordHash[:], hash[:]) == 1 {
+		return cached.groups, nil
+	}
+
+	groups, err := ac.bind(username, password)
+	if err != nil {
+		return nil, err
+	}
+
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+	for name, entry := range ac.cache {
+		if !now.Before(entry.expires) {
+			delete(ac.cache, name)
+		}
+	}
+	ac.cache[username] = cachedBind{
+		passwordHash: hash,
+		groups:       groups,
+		expires:      now.Add(ac.cacheTTL),
+	}
+	return groups, nil
+}
+
+// bind searches the entry of the user, binds as that entry with the password
+// and, when rules are configured, looks up the groups of the user.
+func (ac *accessController) bind(username, password string) ([]string, error) {
+	conn, err := ac.dial()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if err := ac.bindSearcher(conn); err != nil {
+		return nil, err
+	}
+	result, err := conn.Search(goldap.NewSearchRequest(
+		ac.baseDN, goldap.ScopeWholeSubtree, goldap.NeverDerefAliases, 2, int(ac.timeout.Seconds()), false,
+		fmt.Sprintf(ac.userFilter, goldap.EscapeFilter(username)),
+		[]string{"dn"}, nil))
+	if err != nil {
+		return nil, fmt.Errorf("unable to search ldap user: %v", err)
+	}
+	if len(result.Entries) != 1 {
+		return nil, auth.ErrAuthenticationFailure
+	}
+	userDN := result.Entries[0].DN
+
+	if err := conn.Bind(userDN, password); err != nil {
+		if goldap.IsErrorWithCode(err, goldap.LDAPResultInvalidCredentials) {
+			return nil, auth.ErrAuthenticationFailure
+		}
+		return nil, fmt.Errorf("unable to bind as ldap user: %v", err)
+	}
+
+	if ac.policy == nil {
+		return nil, nil
+	}
+
+	// the user may not be allowed to search the groups
+	if err := ac.bindSearcher(conn); err != nil {
+		return nil, err
+	}
+	result, err = conn.Search(goldap.NewSearchRequest(
+		ac.groupBaseDN, goldap.ScopeWholeSubtree, goldap.NeverDerefAliases, 0, int(ac.timeout.Seconds()), false,
+		fmt.Sprintf(ac.groupFilter, goldap.EscapeFilter(userDN)),
+		[]string{ac.groupAttribute}, nil))
+	if err != nil {
+		return nil, fmt.Errorf("unable to search ldap groups: %v", err)
+	}
+	var groups []string
+	for _, entry := range result.Entries {
+		groups = append(groups, entry.GetAttributeValues(ac.groupAttribute)...)
+	}
+	return groups, nil
+}
+
+// dial connects to the directory, over TLS if configured.
+func (ac *accessController) dial() (*goldap.Conn, error) {
+	conn, err := goldap.DialURL(ac.url,
+		goldap.DialWithDialer(&net.Dialer{Timeout: ac.timeout}),
+		goldap.DialWithTLSConfig(ac.tlsConfig))
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to ldap server: %v", err)
+	}
+	conn.SetTimeout(ac.timeout)
+
+	if ac.startTLS {
+		if err := conn.StartTLS(ac.tlsConfig); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("unable to start tls with ldap server: %v", err)
+		}
+	}
+	return conn, nil
+}
+
+// bindSearcher binds as the account searching the directory, if any.
+func (ac *accessController) bindSearcher(conn *goldap.Conn) error {
+	if ac.bindDN == "" {
+		return nil
+	}
+	if err := conn.Bind(ac.bindDN, ac.bindPassword); err != nil {
+		return fmt.Errorf("unable to bind as ldap binddn: %v", err)
+	}
+	return nil
+}
+
+func (ac *accessController) hashPassword(password string) [sha256.Size]byte {
+	return sha256.Sum256(append(append([]byte{}, ac.salt...), password...))
+}
+
+// challenge implements the auth.Challenge interface.
+type challenge struct {
+	realm string
+	err   error
+}
+
+var _ auth.Challenge = challenge{}
+
+// SetHeaders sets the basic challenge header on the response.
+func (ch challenge) SetHeaders(r *http.Request, w http.ResponseWriter) {
+	w.Header().Set("WWW-Authenticate", fmt.Sprintf("Basic realm=%q", ch.realm))
+}
+
+func (ch challenge) Error() string {
+	return fmt.Sprintf("basic authentication challenge for realm %q: %s", ch.realm, ch.err)
+}
+
+func init() {
+	auth.Register("ldap", auth.InitFunc(newAccessController))
+}
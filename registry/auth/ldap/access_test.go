@@ -0,0 +1,364 @@
+package ldap
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/registry/auth"
+	"github.com/distribution/distribution/v3/registry/auth/policy"
+	ber "github.com/go-asn1-ber/asn1-ber"
+	goldap "github.com/go-ldap/ldap/v3"
+)
+
+// stubServer is an in-process LDAP server answering simple binds, equality
+// searches and StartTLS requests from a fixed directory.
+type stubServer struct {
+	listener  net.Listener
+	tlsConfig *tls.Config
+
+	// passwords maps the DN of the entries which may bind to their password.
+	passwords map[string]string
+	// entries maps DNs to their attributes.
+	entries map[string]map[string][]string
+	// searcherDN is the DN which must be bound to search, if any.
+	searcherDN string
+
+	mu    sync.Mutex
+	binds map[string]int
+}
+
+func newStubServer(t *testing.T, ldaps bool, tlsConfig *tls.Config) *stubServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ldaps {
+		listener = tls.NewListener(listener, tlsConfig)
+	}
+
+	s := &stubServer{
+		listener:   listener,
+		tlsConfig:  tlsConfig,
+		searcherDN: "cn=registry,dc=example,dc=com",
+		passwords: map[string]string{
+			"cn=registry,dc=example,dc=com":         "registry-password",
+			"uid=alice,ou=people,dc=example,dc=com": "alice-password",
+			"uid=bob,ou=people,dc=example,dc=com":   "bob-password",
+		},
+		entries: map[string]map[string][]string{
+			"uid=alice,ou=people,dc=example,dc=com": {"uid": {"alice"}},
+			"uid=bob,ou=people,dc=example,dc=com":   {"uid": {"bob"}},
+			"cn=developers,ou=groups,dc=example,dc=com": {
+				"cn":     {"developers"},
+				"member": {"uid=alice,ou=people,dc=example,dc=com"},
+			},
+		},
+		binds: make(map[string]int),
+	}
+	go s.serve()
+	t.Cleanup(func() { listener.Close() })
+	return s
+}
+
+func (s *stubServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *stubServer) handle(conn net.Conn) {
+	defer func() { conn.Close() }()
+
+	var boundDN string
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil {
+			return
+		}
+		messageID := packet.Children[0].Value.(int64)
+		op := packet.Children[1]
+
+		switch op.Tag {
+		case goldap.ApplicationBindRequest:
+			dn := op.Children[1].Value.(string)
+			password := op.Children[2].Data.String()
+			s.mu.Lock()
+			s.binds[dn]++
+			s.mu.Unlock()
+			if expected, ok := s.passwords[dn]; ok && password == expected {
+				boundDN = dn
+				writeResult(conn, messageID, goldap.ApplicationBindResponse, goldap.LDAPResultSuccess)
+			} else {
+				boundDN = ""
+				writeResult(conn, messageID, goldap.ApplicationBindResponse, goldap.LDAPResultInvalidCredentials)
+			}
+		case goldap.ApplicationSearchRequest:
+			if boundDN != s.searcherDN {
+				writeResult(conn, messageID, goldap.ApplicationSearchResultDone, goldap.LDAPResultInsufficientAccessRights)
+				continue
+			}
+			baseDN := op.Children[0].Value.(string)
+			filter := op.Children[6]
+			if filter.Tag != goldap.FilterEqualityMatch {
+				writeResult(conn, messageID, goldap.ApplicationSearchResultDone, goldap.LDAPResultUnwillingToPerform)
+				continue
+			}
+			attribute, value := filter.Children[0].Value.(string), filter.Children[1].Value.(string)
+			for dn, attributes := range s.entries {
+				if !strings.HasSuffix(dn, baseDN) || !contains(attributes[attribute], value) {
+					continue
+				}
+				writeEntry(conn, messageID, dn, attributes)
+			}
+			writeResult(conn, messageID, goldap.ApplicationSearchResultDone, goldap.LDAPResultSuccess)
+		case goldap.ApplicationExtendedRequest:
+			writeResult(conn, messageID, goldap.ApplicationExtendedResponse, goldap.LDAPResultSuccess)
+			conn = tls.Server(conn, s.tlsConfig)
+		case goldap.ApplicationUnbindRequest:
+			return
+		}
+	}
+}
+
+func (s *stubServer) bindCount(dn string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.binds[dn]
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func writeResult(w io.Writer, messageID int64, op ber.Tag, resultCode uint16) {
+	result := ber.Encode(ber.ClassApplication, ber.TypeConstructed, op, nil, "")
+	result.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, int64(resultCode), ""))
+	result.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", ""))
+	result.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", ""))
+	writeMessage(w, messageID, result)
+}
+
+func writeEntry(w io.Writer, messageID int64, dn string, attributes map[string][]string) {
+	entry := ber.Encode(ber.ClassApplication, ber.TypeConstructed, goldap.ApplicationSearchResultEntry, nil, "")
+	entry.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, dn, ""))
+	attributeList := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "")
+	for name, values := range attributes {
+		attribute := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "")
+		attribute.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, ""))
+		set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "")
+		for _, value := range values {
+			set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, value, ""))
+		}
+		attribute.AppendChild(set)
+		attributeList.AppendChild(attribute)
+	}
+	entry.AppendChild(attributeList)
+	writeMessage(w, messageID, entry)
+}
+
+func writeMessage(w io.Writer, messageID int64, op *ber.Packet) {
+	message := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "")
+	message.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, messageID, ""))
+	message.AppendChild(op)
+	w.Write(message.Bytes())
+}
+
+// newTLSConfig returns a server TLS configuration for 127.0.0.1 and the path
+// to the PEM encoded certificate trusting it.
+func newTLSConfig(t *testing.T) (*tls.Config, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "ldap-test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}, path
+}
+
+func repositoryAccess(name, action string) auth.Access {
+	return auth.Access{Resource: auth.Resource{Type: "repository", Name: name}, Action: action}
+}
+
+func TestAccessController(t *testing.T) {
+	tlsConfig, caPath := newTLSConfig(t)
+
+	for _, mode := range []string{"ldap", "starttls", "ldaps"} {
+		t.Run(mode, func(t *testing.T) {
+			server := newStubServer(t, mode == "ldaps", tlsConfig)
+			scheme := "ldap"
+			if mode == "ldaps" {
+				scheme = "ldaps"
+			}
+
+			controller, err := newAccessController(map[string]interface{}{
+				"realm":        "test-realm",
+				"url":          scheme + "://" + server.listener.Addr().String(),
+				"starttls":     mode == "starttls",
+				"tlsca":        caPath,
+				"binddn":       "cn=registry,dc=example,dc=com",
+				"bindpassword": "registry-password",
+				"basedn":       "ou=people,dc=example,dc=com",
+				"groupbasedn":  "ou=groups,dc=example,dc=com",
+				"cachettl":     "1m",
+				"rules": []interface{}{
+					map[interface{}]interface{}{
+						"groups":       []interface{}{"developers"},
+						"repositories": []interface{}{"team/**"},
+						"actions":      []interface{}{"pull", "push"},
+					},
+					map[interface{}]interface{}{
+						"users":        []interface{}{"*"},
+						"repositories": []interface{}{"library/*"},
+						"actions":      []interface{}{"pull"},
+					},
+				},
+			})
+			if err != nil {
+				t.Fatalf("error creating access controller: %v", err)
+			}
+
+			authorized := func(username, password string, access ...auth.Access) (string, error) {
+				req, err := http.NewRequest("GET", "http://example.com/v2/", nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if username != "" {
+					req.SetBasicAuth(username, password)
+				}
+				ctx, err := controller.Authorized(context.WithRequest(context.Background(), req), access...)
+				if err != nil {
+					return "", err
+				}
+				return context.GetStringValue(ctx, auth.UserNameKey), nil
+			}
+
+			if _, err := authorized("", ""); err == nil {
+				t.Fatal("expected an error authorizing without credentials")
+			} else if ch, ok := err.(*challenge); !ok || ch.err != auth.ErrInvalidCredential {
+				t.Fatalf("expected invalid credential challenge, got %v", err)
+			}
+
+			user, err := authorized("alice", "alice-password", repositoryAccess("team/app", "pull"), repositoryAccess("team/app", "push"))
+			if err != nil {
+				t.Fatalf("unexpected error authorizing alice: %v", err)
+			}
+			if user != "alice" {
+				t.Fatalf("expected user alice, got %q", user)
+			}
+
+			// successful binds are cached
+			aliceDN := "uid=alice,ou=people,dc=example,dc=com"
+			if _, err := authorized("alice", "alice-password", repositoryAccess("team/app", "pull")); err != nil {
+				t.Fatalf("unexpected error authorizing alice again: %v", err)
+			}
+			if binds := server.bindCount(aliceDN); binds != 1 {
+				t.Fatalf("expected alice to bind once, got %d binds", binds)
+			}
+
+			for _, credentials := range [][2]string{
+				{"alice", "wrong"},
+				{"alice", ""},
+				{"carol", "carol-password"},
+				{"*", "alice-password"},
+			} {
+				_, err := authorized(credentials[0], credentials[1])
+				if ch, ok := err.(*challenge); !ok || ch.err != auth.ErrAuthenticationFailure {
+					t.Fatalf("expected authentication failure for %q, got %v", credentials[0], err)
+				}
+			}
+			if binds := server.bindCount(aliceDN); binds != 2 {
+				t.Fatalf("expected the wrong password to bind again, got %d binds", binds)
+			}
+
+			if _, err := authorized("bob", "bob-password", repositoryAccess("library/alpine", "pull")); err != nil {
+				t.Fatalf("unexpected error authorizing bob: %v", err)
+			}
+			_, err = authorized("bob", "bob-password", repositoryAccess("team/app", "pull"))
+			if ch, ok := err.(*challenge); !ok || ch.err != policy.ErrInsufficientAccess {
+				t.Fatalf("expected insufficient access challenge, got %v", err)
+			}
+
+			ac := controller.(*accessController)
+			if !ac.AuthorizeUser("alice", repositoryAccess("team/app", "push")) || ac.AuthorizeUser("bob", repositoryAccess("team/app", "push")) {
+				t.Fatal("expected AuthorizeUser to follow the groups of the users")
+			}
+		})
+	}
+}
+
+func TestNewAccessControllerErrors(t *testing.T) {
+	valid := map[string]interface{}{
+		"realm":  "test-realm",
+		"url":    "ldap://127.0.0.1",
+		"basedn": "dc=example,dc=com",
+	}
+	if _, err := newAccessController(valid); err != nil {
+		t.Fatalf("unexpected error creating access controller: %v", err)
+	}
+
+	for key, value := range map[string]interface{}{
+		"realm":    nil,
+		"url":      "http://127.0.0.1",
+		"basedn":   nil,
+		"starttls": "yes",
+		"tlsca":    "/nonexistent",
+		"cachettl": "soon",
+		"rules":    []interface{}{map[interface{}]interface{}{"users": []interface{}{"alice"}, "actions": []interface{}{"write"}}},
+	} {
+		options := make(map[string]interface{})
+		for k, v := range valid {
+			options[k] = v
+		}
+		if value == nil {
+			delete(options, key)
+		} else {
+			options[key] = value
+		}
+		if _, err := newAccessController(options); err == nil {
+			t.Errorf("expected an error creating access controller with %s %v", key, value)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+// Package mtls provides an authentication scheme which identifies users by
+// the TLS client certificate the registry verified against http.tls.clientcas.
+//
+// The user is taken from the subject common name of the certificate, or from
+// its subject alternative names. Authenticated users are authorized to access
+// everything, unless rules are configured, in which case access is
+// restricted to what the rules grant them.
+package mtls
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+
+	dcontext "github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/registry/auth"
+	"github.com/distribution/distribution/v3/registry/auth/policy"
+)
+
+const (
+	// identityCommonName identifies users by the subject common name of
+	// their certificate.
+	identityCommonName = "cn"
+
+	// identitySAN identifies users by the first DNS name, email address or
+	// URI of the subject alternative names of their certificate.
+	identitySAN = "san"
+)
+
+// ErrNoIdentity is returned when a verified client certificate carries no
+// identity of the configured kind.
+var ErrNoIdentity = errors.New("client certificate has no identity")
+
+type accessController struct {
+	identity string
+	policy   *policy.Policy
+}
+
+var (
+	_ auth.AccessController = &accessController{}
+	_ auth.AccessAuthorizer = &accessController{}
+)
+
+func newAccessController(options map[string]interface{}) (auth.AccessController, error) {
+	identity := identityCommonName
+	if identityOpt, present := options["identity"]; present {
+		var ok bool
+		if identity, ok = identityOpt.(string); !ok || (identity != identityCommonName && identity != identitySAN) {
+			return nil, fmt.Errorf(`"identity" must be %q or %q for mtls access controller`, identityCommonName, identitySAN)
+		}
+	}
+
+	ac := &accessController{identity: identity}
+	if _, present := options["rules"]; present {
+		config, err := policy.ConfigFromOptions(options)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rules for mtls access controller: %v", err)
+		}
+		p, err := policy.New(config)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rules for mtls access controller: %v", err)
+		}
+		ac.policy = p
+	}
+	return ac, nil
+}
+
+// Authorized identifies the user by the verified client certificate of the
+// request and checks that the rules grant the requested access.
+func (ac *accessController) Authorized(ctx context.Context, accessRecords ...auth.Access) (context.Context, error) {
+	req, err := dcontext.GetRequest(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.TLS == nil || len(req.TLS.VerifiedChains) == 0 || len(req.TLS.VerifiedChains[0]) == 0 {
+		return nil, &challenge{err: auth.ErrInvalidCredential}
+	}
+
+	cert := req.TLS.VerifiedChains[0][0]
+	username := ac.username(cert)
+	if username == "" {
+		dcontext.GetLogger(ctx).Errorf("client certificate %q has no %s identity", cert.Subject, ac.identity)
+		return nil, &challenge{err: ErrNoIdentity}
+	}
+
+	for _, access := range accessRecords {
+		if !ac.AuthorizeUser(username, access) {
+			dcontext.GetLogger(ctx).Warnf("user %q is not allowed to %s %s %q", username, access.Action, access.Type, access.Name)
+			return nil, &challenge{err: policy.ErrInsufficientAccess}
+		}
+	}
+
+	ctx = auth.WithUser(ctx, auth.UserInfo{Name: username})
+	ctx = dcontext.WithLogger(ctx, dcontext.GetLogger(ctx, auth.UserNameKey, auth.UserKey))
+
+	return ctx, nil
+}
+
+// AuthorizeUser reports whether the rules grant the user the access. All
+// access is granted when no rules are configured.
+func (ac *accessController) AuthorizeUser(username string, access auth.Access) bool {
+	return ac.policy == nil || ac.policy.Allows(username, access)
+}
+
+// HasPolicy reports whether rules are configured.
+func (ac *accessController) HasPolicy() bool {
+	return ac.policy != nil
+}
+
+// username returns the identity of the configured kind in the certificate,
+// or an empty string if it has none.
+func (ac *accessController) username(cert *x509.Certificate) string {
+	if ac.identity == identityCommonName {
+		return cert.Subject.CommonName
+	}
+
+	switch {
+	case len(cert.DNSNames) > 0:
+		return cert.DNSNames[0]
+	case len(cert.EmailAddresses) > 0:
+		return cert.EmailAddresses[0]
+	case len(cert.URIs) > 0:
+		return cert.URIs[0].String()
+	}
+	return ""
+}
+
+// challenge implements the auth.Challenge interface. Clients authenticate
+// during the TLS handshake, so there is no HTTP challenge to set.
+type challenge struct {
+	err error
+}
+
+var _ auth.Challenge = challenge{}
+
+// SetHeaders sets no header, as client certificates are not negotiated over
+// HTTP.
+func (ch challenge) SetHeaders(r *http.Request, w http.ResponseWriter) {}
+
+func (ch challenge) Error() string {
+	return ch.err.Error()
+}
+
+func init() {
+	auth.Register("mtls", auth.InitFunc(newAccessController))
+}
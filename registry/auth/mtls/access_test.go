@@ -0,0 +1,118 @@
+package mtls
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"testing"
+
+	"github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/registry/auth"
+	"github.com/distribution/distribution/v3/registry/auth/policy"
+	"gopkg.in/yaml.v2"
+)
+
+const testConfig = `
+identity: cn
+groups:
+  builders: [ci.example.com]
+rules:
+  - groups: [builders]
+    repositories: ["team/**"]
+    actions: [pull, push]
+  - users: ["*"]
+    repositories: ["library/*"]
+    actions: [pull]
+`
+
+func repositoryAccess(name, action string) auth.Access {
+	return auth.Access{Resource: auth.Resource{Type: "repository", Name: name}, Action: action}
+}
+
+func TestAccessController(t *testing.T) {
+	// options are parsed from the configuration file like these
+	var options map[string]interface{}
+	if err := yaml.Unmarshal([]byte(testConfig), &options); err != nil {
+		t.Fatal(err)
+	}
+	accessController, err := newAccessController(options)
+	if err != nil {
+		t.Fatalf("error creating access controller: %v", err)
+	}
+
+	authorized := func(cert *x509.Certificate, access ...auth.Access) (string, error) {
+		req, err := http.NewRequest("GET", "https://example.com/v2/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cert != nil {
+			req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+		}
+		ctx, err := accessController.Authorized(context.WithRequest(context.Background(), req), access...)
+		if err != nil {
+			return "", err
+		}
+		return context.GetStringValue(ctx, auth.UserNameKey), nil
+	}
+
+	ci := &x509.Certificate{Subject: pkix.Name{CommonName: "ci.example.com"}}
+	dev := &x509.Certificate{Subject: pkix.Name{CommonName: "dev.example.com"}}
+
+	if _, err := authorized(nil); err == nil {
+		t.Fatal("expected an error authorizing without a client certificate")
+	} else if _, ok := err.(auth.Challenge); !ok {
+		t.Fatalf("expected a challenge, got %v", err)
+	}
+	if _, err := authorized(&x509.Certificate{}); err == nil {
+		t.Fatal("expected an error authorizing a certificate without common name")
+	}
+
+	user, err := authorized(ci, repositoryAccess("team/app", "pull"), repositoryAccess("team/app", "push"))
+	if err != nil {
+		t.Fatalf("unexpected error authorizing push: %v", err)
+	}
+	if user != "ci.example.com" {
+		t.Fatalf("expected user ci.example.com, got %q", user)
+	}
+	if _, err := authorized(dev, repositoryAccess("library/alpine", "pull")); err != nil {
+		t.Fatalf("unexpected error authorizing pull: %v", err)
+	}
+	_, err = authorized(dev, repositoryAccess("team/app", "pull"))
+	if ch, ok := err.(*challenge); !ok || ch.err != policy.ErrInsufficientAccess {
+		t.Fatalf("expected insufficient access challenge, got %v", err)
+	}
+}
+
+func TestAccessControllerSAN(t *testing.T) {
+	ac, err := newAccessController(map[string]interface{}{"identity": "san"})
+	if err != nil {
+		t.Fatalf("error creating access controller: %v", err)
+	}
+
+	for _, tc := range []struct {
+		cert *x509.Certificate
+		user string
+	}{
+		{&x509.Certificate{Subject: pkix.Name{CommonName: "ignored"}, DNSNames: []string{"ci.example.com"}}, "ci.example.com"},
+		{&x509.Certificate{EmailAddresses: []string{"alice@example.com"}}, "alice@example.com"},
+		{&x509.Certificate{Subject: pkix.Name{CommonName: "ignored"}}, ""},
+	} {
+		if user := ac.(*accessController).username(tc.cert); user != tc.user {
+			t.Errorf("expected user %q, got %q", tc.user, user)
+		}
+	}
+}
+
+func TestNewAccessControllerErrors(t *testing.T) {
+	for _, options := range []map[string]interface{}{
+		{"identity": "serial"},
+		{"rules": []interface{}{map[interface{}]interface{}{"users": []interface{}{"alice"}, "actions": []interface{}{"write"}}}},
+		{"rules": []interface{}{map[interface{}]interface{}{"groups": []interface{}{"missing"}}}},
+		{"rules": []interface{}{map[interface{}]interface{}{"user": []interface{}{"alice"}}}},
+	} {
+		if _, err := newAccessController(options); err == nil {
+			t.Errorf("expected an error creating access controller with options %v", options)
+		}
+	}
+}
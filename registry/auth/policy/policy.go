@@ -0,0 +1,211 @@
+// Package policy grants users access to registry resources following a set
+// of rules, shared by the access controllers which authenticate users but
+// leave authorization to the registry configuration.
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/distribution/distribution/v3/registry/auth"
+	"gopkg.in/yaml.v2"
+)
+
+// ErrInsufficientAccess is returned when an authenticated user is not
+// granted the requested access by the policy.
+var ErrInsufficientAccess = errors.New("insufficient access")
+
+// Config is the YAML representation of a policy.
+//
+//	groups:
+//	  developers: [alice, bob]
+//	rules:
+//	  - groups: [developers]
+//	    repositories: ["team/**"]
+//	    actions: [pull, push]
+//	  - users: ["*"]
+//	    repositories: ["library/*"]
+//	    actions: [pull]
+type Config struct {
+	// Groups maps group names to their members.
+	Groups map[string][]string `yaml:"groups"`
+	Rules  []RuleConfig        `yaml:"rules"`
+
+	// ExternalGroups allows rules to name groups which are not defined in
+	// Groups, because the membership of users is looked up elsewhere, such
+	// as in a directory, and passed to AllowsGroups.
+	ExternalGroups bool `yaml:"-"`
+}
+
+// RuleConfig is the YAML representation of a rule of a policy.
+type RuleConfig struct {
+	// Users and Groups list the users and groups the rule applies to. The
+	// user "*" stands for any authenticated user.
+	Users  []string `yaml:"users"`
+	Groups []string `yaml:"groups"`
+	// Repositories lists glob patterns of the repositories the rule grants
+	// access to. "*" matches within a path component, "**" across them.
+	Repositories []string `yaml:"repositories"`
+	// Actions lists the granted actions: pull, push, delete, "*" for all
+	// of them, catalog to list the repositories of the registry and robots
+	// to manage its robot accounts.
+	Actions []string `yaml:"actions"`
+}
+
+// Policy grants users access to repositories.
+type Policy struct {
+	rules []rule
+}
+
+type rule struct {
+	users        map[string]bool
+	groups       map[string]bool
+	repositories []*regexp.Regexp
+	actions      map[string]bool
+}
+
+// Load reads and compiles the policy file at path.
+func Load(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var config Config
+	if err := yaml.UnmarshalStrict(data, &config); err != nil {
+		return nil, fmt.Errorf("unable to parse policy file %q: %v", path, err)
+	}
+
+	p, err := New(config)
+	if err != nil {
+		return nil, fmt.Errorf("policy file %q: %v", path, err)
+	}
+	return p, nil
+}
+
+// ConfigFromOptions decodes the groups and rules of the options of an access
+// controller, which have the format of a policy file.
+func ConfigFromOptions(options map[string]interface{}) (Config, error) {
+	data, err := yaml.Marshal(map[string]interface{}{
+		"groups": options["groups"],
+		"rules":  options["rules"],
+	})
+	if err != nil {
+		return Config{}, err
+	}
+
+	var config Config
+	if err := yaml.UnmarshalStrict(data, &config); err != nil {
+		return Config{}, err
+	}
+	return config, nil
+}
+
+// New compiles the policy described by config.
+func New(config Config) (*Policy, error) {
+	p := &Policy{rules: make([]rule, 0, len(config.Rules))}
+	for i, rc := range config.Rules {
+		r := rule{
+			users:   make(map[string]bool),
+			groups:  make(map[string]bool),
+			actions: make(map[string]bool),
+		}
+		for _, user := range rc.Users {
+			r.users[user] = true
+		}
+		for _, group := range rc.Groups {
+			r.groups[group] = true
+			members, ok := config.Groups[group]
+			if !ok && !config.ExternalGroups {
+				return nil, fmt.Errorf("rule %d: unknown group %q", i, group)
+			}
+			for _, user := range members {
+				r.users[user] = true
+			}
+		}
+		for _, action := range rc.Actions {
+			switch action {
+			case "pull", "push", "delete", "*", "catalog", "robots":
+				r.actions[action] = true
+			default:
+				return nil, fmt.Errorf("rule %d: unknown action %q", i, action)
+			}
+		}
+		for _, pattern := range rc.Repositories {
+			r.repositories = append(r.repositories, globRegexp(pattern))
+		}
+		p.rules = append(p.rules, r)
+	}
+	return p, nil
+}
+
+// globRegexp compiles a repository glob pattern, in which "**" matches any
+// sequence of characters, "*" any sequence of characters other than "/" and
+// "?" any single character other than "/".
+func globRegexp(pattern string) *regexp.Regexp {
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		switch {
+		case strings.HasPrefix(pattern[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case pattern[i] == '*':
+			b.WriteString("[^/]*")
+		case pattern[i] == '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		}
+	}
+	b.WriteString("$")
+	return regexp.MustCompile(b.String())
+}
+
+// Allows reports whether a rule of the policy grants the user the access.
+func (p *Policy) Allows(username string, access auth.Access) bool {
+	return p.AllowsGroups(username, nil, access)
+}
+
+// AllowsGroups reports whether a rule of the policy grants the access to the
+// user, who is also a member of the given groups.
+func (p *Policy) AllowsGroups(username string, groups []string, access auth.Access) bool {
+	for _, r := range p.rules {
+		if r.appliesTo(username, groups) && r.allows(access) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *rule) appliesTo(username string, groups []string) bool {
+	if r.users[username] || r.users["*"] {
+		return true
+	}
+	for _, group := range groups {
+		if r.groups[group] {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *rule) allows(access auth.Access) bool {
+	switch access.Type {
+	case "registry":
+		return (access.Name == "catalog" || access.Name == "robots") && r.actions[access.Name]
+	case "repository":
+		if !r.actions["*"] && !r.actions[access.Action] {
+			return false
+		}
+		for _, re := range r.repositories {
+			if re.MatchString(access.Name) {
+				return true
+			}
+		}
+	}
+	return false
+}
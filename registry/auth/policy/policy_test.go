@@ -0,0 +1,108 @@
+package policy
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/distribution/distribution/v3/registry/auth"
+)
+
+const testPolicy = `
+groups:
+  developers: [alice, bob]
+  admins: [carol]
+rules:
+  - groups: [developers]
+    repositories: ["team/**"]
+    actions: [pull, push]
+  - users: ["*"]
+    repositories: ["library/*"]
+    actions: [pull]
+  - groups: [admins]
+    repositories: ["**"]
+    actions: ["*", catalog, robots]
+`
+
+func repositoryAccess(name, action string) auth.Access {
+	return auth.Access{Resource: auth.Resource{Type: "repository", Name: name}, Action: action}
+}
+
+var (
+	catalogAccess = auth.Access{Resource: auth.Resource{Type: "registry", Name: "catalog"}, Action: "*"}
+	robotsAccess  = auth.Access{Resource: auth.Resource{Type: "registry", Name: "robots"}, Action: "*"}
+)
+
+func TestPolicy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.yml")
+	if err := os.WriteFile(path, []byte(testPolicy), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	p, err := Load(path)
+	if err != nil {
+		t.Fatalf("error loading policy: %v", err)
+	}
+
+	for _, tc := range []struct {
+		user    string
+		access  auth.Access
+		allowed bool
+	}{
+		{"alice", repositoryAccess("team/app", "push"), true},
+		{"alice", repositoryAccess("team/app/base", "pull"), true},
+		{"alice", repositoryAccess("team/app", "delete"), false},
+		{"alice", repositoryAccess("teams/app", "pull"), false},
+		{"alice", repositoryAccess("library/alpine", "pull"), true},
+		{"dave", repositoryAccess("library/alpine", "pull"), true},
+		{"dave", repositoryAccess("library/alpine", "push"), false},
+		{"dave", repositoryAccess("library/alpine/old", "pull"), false},
+		{"alice", catalogAccess, false},
+		{"carol", repositoryAccess("team/app", "delete"), true},
+		{"carol", repositoryAccess("team/app", "*"), true},
+		{"carol", catalogAccess, true},
+		{"alice", robotsAccess, false},
+		{"carol", robotsAccess, true},
+	} {
+		if allowed := p.Allows(tc.user, tc.access); allowed != tc.allowed {
+			t.Errorf("expected %s %s on %s allowed to be %v, got %v", tc.user, tc.access.Action, tc.access.Name, tc.allowed, allowed)
+		}
+	}
+}
+
+func TestLoadPolicyErrors(t *testing.T) {
+	for _, content := range []string{
+		"rules:\n  - groups: [missing]\n    actions: [pull]\n",
+		"rules:\n  - users: [alice]\n    actions: [write]\n",
+		"rule:\n  - users: [alice]\n",
+	} {
+		path := filepath.Join(t.TempDir(), "policy.yml")
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Load(path); err == nil {
+			t.Errorf("expected an error loading policy %q", content)
+		}
+	}
+}
+
+func TestPolicyExternalGroups(t *testing.T) {
+	p, err := New(Config{
+		Rules: []RuleConfig{
+			{Groups: []string{"developers"}, Repositories: []string{"team/**"}, Actions: []string{"pull", "push"}},
+		},
+		ExternalGroups: true,
+	})
+	if err != nil {
+		t.Fatalf("error creating policy: %v", err)
+	}
+
+	if !p.AllowsGroups("alice", []string{"staff", "developers"}, repositoryAccess("team/app", "push")) {
+		t.Error("expected a member of developers to be allowed to push")
+	}
+	if p.AllowsGroups("alice", []string{"staff"}, repositoryAccess("team/app", "pull")) {
+		t.Error("expected a user outside of developers to be denied")
+	}
+	if p.Allows("alice", repositoryAccess("team/app", "pull")) {
+		t.Error("expected a user without groups to be denied")
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"net/http"
 	"os"
 	"strings"
+	"time"
 
 	dcontext "github.com/distribution/distribution/v3/context"
 	"github.com/distribution/distribution/v3/registry/auth"
@@ -133,6 +134,7 @@ type accessController struct {
 	service      string
 	rootCerts    *x509.CertPool
 	trustedKeys  map[string]libtrust.PublicKey
+	jwks         *jwks
 }
 
 // tokenAccessOptions is a convenience type for handling
@@ -143,6 +145,10 @@ type tokenAccessOptions struct {
 	issuer         string
 	service        string
 	rootCertBundle string
+	jwks           string
+	jwksRefresh    time.Duration
+	jwksGrace      time.Duration
+	trustedKeys    []libtrust.PublicKey
 }
 
 // checkOptions gathers the necessary options
@@ -150,7 +156,7 @@ type tokenAccessOptions struct {
 func checkOptions(options map[string]interface{}) (tokenAccessOptions, error) {
 	var opts tokenAccessOptions
 
-	keys := []string{"realm", "issuer", "service", "rootcertbundle"}
+	keys := []string{"realm", "issuer", "service"}
 	vals := make([]string, 0, len(keys))
 	for _, key := range keys {
 		val, ok := options[key].(string)
@@ -160,7 +166,39 @@ func checkOptions(options map[string]interface{}) (tokenAccessOptions, error) {
 		vals = append(vals, val)
 	}
 
-	opts.realm, opts.issuer, opts.service, opts.rootCertBundle = vals[0], vals[1], vals[2], vals[3]
+	opts.realm, opts.issuer, opts.service = vals[0], vals[1], vals[2]
+
+	// signing keys are trusted through a root certificate bundle, a JWKS
+	// or both.
+	for key, val := range map[string]*string{"rootcertbundle": &opts.rootCertBundle, "jwks": &opts.jwks} {
+		if v, ok := options[key]; ok {
+			if *val, ok = v.(string); !ok {
+				return opts, fmt.Errorf("token auth requires a valid option string: %q", key)
+			}
+		}
+	}
+
+	// trustedkeys is set by the registry to trust its own token issuer.
+	if v, ok := options["trustedkeys"]; ok {
+		if opts.trustedKeys, ok = v.([]libtrust.PublicKey); !ok {
+			return opts, fmt.Errorf("token auth requires a valid option list of keys: %q", "trustedkeys")
+		}
+	}
+
+	if opts.rootCertBundle == "" && opts.jwks == "" && len(opts.trustedKeys) == 0 {
+		return opts, fmt.Errorf("token auth requires a valid option string: %q", "rootcertbundle")
+	}
+
+	var err error
+	if opts.jwksRefresh, err = auth.DurationOption(options, "jwksrefresh", defaultJWKSRefresh); err != nil {
+		return opts, fmt.Errorf("token auth requires a valid option duration: %v", err)
+	}
+	if opts.jwksGrace, err = auth.DurationOption(options, "jwksgrace", defaultJWKSGrace); err != nil {
+		return opts, fmt.Errorf("token auth requires a valid option duration: %v", err)
+	}
+	if opts.jwksRefresh <= 0 || opts.jwksGrace < 0 {
+		return opts, fmt.Errorf("token auth requires a positive jwksrefresh and a non-negative jwksgrace")
+	}
 
 	autoRedirectVal, ok := options["autoredirect"]
 	if ok {
@@ -181,15 +219,57 @@ func newAccessController(options map[string]interface{}) (auth.AccessController,
 		return nil, err
 	}
 
-	fp, err := os.Open(config.rootCertBundle)
+	rootPool := x509.NewCertPool()
+	trustedKeys := make(map[string]libtrust.PublicKey)
+	if config.rootCertBundle != "" {
+		rootCerts, err := loadRootCertBundle(config.rootCertBundle)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, rootCert := range rootCerts {
+			rootPool.AddCert(rootCert)
+			pubKey, err := libtrust.FromCryptoPublicKey(crypto.PublicKey(rootCert.PublicKey))
+			if err != nil {
+				return nil, fmt.Errorf("unable to get public key from token auth root certificate: %s", err)
+			}
+			trustedKeys[pubKey.KeyID()] = pubKey
+		}
+	}
+	for _, pubKey := range config.trustedKeys {
+		trustedKeys[pubKey.KeyID()] = pubKey
+	}
+
+	var keySet *jwks
+	if config.jwks != "" {
+		keySet, err = newJWKS(config.jwks, config.jwksRefresh, config.jwksGrace)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load token auth jwks %q: %s", config.jwks, err)
+		}
+	}
+
+	return &accessController{
+		realm:        config.realm,
+		autoRedirect: config.autoRedirect,
+		issuer:       config.issuer,
+		service:      config.service,
+		rootCerts:    rootPool,
+		trustedKeys:  trustedKeys,
+		jwks:         keySet,
+	}, nil
+}
+
+// loadRootCertBundle reads the certificates of a PEM bundle.
+func loadRootCertBundle(path string) ([]*x509.Certificate, error) {
+	fp, err := os.Open(path)
 	if err != nil {
-		return nil, fmt.Errorf("unable to open token auth root certificate bundle file %q: %s", config.rootCertBundle, err)
+		return nil, fmt.Errorf("unable to open token auth root certificate bundle file %q: %s", path, err)
 	}
 	defer fp.Close()
 
 	rawCertBundle, err := ioutil.ReadAll(fp)
 	if err != nil {
-		return nil, fmt.Errorf("unable to read token auth root certificate bundle file %q: %s", config.rootCertBundle, err)
+		return nil, fmt.Errorf("unable to read token auth root certificate bundle file %q: %s", path, err)
 	}
 
 	var rootCerts []*x509.Certificate
@@ -211,25 +291,7 @@ func newAccessController(options map[string]interface{}) (auth.AccessController,
 		return nil, errors.New("token auth requires at least one token signing root certificate")
 	}
 
-	rootPool := x509.NewCertPool()
-	trustedKeys := make(map[string]libtrust.PublicKey, len(rootCerts))
-	for _, rootCert := range rootCerts {
-		rootPool.AddCert(rootCert)
-		pubKey, err := libtrust.FromCryptoPublicKey(crypto.PublicKey(rootCert.PublicKey))
-		if err != nil {
-			return nil, fmt.Errorf("unable to get public key from token auth root certificate: %s", err)
-		}
-		trustedKeys[pubKey.KeyID()] = pubKey
-	}
-
-	return &accessController{
-		realm:        config.realm,
-		autoRedirect: config.autoRedirect,
-		issuer:       config.issuer,
-		service:      config.service,
-		rootCerts:    rootPool,
-		trustedKeys:  trustedKeys,
-	}, nil
+	return rootCerts, nil
 }
 
 // Authorized handles checking whether the given request is authorized
@@ -268,6 +330,9 @@ func (ac *accessController) Authorized(ctx context.Context, accessItems ...auth.
 		Roots:             ac.rootCerts,
 		TrustedKeys:       ac.trustedKeys,
 	}
+	if ac.jwks != nil {
+		verifyOpts.KeyFunc = ac.jwks.key
+	}
 
 	if err = token.Verify(verifyOpts); err != nil {
 		challenge.err = err
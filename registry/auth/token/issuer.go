@@ -0,0 +1,111 @@
+package token
+
+import (
+	"crypto"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/distribution/distribution/v3/registry/auth"
+	"github.com/docker/libtrust"
+)
+
+// defaultExpiration is how long issued tokens are valid by default.
+const defaultExpiration = 5 * time.Minute
+
+// Issuer mints tokens granting access to registry resources, signed with a
+// key which the token access controller trusts directly.
+type Issuer struct {
+	// Issuer is the name of the issuer inserted into tokens.
+	Issuer string
+	// SigningKey is the key tokens are signed with. Tokens identify it by
+	// its libtrust key ID.
+	SigningKey libtrust.PrivateKey
+	// Expiration is how long tokens are valid, 5 minutes if zero.
+	Expiration time.Duration
+}
+
+// CreateJWT creates and signs a JSON Web Token for the given subject and
+// audience with the granted access.
+func (issuer *Issuer) CreateJWT(subject string, audience string, grantedAccessList []auth.Access) (string, error) {
+	// Group the granted actions by resource, in the order they were granted.
+	accessEntries := make([]*ResourceActions, 0, len(grantedAccessList))
+	resourceActions := make(map[auth.Resource]*ResourceActions, len(grantedAccessList))
+	for _, access := range grantedAccessList {
+		entry, exists := resourceActions[access.Resource]
+		if !exists {
+			entry = &ResourceActions{
+				Type:    access.Type,
+				Class:   access.Class,
+				Name:    access.Name,
+				Actions: []string{},
+			}
+			resourceActions[access.Resource] = entry
+			accessEntries = append(accessEntries, entry)
+		}
+		if !contains(entry.Actions, access.Action) {
+			entry.Actions = append(entry.Actions, access.Action)
+		}
+	}
+
+	randomBytes := make([]byte, 15)
+	if _, err := io.ReadFull(rand.Reader, randomBytes); err != nil {
+		return "", err
+	}
+
+	var alg string
+	switch issuer.SigningKey.KeyType() {
+	case "RSA":
+		alg = "RS256"
+	case "EC":
+		alg = "ES256"
+	default:
+		return "", fmt.Errorf("unsupported signing key type %q", issuer.SigningKey.KeyType())
+	}
+
+	joseHeader := Header{
+		Type:       "JWT",
+		SigningAlg: alg,
+		KeyID:      issuer.SigningKey.KeyID(),
+	}
+
+	exp := issuer.Expiration
+	if exp == 0 {
+		exp = defaultExpiration
+	}
+
+	now := time.Now()
+	claimSet := ClaimSet{
+		Issuer:     issuer.Issuer,
+		Subject:    subject,
+		Audience:   audience,
+		Expiration: now.Add(exp).Unix(),
+		NotBefore:  now.Unix(),
+		IssuedAt:   now.Unix(),
+		JWTID:      base64.URLEncoding.EncodeToString(randomBytes),
+
+		Access: accessEntries,
+	}
+
+	joseHeaderBytes, err := json.Marshal(joseHeader)
+	if err != nil {
+		return "", fmt.Errorf("unable to encode jose header: %s", err)
+	}
+	claimSetBytes, err := json.Marshal(claimSet)
+	if err != nil {
+		return "", fmt.Errorf("unable to encode claim set: %s", err)
+	}
+
+	encodingToSign := fmt.Sprintf("%s.%s", joseBase64UrlEncode(joseHeaderBytes), joseBase64UrlEncode(claimSetBytes))
+
+	signatureBytes, _, err := issuer.SigningKey.Sign(strings.NewReader(encodingToSign), crypto.SHA256)
+	if err != nil {
+		return "", fmt.Errorf("unable to sign jwt payload: %s", err)
+	}
+
+	return fmt.Sprintf("%s.%s", encodingToSign, joseBase64UrlEncode(signatureBytes)), nil
+}
@@ -0,0 +1,62 @@
+package token
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/distribution/distribution/v3/registry/auth"
+	"github.com/docker/libtrust"
+)
+
+func TestIssuerCreateJWT(t *testing.T) {
+	signingKey, err := libtrust.GenerateECP256PrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer := &Issuer{Issuer: "test-issuer", SigningKey: signingKey}
+
+	repository := auth.Resource{Type: "repository", Name: "foo/bar"}
+	raw, err := issuer.CreateJWT("alice", "test-service", []auth.Access{
+		{Resource: repository, Action: "pull"},
+		{Resource: auth.Resource{Type: "registry", Name: "catalog"}, Action: "*"},
+		{Resource: repository, Action: "push"},
+		{Resource: repository, Action: "pull"},
+	})
+	if err != nil {
+		t.Fatalf("error creating token: %v", err)
+	}
+
+	token, err := NewToken(raw)
+	if err != nil {
+		t.Fatalf("error parsing token: %v", err)
+	}
+	if token.Header.KeyID != signingKey.KeyID() {
+		t.Fatalf("expected key ID %q, got %q", signingKey.KeyID(), token.Header.KeyID)
+	}
+
+	verifyOpts := VerifyOptions{
+		TrustedIssuers:    []string{"test-issuer"},
+		AcceptedAudiences: []string{"test-service"},
+		TrustedKeys:       map[string]libtrust.PublicKey{signingKey.KeyID(): signingKey.PublicKey()},
+	}
+	if err := token.Verify(verifyOpts); err != nil {
+		t.Fatalf("error verifying token: %v", err)
+	}
+
+	expected := []*ResourceActions{
+		{Type: "repository", Name: "foo/bar", Actions: []string{"pull", "push"}},
+		{Type: "registry", Name: "catalog", Actions: []string{"*"}},
+	}
+	if token.Claims.Subject != "alice" || !reflect.DeepEqual(token.Claims.Access, expected) {
+		t.Fatalf("unexpected claims: %+v", token.Claims)
+	}
+
+	otherKey, err := libtrust.GenerateECP256PrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifyOpts.TrustedKeys = map[string]libtrust.PublicKey{otherKey.KeyID(): otherKey.PublicKey()}
+	if err := token.Verify(verifyOpts); err == nil {
+		t.Fatal("expected an error verifying a token signed by an untrusted key")
+	}
+}
@@ -0,0 +1,296 @@
+package token
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// defaultJWKSRefresh is how often a key set is reloaded by default.
+	defaultJWKSRefresh = 5 * time.Minute
+
+	// defaultJWKSGrace is how long a key removed from a key set stays
+	// trusted by default, so that tokens signed before a rotation remain
+	// valid.
+	defaultJWKSGrace = time.Hour
+
+	// maxJWKSSize bounds the size of a key set document.
+	maxJWKSSize = 1 << 20
+)
+
+// jsonWebKey is a key of a JSON Web Key Set, as described in RFC 7517.
+type jsonWebKey struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	Curve     string `json:"crv"`
+	N         string `json:"n"`
+	E         string `json:"e"`
+	X         string `json:"x"`
+	Y         string `json:"y"`
+}
+
+// trustedKey is a key of a key set, along with the time at which it stops
+// being trusted once it has been removed from the key set.
+type trustedKey struct {
+	key       crypto.PublicKey
+	algorithm string
+	expires   time.Time
+}
+
+// jwks holds the signing keys published as a JSON Web Key Set in a file or
+// at a URL, reloading them periodically. Keys removed from the key set stay
+// trusted for a grace period.
+type jwks struct {
+	location string
+	client   *http.Client
+	grace    time.Duration
+
+	mu   sync.RWMutex
+	keys map[string]*trustedKey
+}
+
+// newJWKS loads the key set at the location, which is either an http(s) URL
+// or a file path, and reloads it every refresh interval.
+func newJWKS(location string, refresh, grace time.Duration) (*jwks, error) {
+	ks := &jwks{
+		location: location,
+		client:   &http.Client{Timeout: 30 * time.Second},
+		grace:    grace,
+		keys:     make(map[string]*trustedKey),
+	}
+	if err := ks.reload(time.Now()); err != nil {
+		return nil, err
+	}
+
+	go func() {
+		ticker := time.NewTicker(refresh)
+		defer ticker.Stop()
+		for now := range ticker.C {
+			if err := ks.reload(now); err != nil {
+				log.Errorf("unable to reload token auth jwks %q: %s", ks.location, err)
+			}
+		}
+	}()
+
+	return ks, nil
+}
+
+// key returns the trusted key with the given ID, and the algorithm it is
+// restricted to, if any.
+func (ks *jwks) key(keyID string) (crypto.PublicKey, string, bool) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	k, ok := ks.keys[keyID]
+	if !ok || (!k.expires.IsZero() && time.Now().After(k.expires)) {
+		return nil, "", false
+	}
+	return k.key, k.algorithm, true
+}
+
+// reload fetches the key set and replaces the trusted keys with its keys.
+// Keys which are no longer in the key set expire after the grace period.
+func (ks *jwks) reload(now time.Time) error {
+	data, err := ks.fetch()
+	if err != nil {
+		return err
+	}
+
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return fmt.Errorf("unable to decode jwks: %s", err)
+	}
+
+	keys := make(map[string]*trustedKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.KeyID == "" || (jwk.Use != "" && jwk.Use != "sig") {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			log.Warnf("skipping key %q of token auth jwks %q: %s", jwk.KeyID, ks.location, err)
+			continue
+		}
+		keys[jwk.KeyID] = &trustedKey{key: key, algorithm: jwk.Algorithm}
+	}
+
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	for keyID, k := range ks.keys {
+		if _, ok := keys[keyID]; ok {
+			continue
+		}
+		if k.expires.IsZero() {
+			k.expires = now.Add(ks.grace)
+		}
+		if now.Before(k.expires) {
+			keys[keyID] = k
+		}
+	}
+	ks.keys = keys
+
+	return nil
+}
+
+func (ks *jwks) fetch() ([]byte, error) {
+	if !strings.HasPrefix(ks.location, "http://") && !strings.HasPrefix(ks.location, "https://") {
+		return os.ReadFile(ks.location)
+	}
+
+	resp, err := ks.client.Get(ks.location)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status fetching jwks: %s", resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxJWKSSize))
+}
+
+// publicKey decodes the RSA, EC or Ed25519 public key.
+func (jwk *jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch jwk.KeyType {
+	case "RSA":
+		n, err := decodeBigInt(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, errors.New("invalid RSA exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch jwk.Curve {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", jwk.Curve)
+		}
+		x, err := decodeBigInt(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("invalid EC point")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case "OKP":
+		if jwk.Curve != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", jwk.Curve)
+		}
+		x, err := joseBase64UrlDecode(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key size")
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", jwk.KeyType)
+	}
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := joseBase64UrlDecode(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) == 0 {
+		return nil, errors.New("missing key parameter")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+// verifyJWS verifies the signature of a JSON Web Signature made with the
+// algorithm by the key.
+func verifyJWS(key crypto.PublicKey, algorithm string, signingInput, signature []byte) error {
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		hash, digest := hashFor(algorithm, "RS", signingInput)
+		if digest == nil {
+			break
+		}
+		return rsa.VerifyPKCS1v15(key, hash, digest, signature)
+	case *ecdsa.PublicKey:
+		bits := key.Curve.Params().BitSize
+		if algorithm != fmt.Sprintf("ES%d", map[int]int{256: 256, 384: 384, 521: 512}[bits]) {
+			break
+		}
+		_, digest := hashFor(algorithm, "ES", signingInput)
+		size := (bits + 7) / 8
+		if len(signature) != 2*size {
+			return errors.New("invalid ECDSA signature size")
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(key, digest, r, s) {
+			return errors.New("invalid ECDSA signature")
+		}
+		return nil
+	case ed25519.PublicKey:
+		if algorithm != "EdDSA" {
+			break
+		}
+		if !ed25519.Verify(key, signingInput, signature) {
+			return errors.New("invalid EdDSA signature")
+		}
+		return nil
+	}
+	return fmt.Errorf("signing algorithm %q does not match key type %T", algorithm, key)
+}
+
+// hashFor returns the hash of the signing input for an algorithm of the
+// family, such as "RS" for RS256, or a nil digest if the algorithm is not of
+// the family.
+func hashFor(algorithm, family string, signingInput []byte) (crypto.Hash, []byte) {
+	switch algorithm {
+	case family + "256":
+		sum := sha256.Sum256(signingInput)
+		return crypto.SHA256, sum[:]
+	case family + "384":
+		sum := sha512.Sum384(signingInput)
+		return crypto.SHA384, sum[:]
+	case family + "512":
+		sum := sha512.Sum512(signingInput)
+		return crypto.SHA512, sum[:]
+	}
+	return 0, nil
+}
@@ -0,0 +1,249 @@
+package token
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/registry/auth"
+)
+
+// jwksServer serves a JSON Web Key Set which can be replaced by tests.
+type jwksServer struct {
+	mu   sync.Mutex
+	keys []jsonWebKey
+}
+
+func (s *jwksServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	json.NewEncoder(w).Encode(map[string]interface{}{"keys": s.keys})
+}
+
+func (s *jwksServer) setKeys(keys ...jsonWebKey) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys = keys
+}
+
+func toJSONWebKey(t *testing.T, keyID string, key crypto.PublicKey) jsonWebKey {
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		return jsonWebKey{
+			KeyType:   "RSA",
+			KeyID:     keyID,
+			Algorithm: "RS256",
+			N:         joseBase64UrlEncode(key.N.Bytes()),
+			E:         joseBase64UrlEncode(big.NewInt(int64(key.E)).Bytes()),
+		}
+	case *ecdsa.PublicKey:
+		return jsonWebKey{
+			KeyType: "EC",
+			KeyID:   keyID,
+			Curve:   key.Curve.Params().Name,
+			X:       joseBase64UrlEncode(key.X.FillBytes(make([]byte, 32))),
+			Y:       joseBase64UrlEncode(key.Y.FillBytes(make([]byte, 32))),
+		}
+	case ed25519.PublicKey:
+		return jsonWebKey{
+			KeyType: "OKP",
+			KeyID:   keyID,
+			Curve:   "Ed25519",
+			X:       joseBase64UrlEncode(key),
+		}
+	}
+	t.Fatalf("unsupported key type %T", key)
+	return jsonWebKey{}
+}
+
+// makeJWKSToken makes a token identifying its signing key by ID, signed with
+// the key using the algorithm.
+func makeJWKSToken(t *testing.T, issuer, audience string, access []*ResourceActions, keyID, algorithm string, key crypto.Signer) string {
+	header, err := json.Marshal(&Header{Type: "JWT", SigningAlg: algorithm, KeyID: keyID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	claims, err := json.Marshal(&ClaimSet{
+		Issuer:     issuer,
+		Subject:    "foo",
+		Audience:   audience,
+		Expiration: now.Add(5 * time.Minute).Unix(),
+		NotBefore:  now.Unix(),
+		IssuedAt:   now.Unix(),
+		JWTID:      keyID,
+		Access:     access,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signingInput := fmt.Sprintf("%s.%s", joseBase64UrlEncode(header), joseBase64UrlEncode(claims))
+	digest := sha256.Sum256([]byte(signingInput))
+
+	var signature []byte
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		signature, err = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	case *ecdsa.PrivateKey:
+		var r, s *big.Int
+		r, s, err = ecdsa.Sign(rand.Reader, key, digest[:])
+		if err == nil {
+			signature = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+		}
+	case ed25519.PrivateKey:
+		signature = ed25519.Sign(key, []byte(signingInput))
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return fmt.Sprintf("%s.%s", signingInput, joseBase64UrlEncode(signature))
+}
+
+func TestAccessControllerJWKS(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	untrustedKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keySet := &jwksServer{}
+	keySet.setKeys(
+		toJSONWebKey(t, "rsa", rsaKey.Public()),
+		toJSONWebKey(t, "ec", ecKey.Public()),
+		toJSONWebKey(t, "ed", edKey.Public()),
+	)
+	server := httptest.NewServer(keySet)
+	defer server.Close()
+
+	issuer := "test-issuer.example.com"
+	service := "test-service.example.com"
+
+	ac, err := newAccessController(map[string]interface{}{
+		"realm":       "https://auth.example.com/token/",
+		"issuer":      issuer,
+		"service":     service,
+		"jwks":        server.URL,
+		"jwksrefresh": "1h",
+		"jwksgrace":   "10m",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ks := ac.(*accessController).jwks
+
+	testAccess := auth.Access{
+		Resource: auth.Resource{
+			Type: "repository",
+			Name: "foo/bar",
+		},
+		Action: "pull",
+	}
+	access := []*ResourceActions{{
+		Type:    testAccess.Type,
+		Name:    testAccess.Name,
+		Actions: []string{testAccess.Action},
+	}}
+
+	authorize := func(token string) error {
+		req, err := http.NewRequest("GET", "http://example.com/foo", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+		_, err = ac.Authorized(context.WithRequest(context.Background(), req), testAccess)
+		return err
+	}
+
+	for _, tc := range []struct {
+		name      string
+		keyID     string
+		algorithm string
+		key       crypto.Signer
+		err       error
+	}{
+		{name: "rsa", keyID: "rsa", algorithm: "RS256", key: rsaKey},
+		{name: "ecdsa", keyID: "ec", algorithm: "ES256", key: ecKey},
+		{name: "ed25519", keyID: "ed", algorithm: "EdDSA", key: edKey},
+		{name: "unknown key", keyID: "other", algorithm: "ES256", key: ecKey, err: ErrInvalidToken},
+		{name: "wrong key", keyID: "ec", algorithm: "ES256", key: untrustedKey, err: ErrInvalidToken},
+		{name: "algorithm mismatch", keyID: "ed", algorithm: "ES256", key: ecKey, err: ErrInvalidToken},
+		{name: "restricted algorithm", keyID: "rsa", algorithm: "RS384", key: rsaKey, err: ErrInvalidToken},
+	} {
+		err := authorize(makeJWKSToken(t, issuer, service, access, tc.keyID, tc.algorithm, tc.key))
+		if tc.err == nil && err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.name, err)
+		}
+		if tc.err != nil && (err == nil || err.Error() != tc.err.Error()) {
+			t.Fatalf("%s: expected %v, got %v", tc.name, tc.err, err)
+		}
+	}
+
+	// Rotate the EC key out of the key set. It stays trusted during the
+	// grace period only.
+	keySet.setKeys(toJSONWebKey(t, "rsa", rsaKey.Public()), toJSONWebKey(t, "ed", edKey.Public()))
+	token := makeJWKSToken(t, issuer, service, access, "ec", "ES256", ecKey)
+
+	if err := ks.reload(time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if err := authorize(token); err != nil {
+		t.Fatalf("expected rotated key to be trusted during the grace period, got %v", err)
+	}
+
+	if err := ks.reload(time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := authorize(token); err == nil || err.Error() != ErrInvalidToken.Error() {
+		t.Fatalf("expected rotated key to be untrusted after the grace period, got %v", err)
+	}
+	if err := authorize(makeJWKSToken(t, issuer, service, access, "rsa", "RS256", rsaKey)); err != nil {
+		t.Fatalf("unexpected error for key remaining in the key set: %v", err)
+	}
+}
+
+func TestNewAccessControllerJWKSOptions(t *testing.T) {
+	options := map[string]interface{}{
+		"realm":   "https://auth.example.com/token/",
+		"issuer":  "test-issuer.example.com",
+		"service": "test-service.example.com",
+	}
+	if _, err := newAccessController(options); err == nil {
+		t.Fatal("expected an error without rootcertbundle or jwks")
+	}
+
+	options["jwks"] = "/nonexistent/jwks.json"
+	if _, err := newAccessController(options); err == nil {
+		t.Fatal("expected an error for an unreadable jwks")
+	}
+
+	options["jwksrefresh"] = "soon"
+	if _, err := checkOptions(options); err == nil {
+		t.Fatal("expected an error for an invalid jwksrefresh")
+	}
+}
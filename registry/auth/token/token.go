@@ -78,6 +78,13 @@ type VerifyOptions struct {
 	AcceptedAudiences []string
 	Roots             *x509.CertPool
 	TrustedKeys       map[string]libtrust.PublicKey
+
+	// KeyFunc, if set, looks up the keys of tokens identifying their
+	// signing key by ID alone which are not in TrustedKeys, such as the
+	// keys of a JSON Web Key Set. It returns the key, the signing
+	// algorithm the key is restricted to if any, and whether it is
+	// trusted.
+	KeyFunc func(keyID string) (key crypto.PublicKey, algorithm string, ok bool)
 }
 
 // NewToken parses the given raw token string
@@ -167,6 +174,19 @@ func (t *Token) Verify(verifyOpts VerifyOptions) error {
 		return ErrInvalidToken
 	}
 
+	// Tokens signed by a key looked up by ID are verified with that key.
+	if key, algorithm, ok := t.lookupKey(verifyOpts); ok {
+		if algorithm != "" && algorithm != t.Header.SigningAlg {
+			log.Infof("token signing algorithm %q does not match key algorithm %q", t.Header.SigningAlg, algorithm)
+			return ErrInvalidToken
+		}
+		if err := verifyJWS(key, t.Header.SigningAlg, []byte(t.Raw), t.Signature); err != nil {
+			log.Infof("unable to verify token signature: %s", err)
+			return ErrInvalidToken
+		}
+		return nil
+	}
+
 	// Verify that the signing key is trusted.
 	signingKey, err := t.VerifySigningKey(verifyOpts)
 	if err != nil {
@@ -219,6 +239,19 @@ func (t *Token) VerifySigningKey(verifyOpts VerifyOptions) (signingKey libtrust.
 	return
 }
 
+// lookupKey returns the key identified by the kid header of a token without
+// a certificate chain or JWK, when KeyFunc trusts it rather than TrustedKeys.
+func (t *Token) lookupKey(verifyOpts VerifyOptions) (crypto.PublicKey, string, bool) {
+	keyID := t.Header.KeyID
+	if verifyOpts.KeyFunc == nil || len(t.Header.X5c) > 0 || t.Header.RawJWK != nil || keyID == "" {
+		return nil, "", false
+	}
+	if _, ok := verifyOpts.TrustedKeys[keyID]; ok {
+		return nil, "", false
+	}
+	return verifyOpts.KeyFunc(keyID)
+}
+
 func parseAndVerifyCertChain(x5c []string, roots *x509.CertPool) (leafKey libtrust.PublicKey, err error) {
 	if len(x5c) == 0 {
 		return nil, errors.New("empty x509 certificate chain")
@@ -203,9 +203,23 @@ type tags struct {
 
 // All returns all tags
 func (t *tags) All(ctx context.Context) ([]string, error) {
+	return t.List(ctx, "", -1)
+}
+
+// List returns up to n tags sorting after last, following the pagination
+// links of the registry until enough tags are received.
+func (t *tags) List(ctx context.Context, last string, n int) ([]string, error) {
 	var tags []string
 
-	listURLStr, err := t.ub.BuildTagsURL(t.name)
+	values := url.Values{}
+	if last != "" {
+		values.Set("last", last)
+	}
+	if n >= 0 {
+		values.Set("n", strconv.Itoa(n))
+	}
+
+	listURLStr, err := t.ub.BuildTagsURL(t.name, values)
 	if err != nil {
 		return tags, err
 	}
@@ -239,6 +253,9 @@ func (t *tags) All(ctx context.Context) ([]string, error) {
 				return tags, err
 			}
 			tags = append(tags, tagsResponse.Tags...)
+			if n >= 0 && len(tags) >= n {
+				return tags[:n], nil
+			}
 			if link := resp.Header.Get("Link"); link != "" {
 				linkURLStr := strings.Trim(strings.Split(link, ";")[0], "<>")
 				linkURL, err := url.Parse(linkURLStr)
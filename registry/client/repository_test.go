@@ -1621,6 +1621,68 @@ func TestManifestTagsPaginated(t *testing.T) {
 	}
 }
 
+func TestManifestTagsList(t *testing.T) {
+	repo, _ := reference.WithName("test.example.com/repo/tags/list")
+	var m testutil.RequestResponseMap
+	// the registry returns fewer tags than requested, so the client follows
+	// the links until it has n tags.
+	for _, page := range []struct {
+		last string
+		n    string
+		tags []string
+	}{
+		{"tag1", "2", []string{"tag2"}},
+		{"tag2", "1", []string{"tag3"}},
+	} {
+		body, err := json.Marshal(map[string]interface{}{
+			"name": repo.Name(),
+			"tags": page.tags,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		m = append(m, testutil.RequestResponseMapping{
+			Request: testutil.Request{
+				Method: "GET",
+				Route:  "/v2/" + repo.Name() + "/tags/list",
+				QueryParams: map[string][]string{
+					"last": {page.last},
+					"n":    {page.n},
+				},
+			},
+			Response: testutil.Response{
+				StatusCode: http.StatusOK,
+				Body:       body,
+				Headers: http.Header(map[string][]string{
+					"Content-Length": {fmt.Sprint(len(body))},
+					"Link":           {fmt.Sprintf(`</v2/%s/tags/list?n=1&last=%s>; rel="next"`, repo.Name(), page.tags[0])},
+				}),
+			},
+		})
+	}
+	e, c := testServer(m)
+	defer c()
+
+	r, err := NewRepository(repo, e, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	lister, ok := r.Tags(ctx).(distribution.TagLister)
+	if !ok {
+		t.Fatal("tag service does not implement TagLister")
+	}
+
+	tags, err := lister.List(ctx, "tag1", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(tags, []string{"tag2", "tag3"}) {
+		t.Fatalf("unexpected tags returned: %v", tags)
+	}
+}
+
 func TestManifestUnauthorized(t *testing.T) {
 	repo, _ := reference.WithName("test.example.com/repo")
 	_, dgst, _ := newRandomSchemaV1Manifest(repo, "latest", 6)
@@ -0,0 +1,64 @@
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/distribution/distribution/v3/registry/storage"
+	"github.com/spf13/cobra"
+)
+
+var duFormat string
+
+// DUCmd is the cobra command that corresponds to the du subcommand
+var DUCmd = &cobra.Command{
+	Use:   "du <config>",
+	Short: "`du` reports the storage used by each repository",
+	Long: "`du` reports the storage used by each repository. Sizes are in bytes: " +
+		"logical counts every blob referenced by a repository, unique only those " +
+		"referenced by no other repository and shared the remainder. The total " +
+		"is the deduplicated size of all referenced blobs.",
+	Run: func(cmd *cobra.Command, args []string) {
+		if duFormat != "table" && duFormat != "json" {
+			fmt.Fprintf(os.Stderr, "unknown output format %q\n", duFormat)
+			cmd.Usage()
+			os.Exit(1)
+		}
+
+		ctx, _, registry := openRegistry(cmd, args)
+
+		report, err := storage.DiskUsage(ctx, registry)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to compute disk usage: %v", err)
+			os.Exit(1)
+		}
+
+		if duFormat == "json" {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			err = enc.Encode(report)
+		} else {
+			err = writeUsageTable(report)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to write disk usage: %v", err)
+			os.Exit(1)
+		}
+	},
+}
+
+func writeUsageTable(report storage.UsageReport) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "REPOSITORY\tBLOBS\tLOGICAL\tUNIQUE\tSHARED")
+	for _, repo := range report.Repositories {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\n", repo.Name, repo.Blobs, repo.LogicalSize, repo.UniqueSize, repo.SharedSize)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	_, err := fmt.Fprintf(os.Stdout, "\n%d blobs, %d bytes logical, %d bytes deduplicated\n", report.Blobs, report.LogicalSize, report.TotalSize)
+	return err
+}
@@ -0,0 +1,73 @@
+package registry
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/distribution/distribution/v3/registry/storage"
+	"github.com/spf13/cobra"
+)
+
+var exportOutput string
+var exportFilters []string
+var exportVerify bool
+var importFilters []string
+var importRepository string
+
+// ExportCmd is the cobra command that corresponds to the export subcommand
+var ExportCmd = &cobra.Command{
+	Use:   "export <config> --output <path>",
+	Short: "`export` writes repositories to an OCI image layout",
+	Long: "`export` writes the tagged manifests of repositories, along with the content " +
+		"they reference, to an OCI image layout. The layout is written into a tar " +
+		"archive if the output path ends with .tar, or into a directory otherwise.",
+	Run: func(cmd *cobra.Command, args []string) {
+		if exportOutput == "" {
+			fmt.Fprintln(os.Stderr, "--output must be specified")
+			cmd.Usage()
+			os.Exit(1)
+		}
+
+		ctx, _, registry := openRegistry(cmd, args)
+
+		report, err := storage.Export(ctx, registry, exportOutput, storage.ExportOpts{
+			Filters: exportFilters,
+			Tarball: strings.HasSuffix(exportOutput, ".tar"),
+			Verify:  exportVerify,
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to export: %v", err)
+			os.Exit(1)
+		}
+		emit("%d tags exported, %d blobs (%d bytes) written", report.Tags, report.Blobs, report.Bytes)
+	},
+}
+
+// ImportCmd is the cobra command that corresponds to the import subcommand
+var ImportCmd = &cobra.Command{
+	Use:   "import <config> <layout>",
+	Short: "`import` loads an OCI image layout into the registry",
+	Long: "`import` loads the manifests listed in an OCI image layout directory or tar " +
+		"archive, along with the content they reference, into the registry. The " +
+		"content is verified against its digest before being stored.",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 2 {
+			fmt.Fprintln(os.Stderr, "a configuration and a layout must be specified")
+			cmd.Usage()
+			os.Exit(1)
+		}
+
+		ctx, _, registry := openRegistry(cmd, args[:1])
+
+		report, err := storage.Import(ctx, registry, args[1], storage.ImportOpts{
+			Filters:    importFilters,
+			Repository: importRepository,
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to import: %v", err)
+			os.Exit(1)
+		}
+		emit("%d tags imported, %d blobs (%d bytes) stored", report.Tags, report.Blobs, report.Bytes)
+	},
+}
@@ -0,0 +1,70 @@
+package registry
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/distribution/distribution/v3/registry/storage"
+	"github.com/spf13/cobra"
+)
+
+var fsckVerifyBlobs bool
+var fsckRepair bool
+
+// FsckCmd is the cobra command that corresponds to the fsck subcommand
+var FsckCmd = &cobra.Command{
+	Use:   "fsck <config>",
+	Short: "`fsck` checks the consistency of the registry storage",
+	Long: "`fsck` checks the consistency of the registry storage, reporting dangling " +
+		"and invalid links, blobs missing for manifests and, with --verify-blobs, " +
+		"blob data which does not match its digest. With --repair, dangling and " +
+		"invalid links are removed and blobs are relinked into repositories. The " +
+		"registry should be in read-only mode or stopped during a repair.",
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx, driver, registry := openRegistry(cmd, args)
+
+		report, err := storage.Fsck(ctx, driver, registry, storage.FsckOpts{
+			VerifyBlobs: fsckVerifyBlobs,
+			Repair:      fsckRepair,
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to check storage: %v", err)
+			os.Exit(1)
+		}
+
+		byKind := make(map[storage.InconsistencyKind][]storage.Inconsistency)
+		var kinds []storage.InconsistencyKind
+		for _, inconsistency := range report.Inconsistencies {
+			if _, ok := byKind[inconsistency.Kind]; !ok {
+				kinds = append(kinds, inconsistency.Kind)
+			}
+			byKind[inconsistency.Kind] = append(byKind[inconsistency.Kind], inconsistency)
+		}
+
+		for _, kind := range kinds {
+			emit("%s (%d):", kind, len(byKind[kind]))
+			for _, inconsistency := range byKind[kind] {
+				line := "  " + inconsistency.Path
+				if inconsistency.Detail != "" {
+					line += ": " + inconsistency.Detail
+				}
+				if inconsistency.Repaired {
+					line += " [repaired]"
+				}
+				emit("%s", line)
+			}
+			emit("")
+		}
+
+		emit("%d repositories and %d blobs checked, %d inconsistencies found, %d unrepaired",
+			report.Repositories, report.Blobs, len(report.Inconsistencies), report.Unrepaired())
+
+		if report.Unrepaired() > 0 {
+			os.Exit(1)
+		}
+	},
+}
+
+func emit(format string, a ...interface{}) {
+	fmt.Printf(format+"\n", a...)
+}
@@ -0,0 +1,236 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/configuration"
+	dcontext "github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/manifest/ocischema"
+	"github.com/distribution/distribution/v3/manifest/schema2"
+	"github.com/distribution/distribution/v3/registry/api/errcode"
+	"github.com/opencontainers/go-digest"
+)
+
+const (
+	// defaultAdmissionTimeout bounds a request to an admission hook which
+	// does not configure a timeout.
+	defaultAdmissionTimeout = 5 * time.Second
+
+	// maxAdmissionResponseSize bounds the response read from an admission
+	// hook.
+	maxAdmissionResponseSize = 1 << 20
+)
+
+// admissionRequest is the body posted to an admission hook for each manifest
+// push.
+type admissionRequest struct {
+	// Repository is the name of the repository the manifest is pushed to.
+	Repository string `json:"repository"`
+
+	// Tag is the tag the manifest is pushed with, if any.
+	Tag string `json:"tag,omitempty"`
+
+	// Digest is the digest of the manifest.
+	Digest digest.Digest `json:"digest"`
+
+	// MediaType is the media type of the manifest.
+	MediaType string `json:"mediaType"`
+
+	// Manifest is the manifest. It is embedded as JSON, so may not match
+	// Digest byte for byte.
+	Manifest json.RawMessage `json:"manifest"`
+
+	// Config is the config blob of an image manifest, when it is JSON.
+	Config json.RawMessage `json:"config,omitempty"`
+}
+
+// admissionResponse is the body an admission hook replies with.
+type admissionResponse struct {
+	// Allowed admits the manifest.
+	Allowed bool `json:"allowed"`
+
+	// Message explains a denial to the client.
+	Message string `json:"message,omitempty"`
+}
+
+// admissionHook posts manifest pushes to a webhook for admission.
+type admissionHook struct {
+	name         string
+	url          string
+	headers      http.Header
+	failOpen     bool
+	repositories []*regexp.Regexp
+	client       *http.Client
+}
+
+// newAdmissionHooks creates the admission hooks of the policy configuration.
+func newAdmissionHooks(hooks []configuration.AdmissionHook) ([]*admissionHook, error) {
+	admissionHooks := make([]*admissionHook, 0, len(hooks))
+	for _, hook := range hooks {
+		if hook.Name == "" || hook.URL == "" {
+			return nil, fmt.Errorf("name and url are required, got %q with url %q", hook.Name, hook.URL)
+		}
+
+		repositories := make([]*regexp.Regexp, 0, len(hook.Repositories))
+		for _, repository := range hook.Repositories {
+			re, err := regexp.Compile("^(?:" + repository + ")$")
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", hook.Name, err)
+			}
+			repositories = append(repositories, re)
+		}
+
+		timeout := hook.Timeout
+		if timeout <= 0 {
+			timeout = defaultAdmissionTimeout
+		}
+
+		admissionHooks = append(admissionHooks, &admissionHook{
+			name:         hook.Name,
+			url:          hook.URL,
+			headers:      hook.Headers,
+			failOpen:     hook.FailOpen,
+			repositories: repositories,
+			client:       &http.Client{Timeout: timeout},
+		})
+	}
+	return admissionHooks, nil
+}
+
+// matches reports whether the hook checks pushes to the repository.
+func (hook *admissionHook) matches(repo string) bool {
+	if len(hook.repositories) == 0 {
+		return true
+	}
+	for _, re := range hook.repositories {
+		if re.MatchString(repo) {
+			return true
+		}
+	}
+	return false
+}
+
+// admit posts the request to the hook and returns its decision.
+func (hook *admissionHook) admit(ctx *Context, request *admissionRequest) (*admissionResponse, error) {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range hook.headers {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := hook.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	var response admissionResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxAdmissionResponseSize)).Decode(&response); err != nil {
+		return nil, fmt.Errorf("decoding response: %v", err)
+	}
+	return &response, nil
+}
+
+// admitManifest asks the admission hooks matching the repository whether the
+// manifest may be stored. A denial is returned as a DENIED error carrying the
+// message of the hook. A hook which cannot be reached denies the manifest
+// with an UNAVAILABLE error, unless it fails open.
+func (ctx *Context) admitManifest(manifest distribution.Manifest, tag string) error {
+	repo := ctx.Repository.Named().Name()
+
+	var request *admissionRequest
+	for _, hook := range ctx.admissionHooks {
+		if !hook.matches(repo) {
+			continue
+		}
+
+		if request == nil {
+			var err error
+			request, err = ctx.describePush(manifest, tag)
+			if err != nil {
+				return err
+			}
+		}
+
+		response, err := hook.admit(ctx, request)
+		if err != nil {
+			if hook.failOpen {
+				dcontext.GetLogger(ctx).Warnf("admission hook %s failed, admitting manifest: %v", hook.name, err)
+				continue
+			}
+			dcontext.GetLogger(ctx).Errorf("admission hook %s failed: %v", hook.name, err)
+			return errcode.ErrorCodeUnavailable.WithMessage(fmt.Sprintf("admission hook %s is unavailable", hook.name))
+		}
+
+		if !response.Allowed {
+			message := response.Message
+			if message == "" {
+				message = fmt.Sprintf("manifest denied by admission hook %s", hook.name)
+			}
+			return errcode.ErrorCodeDenied.WithMessage(message)
+		}
+	}
+	return nil
+}
+
+// describePush describes the push of the manifest for the admission hooks.
+func (ctx *Context) describePush(manifest distribution.Manifest, tag string) (*admissionRequest, error) {
+	mediaType, payload, err := manifest.Payload()
+	if err != nil {
+		return nil, err
+	}
+
+	request := &admissionRequest{
+		Repository: ctx.Repository.Named().Name(),
+		Tag:        tag,
+		Digest:     digest.FromBytes(payload),
+		MediaType:  mediaType,
+		Manifest:   payload,
+	}
+
+	var config distribution.Descriptor
+	switch m := manifest.(type) {
+	case *schema2.DeserializedManifest:
+		config = m.Config
+	case *ocischema.DeserializedManifest:
+		config = m.Config
+	default:
+		return request, nil
+	}
+
+	if config.Size > maxManifestBodySize {
+		return request, nil
+	}
+
+	p, err := ctx.Repository.Blobs(ctx).Get(ctx, config.Digest)
+	if err != nil {
+		if err == distribution.ErrBlobUnknown {
+			// storing the manifest reports the missing blob.
+			return request, nil
+		}
+		return nil, err
+	}
+	if json.Valid(p) {
+		request.Config = p
+	}
+	return request, nil
+}
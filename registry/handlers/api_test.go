@@ -3,7 +3,14 @@ package handlers
 import (
 	"bytes"
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
 	"encoding/json"
+	"encoding/pem"
 	"errors"
 	"fmt"
 	"io"
@@ -14,21 +21,31 @@ import (
 	"net/url"
 	"os"
 	"path"
+	"path/filepath"
 	"reflect"
 	"regexp"
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/distribution/distribution/v3"
 	"github.com/distribution/distribution/v3/configuration"
 	"github.com/distribution/distribution/v3/manifest"
 	"github.com/distribution/distribution/v3/manifest/manifestlist"
+	"github.com/distribution/distribution/v3/manifest/ocischema"
 	"github.com/distribution/distribution/v3/manifest/schema1"
 	"github.com/distribution/distribution/v3/manifest/schema2"
+	"github.com/distribution/distribution/v3/notifications"
 	"github.com/distribution/distribution/v3/reference"
 	"github.com/distribution/distribution/v3/registry/api/errcode"
 	v2 "github.com/distribution/distribution/v3/registry/api/v2"
+	"github.com/distribution/distribution/v3/registry/audit"
+	"github.com/distribution/distribution/v3/registry/auth"
+	"github.com/distribution/distribution/v3/registry/auth/anonymous"
+	_ "github.com/distribution/distribution/v3/registry/auth/htpasswd"
+	"github.com/distribution/distribution/v3/registry/signature"
+	"github.com/distribution/distribution/v3/registry/storage"
 	storagedriver "github.com/distribution/distribution/v3/registry/storage/driver"
 	"github.com/distribution/distribution/v3/registry/storage/driver/factory"
 	_ "github.com/distribution/distribution/v3/registry/storage/driver/testdriver"
@@ -36,6 +53,8 @@ import (
 	"github.com/docker/libtrust"
 	"github.com/gorilla/handlers"
 	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"golang.org/x/crypto/bcrypt"
 )
 
 var headerConfig = http.Header{
@@ -196,6 +215,74 @@ func TestCatalogAPI(t *testing.T) {
 	}
 }
 
+// TestCatalogAPIPrefix tests filtering the catalog by repository prefix.
+func TestCatalogAPIPrefix(t *testing.T) {
+	env := newTestEnv(t, false)
+	defer env.Shutdown()
+
+	for _, image := range []string{"foo/aaaa", "foo/bbbb", "foo/cccc", "foobar/dddd", "bar/eeee"} {
+		createRepository(env, t, image, "sometag")
+	}
+
+	catalogURL, err := env.builder.BuildCatalogURL(url.Values{
+		"prefix": []string{"foo/"},
+		"n":      []string{"2"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error building catalog url: %v", err)
+	}
+
+	var ctlg struct {
+		Repositories []string `json:"repositories"`
+	}
+	var repositories []string
+	for catalogURL != "" {
+		resp, err := http.Get(catalogURL)
+		if err != nil {
+			t.Fatalf("unexpected error issuing request: %v", err)
+		}
+		defer resp.Body.Close()
+
+		checkResponse(t, "issuing catalog api check", resp, http.StatusOK)
+
+		if err := json.NewDecoder(resp.Body).Decode(&ctlg); err != nil {
+			t.Fatalf("error decoding catalog: %v", err)
+		}
+		repositories = append(repositories, ctlg.Repositories...)
+
+		catalogURL = ""
+		if link := resp.Header.Get("Link"); link != "" {
+			values := checkLink(t, link, 2, ctlg.Repositories[len(ctlg.Repositories)-1])
+			if values.Get("prefix") != "foo/" {
+				t.Fatalf("catalog link lost the prefix: %s", link)
+			}
+			catalogURL, err = env.builder.BuildCatalogURL(values)
+			if err != nil {
+				t.Fatalf("unexpected error building catalog url: %v", err)
+			}
+		}
+	}
+
+	expected := []string{"foo/aaaa", "foo/bbbb", "foo/cccc"}
+	if !reflect.DeepEqual(repositories, expected) {
+		t.Fatalf("unexpected repositories: %v != %v", repositories, expected)
+	}
+
+	// the namespace of the prefix must be a valid repository name
+	catalogURL, err = env.builder.BuildCatalogURL(url.Values{"prefix": []string{"Foo/"}})
+	if err != nil {
+		t.Fatalf("unexpected error building catalog url: %v", err)
+	}
+	resp, err := http.Get(catalogURL)
+	if err != nil {
+		t.Fatalf("unexpected error issuing request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	checkResponse(t, "issuing catalog api check with invalid prefix", resp, http.StatusBadRequest)
+	checkBodyHasErrorCodes(t, "invalid prefix", resp, v2.ErrorCodeNameInvalid)
+}
+
 // TestTagsAPI tests the /v2/<name>/tags/list endpoint
 func TestTagsAPI(t *testing.T) {
 	env := newTestEnv(t, false)
@@ -309,6 +396,7 @@ func TestTagsAPI(t *testing.T) {
 			queryParams:        url.Values{"last": []string{"does-not-exist"}, "n": []string{"3"}},
 			expectedStatusCode: http.StatusOK,
 			expectedBody: tagsAPIResponse{Name: imageName.Name(), Tags: []string{
+				"jyi7b",
 				"kb0j5",
 				"sb71y",
 			}},
@@ -2872,3 +2960,1750 @@ func TestProxyManifestGetByTag(t *testing.T) {
 		"Docker-Content-Digest": []string{newDigest.String()},
 	})
 }
+
+func TestQuotaAPI(t *testing.T) {
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"testdriver": configuration.Parameters{},
+			"maintenance": configuration.Parameters{"uploadpurging": map[interface{}]interface{}{
+				"enabled": false,
+			}},
+		},
+	}
+	config.HTTP.Headers = headerConfig
+	config.Quota.Limits = []configuration.QuotaLimit{
+		{Repository: "quota/", Size: 20},
+	}
+
+	env := newTestEnvWithConfig(t, &config)
+	defer env.Shutdown()
+
+	imageName, _ := reference.WithName("quota/repo")
+
+	first := []byte("first quota layer")
+	uploadURLBase, _ := startPushLayer(t, env, imageName)
+	pushLayer(t, env.builder, imageName, digest.FromBytes(first), uploadURLBase, bytes.NewReader(first))
+
+	second := []byte("second quota layer")
+	uploadURLBase, _ = startPushLayer(t, env, imageName)
+	resp, err := doPushLayer(t, env.builder, imageName, digest.FromBytes(second), uploadURLBase, bytes.NewReader(second))
+	if err != nil {
+		t.Fatalf("unexpected error pushing layer: %v", err)
+	}
+	defer resp.Body.Close()
+	checkResponse(t, "pushing layer over quota", resp, http.StatusForbidden)
+	checkBodyHasErrorCodes(t, "pushing layer over quota", resp, errcode.ErrorCodeDenied)
+
+	quotaURL, err := env.builder.BuildQuotaURL(imageName)
+	checkErr(t, err, "building quota url")
+
+	resp, err = http.Get(quotaURL)
+	if err != nil {
+		t.Fatalf("unexpected error getting quota: %v", err)
+	}
+	defer resp.Body.Close()
+	checkResponse(t, "getting quota", resp, http.StatusOK)
+
+	var body quotaAPIResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("unexpected error decoding quota response: %v", err)
+	}
+
+	expected := quotaAPIResponse{
+		Name: "quota/repo",
+		Quotas: []storage.QuotaStatus{
+			{Scope: "quota/", Limit: 20, Usage: int64(len(first))},
+		},
+	}
+	if !reflect.DeepEqual(body, expected) {
+		t.Fatalf("unexpected quota response: %#v != %#v", body, expected)
+	}
+}
+
+func TestReferrersAPI(t *testing.T) {
+	env := newTestEnv(t, false)
+	defer env.Shutdown()
+
+	imageName, _ := reference.WithName("foo/referrers")
+
+	config := []byte("{}")
+	configDigest := digest.FromBytes(config)
+	uploadURLBase, _ := startPushLayer(t, env, imageName)
+	pushLayer(t, env.builder, imageName, configDigest, uploadURLBase, bytes.NewReader(config))
+
+	// the subject does not need to exist
+	subject := distribution.Descriptor{
+		MediaType: v1.MediaTypeImageManifest,
+		Size:      1234,
+		Digest:    digest.FromString("subject"),
+	}
+
+	putReferrer := func(artifactType string, subject distribution.Descriptor) *http.Response {
+		m, err := ocischema.FromStruct(ocischema.Manifest{
+			Versioned:    ocischema.SchemaVersion,
+			ArtifactType: artifactType,
+			Config: distribution.Descriptor{
+				MediaType: "application/vnd.oci.empty.v1+json",
+				Size:      int64(len(config)),
+				Digest:    configDigest,
+			},
+			Layers:  []distribution.Descriptor{},
+			Subject: &subject,
+		})
+		if err != nil {
+			t.Fatalf("unexpected error creating manifest: %v", err)
+		}
+		_, payload, _ := m.Payload()
+		digestRef, _ := reference.WithDigest(imageName, digest.FromBytes(payload))
+		manifestURL, err := env.builder.BuildManifestURL(digestRef)
+		checkErr(t, err, "building manifest url")
+		return putManifest(t, "putting referrer", manifestURL, v1.MediaTypeImageManifest, m)
+	}
+
+	for _, artifactType := range []string{"application/vnd.example.signature", "application/vnd.example.sbom"} {
+		resp := putReferrer(artifactType, subject)
+		defer resp.Body.Close()
+		checkResponse(t, "putting referrer", resp, http.StatusCreated)
+		checkHeaders(t, resp, http.Header{
+			"OCI-Subject": []string{subject.Digest.String()},
+		})
+	}
+
+	resp := putReferrer("application/vnd.example.invalid", distribution.Descriptor{Digest: subject.Digest})
+	defer resp.Body.Close()
+	checkResponse(t, "putting referrer with invalid subject", resp, http.StatusBadRequest)
+	checkBodyHasErrorCodes(t, "putting referrer with invalid subject", resp, v2.ErrorCodeManifestInvalid)
+
+	subjectRef, _ := reference.WithDigest(imageName, subject.Digest)
+	for _, tc := range []struct {
+		artifactType string
+		expected     int
+	}{
+		{"", 2},
+		{"application/vnd.example.sbom", 1},
+		{"application/vnd.example.unknown", 0},
+	} {
+		var values []url.Values
+		if tc.artifactType != "" {
+			values = append(values, url.Values{"artifactType": []string{tc.artifactType}})
+		}
+		referrersURL, err := env.builder.BuildReferrersURL(subjectRef, values...)
+		checkErr(t, err, "building referrers url")
+
+		resp, err := http.Get(referrersURL)
+		if err != nil {
+			t.Fatalf("unexpected error getting referrers: %v", err)
+		}
+		defer resp.Body.Close()
+		checkResponse(t, "getting referrers", resp, http.StatusOK)
+		checkHeaders(t, resp, http.Header{
+			"Content-Type": []string{v1.MediaTypeImageIndex},
+		})
+		if filters := resp.Header.Get("OCI-Filters-Applied"); (filters != "") != (tc.artifactType != "") {
+			t.Fatalf("unexpected OCI-Filters-Applied header: %q", filters)
+		}
+
+		var index referrersAPIResponse
+		if err := json.NewDecoder(resp.Body).Decode(&index); err != nil {
+			t.Fatalf("unexpected error decoding referrers: %v", err)
+		}
+		if index.MediaType != v1.MediaTypeImageIndex || len(index.Manifests) != tc.expected {
+			t.Fatalf("unexpected referrers for artifact type %q: %#v", tc.artifactType, index)
+		}
+		for _, desc := range index.Manifests {
+			if tc.artifactType != "" && desc.ArtifactType != tc.artifactType {
+				t.Fatalf("unexpected artifact type: %s", desc.ArtifactType)
+			}
+		}
+	}
+}
+
+func TestTagMetadataAPI(t *testing.T) {
+	env := newTestEnv(t, false)
+	defer env.Shutdown()
+
+	imageName, _ := reference.WithName("foo/tagmetadata")
+
+	// tags are created in an order different from their names
+	tags := []string{"b", "c", "a"}
+	digests := make(map[string]digest.Digest)
+	for _, tag := range tags {
+		digests[tag] = createRepository(env, t, imageName.Name(), tag)
+	}
+
+	getTagMetadata := func(values url.Values) (tagMetadataAPIResponse, *http.Response) {
+		tagsURL, err := env.builder.BuildTagMetadataURL(imageName, values)
+		checkErr(t, err, "building tag metadata url")
+
+		resp, err := http.Get(tagsURL)
+		if err != nil {
+			t.Fatalf("unexpected error getting tag metadata: %v", err)
+		}
+		defer resp.Body.Close()
+		checkResponse(t, "getting tag metadata", resp, http.StatusOK)
+
+		var body tagMetadataAPIResponse
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			t.Fatalf("unexpected error decoding tag metadata: %v", err)
+		}
+		return body, resp
+	}
+
+	tagNames := func(body tagMetadataAPIResponse) []string {
+		names := []string{}
+		for _, tag := range body.Tags {
+			names = append(names, tag.Name)
+		}
+		return names
+	}
+
+	body, _ := getTagMetadata(nil)
+	if names := tagNames(body); !reflect.DeepEqual(names, []string{"a", "b", "c"}) {
+		t.Fatalf("unexpected tags sorted by name: %v", names)
+	}
+	for _, tag := range body.Tags {
+		if tag.Digest != digests[tag.Name] {
+			t.Fatalf("unexpected digest for tag %s: %s != %s", tag.Name, tag.Digest, digests[tag.Name])
+		}
+		if tag.MediaType != schema1.MediaTypeSignedManifest || tag.Size <= 0 {
+			t.Fatalf("unexpected metadata for tag %s: %#v", tag.Name, tag)
+		}
+		if tag.ModTime == nil || tag.ModTime.IsZero() {
+			t.Fatalf("missing modification time for tag %s", tag.Name)
+		}
+	}
+
+	body, resp := getTagMetadata(url.Values{"sort": []string{"time"}, "n": []string{"2"}})
+	if names := tagNames(body); !reflect.DeepEqual(names, []string{"a", "c"}) {
+		t.Fatalf("unexpected tags sorted by time: %v", names)
+	}
+	var c tagMetadata
+	for _, tag := range body.Tags {
+		if tag.Name == "c" {
+			c = tag
+		}
+	}
+	next := url.Values{
+		"last":        []string{"c"},
+		"lastmodtime": []string{c.ModTime.Format(time.RFC3339Nano)},
+		"n":           []string{"2"},
+		"sort":        []string{"time"},
+	}
+	checkHeaders(t, resp, http.Header{
+		"Link": []string{`</v2/foo/tagmetadata/_ext/tags?` + next.Encode() + `>; rel="next"`},
+	})
+
+	body, _ = getTagMetadata(next)
+	if names := tagNames(body); !reflect.DeepEqual(names, []string{"b"}) {
+		t.Fatalf("unexpected second page of tags sorted by time: %v", names)
+	}
+
+	// the next page resumes where the last tag sorted, even once it is
+	// removed
+	repo, err := env.app.registry.Repository(env.ctx, imageName)
+	checkErr(t, err, "getting repository")
+	checkErr(t, repo.Tags(env.ctx).Untag(env.ctx, "c"), "untagging c")
+	body, _ = getTagMetadata(next)
+	if names := tagNames(body); !reflect.DeepEqual(names, []string{"b"}) {
+		t.Fatalf("unexpected second page of tags sorted by time after removing the last tag: %v", names)
+	}
+	body, _ = getTagMetadata(url.Values{"n": []string{"2"}, "last": []string{"a"}})
+	if names := tagNames(body); !reflect.DeepEqual(names, []string{"b"}) {
+		t.Fatalf("unexpected second page of tags sorted by name after removing a tag: %v", names)
+	}
+}
+
+func TestCopyAPI(t *testing.T) {
+	env := newTestEnv(t, false)
+	defer env.Shutdown()
+
+	sourceName, _ := reference.WithName("staging/app")
+	destinationName, _ := reference.WithName("prod/app")
+
+	imageDigest := createRepository(env, t, sourceName.Name(), "1.0")
+
+	// push an index of the image to the source repository
+	imageRef, _ := reference.WithDigest(sourceName, imageDigest)
+	imageURL, err := env.builder.BuildManifestURL(imageRef)
+	checkErr(t, err, "building manifest url")
+	resp, err := http.Get(imageURL)
+	checkErr(t, err, "fetching image manifest")
+	defer resp.Body.Close()
+	checkResponse(t, "fetching image manifest", resp, http.StatusOK)
+	var image schema1.SignedManifest
+	if err := json.NewDecoder(resp.Body).Decode(&image); err != nil {
+		t.Fatalf("unexpected error decoding manifest: %v", err)
+	}
+
+	index, err := manifestlist.FromDescriptors([]manifestlist.ManifestDescriptor{
+		{
+			Descriptor: distribution.Descriptor{
+				MediaType: schema1.MediaTypeSignedManifest,
+				Size:      resp.ContentLength,
+				Digest:    imageDigest,
+			},
+			Platform: manifestlist.PlatformSpec{Architecture: "amd64", OS: "linux"},
+		},
+	})
+	checkErr(t, err, "creating manifest list")
+	_, payload, _ := index.Payload()
+	indexDigest := digest.FromBytes(payload)
+	indexRef, _ := reference.WithTag(sourceName, "multi")
+	indexURL, err := env.builder.BuildManifestURL(indexRef)
+	checkErr(t, err, "building manifest url")
+	resp = putManifest(t, "putting manifest list", indexURL, manifestlist.MediaTypeManifestList, index)
+	defer resp.Body.Close()
+	checkResponse(t, "putting manifest list", resp, http.StatusCreated)
+
+	copyManifest := func(values url.Values) *http.Response {
+		copyURL, err := env.builder.BuildCopyURL(destinationName, values)
+		checkErr(t, err, "building copy url")
+		resp, err := http.Post(copyURL, "", nil)
+		checkErr(t, err, "copying manifest")
+		return resp
+	}
+
+	// copying the index by tag copies the image it refers to and its blobs
+	resp = copyManifest(url.Values{"from": {sourceName.Name()}, "reference": {"multi"}, "tag": {"release"}})
+	defer resp.Body.Close()
+	checkResponse(t, "copying manifest list", resp, http.StatusCreated)
+	checkHeaders(t, resp, http.Header{
+		"Docker-Content-Digest": []string{indexDigest.String()},
+		"Content-Length":        []string{"0"},
+	})
+
+	releaseRef, _ := reference.WithTag(destinationName, "release")
+	releaseURL, err := env.builder.BuildManifestURL(releaseRef)
+	checkErr(t, err, "building manifest url")
+	req, _ := http.NewRequest("GET", releaseURL, nil)
+	req.Header.Set("Accept", manifestlist.MediaTypeManifestList)
+	resp, err = http.DefaultClient.Do(req)
+	checkErr(t, err, "fetching copied manifest list")
+	defer resp.Body.Close()
+	checkResponse(t, "fetching copied manifest list", resp, http.StatusOK)
+	checkHeaders(t, resp, http.Header{
+		"Docker-Content-Digest": []string{indexDigest.String()},
+	})
+
+	copiedImageRef, _ := reference.WithDigest(destinationName, imageDigest)
+	copiedImageURL, err := env.builder.BuildManifestURL(copiedImageRef)
+	checkErr(t, err, "building manifest url")
+	resp, err = http.Head(copiedImageURL)
+	checkErr(t, err, "checking copied image")
+	defer resp.Body.Close()
+	checkResponse(t, "checking copied image", resp, http.StatusOK)
+
+	for _, layer := range image.FSLayers {
+		layerRef, _ := reference.WithDigest(destinationName, layer.BlobSum)
+		layerURL, err := env.builder.BuildBlobURL(layerRef)
+		checkErr(t, err, "building blob url")
+		resp, err := http.Head(layerURL)
+		checkErr(t, err, "checking copied layer")
+		defer resp.Body.Close()
+		checkResponse(t, "checking copied layer", resp, http.StatusOK)
+	}
+
+	// copying by digest does not tag the manifest
+	resp = copyManifest(url.Values{"from": {"staging/app"}, "reference": {imageDigest.String()}})
+	defer resp.Body.Close()
+	checkResponse(t, "copying manifest by digest", resp, http.StatusCreated)
+
+	for _, tc := range []struct {
+		name       string
+		values     url.Values
+		statusCode int
+		code       errcode.ErrorCode
+	}{
+		{"unknown tag", url.Values{"from": {"staging/app"}, "reference": {"missing"}}, http.StatusNotFound, v2.ErrorCodeManifestUnknown},
+		{"unknown digest", url.Values{"from": {"staging/app"}, "reference": {digest.FromString("missing").String()}}, http.StatusNotFound, v2.ErrorCodeManifestUnknown},
+		{"invalid source", url.Values{"from": {"Staging"}, "reference": {"1.0"}}, http.StatusBadRequest, v2.ErrorCodeNameInvalid},
+		{"invalid tag", url.Values{"from": {"staging/app"}, "reference": {"1.0"}, "tag": {"-bad"}}, http.StatusBadRequest, v2.ErrorCodeTagInvalid},
+	} {
+		resp := copyManifest(tc.values)
+		defer resp.Body.Close()
+		checkResponse(t, tc.name, resp, tc.statusCode)
+		checkBodyHasErrorCodes(t, tc.name, resp, tc.code)
+	}
+}
+
+func TestRepositoryDeleteAPI(t *testing.T) {
+	env := newTestEnv(t, true)
+	defer env.Shutdown()
+
+	imageName, _ := reference.WithName("foo/removed")
+	nestedName, _ := reference.WithName("foo/removed/nested")
+	createRepository(env, t, imageName.Name(), "latest")
+	createRepository(env, t, nestedName.Name(), "latest")
+
+	repositoryURL, err := env.builder.BuildRepositoryURL(imageName)
+	checkErr(t, err, "building repository url")
+
+	resp, err := httpDelete(repositoryURL)
+	checkErr(t, err, "deleting repository")
+	defer resp.Body.Close()
+	checkResponse(t, "deleting repository", resp, http.StatusAccepted)
+
+	for _, tc := range []struct {
+		name       reference.Named
+		statusCode int
+	}{
+		{imageName, http.StatusNotFound},
+		{nestedName, http.StatusOK},
+	} {
+		tagsURL, err := env.builder.BuildTagsURL(tc.name)
+		checkErr(t, err, "building tags url")
+		resp, err := http.Get(tagsURL)
+		checkErr(t, err, "fetching tags")
+		defer resp.Body.Close()
+		checkResponse(t, "fetching tags of "+tc.name.Name(), resp, tc.statusCode)
+	}
+
+	resp, err = httpDelete(repositoryURL)
+	checkErr(t, err, "deleting repository")
+	defer resp.Body.Close()
+	checkResponse(t, "deleting unknown repository", resp, http.StatusNotFound)
+	checkBodyHasErrorCodes(t, "deleting unknown repository", resp, v2.ErrorCodeNameUnknown)
+
+	// deleting requires delete to be enabled
+	env = newTestEnv(t, false)
+	defer env.Shutdown()
+	createRepository(env, t, imageName.Name(), "latest")
+
+	repositoryURL, err = env.builder.BuildRepositoryURL(imageName)
+	checkErr(t, err, "building repository url")
+	resp, err = httpDelete(repositoryURL)
+	checkErr(t, err, "deleting repository")
+	defer resp.Body.Close()
+	checkResponse(t, "deleting repository with delete disabled", resp, http.StatusMethodNotAllowed)
+}
+
+func TestRepositoryRenameAPI(t *testing.T) {
+	env := newTestEnv(t, true)
+	defer env.Shutdown()
+
+	sourceName, _ := reference.WithName("foo/source")
+	destinationName, _ := reference.WithName("foo/destination")
+	existingName, _ := reference.WithName("foo/existing")
+	dgst := createRepository(env, t, sourceName.Name(), "latest")
+	createRepository(env, t, existingName.Name(), "latest")
+
+	rename := func(to string) *http.Response {
+		renameURL, err := env.builder.BuildRenameURL(sourceName, url.Values{"to": {to}})
+		checkErr(t, err, "building rename url")
+		resp, err := http.Post(renameURL, "", nil)
+		checkErr(t, err, "renaming repository")
+		return resp
+	}
+
+	resp := rename("Invalid")
+	defer resp.Body.Close()
+	checkResponse(t, "renaming to an invalid name", resp, http.StatusBadRequest)
+	checkBodyHasErrorCodes(t, "renaming to an invalid name", resp, v2.ErrorCodeNameInvalid)
+
+	resp = rename(existingName.Name())
+	defer resp.Body.Close()
+	checkResponse(t, "renaming to an existing repository", resp, http.StatusForbidden)
+	checkBodyHasErrorCodes(t, "renaming to an existing repository", resp, errcode.ErrorCodeDenied)
+
+	resp = rename(destinationName.Name())
+	defer resp.Body.Close()
+	checkResponse(t, "renaming repository", resp, http.StatusCreated)
+	tagsURL, err := env.builder.BuildTagsURL(destinationName)
+	checkErr(t, err, "building tags url")
+	checkHeaders(t, resp, http.Header{
+		"Location":       []string{tagsURL},
+		"Content-Length": []string{"0"},
+	})
+
+	tagRef, _ := reference.WithTag(destinationName, "latest")
+	manifestURL, err := env.builder.BuildManifestURL(tagRef)
+	checkErr(t, err, "building manifest url")
+	resp, err = http.Get(manifestURL)
+	checkErr(t, err, "fetching renamed manifest")
+	defer resp.Body.Close()
+	checkResponse(t, "fetching renamed manifest", resp, http.StatusOK)
+	checkHeaders(t, resp, http.Header{
+		"Docker-Content-Digest": []string{dgst.String()},
+	})
+
+	tagsURL, err = env.builder.BuildTagsURL(sourceName)
+	checkErr(t, err, "building tags url")
+	resp, err = http.Get(tagsURL)
+	checkErr(t, err, "fetching tags")
+	defer resp.Body.Close()
+	checkResponse(t, "fetching tags of renamed repository", resp, http.StatusNotFound)
+
+	resp = rename("foo/other")
+	defer resp.Body.Close()
+	checkResponse(t, "renaming unknown repository", resp, http.StatusNotFound)
+	checkBodyHasErrorCodes(t, "renaming unknown repository", resp, v2.ErrorCodeNameUnknown)
+}
+
+func TestImmutableTagsAPI(t *testing.T) {
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"testdriver": configuration.Parameters{},
+			"delete":     configuration.Parameters{"enabled": true},
+			"maintenance": configuration.Parameters{"uploadpurging": map[interface{}]interface{}{
+				"enabled": false,
+			}},
+		},
+	}
+	config.Compatibility.Schema1.Enabled = true
+	config.HTTP.Headers = headerConfig
+	config.Policy.ImmutableTags = []configuration.ImmutableTagRule{
+		{Repository: "release/.*", Tags: []string{`1\.[0-9]+`}},
+	}
+
+	env := newTestEnvWithConfig(t, &config)
+	defer env.Shutdown()
+
+	imageName, _ := reference.WithName("release/app")
+	releaseDigest := createRepository(env, t, imageName.Name(), "1.0")
+	createRepository(env, t, imageName.Name(), "latest")
+
+	manifestURL := func(tag string) string {
+		ref, _ := reference.WithTag(imageName, tag)
+		u, err := env.builder.BuildManifestURL(ref)
+		checkErr(t, err, "building manifest url")
+		return u
+	}
+	fetchManifest := func(tag string) *schema1.SignedManifest {
+		resp, err := http.Get(manifestURL(tag))
+		checkErr(t, err, "fetching manifest")
+		defer resp.Body.Close()
+		checkResponse(t, "fetching manifest", resp, http.StatusOK)
+		var m schema1.SignedManifest
+		if err := json.NewDecoder(resp.Body).Decode(&m); err != nil {
+			t.Fatalf("unexpected error decoding manifest: %v", err)
+		}
+		return &m
+	}
+	release := fetchManifest("1.0")
+	latest := fetchManifest("latest")
+
+	// pushing the same manifest again is idempotent
+	resp := putManifest(t, "re-pushing immutable tag", manifestURL("1.0"), schema1.MediaTypeSignedManifest, release)
+	defer resp.Body.Close()
+	checkResponse(t, "re-pushing immutable tag", resp, http.StatusCreated)
+
+	resp = putManifest(t, "moving immutable tag", manifestURL("1.0"), schema1.MediaTypeSignedManifest, latest)
+	defer resp.Body.Close()
+	checkResponse(t, "moving immutable tag", resp, http.StatusForbidden)
+	checkBodyHasErrorCodes(t, "moving immutable tag", resp, errcode.ErrorCodeDenied)
+
+	// a new immutable tag may point anywhere
+	resp = putManifest(t, "pushing new immutable tag", manifestURL("1.1"), schema1.MediaTypeSignedManifest, latest)
+	defer resp.Body.Close()
+	checkResponse(t, "pushing new immutable tag", resp, http.StatusCreated)
+
+	// other tags may move freely
+	resp = putManifest(t, "moving mutable tag", manifestURL("latest"), schema1.MediaTypeSignedManifest, release)
+	defer resp.Body.Close()
+	checkResponse(t, "moving mutable tag", resp, http.StatusCreated)
+
+	copyURL, err := env.builder.BuildCopyURL(imageName, url.Values{"from": {imageName.Name()}, "reference": {"1.1"}, "tag": {"1.0"}})
+	checkErr(t, err, "building copy url")
+	resp, err = http.Post(copyURL, "", nil)
+	checkErr(t, err, "copying onto immutable tag")
+	defer resp.Body.Close()
+	checkResponse(t, "copying onto immutable tag", resp, http.StatusForbidden)
+	checkBodyHasErrorCodes(t, "copying onto immutable tag", resp, errcode.ErrorCodeDenied)
+
+	releaseRef, _ := reference.WithDigest(imageName, releaseDigest)
+	releaseDigestURL, err := env.builder.BuildManifestURL(releaseRef)
+	checkErr(t, err, "building manifest url")
+	repositoryURL, err := env.builder.BuildRepositoryURL(imageName)
+	checkErr(t, err, "building repository url")
+
+	// without an access controller, immutable tags cannot be deleted
+	for _, tc := range []struct {
+		name string
+		url  string
+	}{
+		{"deleting immutable tag", manifestURL("1.0")},
+		{"deleting manifest of immutable tag", releaseDigestURL},
+		{"deleting repository with immutable tags", repositoryURL},
+	} {
+		resp, err := httpDelete(tc.url)
+		checkErr(t, err, tc.name)
+		defer resp.Body.Close()
+		checkResponse(t, tc.name, resp, http.StatusForbidden)
+		checkBodyHasErrorCodes(t, tc.name, resp, errcode.ErrorCodeDenied)
+	}
+
+	resp, err = httpDelete(manifestURL("latest"))
+	checkErr(t, err, "deleting mutable tag")
+	defer resp.Body.Close()
+	checkResponse(t, "deleting mutable tag", resp, http.StatusAccepted)
+}
+
+func TestAdmissionAPI(t *testing.T) {
+	var requests []admissionRequest
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var request admissionRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		requests = append(requests, request)
+
+		response := admissionResponse{Allowed: true}
+		if request.Tag == "unscanned" {
+			response = admissionResponse{Message: "image has not been scanned"}
+		}
+		json.NewEncoder(w).Encode(response)
+	}))
+	defer hook.Close()
+
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"testdriver": configuration.Parameters{},
+			"maintenance": configuration.Parameters{"uploadpurging": map[interface{}]interface{}{
+				"enabled": false,
+			}},
+		},
+	}
+	config.HTTP.Headers = headerConfig
+	config.Policy.Admission = []configuration.AdmissionHook{
+		{
+			Name:         "scanner",
+			URL:          hook.URL,
+			Headers:      http.Header{"Authorization": []string{"Bearer secret"}},
+			Repositories: []string{"scanned/.*"},
+		},
+		{Name: "closed", URL: down.URL, Repositories: []string{"closed/.*"}},
+		{Name: "open", URL: down.URL, FailOpen: true, Repositories: []string{"open/.*"}},
+	}
+
+	env := newTestEnvWithConfig(t, &config)
+	defer env.Shutdown()
+
+	imageConfig := []byte(`{"config":{"Labels":{"team":"registry"}}}`)
+	configDigest := digest.FromBytes(imageConfig)
+	m, err := ocischema.FromStruct(ocischema.Manifest{
+		Versioned: ocischema.SchemaVersion,
+		Config: distribution.Descriptor{
+			MediaType: v1.MediaTypeImageConfig,
+			Size:      int64(len(imageConfig)),
+			Digest:    configDigest,
+		},
+		Layers: []distribution.Descriptor{},
+	})
+	checkErr(t, err, "creating manifest")
+	_, payload, _ := m.Payload()
+
+	pushManifest := func(name, tag string) *http.Response {
+		imageName, _ := reference.WithName(name)
+		uploadURLBase, _ := startPushLayer(t, env, imageName)
+		pushLayer(t, env.builder, imageName, configDigest, uploadURLBase, bytes.NewReader(imageConfig))
+
+		tagRef, _ := reference.WithTag(imageName, tag)
+		manifestURL, err := env.builder.BuildManifestURL(tagRef)
+		checkErr(t, err, "building manifest url")
+		return putManifest(t, "putting manifest", manifestURL, v1.MediaTypeImageManifest, m)
+	}
+
+	resp := pushManifest("scanned/app", "latest")
+	defer resp.Body.Close()
+	checkResponse(t, "putting admitted manifest", resp, http.StatusCreated)
+
+	if len(requests) != 1 {
+		t.Fatalf("expected 1 admission request, got %d", len(requests))
+	}
+	request := requests[0]
+	if request.Repository != "scanned/app" || request.Tag != "latest" || request.Digest != digest.FromBytes(payload) || request.MediaType != v1.MediaTypeImageManifest {
+		t.Fatalf("unexpected admission request: %+v", request)
+	}
+	// the manifest is embedded as JSON, so it is compacted
+	var compacted bytes.Buffer
+	checkErr(t, json.Compact(&compacted, payload), "compacting manifest")
+	if !bytes.Equal(request.Manifest, compacted.Bytes()) || !bytes.Equal(request.Config, imageConfig) {
+		t.Fatalf("unexpected manifest or config in admission request: %s, %s", request.Manifest, request.Config)
+	}
+
+	resp = pushManifest("scanned/app", "unscanned")
+	defer resp.Body.Close()
+	checkResponse(t, "putting denied manifest", resp, http.StatusForbidden)
+	errs, _, _ := checkBodyHasErrorCodes(t, "putting denied manifest", resp, errcode.ErrorCodeDenied)
+	if errs[0].(errcode.Error).Message != "image has not been scanned" {
+		t.Fatalf("unexpected denial message: %v", errs[0])
+	}
+
+	for _, tc := range []struct {
+		name       string
+		statusCode int
+	}{
+		{"other/app", http.StatusCreated},
+		{"closed/app", http.StatusServiceUnavailable},
+		{"open/app", http.StatusCreated},
+	} {
+		resp := pushManifest(tc.name, "latest")
+		defer resp.Body.Close()
+		checkResponse(t, "putting manifest to "+tc.name, resp, tc.statusCode)
+	}
+
+	if len(requests) != 2 {
+		t.Fatalf("expected only pushes to matching repositories to be admitted, got %d requests", len(requests))
+	}
+}
+
+func TestSignaturePolicyAPI(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	checkErr(t, err, "generating key")
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	checkErr(t, err, "marshaling public key")
+	keyPath := filepath.Join(t.TempDir(), "cosign.pub")
+	checkErr(t, os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0o600), "writing public key")
+
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"testdriver": configuration.Parameters{},
+			"delete":     configuration.Parameters{"enabled": true},
+			"maintenance": configuration.Parameters{"uploadpurging": map[interface{}]interface{}{
+				"enabled": false,
+			}},
+		},
+	}
+	config.HTTP.Headers = headerConfig
+	config.Policy.Signatures = []configuration.SignaturePolicy{
+		{Repositories: []string{"signed/.*"}, Keys: []string{keyPath}, VerifyOnPull: true},
+	}
+
+	env := newTestEnvWithConfig(t, &config)
+	defer env.Shutdown()
+
+	imageName, _ := reference.WithName("signed/app")
+
+	pushBlob := func(p []byte) distribution.Descriptor {
+		dgst := digest.FromBytes(p)
+		uploadURLBase, _ := startPushLayer(t, env, imageName)
+		pushLayer(t, env.builder, imageName, dgst, uploadURLBase, bytes.NewReader(p))
+		return distribution.Descriptor{Size: int64(len(p)), Digest: dgst}
+	}
+	manifestURL := func(ref string) string {
+		var r reference.Named
+		if dgst, err := digest.Parse(ref); err == nil {
+			r, _ = reference.WithDigest(imageName, dgst)
+		} else {
+			r, _ = reference.WithTag(imageName, ref)
+		}
+		u, err := env.builder.BuildManifestURL(r)
+		checkErr(t, err, "building manifest url")
+		return u
+	}
+	pushManifest := func(ref string, layers ...distribution.Descriptor) (*http.Response, digest.Digest) {
+		configDesc := pushBlob([]byte("{}"))
+		configDesc.MediaType = v1.MediaTypeImageConfig
+		m, err := ocischema.FromStruct(ocischema.Manifest{
+			Versioned: ocischema.SchemaVersion,
+			Config:    configDesc,
+			Layers:    append([]distribution.Descriptor{}, layers...),
+		})
+		checkErr(t, err, "creating manifest")
+		_, payload, _ := m.Payload()
+		dgst := digest.FromBytes(payload)
+		if ref == "" {
+			ref = dgst.String()
+		}
+		return putManifest(t, "putting manifest", manifestURL(ref), v1.MediaTypeImageManifest, m), dgst
+	}
+	getManifest := func(ref string) *http.Response {
+		req, _ := http.NewRequest("GET", manifestURL(ref), nil)
+		req.Header.Set("Accept", v1.MediaTypeImageManifest)
+		resp, err := http.DefaultClient.Do(req)
+		checkErr(t, err, "fetching manifest")
+		return resp
+	}
+
+	resp, dgst := pushManifest("")
+	defer resp.Body.Close()
+	checkResponse(t, "putting manifest by digest", resp, http.StatusCreated)
+
+	resp, _ = pushManifest("latest")
+	defer resp.Body.Close()
+	checkResponse(t, "tagging unsigned manifest", resp, http.StatusForbidden)
+	checkBodyHasErrorCodes(t, "tagging unsigned manifest", resp, errcode.ErrorCodeDenied)
+
+	signatureLayer := func(dgst digest.Digest) distribution.Descriptor {
+		payload := []byte(fmt.Sprintf(`{"critical":{"image":{"docker-manifest-digest":"%s"}}}`, dgst))
+		sum := sha256.Sum256(payload)
+		sig, err := ecdsa.SignASN1(rand.Reader, key, sum[:])
+		checkErr(t, err, "signing payload")
+		payloadDesc := pushBlob(payload)
+		payloadDesc.MediaType = signature.SimpleSigningMediaType
+		payloadDesc.Annotations = map[string]string{signature.SignatureAnnotation: base64.StdEncoding.EncodeToString(sig)}
+		return payloadDesc
+	}
+
+	// other manifests are checked under a signature tag
+	resp, _ = pushManifest(signature.SignatureTag(dgst), pushBlob([]byte("not a signature")))
+	defer resp.Body.Close()
+	checkResponse(t, "putting image under signature tag", resp, http.StatusForbidden)
+	checkBodyHasErrorCodes(t, "putting image under signature tag", resp, errcode.ErrorCodeDenied)
+
+	missing := digest.FromString("missing manifest")
+	resp, _ = pushManifest(signature.SignatureTag(missing), signatureLayer(missing))
+	defer resp.Body.Close()
+	checkResponse(t, "putting signature of missing manifest", resp, http.StatusForbidden)
+	checkBodyHasErrorCodes(t, "putting signature of missing manifest", resp, errcode.ErrorCodeDenied)
+
+	repo, err := env.app.registry.Repository(env.app, imageName)
+	checkErr(t, err, "getting repository")
+	checkErr(t, repo.Tags(env.app).Tag(env.app, signature.SignatureTag(dgst), distribution.Descriptor{Digest: dgst}), "tagging image under signature tag")
+	resp = getManifest(signature.SignatureTag(dgst))
+	defer resp.Body.Close()
+	checkResponse(t, "fetching image under signature tag", resp, http.StatusForbidden)
+	checkBodyHasErrorCodes(t, "fetching image under signature tag", resp, errcode.ErrorCodeDenied)
+
+	// the signature manifest itself is exempt
+	resp, _ = pushManifest(signature.SignatureTag(dgst), signatureLayer(dgst))
+	defer resp.Body.Close()
+	checkResponse(t, "putting signature", resp, http.StatusCreated)
+
+	resp = getManifest(signature.SignatureTag(dgst))
+	defer resp.Body.Close()
+	checkResponse(t, "fetching signature", resp, http.StatusOK)
+
+	resp, _ = pushManifest("latest")
+	defer resp.Body.Close()
+	checkResponse(t, "tagging signed manifest", resp, http.StatusCreated)
+
+	resp = getManifest("latest")
+	defer resp.Body.Close()
+	checkResponse(t, "fetching signed manifest", resp, http.StatusOK)
+
+	resp, err = httpDelete(manifestURL(signature.SignatureTag(dgst)))
+	checkErr(t, err, "deleting signature")
+	defer resp.Body.Close()
+	checkResponse(t, "deleting signature", resp, http.StatusAccepted)
+
+	resp = getManifest("latest")
+	defer resp.Body.Close()
+	checkResponse(t, "fetching unsigned manifest", resp, http.StatusForbidden)
+	checkBodyHasErrorCodes(t, "fetching unsigned manifest", resp, errcode.ErrorCodeDenied)
+
+	// pulling by digest is not checked
+	resp = getManifest(dgst.String())
+	defer resp.Body.Close()
+	checkResponse(t, "fetching manifest by digest", resp, http.StatusOK)
+}
+
+// newPolicyTestEnv starts a registry authenticating alice with the password
+// "secret" against htpasswd, and authorizing her with the given policy. The
+// configure functions may adjust the configuration before the registry starts.
+func newPolicyTestEnv(t *testing.T, policy string, configure ...func(*configuration.Configuration)) *testEnv {
+	dir := t.TempDir()
+	htpasswdPath := filepath.Join(dir, "htpasswd")
+	policyPath := filepath.Join(dir, "policy.yml")
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(htpasswdPath, []byte("alice:"+string(hash)+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(policyPath, []byte(policy), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"testdriver": configuration.Parameters{},
+			"maintenance": configuration.Parameters{"uploadpurging": map[interface{}]interface{}{
+				"enabled": false,
+			}},
+		},
+		Auth: configuration.Auth{
+			"htpasswd": configuration.Parameters{
+				"realm":  "registry-test",
+				"path":   htpasswdPath,
+				"policy": policyPath,
+			},
+		},
+	}
+	config.HTTP.Headers = headerConfig
+	for _, fn := range configure {
+		fn(&config)
+	}
+
+	return newTestEnvWithConfig(t, &config)
+}
+
+// TestImmutableTagsOverride checks that immutable tags can only be deleted
+// when the policy grants the "*" action on the repository.
+func TestImmutableTagsOverride(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		policy   string
+		noPolicy bool
+		status   int
+	}{
+		{
+			name:   "delete action",
+			policy: "rules:\n  - users: [alice]\n    repositories: [\"release/**\"]\n    actions: [pull, push, delete]\n",
+			status: http.StatusForbidden,
+		},
+		{
+			name:   "all actions",
+			policy: "rules:\n  - users: [alice]\n    repositories: [\"release/**\"]\n    actions: [\"*\"]\n",
+			status: http.StatusAccepted,
+		},
+		{
+			name:     "no policy",
+			noPolicy: true,
+			status:   http.StatusForbidden,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			env := newPolicyTestEnv(t, tc.policy, func(config *configuration.Configuration) {
+				config.Storage["delete"] = configuration.Parameters{"enabled": true}
+				config.Policy.ImmutableTags = []configuration.ImmutableTagRule{
+					{Repository: "release/.*", Tags: []string{`1\.[0-9]+`}},
+				}
+				if tc.noPolicy {
+					delete(config.Auth["htpasswd"], "policy")
+				}
+			})
+			defer env.Shutdown()
+
+			imageName, _ := reference.WithName("release/app")
+			repo, err := env.app.registry.Repository(env.app, imageName)
+			checkErr(t, err, "getting repository")
+			checkErr(t, repo.Tags(env.app).Tag(env.app, "1.0", distribution.Descriptor{Digest: digest.FromString("release")}), "tagging release")
+
+			ref, _ := reference.WithTag(imageName, "1.0")
+			manifestURL, err := env.builder.BuildManifestURL(ref)
+			checkErr(t, err, "building manifest url")
+
+			req, err := http.NewRequest(http.MethodDelete, manifestURL, nil)
+			checkErr(t, err, "creating delete request")
+			req.SetBasicAuth("alice", "secret")
+			resp, err := http.DefaultClient.Do(req)
+			checkErr(t, err, "deleting immutable tag")
+			defer resp.Body.Close()
+			checkResponse(t, "deleting immutable tag", resp, tc.status)
+		})
+	}
+}
+
+// TestCopyAPISourceFromQuery checks that pull access is checked against the
+// source repository the copy reads from, which is taken from the query even
+// when a form in the body names another one.
+func TestCopyAPISourceFromQuery(t *testing.T) {
+	env := newPolicyTestEnv(t, "rules:\n  - users: [alice]\n    repositories: [\"prod/**\"]\n    actions: [pull, push]\n  - users: [alice]\n    repositories: [\"public/**\"]\n    actions: [pull]\n")
+	defer env.Shutdown()
+
+	destinationName, _ := reference.WithName("prod/app")
+	copyURL, err := env.builder.BuildCopyURL(destinationName, url.Values{"from": {"secret/app"}, "reference": {"1.0"}, "tag": {"1.0"}})
+	checkErr(t, err, "building copy url")
+
+	req, err := http.NewRequest(http.MethodPost, copyURL, strings.NewReader(url.Values{"from": {"public/app"}}.Encode()))
+	checkErr(t, err, "creating copy request")
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth("alice", "secret")
+	resp, err := http.DefaultClient.Do(req)
+	checkErr(t, err, "copying manifest")
+	defer resp.Body.Close()
+	checkResponse(t, "copying from a repository named differently in the body", resp, http.StatusUnauthorized)
+}
+
+// TestRenameAPIDestinationFromQuery checks that push access is checked
+// against the repository the rename writes to, which is taken from the
+// query even when a form in the body names another one.
+func TestRenameAPIDestinationFromQuery(t *testing.T) {
+	env := newPolicyTestEnv(t, "rules:\n  - users: [alice]\n    repositories: [\"team/**\"]\n    actions: [pull, push, delete]\n")
+	defer env.Shutdown()
+
+	sourceName, _ := reference.WithName("team/app")
+	renameURL, err := env.builder.BuildRenameURL(sourceName, url.Values{"to": {"other/app"}})
+	checkErr(t, err, "building rename url")
+
+	req, err := http.NewRequest(http.MethodPost, renameURL, strings.NewReader(url.Values{"to": {"team/renamed"}}.Encode()))
+	checkErr(t, err, "creating rename request")
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth("alice", "secret")
+	resp, err := http.DefaultClient.Do(req)
+	checkErr(t, err, "renaming repository")
+	defer resp.Body.Close()
+	checkResponse(t, "renaming to a repository named differently in the body", resp, http.StatusUnauthorized)
+}
+
+// newTokenIssuerTestEnv starts a registry with token authentication, issuing
+// tokens to alice with the password "secret" as authorized by the given
+// htpasswd policy, if any.
+func newTokenIssuerTestEnv(t *testing.T, policy string) *testEnv {
+	dir := t.TempDir()
+	htpasswdPath := filepath.Join(dir, "htpasswd")
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(htpasswdPath, []byte("alice:"+string(hash)+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	authenticator := configuration.Parameters{"path": htpasswdPath}
+	if policy != "" {
+		policyPath := filepath.Join(dir, "policy.yml")
+		if err := os.WriteFile(policyPath, []byte(policy), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		authenticator["policy"] = policyPath
+	}
+
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"testdriver": configuration.Parameters{},
+			"maintenance": configuration.Parameters{"uploadpurging": map[interface{}]interface{}{
+				"enabled": false,
+			}},
+		},
+		Auth: configuration.Auth{
+			"token": configuration.Parameters{
+				"realm":   "https://registry.example.com/auth/token",
+				"service": "registry-test",
+			},
+		},
+		TokenIssuer: configuration.TokenIssuer{
+			Enabled:       true,
+			Authenticator: configuration.Auth{"htpasswd": authenticator},
+		},
+	}
+	config.HTTP.Headers = headerConfig
+
+	return newTestEnvWithConfig(t, &config)
+}
+
+// getIssuedToken requests a token for the service and scopes from the token
+// issuer of the registry, and returns the response along with the token if
+// one was issued.
+func getIssuedToken(t *testing.T, env *testEnv, service, username, password string, scopes ...string) (*http.Response, string) {
+	values := url.Values{"service": []string{service}, "scope": scopes}
+	req, err := http.NewRequest(http.MethodGet, env.server.URL+"/auth/token?"+values.Encode(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if username != "" {
+		req.SetBasicAuth(username, password)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		Token string `json:"token"`
+	}
+	if resp.StatusCode == http.StatusOK {
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return resp, body.Token
+}
+
+// listTagsWithToken lists the tags of the repository with the bearer token
+// and checks the status of the response.
+func listTagsWithToken(t *testing.T, env *testEnv, name, token string, status int) {
+	ref, _ := reference.WithName(name)
+	u, err := env.builder.BuildTagsURL(ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	checkResponse(t, "listing tags of "+name, resp, status)
+}
+
+func TestTokenIssuerAPI(t *testing.T) {
+	env := newTokenIssuerTestEnv(t, "rules:\n  - users: [alice]\n    repositories: [\"foo/**\"]\n    actions: [pull, push]\n")
+	defer env.Shutdown()
+
+	baseURL, err := env.builder.BuildBaseURL()
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.Get(baseURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	checkResponse(t, "getting base url without a token", resp, http.StatusUnauthorized)
+	if challenge := resp.Header.Get("WWW-Authenticate"); !strings.HasPrefix(challenge, "Bearer ") {
+		t.Fatalf("expected bearer challenge, got %q", challenge)
+	}
+
+	resp, _ = getIssuedToken(t, env, "registry-test", "", "")
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("unexpected status getting token without credentials: %s", resp.Status)
+	}
+	if challenge := resp.Header.Get("WWW-Authenticate"); !strings.HasPrefix(challenge, "Basic ") {
+		t.Fatalf("expected basic challenge, got %q", challenge)
+	}
+	resp, _ = getIssuedToken(t, env, "registry-test", "alice", "wrong")
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("unexpected status getting token with the wrong password: %s", resp.Status)
+	}
+	for _, service := range []string{"other", ""} {
+		resp, _ = getIssuedToken(t, env, service, "alice", "secret", "repository:foo/bar:pull")
+		if resp.StatusCode != http.StatusForbidden {
+			t.Fatalf("unexpected status getting token for service %q: %s", service, resp.Status)
+		}
+	}
+
+	resp, token := getIssuedToken(t, env, "registry-test", "alice", "secret", "repository:foo/bar:pull,push", "repository:baz/qux:pull")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected status getting token: %s", resp.Status)
+	}
+
+	// the repository is unknown, but access to it is granted
+	listTagsWithToken(t, env, "foo/bar", token, http.StatusNotFound)
+	// access to the repository is denied by the policy
+	listTagsWithToken(t, env, "baz/qux", token, http.StatusUnauthorized)
+
+	resp, err = http.PostForm(env.server.URL+"/auth/token", url.Values{
+		"grant_type": []string{"password"},
+		"username":   []string{"alice"},
+		"password":   []string{"secret"},
+		"service":    []string{"registry-test"},
+		"scope":      []string{"repository:foo/bar:pull"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected status getting token with a password grant: %s", resp.Status)
+	}
+}
+
+func TestTokenIssuerWithoutPolicyAPI(t *testing.T) {
+	env := newTokenIssuerTestEnv(t, "")
+	defer env.Shutdown()
+
+	resp, token := getIssuedToken(t, env, "registry-test", "alice", "secret", "repository:foo/bar:pull")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected status getting token: %s", resp.Status)
+	}
+	listTagsWithToken(t, env, "foo/bar", token, http.StatusUnauthorized)
+}
+
+func TestRobotAccountsAPI(t *testing.T) {
+	dir := t.TempDir()
+	htpasswdPath := filepath.Join(dir, "htpasswd")
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(htpasswdPath, []byte("alice:"+string(hash)+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	actors := make(chan string, 16)
+	notificationServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var envelope struct {
+			Events []notifications.Event `json:"events"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&envelope); err != nil {
+			t.Errorf("error decoding notification: %v", err)
+		}
+		for _, event := range envelope.Events {
+			actors <- event.Actor.Name
+		}
+	}))
+	defer notificationServer.Close()
+
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"testdriver": configuration.Parameters{},
+			"maintenance": configuration.Parameters{"uploadpurging": map[interface{}]interface{}{
+				"enabled": false,
+			}},
+		},
+		Auth: configuration.Auth{
+			"htpasswd": configuration.Parameters{
+				"realm": "registry-test",
+				"path":  htpasswdPath,
+			},
+		},
+		Robots: configuration.Robots{Enabled: true},
+	}
+	config.Notifications.Endpoints = []configuration.Endpoint{{
+		Name:      "test",
+		URL:       notificationServer.URL,
+		Timeout:   time.Second,
+		Threshold: 1,
+		Backoff:   time.Second,
+	}}
+	config.HTTP.Headers = headerConfig
+
+	env := newTestEnvWithConfig(t, &config)
+	defer env.Shutdown()
+
+	do := func(method, u, username, password string, body io.Reader) *http.Response {
+		req, err := http.NewRequest(method, u, body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if username != "" {
+			req.SetBasicAuth(username, password)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	robotsURL, err := env.builder.BuildRobotsURL()
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp := do(http.MethodPost, robotsURL, "", "", strings.NewReader(`{"name": "ci"}`))
+	resp.Body.Close()
+	checkResponse(t, "creating robot account without credentials", resp, http.StatusUnauthorized)
+
+	resp = do(http.MethodPost, robotsURL, "alice", "secret", strings.NewReader(`{"name": "ci", "actions": ["admin"]}`))
+	defer resp.Body.Close()
+	checkResponse(t, "creating invalid robot account", resp, http.StatusBadRequest)
+	checkBodyHasErrorCodes(t, "creating invalid robot account", resp, v2.ErrorCodeRobotInvalid)
+
+	resp = do(http.MethodPost, robotsURL, "alice", "secret", strings.NewReader(`{"name": "ci", "repositories": ["foo/**"], "actions": ["pull", "push"]}`))
+	defer resp.Body.Close()
+	checkResponse(t, "creating robot account", resp, http.StatusCreated)
+	var created struct {
+		Name   string `json:"name"`
+		Secret string `json:"secret"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
+		t.Fatal(err)
+	}
+	if created.Name != "ci" || created.Secret == "" {
+		t.Fatalf("unexpected robot account %+v", created)
+	}
+	robotURL, err := env.builder.BuildRobotURL("ci")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if location := resp.Header.Get("Location"); location != robotURL {
+		t.Fatalf("expected location %q, got %q", robotURL, location)
+	}
+
+	// the robot account may push to the repositories matching its patterns
+	fooBar, _ := reference.WithName("foo/bar")
+	uploadURL, err := env.builder.BuildBlobUploadURL(fooBar)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp = do(http.MethodPost, uploadURL, "robot$ci", "wrong", nil)
+	resp.Body.Close()
+	checkResponse(t, "starting upload with the wrong robot secret", resp, http.StatusUnauthorized)
+
+	resp = do(http.MethodPost, uploadURL, "robot$ci", created.Secret, nil)
+	resp.Body.Close()
+	checkResponse(t, "starting upload as robot account", resp, http.StatusAccepted)
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := []byte("robot layer")
+	query := location.Query()
+	query.Set("digest", digest.FromBytes(content).String())
+	location.RawQuery = query.Encode()
+	resp = do(http.MethodPut, location.String(), "robot$ci", created.Secret, bytes.NewReader(content))
+	resp.Body.Close()
+	checkResponse(t, "completing upload as robot account", resp, http.StatusCreated)
+
+	select {
+	case actor := <-actors:
+		if actor != "robot$ci" {
+			t.Fatalf("expected the push to be attributed to robot$ci, got %q", actor)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for push notification")
+	}
+
+	// other repositories and the robot accounts API are denied
+	bazQux, _ := reference.WithName("baz/qux")
+	otherUploadURL, err := env.builder.BuildBlobUploadURL(bazQux)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp = do(http.MethodPost, otherUploadURL, "robot$ci", created.Secret, nil)
+	resp.Body.Close()
+	checkResponse(t, "starting upload to another repository as robot account", resp, http.StatusForbidden)
+	resp = do(http.MethodGet, robotsURL, "robot$ci", created.Secret, nil)
+	resp.Body.Close()
+	checkResponse(t, "listing robot accounts as robot account", resp, http.StatusForbidden)
+
+	resp = do(http.MethodGet, robotURL, "alice", "secret", nil)
+	defer resp.Body.Close()
+	checkResponse(t, "getting robot account", resp, http.StatusOK)
+	var account storage.RobotAccount
+	if err := json.NewDecoder(resp.Body).Decode(&account); err != nil {
+		t.Fatal(err)
+	}
+	if account.LastUsed == nil {
+		t.Fatalf("expected the last use of the robot account to be recorded, got %+v", account)
+	}
+
+	resp = do(http.MethodGet, robotsURL, "alice", "secret", nil)
+	defer resp.Body.Close()
+	checkResponse(t, "listing robot accounts", resp, http.StatusOK)
+	var list struct {
+		Robots []storage.RobotAccount `json:"robots"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Robots) != 1 || list.Robots[0].Name != "ci" {
+		t.Fatalf("unexpected robot accounts %+v", list.Robots)
+	}
+
+	resp = do(http.MethodDelete, robotURL, "alice", "secret", nil)
+	resp.Body.Close()
+	checkResponse(t, "revoking robot account", resp, http.StatusAccepted)
+	resp = do(http.MethodGet, robotURL, "alice", "secret", nil)
+	defer resp.Body.Close()
+	checkResponse(t, "getting revoked robot account", resp, http.StatusNotFound)
+	checkBodyHasErrorCodes(t, "getting revoked robot account", resp, v2.ErrorCodeRobotUnknown)
+
+	resp = do(http.MethodPost, uploadURL, "robot$ci", created.Secret, nil)
+	resp.Body.Close()
+	checkResponse(t, "starting upload as revoked robot account", resp, http.StatusUnauthorized)
+}
+
+func TestAnonymousPullAPI(t *testing.T) {
+	dir := t.TempDir()
+	htpasswdPath := filepath.Join(dir, "htpasswd")
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(htpasswdPath, []byte("alice:"+string(hash)+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	actors := make(chan string, 16)
+	notificationServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var envelope struct {
+			Events []notifications.Event `json:"events"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&envelope); err != nil {
+			t.Errorf("error decoding notification: %v", err)
+		}
+		for _, event := range envelope.Events {
+			actors <- event.Actor.Name
+		}
+	}))
+	defer notificationServer.Close()
+
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"testdriver": configuration.Parameters{},
+			"maintenance": configuration.Parameters{"uploadpurging": map[interface{}]interface{}{
+				"enabled": false,
+			}},
+		},
+		Auth: configuration.Auth{
+			"htpasswd": configuration.Parameters{
+				"realm": "registry-test",
+				"path":  htpasswdPath,
+				"anonymous": map[interface{}]interface{}{
+					"repositories": []interface{}{"public/**"},
+					"catalog":      true,
+				},
+			},
+		},
+	}
+	config.Notifications.Endpoints = []configuration.Endpoint{{
+		Name:      "test",
+		URL:       notificationServer.URL,
+		Timeout:   time.Second,
+		Threshold: 1,
+		Backoff:   time.Second,
+	}}
+	config.HTTP.Headers = headerConfig
+
+	env := newTestEnvWithConfig(t, &config)
+	defer env.Shutdown()
+
+	do := func(method, u string, authenticated bool, body io.Reader) *http.Response {
+		req, err := http.NewRequest(method, u, body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if authenticated {
+			req.SetBasicAuth("alice", "secret")
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+	expectActor := func(expected string) {
+		select {
+		case actor := <-actors:
+			if actor != expected {
+				t.Fatalf("expected event actor %q, got %q", expected, actor)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for notification")
+		}
+	}
+
+	publicApp, _ := reference.WithName("public/app")
+	uploadURL, err := env.builder.BuildBlobUploadURL(publicApp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkResponse(t, "starting anonymous upload", do(http.MethodPost, uploadURL, false, nil), http.StatusUnauthorized)
+
+	resp := do(http.MethodPost, uploadURL, true, nil)
+	checkResponse(t, "starting upload", resp, http.StatusAccepted)
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := []byte("public layer")
+	dgst := digest.FromBytes(content)
+	query := location.Query()
+	query.Set("digest", dgst.String())
+	location.RawQuery = query.Encode()
+	checkResponse(t, "completing upload", do(http.MethodPut, location.String(), true, bytes.NewReader(content)), http.StatusCreated)
+	expectActor("alice")
+
+	ref, _ := reference.WithDigest(publicApp, dgst)
+	blobURL, err := env.builder.BuildBlobURL(ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkResponse(t, "pulling anonymously", do(http.MethodGet, blobURL, false, nil), http.StatusOK)
+	expectActor(anonymous.Username)
+	checkResponse(t, "deleting anonymously", do(http.MethodDelete, blobURL, false, nil), http.StatusUnauthorized)
+
+	privateApp, _ := reference.WithName("private/app")
+	ref, _ = reference.WithDigest(privateApp, dgst)
+	privateBlobURL, err := env.builder.BuildBlobURL(ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkResponse(t, "pulling anonymously from a private repository", do(http.MethodGet, privateBlobURL, false, nil), http.StatusUnauthorized)
+
+	catalogURL, err := env.builder.BuildCatalogURL()
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkResponse(t, "listing the catalog anonymously", do(http.MethodGet, catalogURL, false, nil), http.StatusOK)
+
+	baseURL, err := env.builder.BuildBaseURL()
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkResponse(t, "checking the api anonymously", do(http.MethodGet, baseURL, false, nil), http.StatusUnauthorized)
+}
+
+func TestAuditLog(t *testing.T) {
+	dir := t.TempDir()
+	htpasswdPath := filepath.Join(dir, "htpasswd")
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(htpasswdPath, []byte("alice:"+string(hash)+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	auditPath := filepath.Join(dir, "audit.log")
+
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"testdriver": configuration.Parameters{},
+			"maintenance": configuration.Parameters{"uploadpurging": map[interface{}]interface{}{
+				"enabled": false,
+			}},
+		},
+		Auth: configuration.Auth{
+			"htpasswd": configuration.Parameters{
+				"realm": "registry-test",
+				"path":  htpasswdPath,
+			},
+		},
+		Audit: configuration.Audit{
+			Exclude: configuration.AuditExclude{Methods: []string{"HEAD"}},
+			File:    configuration.AuditFile{Path: auditPath},
+		},
+	}
+	config.HTTP.Headers = headerConfig
+
+	env := newTestEnvWithConfig(t, &config)
+	defer env.Shutdown()
+
+	do := func(method, u, username, password string, body io.Reader) *http.Response {
+		req, err := http.NewRequest(method, u, body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if username != "" {
+			req.SetBasicAuth(username, password)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	fooBar, _ := reference.WithName("foo/bar")
+	uploadURL, err := env.builder.BuildBlobUploadURL(fooBar)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkResponse(t, "starting upload with the wrong password", do(http.MethodPost, uploadURL, "alice", "wrong", nil), http.StatusUnauthorized)
+
+	resp := do(http.MethodPost, uploadURL, "alice", "secret", nil)
+	checkResponse(t, "starting upload", resp, http.StatusAccepted)
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := []byte("audited layer")
+	dgst := digest.FromBytes(content)
+	query := location.Query()
+	query.Set("digest", dgst.String())
+	location.RawQuery = query.Encode()
+	checkResponse(t, "completing upload", do(http.MethodPut, location.String(), "alice", "secret", bytes.NewReader(content)), http.StatusCreated)
+
+	ref, _ := reference.WithDigest(fooBar, dgst)
+	blobURL, err := env.builder.BuildBlobURL(ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkResponse(t, "checking blob", do(http.MethodHead, blobURL, "alice", "secret", nil), http.StatusOK)
+	checkResponse(t, "pulling blob", do(http.MethodGet, blobURL, "alice", "secret", nil), http.StatusOK)
+
+	data, err := os.ReadFile(auditPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var records []audit.Record
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var record audit.Record
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("error decoding audit record %q: %v", line, err)
+		}
+		records = append(records, record)
+	}
+
+	expected := []audit.Record{
+		{User: "alice", Method: http.MethodPost, Action: "pull", Decision: audit.Denied, Reason: auth.ErrAuthenticationFailure.Error(), Status: http.StatusUnauthorized},
+		{User: "alice", Method: http.MethodPost, Action: "push", Decision: audit.Denied, Reason: auth.ErrAuthenticationFailure.Error(), Status: http.StatusUnauthorized},
+		{User: "alice", Method: http.MethodPost, Action: "pull", Decision: audit.Allowed, Status: http.StatusAccepted},
+		{User: "alice", Method: http.MethodPost, Action: "push", Decision: audit.Allowed, Status: http.StatusAccepted},
+		{User: "alice", Method: http.MethodPut, Action: "pull", Digest: dgst, Decision: audit.Allowed, Status: http.StatusCreated},
+		{User: "alice", Method: http.MethodPut, Action: "push", Digest: dgst, Decision: audit.Allowed, Status: http.StatusCreated},
+		{User: "alice", Method: http.MethodGet, Action: "pull", Digest: dgst, Decision: audit.Allowed, Status: http.StatusOK},
+	}
+	if len(records) != len(expected) {
+		t.Fatalf("expected %d audit records, got %d: %s", len(expected), len(records), data)
+	}
+	for i, record := range records {
+		if record.Time.IsZero() || record.RemoteAddr == "" || record.RequestID == "" {
+			t.Fatalf("expected audit record %d to identify the request, got %+v", i, record)
+		}
+		record.Time, record.RemoteAddr, record.RequestID = time.Time{}, "", ""
+		if expected[i].Reason != "" && strings.HasSuffix(record.Reason, expected[i].Reason) {
+			// the reason is the error of the access controller, which
+			// describes the challenge.
+			record.Reason = expected[i].Reason
+		}
+		expected[i].Type, expected[i].Name = "repository", "foo/bar"
+		if record != expected[i] {
+			t.Fatalf("unexpected audit record %d: %+v != %+v", i, record, expected[i])
+		}
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	dir := t.TempDir()
+	htpasswdPath := filepath.Join(dir, "htpasswd")
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(htpasswdPath, []byte("alice:"+string(hash)+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"testdriver": configuration.Parameters{},
+			"maintenance": configuration.Parameters{"uploadpurging": map[interface{}]interface{}{
+				"enabled": false,
+			}},
+		},
+		Auth: configuration.Auth{
+			"htpasswd": configuration.Parameters{
+				"realm": "registry-test",
+				"path":  htpasswdPath,
+			},
+		},
+		RateLimit: configuration.RateLimit{
+			Limits: []configuration.RateLimitRule{
+				{Key: "user", Budget: "manifests", Rate: 0.001, Burst: 2},
+				{Key: "ip", Budget: "blobbytes", Rate: 0.001, Burst: 10},
+			},
+		},
+	}
+	config.HTTP.Headers = headerConfig
+
+	env := newTestEnvWithConfig(t, &config)
+	defer env.Shutdown()
+
+	do := func(method, u string, body io.Reader) *http.Response {
+		req, err := http.NewRequest(method, u, body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.SetBasicAuth("alice", "secret")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+	checkTooManyRequests := func(msg string, resp *http.Response) {
+		defer resp.Body.Close()
+		checkResponse(t, msg, resp, http.StatusTooManyRequests)
+		checkBodyHasErrorCodes(t, msg, resp, errcode.ErrorCodeTooManyRequests)
+		if retryAfter, err := strconv.Atoi(resp.Header.Get("Retry-After")); err != nil || retryAfter < 1 {
+			t.Fatalf("%s: expected a Retry-After header, got %q", msg, resp.Header.Get("Retry-After"))
+		}
+	}
+
+	fooBar, _ := reference.WithName("foo/bar")
+	tagRef, _ := reference.WithTag(fooBar, "latest")
+	manifestURL, err := env.builder.BuildManifestURL(tagRef)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		resp := do(http.MethodGet, manifestURL, nil)
+		resp.Body.Close()
+		checkResponse(t, "getting manifest", resp, http.StatusNotFound)
+	}
+	checkTooManyRequests("getting manifest over the limit", do(http.MethodGet, manifestURL, nil))
+
+	// blob bytes are charged once served, leaving the bucket in debt
+	uploadURL, err := env.builder.BuildBlobUploadURL(fooBar)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp := do(http.MethodPost, uploadURL, nil)
+	resp.Body.Close()
+	checkResponse(t, "starting upload", resp, http.StatusAccepted)
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := []byte("twenty bytes of blob")
+	dgst := digest.FromBytes(content)
+	query := location.Query()
+	query.Set("digest", dgst.String())
+	location.RawQuery = query.Encode()
+	resp = do(http.MethodPut, location.String(), bytes.NewReader(content))
+	resp.Body.Close()
+	checkResponse(t, "completing upload", resp, http.StatusCreated)
+
+	ref, _ := reference.WithDigest(fooBar, dgst)
+	blobURL, err := env.builder.BuildBlobURL(ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkTooManyRequests("pulling blob over the limit", do(http.MethodGet, blobURL, nil))
+
+	// a forged X-Forwarded-For header does not get another bucket
+	req, err := http.NewRequest(http.MethodGet, blobURL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.SetBasicAuth("alice", "secret")
+	req.Header.Set("X-Forwarded-For", "192.0.2.1")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkTooManyRequests("pulling blob over the limit with a forwarded ip", resp)
+}
+
+func TestManifestPayloadSizeLimit(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		payloadSize int64
+		bodySize    int
+		max         int64
+	}{
+		{name: "configured limit", payloadSize: 64, bodySize: 128, max: 64},
+		{name: "configured limit above the cap", payloadSize: 2 * maxManifestBodySize, bodySize: maxManifestBodySize + 1, max: maxManifestBodySize},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			config := configuration.Configuration{
+				Storage: configuration.Storage{
+					"testdriver": configuration.Parameters{},
+					"maintenance": configuration.Parameters{"uploadpurging": map[interface{}]interface{}{
+						"enabled": false,
+					}},
+				},
+			}
+			config.HTTP.Headers = headerConfig
+			config.Validation.Manifests.Limits.PayloadSize = tc.payloadSize
+			env := newTestEnvWithConfig(t, &config)
+			defer env.Shutdown()
+
+			imageName, _ := reference.WithName("foo/bar")
+			ref, _ := reference.WithTag(imageName, "latest")
+			u, err := env.builder.BuildManifestURL(ref)
+			if err != nil {
+				t.Fatalf("unexpected error building manifest url: %v", err)
+			}
+
+			req, err := http.NewRequest("PUT", u, bytes.NewReader(bytes.Repeat([]byte(" "), tc.bodySize)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Content-Type", v1.MediaTypeImageManifest)
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("unexpected error putting manifest: %v", err)
+			}
+			defer resp.Body.Close()
+
+			checkResponse(t, "putting oversized manifest", resp, http.StatusBadRequest)
+			_, p, _ := checkBodyHasErrorCodes(t, "putting oversized manifest", resp, v2.ErrorCodeManifestInvalid)
+			limitErr := distribution.ErrManifestLimitExceeded{Limit: "payload size", Max: tc.max, Value: int64(tc.bodySize)}
+			if !strings.Contains(string(p), limitErr.Error()) {
+				t.Fatalf("expected %q in response: %s", limitErr.Error(), p)
+			}
+		})
+	}
+}
@@ -26,10 +26,13 @@ import (
 	"github.com/distribution/distribution/v3/reference"
 	"github.com/distribution/distribution/v3/registry/api/errcode"
 	v2 "github.com/distribution/distribution/v3/registry/api/v2"
+	"github.com/distribution/distribution/v3/registry/audit"
 	"github.com/distribution/distribution/v3/registry/auth"
+	"github.com/distribution/distribution/v3/registry/auth/anonymous"
 	registrymiddleware "github.com/distribution/distribution/v3/registry/middleware/registry"
 	repositorymiddleware "github.com/distribution/distribution/v3/registry/middleware/repository"
 	"github.com/distribution/distribution/v3/registry/proxy"
+	"github.com/distribution/distribution/v3/registry/ratelimit"
 	"github.com/distribution/distribution/v3/registry/storage"
 	memorycache "github.com/distribution/distribution/v3/registry/storage/cache/memory"
 	rediscache "github.com/distribution/distribution/v3/registry/storage/cache/redis"
@@ -65,6 +68,18 @@ type App struct {
 	registry         distribution.Namespace         // registry is the primary registry backend for the app instance.
 	repoRemover      distribution.RepositoryRemover // repoRemover provides ability to delete repos
 	accessController auth.AccessController          // main access controller for application
+	tokenIssuer      *tokenIssuer                   // tokenIssuer serves tokens trusted by the token access controller, if enabled
+	robots           *storage.RobotAccounts         // robots stores the robot accounts, if enabled
+	robotPolicies    *robotPolicies                 // robotPolicies holds the compiled access of robot accounts
+	audit            *audit.Logger                  // audit records the access to the registry, if enabled
+	rateLimits       []rateLimit                    // rateLimits limit the rate at which clients use the registry
+	rateLimitStore   ratelimit.Store                // rateLimitStore keeps the token buckets of the rate limits
+	trustedProxies   int                            // trustedProxies is the number of proxies whose X-Forwarded-For entries give the client IP of rate limits
+	quotas           *storage.QuotaEnforcer         // quotas tracks storage usage against configured limits, if any
+	immutableTags    []immutableTagRule             // immutableTags lists the tags which may not be moved or deleted
+	admissionHooks   []*admissionHook               // admissionHooks admit manifests before they are stored
+	signatures       []signaturePolicy              // signatures require tagged manifests to be signed
+	manifestLimits   storage.ManifestLimits         // manifestLimits bounds the size and shape of pushed manifests
 
 	// httpHost is a parsed representation of the http.host parameter from
 	// the configuration. Only the Scheme and Host fields are used.
@@ -111,6 +126,14 @@ func NewApp(ctx context.Context, config *configuration.Configuration) *App {
 	app.register(v2.RouteNameBlob, blobDispatcher)
 	app.register(v2.RouteNameBlobUpload, blobUploadDispatcher)
 	app.register(v2.RouteNameBlobUploadChunk, blobUploadDispatcher)
+	app.register(v2.RouteNameQuota, quotaDispatcher)
+	app.register(v2.RouteNameReferrers, referrersDispatcher)
+	app.register(v2.RouteNameTagMetadata, tagMetadataDispatcher)
+	app.register(v2.RouteNameCopy, copyDispatcher)
+	app.register(v2.RouteNameRepository, repositoryDispatcher)
+	app.register(v2.RouteNameRename, renameDispatcher)
+	app.register(v2.RouteNameRobots, robotsDispatcher)
+	app.register(v2.RouteNameRobot, robotDispatcher)
 
 	// override the storage driver's UA string for registry outbound HTTP requests
 	storageParams := config.Storage.Parameters()
@@ -159,7 +182,9 @@ func NewApp(ctx context.Context, config *configuration.Configuration) *App {
 
 	app.configureSecret(config)
 	app.configureEvents(config)
+	app.configureAudit(config)
 	app.configureRedis(config)
+	app.configureRateLimit(config)
 	app.configureLogHook(config)
 
 	options := registrymiddleware.GetRegistryOptions()
@@ -257,6 +282,64 @@ func NewApp(ctx context.Context, config *configuration.Configuration) *App {
 				options = append(options, storage.ManifestURLsDenyRegexp(re))
 			}
 		}
+
+		limits := config.Validation.Manifests.Limits
+		mediaTypes := config.Validation.Manifests.MediaTypes
+		app.manifestLimits = storage.ManifestLimits{
+			PayloadSize:      limits.PayloadSize,
+			Layers:           limits.Layers,
+			IndexEntries:     limits.IndexEntries,
+			ImageSize:        limits.ImageSize,
+			LayerMediaTypes:  mediaTypes.Layers,
+			ConfigMediaTypes: mediaTypes.Configs,
+		}
+		options = append(options, storage.EnforceManifestLimits(app.manifestLimits))
+	}
+
+	// configure storage quotas
+	if len(config.Quota.Limits) > 0 {
+		limits := make([]storage.QuotaLimit, 0, len(config.Quota.Limits))
+		for _, limit := range config.Quota.Limits {
+			if limit.Repository == "" || limit.Size <= 0 {
+				panic(fmt.Sprintf("quota.limits: repository and a positive size are required, got %q with size %d", limit.Repository, limit.Size))
+			}
+			limits = append(limits, storage.QuotaLimit{
+				Scope: limit.Repository,
+				Limit: limit.Size,
+			})
+		}
+		app.quotas = storage.NewQuotaEnforcer(app.driver, limits)
+		options = append(options, storage.EnforceQuotas(app.quotas))
+		dcontext.GetLogger(app).Infof("enforcing %d storage quotas", len(limits))
+	}
+
+	// configure immutable tags
+	if len(config.Policy.ImmutableTags) > 0 {
+		rules, err := compileImmutableTags(config.Policy.ImmutableTags)
+		if err != nil {
+			panic(fmt.Sprintf("policy.immutabletags: %s", err))
+		}
+		app.immutableTags = rules
+		options = append(options, storage.ImmutableTags(app.isImmutableTag))
+	}
+
+	// configure admission hooks
+	if len(config.Policy.Admission) > 0 {
+		hooks, err := newAdmissionHooks(config.Policy.Admission)
+		if err != nil {
+			panic(fmt.Sprintf("policy.admission: %s", err))
+		}
+		app.admissionHooks = hooks
+		dcontext.GetLogger(app).Infof("configured %d admission hooks", len(hooks))
+	}
+
+	// configure signature verification
+	if len(config.Policy.Signatures) > 0 {
+		policies, err := newSignaturePolicies(config.Policy.Signatures)
+		if err != nil {
+			panic(fmt.Sprintf("policy.signatures: %s", err))
+		}
+		app.signatures = policies
 	}
 
 	// configure storage caches
@@ -309,15 +392,71 @@ func NewApp(ctx context.Context, config *configuration.Configuration) *App {
 
 	authType := config.Auth.Type()
 
+	if config.Robots.Enabled {
+		app.robots = storage.NewRobotAccounts(app.driver)
+		app.robotPolicies = &robotPolicies{}
+	}
+
+	// configure the token issuer, served alongside the registry API
+	if config.TokenIssuer.Enabled {
+		issuerConfig := config.TokenIssuer
+		if issuerConfig.Service == "" && authType == "token" {
+			issuerConfig.Service, _ = config.Auth.Parameters()["service"].(string)
+		}
+		app.tokenIssuer, err = newTokenIssuer(issuerConfig)
+		if err != nil {
+			panic(fmt.Sprintf("tokenissuer: %s", err))
+		}
+		if app.tokenIssuer.authorizer == nil {
+			dcontext.GetLogger(app).Warnf("tokenissuer: the %s authenticator has no access policy, tokens grant no access to its users", issuerConfig.Authenticator.Type())
+		}
+		app.tokenIssuer.robots = app.robots
+		app.tokenIssuer.robotPolicies = app.robotPolicies
+		app.router.Path(app.tokenIssuer.path).Methods(http.MethodGet, http.MethodPost).Handler(app.tokenIssuer)
+		dcontext.GetLogger(app).Infof("serving tokens at %s", app.tokenIssuer.path)
+	}
+
 	if authType != "" && !strings.EqualFold(authType, "none") {
-		accessController, err := auth.GetAccessController(config.Auth.Type(), config.Auth.Parameters())
+		options := config.Auth.Parameters()
+		anonymousOption, anonymousEnabled := options["anonymous"]
+		if anonymousEnabled {
+			// the anonymous option is handled by the registry, whatever
+			// the access controller.
+			withoutAnonymous := make(map[string]interface{}, len(options))
+			for k, v := range options {
+				if k != "anonymous" {
+					withoutAnonymous[k] = v
+				}
+			}
+			options = withoutAnonymous
+		}
+		if app.tokenIssuer != nil && authType == "token" {
+			options = app.tokenIssuer.accessControllerOptions(options, config.HTTP.Host)
+		}
+		accessController, err := auth.GetAccessController(config.Auth.Type(), options)
 		if err != nil {
 			panic(fmt.Sprintf("unable to configure authorization (%s): %v", authType, err))
 		}
+		if anonymousEnabled {
+			anonymousConfig, err := anonymous.ParseConfig(anonymousOption)
+			if err != nil {
+				panic(fmt.Sprintf("unable to configure authorization (%s): %v", authType, err))
+			}
+			accessController, err = anonymous.NewAccessController(accessController, anonymousConfig)
+			if err != nil {
+				panic(fmt.Sprintf("unable to configure authorization (%s): %v", authType, err))
+			}
+			dcontext.GetLogger(app).Infof("allowing anonymous pulls")
+		}
 		app.accessController = accessController
 		dcontext.GetLogger(app).Debugf("configured %q access controller", authType)
 	}
 
+	if app.robots != nil && app.accessController == nil {
+		// the robot accounts API would be open to anyone
+		panic("robots: an auth provider is required to manage robot accounts")
+	}
+
 	// configure as a pull through cache
 	if config.Proxy.RemoteURL != "" {
 		app.registry, err = proxy.NewRegistryPullThroughCache(ctx, app.registry, app.driver, config.Proxy)
@@ -666,8 +805,19 @@ func (app *App) dispatcher(dispatch dispatchFunc) http.Handler {
 
 		if err := app.authorized(w, r, context); err != nil {
 			dcontext.GetLogger(context).Warnf("error authorizing context: %v", err)
+			app.auditAccess(context, r, audit.Denied, err.Error())
 			return
 		}
+		defer app.auditRequest(context, r)
+
+		if app.rateLimitStore != nil {
+			limited, err := app.limitRate(w, r, context)
+			if err != nil {
+				dcontext.GetLogger(context).Warnf("rate limiting request: %v", err)
+				return
+			}
+			defer app.chargeRateLimits(context, limited)
+		}
 
 		// Add username to request logging
 		context.Context = dcontext.WithLogger(context.Context, dcontext.GetLogger(context.Context, auth.UserNameKey))
@@ -813,17 +963,31 @@ func (app *App) authorized(w http.ResponseWriter, r *http.Request, context *Cont
 	dcontext.GetLogger(context).Debug("authorizing request")
 	repo := getName(context)
 
-	if app.accessController == nil {
+	if app.accessController == nil && app.robots == nil && app.audit == nil {
 		return nil // access controller is not enabled.
 	}
 
 	var accessRecords []auth.Access
 
-	if repo != "" {
+	if repo != "" && isRoute(r, v2.RouteNameRename) {
+		// renaming a repository deletes it and pushes to the new name.
+		accessRecords = appendAccessRecords(accessRecords, "DELETE", repo)
+		// the rename handler only reads the destination from the query,
+		// never from a form in the body.
+		if toRepo := r.URL.Query().Get("to"); toRepo != "" {
+			accessRecords = appendAccessRecords(accessRecords, r.Method, toRepo)
+		}
+	} else if repo != "" {
 		accessRecords = appendAccessRecords(accessRecords, r.Method, repo)
-		if fromRepo := r.FormValue("from"); fromRepo != "" {
-			// mounting a blob from one repository to another requires pull (GET)
-			// access to the source repository.
+		fromRepo := r.FormValue("from")
+		if isRoute(r, v2.RouteNameCopy) {
+			// the copy handler only reads the source from the query,
+			// never from a form in the body.
+			fromRepo = r.URL.Query().Get("from")
+		}
+		if fromRepo != "" {
+			// mounting a blob or copying a manifest from one repository to
+			// another requires pull (GET) access to the source repository.
 			accessRecords = appendAccessRecords(accessRecords, "GET", fromRepo)
 		}
 	} else {
@@ -841,6 +1005,19 @@ func (app *App) authorized(w http.ResponseWriter, r *http.Request, context *Cont
 			return fmt.Errorf("forbidden: no repository name")
 		}
 		accessRecords = appendCatalogAccessRecord(accessRecords, r)
+		accessRecords = appendRobotsAccessRecord(accessRecords, r)
+	}
+	context.accessRecords = accessRecords
+
+	if app.robots != nil {
+		if username, secret, ok := r.BasicAuth(); ok {
+			if name, ok := robotAccount(username); ok {
+				return app.authorizedRobot(w, r, context, name, secret, accessRecords)
+			}
+		}
+	}
+	if app.accessController == nil {
+		return nil
 	}
 
 	ctx, err := app.accessController.Authorized(context.Context, accessRecords...)
@@ -873,6 +1050,40 @@ func (app *App) authorized(w http.ResponseWriter, r *http.Request, context *Cont
 	return nil
 }
 
+// authorizedRobot authenticates the robot account credentials of the request
+// and checks that the robot account grants the requested access, whatever
+// the access controller.
+func (app *App) authorizedRobot(w http.ResponseWriter, r *http.Request, context *Context, name, secret string, accessRecords []auth.Access) error {
+	account, err := app.robots.Authenticate(context, name, secret)
+	if err != nil {
+		if err == storage.ErrRobotAccountAuthentication {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf("Basic realm=%q", robotRealm))
+			err = errcode.ErrorCodeUnauthorized.WithDetail(accessRecords)
+		} else {
+			dcontext.GetLogger(context).Errorf("error authenticating robot account %q: %v", name, err)
+			err = errcode.ErrorCodeUnknown
+		}
+		if err := errcode.ServeJSON(w, err); err != nil {
+			dcontext.GetLogger(context).Errorf("error serving error json: %v (from %v)", err, context.Errors)
+		}
+		return fmt.Errorf("robot account %q: authentication failure", name)
+	}
+
+	for _, access := range accessRecords {
+		if !app.robotPolicies.allows(account, access) {
+			if err := errcode.ServeJSON(w, errcode.ErrorCodeDenied.WithDetail(accessRecords)); err != nil {
+				dcontext.GetLogger(context).Errorf("error serving error json: %v (from %v)", err, context.Errors)
+			}
+			return fmt.Errorf("robot account %q may not %s %s %q", name, access.Action, access.Type, access.Name)
+		}
+	}
+
+	ctx := auth.WithUser(context.Context, auth.UserInfo{Name: robotUsernamePrefix + account.Name})
+	dcontext.GetLogger(ctx, auth.UserNameKey).Info("authorized robot account request")
+	context.Context = ctx
+	return nil
+}
+
 // eventBridge returns a bridge for the current request, configured with the
 // correct actor and source.
 func (app *App) eventBridge(ctx *Context, r *http.Request) notifications.Listener {
@@ -891,7 +1102,14 @@ func (app *App) nameRequired(r *http.Request) bool {
 		return true
 	}
 	routeName := route.GetName()
-	return routeName != v2.RouteNameBase && routeName != v2.RouteNameCatalog
+	return routeName != v2.RouteNameBase && routeName != v2.RouteNameCatalog &&
+		routeName != v2.RouteNameRobots && routeName != v2.RouteNameRobot
+}
+
+// isRoute returns true if the request matched the named route.
+func isRoute(r *http.Request, name string) bool {
+	route := mux.CurrentRoute(r)
+	return route != nil && route.GetName() == name
 }
 
 // apiBase implements a simple yes-man for doing overall checks against the
@@ -959,6 +1177,22 @@ func appendCatalogAccessRecord(accessRecords []auth.Access, r *http.Request) []a
 	return accessRecords
 }
 
+// appendRobotsAccessRecord adds the access record for managing robot
+// accounts if the current route is one of the robot account routes.
+func appendRobotsAccessRecord(accessRecords []auth.Access, r *http.Request) []auth.Access {
+	if isRoute(r, v2.RouteNameRobots) || isRoute(r, v2.RouteNameRobot) {
+		accessRecords = append(accessRecords,
+			auth.Access{
+				Resource: auth.Resource{
+					Type: "registry",
+					Name: "robots",
+				},
+				Action: "*",
+			})
+	}
+	return accessRecords
+}
+
 // applyRegistryMiddleware wraps a registry instance with the configured middlewares
 func applyRegistryMiddleware(ctx context.Context, registry distribution.Namespace, middlewares []configuration.Middleware) (distribution.Namespace, error) {
 	for _, mw := range middlewares {
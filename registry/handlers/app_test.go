@@ -212,6 +212,27 @@ func TestNewApp(t *testing.T) {
 	}
 }
 
+// TestNewAppRobotsWithoutAuth checks that the registry refuses to start with
+// robot accounts enabled but no access controller to protect their API.
+func TestNewAppRobotsWithoutAuth(t *testing.T) {
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"testdriver": nil,
+			"maintenance": configuration.Parameters{"uploadpurging": map[interface{}]interface{}{
+				"enabled": false,
+			}},
+		},
+		Robots: configuration.Robots{Enabled: true},
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected NewApp to panic with robots enabled and no auth")
+		}
+	}()
+	NewApp(context.Background(), &config)
+}
+
 // Test the access record accumulator
 func TestAppendAccessRecords(t *testing.T) {
 	repo := "testRepo"
@@ -277,3 +298,28 @@ func TestAppendAccessRecords(t *testing.T) {
 	}
 
 }
+
+func TestRateLimitClientIP(t *testing.T) {
+	for _, tc := range []struct {
+		forwarded      []string
+		trustedProxies int
+		expected       string
+	}{
+		{expected: "203.0.113.1"},
+		{forwarded: []string{"192.0.2.1"}, expected: "203.0.113.1"},
+		{trustedProxies: 1, expected: "203.0.113.1"},
+		{forwarded: []string{"192.0.2.1"}, trustedProxies: 1, expected: "192.0.2.1"},
+		{forwarded: []string{"198.51.100.1, 192.0.2.1"}, trustedProxies: 1, expected: "192.0.2.1"},
+		{forwarded: []string{"198.51.100.1", "192.0.2.1, 192.0.2.2"}, trustedProxies: 2, expected: "192.0.2.1"},
+		{forwarded: []string{"192.0.2.1"}, trustedProxies: 3, expected: "192.0.2.1"},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/v2/", nil)
+		r.RemoteAddr = "203.0.113.1:1234"
+		for _, forwarded := range tc.forwarded {
+			r.Header.Add("X-Forwarded-For", forwarded)
+		}
+		if ip := rateLimitClientIP(r, tc.trustedProxies); ip != tc.expected {
+			t.Errorf("%v with %d trusted proxies: expected %s, got %s", tc.forwarded, tc.trustedProxies, tc.expected, ip)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/distribution/distribution/v3/configuration"
+	dcontext "github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/registry/api/errcode"
+	"github.com/distribution/distribution/v3/registry/audit"
+	"github.com/opencontainers/go-digest"
+)
+
+// defaultAuditSyslogTag is the tag of the audit messages sent to syslog.
+const defaultAuditSyslogTag = "registry"
+
+// configureAudit sets up the audit log, if any sink is configured.
+func (app *App) configureAudit(configuration *configuration.Configuration) {
+	config := configuration.Audit
+
+	var sinks []audit.Sink
+	if config.File.Path != "" {
+		sink, err := audit.NewFileSink(config.File.Path, config.File.MaxSize, config.File.MaxBackups)
+		if err != nil {
+			panic(fmt.Sprintf("audit: %v", err))
+		}
+		sinks = append(sinks, sink)
+	}
+	if config.Syslog.Enabled {
+		tag := config.Syslog.Tag
+		if tag == "" {
+			tag = defaultAuditSyslogTag
+		}
+		sink, err := audit.NewSyslogSink(config.Syslog.Network, config.Syslog.Address, tag)
+		if err != nil {
+			panic(fmt.Sprintf("audit: %v", err))
+		}
+		sinks = append(sinks, sink)
+	}
+	if len(sinks) == 0 {
+		return
+	}
+
+	filter := audit.Filter{
+		Methods: config.Exclude.Methods,
+		Actions: config.Exclude.Actions,
+	}
+	for _, decision := range config.Exclude.Decisions {
+		filter.Decisions = append(filter.Decisions, audit.Decision(decision))
+	}
+	app.audit = audit.NewLogger(filter, sinks...)
+	dcontext.GetLogger(app).Infof("recording audit log to %d sinks", len(sinks))
+}
+
+// auditAccess records the access of the request to the audit log, with the
+// given decision. It must be called once the response has been served.
+func (app *App) auditAccess(ctx *Context, r *http.Request, decision audit.Decision, reason string) {
+	if app.audit == nil {
+		return
+	}
+
+	status, _ := ctx.Value("http.response.status").(int)
+	dgst, tag := auditedContent(ctx, r)
+	for _, access := range ctx.accessRecords {
+		err := app.audit.Log(audit.Record{
+			RequestID:  dcontext.GetRequestID(ctx),
+			User:       getUserName(ctx, r),
+			RemoteAddr: dcontext.RemoteAddr(r),
+			Method:     r.Method,
+			Type:       access.Type,
+			Name:       access.Name,
+			Action:     access.Action,
+			Digest:     dgst,
+			Tag:        tag,
+			Decision:   decision,
+			Reason:     reason,
+			Status:     status,
+		})
+		if err != nil {
+			dcontext.GetLogger(ctx).Errorf("error writing audit log: %v", err)
+		}
+	}
+}
+
+// auditRequest records the access of an authorized request once it has been
+// served. Requests refused by a registry policy, such as immutable tags or
+// quotas, are recorded as denied.
+func (app *App) auditRequest(ctx *Context, r *http.Request) {
+	decision, reason := audit.Allowed, ""
+	for _, err := range ctx.Errors {
+		switch err := err.(type) {
+		case errcode.Error:
+			if err.Code == errcode.ErrorCodeDenied {
+				decision, reason = audit.Denied, err.Message
+			}
+		case errcode.ErrorCode:
+			if err == errcode.ErrorCodeDenied {
+				decision, reason = audit.Denied, err.Message()
+			}
+		}
+	}
+	app.auditAccess(ctx, r, decision, reason)
+}
+
+// auditedContent returns the digest or the tag of the content the request
+// names, if any.
+func auditedContent(ctx *Context, r *http.Request) (digest.Digest, string) {
+	if dgst, err := digest.Parse(dcontext.GetStringValue(ctx, "vars.digest")); err == nil {
+		return dgst, ""
+	}
+	if reference := getReference(ctx); reference != "" {
+		if dgst, err := digest.Parse(reference); err == nil {
+			return dgst, ""
+		}
+		return "", reference
+	}
+	// completed uploads and cross repository mounts name the blob in the
+	// query.
+	query := r.URL.Query()
+	for _, key := range []string{"digest", "mount"} {
+		if dgst, err := digest.Parse(query.Get(key)); err == nil {
+			return dgst, ""
+		}
+	}
+	return "", ""
+}
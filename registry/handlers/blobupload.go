@@ -214,6 +214,8 @@ func (buh *blobUploadHandler) PutBlobUploadComplete(w http.ResponseWriter, r *ht
 		switch err := err.(type) {
 		case distribution.ErrBlobInvalidDigest:
 			buh.Errors = append(buh.Errors, v2.ErrorCodeDigestInvalid.WithDetail(err))
+		case distribution.ErrQuotaExceeded:
+			buh.Errors = append(buh.Errors, quotaExceededError(err))
 		case errcode.Error:
 			buh.Errors = append(buh.Errors, err)
 		default:
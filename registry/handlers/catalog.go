@@ -7,8 +7,12 @@ import (
 	"net/http"
 	"net/url"
 	"strconv"
+	"strings"
 
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/reference"
 	"github.com/distribution/distribution/v3/registry/api/errcode"
+	v2 "github.com/distribution/distribution/v3/registry/api/v2"
 	"github.com/distribution/distribution/v3/registry/storage/driver"
 	"github.com/gorilla/handlers"
 )
@@ -45,11 +49,33 @@ func (ch *catalogHandler) GetCatalog(w http.ResponseWriter, r *http.Request) {
 
 	repos := make([]string, maxEntries)
 
-	filled, err := ch.App.registry.Repositories(ch.Context, repos, lastEntry)
+	var filled int
+	if prefix := q.Get("prefix"); prefix != "" {
+		// The namespace part of the prefix must be a valid repository name
+		// as it is used to locate the repositories in storage.
+		if dir := prefix[:strings.LastIndex(prefix, "/")+1]; dir != "" {
+			if _, err := reference.WithName(strings.TrimSuffix(dir, "/")); err != nil {
+				ch.Errors = append(ch.Errors, v2.ErrorCodeNameInvalid.WithDetail(map[string]string{"prefix": prefix}))
+				return
+			}
+		}
+
+		lister, ok := ch.App.registry.(distribution.RepositoryPrefixLister)
+		if !ok {
+			ch.Errors = append(ch.Errors, errcode.ErrorCodeUnsupported.WithMessage("catalog prefix filter is not supported"))
+			return
+		}
+		filled, err = lister.RepositoriesWithPrefix(ch.Context, prefix, repos, lastEntry)
+	} else {
+		filled, err = ch.App.registry.Repositories(ch.Context, repos, lastEntry)
+	}
 	_, pathNotFound := err.(driver.PathNotFoundError)
 
 	if err == io.EOF || pathNotFound {
 		moreEntries = false
+	} else if err == distribution.ErrUnsupported {
+		ch.Errors = append(ch.Errors, errcode.ErrorCodeUnsupported)
+		return
 	} else if err != nil {
 		ch.Errors = append(ch.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
 		return
@@ -85,9 +111,10 @@ func createLinkEntry(origURL string, maxEntries int, lastEntry string) (string,
 		return "", err
 	}
 
-	v := url.Values{}
-	v.Add("n", strconv.Itoa(maxEntries))
-	v.Add("last", lastEntry)
+	// keep other parameters, such as filters, for the next page
+	v := calledURL.Query()
+	v.Set("n", strconv.Itoa(maxEntries))
+	v.Set("last", lastEntry)
 
 	calledURL.RawQuery = v.Encode()
 
@@ -33,6 +33,10 @@ type Context struct {
 	// handler *must not* start the response via http.ResponseWriter.
 	Errors errcode.Errors
 
+	// accessRecords is the access the request asks for, recorded to the
+	// audit log.
+	accessRecords []auth.Access
+
 	urlBuilder *v2.URLBuilder
 
 	// TODO(stevvooe): The goal is too completely factor this context and
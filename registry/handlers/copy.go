@@ -0,0 +1,262 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/distribution/distribution/v3"
+	dcontext "github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/manifest/manifestlist"
+	"github.com/distribution/distribution/v3/reference"
+	"github.com/distribution/distribution/v3/registry/api/errcode"
+	v2 "github.com/distribution/distribution/v3/registry/api/v2"
+	"github.com/distribution/distribution/v3/registry/signature"
+	"github.com/distribution/distribution/v3/registry/storage"
+	"github.com/gorilla/handlers"
+	"github.com/opencontainers/go-digest"
+)
+
+// copyDispatcher constructs the copy api endpoint.
+func copyDispatcher(ctx *Context, r *http.Request) http.Handler {
+	copyHandler := &copyHandler{
+		Context: ctx,
+	}
+
+	handler := handlers.MethodHandler{}
+	if !ctx.readOnly {
+		handler["POST"] = http.HandlerFunc(copyHandler.CopyManifest)
+	}
+
+	return handler
+}
+
+// copyHandler copies manifests from another repository into the repository
+// of the request.
+type copyHandler struct {
+	*Context
+
+	// Source is the repository the manifests are copied from.
+	Source distribution.Repository
+}
+
+// CopyManifest copies a manifest, along with the manifests of an index, from
+// the source repository and optionally tags it. Blobs are mounted from the
+// source repository rather than transferred.
+func (ch *copyHandler) CopyManifest(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	fromRef, err := reference.WithName(q.Get("from"))
+	if err != nil {
+		ch.Errors = append(ch.Errors, v2.ErrorCodeNameInvalid.WithDetail(err))
+		return
+	}
+
+	tag := q.Get("tag")
+	if tag != "" {
+		if _, err := reference.WithTag(ch.Repository.Named(), tag); err != nil {
+			ch.Errors = append(ch.Errors, v2.ErrorCodeTagInvalid.WithDetail(err))
+			return
+		}
+	}
+
+	ch.Source, err = ch.App.registry.Repository(ch, fromRef)
+	if err != nil {
+		switch err := err.(type) {
+		case distribution.ErrRepositoryUnknown:
+			ch.Errors = append(ch.Errors, v2.ErrorCodeNameUnknown.WithDetail(err))
+		case distribution.ErrRepositoryNameInvalid:
+			ch.Errors = append(ch.Errors, v2.ErrorCodeNameInvalid.WithDetail(err))
+		default:
+			ch.Errors = append(ch.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		}
+		return
+	}
+
+	dgst, err := ch.resolve(q.Get("reference"))
+	if err != nil {
+		ch.appendCopyError(err)
+		return
+	}
+
+	source, err := ch.Source.Manifests(ch)
+	if err != nil {
+		ch.Errors = append(ch.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+	destination, err := ch.Repository.Manifests(ch)
+	if err != nil {
+		ch.Errors = append(ch.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+
+	if tag != "" {
+		if err := ch.checkTagMove(tag, dgst); err != nil {
+			ch.appendCopyError(err)
+			return
+		}
+		// signature manifests are read from the source, as they are not in
+		// the repository yet
+		var manifest distribution.Manifest
+		if signature.IsSignatureTag(tag) {
+			manifest, err = source.Get(ch, dgst)
+			if err != nil {
+				ch.appendCopyError(err)
+				return
+			}
+		}
+		if err := ch.verifySignature(tag, dgst, manifest, false); err != nil {
+			ch.appendCopyError(err)
+			return
+		}
+	}
+
+	manifest, err := ch.copyManifest(source, destination, dgst, tag)
+	if err != nil {
+		ch.appendCopyError(err)
+		return
+	}
+
+	if tag != "" {
+		mediaType, payload, err := manifest.Payload()
+		if err != nil {
+			ch.Errors = append(ch.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+			return
+		}
+		desc := distribution.Descriptor{MediaType: mediaType, Size: int64(len(payload)), Digest: dgst}
+		if err := ch.Repository.Tags(ch).Tag(ch, tag, desc); err != nil {
+			if _, ok := err.(distribution.ErrTagImmutable); ok {
+				ch.Errors = append(ch.Errors, errcode.ErrorCodeDenied.WithMessage(err.Error()))
+				return
+			}
+			ch.Errors = append(ch.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+			return
+		}
+	}
+
+	ref, err := reference.WithDigest(ch.Repository.Named(), dgst)
+	if err != nil {
+		ch.Errors = append(ch.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+
+	location, err := ch.urlBuilder.BuildManifestURL(ref)
+	if err != nil {
+		dcontext.GetLogger(ch).Errorf("error building manifest url from digest: %v", err)
+	}
+
+	w.Header().Set("Location", location)
+	w.Header().Set("Content-Length", "0")
+	w.Header().Set("Docker-Content-Digest", dgst.String())
+	w.WriteHeader(http.StatusCreated)
+}
+
+// resolve returns the digest of the manifest identified by a tag or digest
+// in the source repository.
+func (ch *copyHandler) resolve(ref string) (digest.Digest, error) {
+	if dgst, err := digest.Parse(ref); err == nil {
+		return dgst, nil
+	}
+
+	if _, err := reference.WithTag(ch.Source.Named(), ref); err != nil {
+		return "", v2.ErrorCodeTagInvalid.WithDetail(err)
+	}
+
+	desc, err := ch.Source.Tags(ch).Get(ch, ref)
+	if err != nil {
+		return "", err
+	}
+	return desc.Digest, nil
+}
+
+// copyManifest stores the manifest with the given digest from the source in
+// the destination, after the blobs and manifests it references. Each manifest
+// is subject to admission as if it were pushed, the given one with the tag.
+func (ch *copyHandler) copyManifest(source, destination distribution.ManifestService, dgst digest.Digest, tag string) (distribution.Manifest, error) {
+	manifest, err := source.Get(ch, dgst)
+	if err != nil {
+		return nil, err
+	}
+
+	_, isList := manifest.(*manifestlist.DeserializedManifestList)
+	for _, desc := range manifest.References() {
+		if !isList {
+			if err := ch.mountBlob(desc.Digest); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		exists, err := destination.Exists(ch, desc.Digest)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			if _, err := ch.copyManifest(source, destination, desc.Digest, ""); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err := ch.applyResourcePolicy(manifest); err != nil {
+		return nil, err
+	}
+
+	if err := ch.admitManifest(manifest, tag); err != nil {
+		return nil, err
+	}
+
+	var options []distribution.ManifestServiceOption
+	if tag != "" {
+		options = append(options, distribution.WithTag(tag))
+	}
+	if _, err := destination.Put(ch, manifest, options...); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// mountBlob links a blob of the source repository into the destination,
+// unless it is already there.
+func (ch *copyHandler) mountBlob(dgst digest.Digest) error {
+	blobs := ch.Repository.Blobs(ch)
+	if _, err := blobs.Stat(ch, dgst); err != distribution.ErrBlobUnknown {
+		return err
+	}
+
+	// the mount falls back to an upload when the blob cannot be linked,
+	// so make sure the source has it.
+	if _, err := ch.Source.Blobs(ch).Stat(ch, dgst); err != nil {
+		return err
+	}
+
+	from, err := reference.WithDigest(ch.Source.Named(), dgst)
+	if err != nil {
+		return err
+	}
+
+	writer, err := blobs.Create(ch, storage.WithMountFrom(from))
+	switch err.(type) {
+	case distribution.ErrBlobMounted:
+		return nil
+	case nil:
+		writer.Cancel(ch)
+		return fmt.Errorf("unable to mount blob %s from %s", dgst, ch.Source.Named().Name())
+	default:
+		return err
+	}
+}
+
+func (ch *copyHandler) appendCopyError(err error) {
+	switch err := err.(type) {
+	case distribution.ErrTagUnknown, distribution.ErrManifestUnknown, distribution.ErrManifestUnknownRevision:
+		ch.Errors = append(ch.Errors, v2.ErrorCodeManifestUnknown.WithDetail(err))
+	case distribution.ErrRepositoryUnknown:
+		ch.Errors = append(ch.Errors, v2.ErrorCodeNameUnknown.WithDetail(err))
+	default:
+		if err == distribution.ErrBlobUnknown {
+			ch.Errors = append(ch.Errors, v2.ErrorCodeBlobUnknown)
+			return
+		}
+		ch.Errors = append(ch.Errors, manifestPutErrors(err)...)
+	}
+}
@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/configuration"
+	dcontext "github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/registry/api/errcode"
+	"github.com/distribution/distribution/v3/registry/auth"
+	"github.com/opencontainers/go-digest"
+)
+
+// immutableTagRule is the compiled form of a configuration.ImmutableTagRule.
+type immutableTagRule struct {
+	repository *regexp.Regexp
+	tags       []*regexp.Regexp
+}
+
+// compileImmutableTags compiles the immutable tag rules of the policy
+// configuration, anchoring each expression to the whole name.
+func compileImmutableTags(rules []configuration.ImmutableTagRule) ([]immutableTagRule, error) {
+	compiled := make([]immutableTagRule, 0, len(rules))
+	for _, rule := range rules {
+		if rule.Repository == "" || len(rule.Tags) == 0 {
+			return nil, fmt.Errorf("repository and tags are required, got %q with %d tags", rule.Repository, len(rule.Tags))
+		}
+
+		repository, err := regexp.Compile("^(?:" + rule.Repository + ")$")
+		if err != nil {
+			return nil, err
+		}
+
+		tags := make([]*regexp.Regexp, 0, len(rule.Tags))
+		for _, tag := range rule.Tags {
+			re, err := regexp.Compile("^(?:" + tag + ")$")
+			if err != nil {
+				return nil, err
+			}
+			tags = append(tags, re)
+		}
+
+		compiled = append(compiled, immutableTagRule{repository: repository, tags: tags})
+	}
+	return compiled, nil
+}
+
+// isImmutableTag reports whether the tag of the repository is made immutable
+// by the policy.
+func (app *App) isImmutableTag(repo, tag string) bool {
+	for _, rule := range app.immutableTags {
+		if !rule.repository.MatchString(repo) {
+			continue
+		}
+		for _, re := range rule.tags {
+			if re.MatchString(tag) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// checkTagMove returns a DENIED error if the tag is immutable and already
+// points to a manifest other than dgst. Pushing the same manifest again is
+// allowed. This only rejects moves before the manifest is stored, the tag
+// store enforces the rule when the tag is set.
+func (ctx *Context) checkTagMove(tag string, dgst digest.Digest) error {
+	if !ctx.isImmutableTag(ctx.Repository.Named().Name(), tag) {
+		return nil
+	}
+
+	desc, err := ctx.Repository.Tags(ctx).Get(ctx, tag)
+	if err != nil {
+		switch err.(type) {
+		case distribution.ErrTagUnknown, distribution.ErrRepositoryUnknown:
+			return nil
+		}
+		return err
+	}
+
+	if desc.Digest != dgst {
+		return errcode.ErrorCodeDenied.WithMessage(fmt.Sprintf("tag %s is immutable and already points to %s", tag, desc.Digest))
+	}
+	return nil
+}
+
+// checkTagsDelete returns a DENIED error if any of the tags is immutable,
+// unless the request has been granted the admin override scope.
+func (ctx *Context) checkTagsDelete(tags ...string) error {
+	repo := ctx.Repository.Named().Name()
+	for _, tag := range tags {
+		if !ctx.isImmutableTag(repo, tag) {
+			continue
+		}
+		if ctx.immutableTagsOverride() {
+			return nil
+		}
+		return errcode.ErrorCodeDenied.WithMessage(fmt.Sprintf("tag %s is immutable", tag))
+	}
+	return nil
+}
+
+// immutableTagsOverride reports whether the request may delete immutable
+// tags, which requires a policy of the access controller to grant the user
+// the "*" action on the repository. Access controllers without a policy grant
+// every action to any authenticated user, so they cannot grant it.
+func (ctx *Context) immutableTagsOverride() bool {
+	authorizer, ok := ctx.accessController.(auth.AccessAuthorizer)
+	if !ok || !authorizer.HasPolicy() {
+		return false
+	}
+
+	username := dcontext.GetStringValue(ctx, auth.UserNameKey)
+	if username == "" {
+		return false
+	}
+
+	return authorizer.AuthorizeUser(username, auth.Access{
+		Resource: auth.Resource{
+			Type: "repository",
+			Name: ctx.Repository.Named().Name(),
+		},
+		Action: "*",
+	})
+}
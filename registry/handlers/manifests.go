@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"mime"
 	"net/http"
@@ -17,6 +18,7 @@ import (
 	"github.com/distribution/distribution/v3/registry/api/errcode"
 	v2 "github.com/distribution/distribution/v3/registry/api/v2"
 	"github.com/distribution/distribution/v3/registry/auth"
+	"github.com/distribution/distribution/v3/registry/storage"
 	"github.com/distribution/distribution/v3/registry/storage/driver"
 	"github.com/gorilla/handlers"
 	"github.com/opencontainers/go-digest"
@@ -130,6 +132,11 @@ func (imh *manifestHandler) GetManifest(w http.ResponseWriter, r *http.Request)
 			return
 		}
 		imh.Digest = desc.Digest
+
+		if err := imh.verifySignature(imh.Tag, imh.Digest, nil, true); err != nil {
+			imh.appendTagPolicyError(err)
+			return
+		}
 	}
 
 	if etagMatch(r, imh.Digest.String()) {
@@ -295,9 +302,27 @@ func (imh *manifestHandler) PutManifest(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	// the configured payload size can only lower the body size cap
+	limit := int64(maxManifestBodySize)
+	if imh.manifestLimits.PayloadSize > 0 && imh.manifestLimits.PayloadSize < limit {
+		limit = imh.manifestLimits.PayloadSize
+	}
+
 	var jsonBuf bytes.Buffer
-	if err := copyFullPayload(imh, w, r, &jsonBuf, maxManifestBodySize, "image manifest PUT"); err != nil {
+	if err := copyFullPayload(imh, w, r, &jsonBuf, limit, "image manifest PUT"); err != nil {
 		// copyFullPayload reports the error if necessary
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			// the body is not read past the limit, so its full size is
+			// only known from the content length
+			size := r.ContentLength
+			if size <= maxBytesErr.Limit {
+				size = maxBytesErr.Limit + 1
+			}
+			limitErr := distribution.ErrManifestLimitExceeded{Limit: "payload size", Max: maxBytesErr.Limit, Value: size}
+			imh.Errors = append(imh.Errors, v2.ErrorCodeManifestInvalid.WithDetail(limitErr.Error()))
+			return
+		}
 		imh.Errors = append(imh.Errors, v2.ErrorCodeManifestInvalid.WithDetail(err.Error()))
 		return
 	}
@@ -340,41 +365,25 @@ func (imh *manifestHandler) PutManifest(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	_, err = manifests.Put(imh, manifest, options...)
-	if err != nil {
-		// TODO(stevvooe): These error handling switches really need to be
-		// handled by an app global mapper.
-		if err == distribution.ErrUnsupported {
-			imh.Errors = append(imh.Errors, errcode.ErrorCodeUnsupported)
+	if imh.Tag != "" {
+		if err := imh.checkTagMove(imh.Tag, desc.Digest); err != nil {
+			imh.appendTagPolicyError(err)
 			return
 		}
-		if err == distribution.ErrAccessDenied {
-			imh.Errors = append(imh.Errors, errcode.ErrorCodeDenied)
+		if err := imh.verifySignature(imh.Tag, desc.Digest, manifest, false); err != nil {
+			imh.appendTagPolicyError(err)
 			return
 		}
-		switch err := err.(type) {
-		case distribution.ErrManifestVerification:
-			for _, verificationError := range err {
-				switch verificationError := verificationError.(type) {
-				case distribution.ErrManifestBlobUnknown:
-					imh.Errors = append(imh.Errors, v2.ErrorCodeManifestBlobUnknown.WithDetail(verificationError.Digest))
-				case distribution.ErrManifestNameInvalid:
-					imh.Errors = append(imh.Errors, v2.ErrorCodeNameInvalid.WithDetail(err))
-				case distribution.ErrManifestUnverified:
-					imh.Errors = append(imh.Errors, v2.ErrorCodeManifestUnverified)
-				default:
-					if verificationError == digest.ErrDigestInvalidFormat {
-						imh.Errors = append(imh.Errors, v2.ErrorCodeDigestInvalid)
-					} else {
-						imh.Errors = append(imh.Errors, errcode.ErrorCodeUnknown, verificationError)
-					}
-				}
-			}
-		case errcode.Error:
-			imh.Errors = append(imh.Errors, err)
-		default:
-			imh.Errors = append(imh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
-		}
+	}
+
+	if err := imh.admitManifest(manifest, imh.Tag); err != nil {
+		imh.Errors = append(imh.Errors, manifestPutErrors(err)...)
+		return
+	}
+
+	_, err = manifests.Put(imh, manifest, options...)
+	if err != nil {
+		imh.Errors = append(imh.Errors, manifestPutErrors(err)...)
 		return
 	}
 
@@ -383,6 +392,10 @@ func (imh *manifestHandler) PutManifest(w http.ResponseWriter, r *http.Request)
 		tags := imh.Repository.Tags(imh)
 		err = tags.Tag(imh, imh.Tag, desc)
 		if err != nil {
+			if _, ok := err.(distribution.ErrTagImmutable); ok {
+				imh.Errors = append(imh.Errors, errcode.ErrorCodeDenied.WithMessage(err.Error()))
+				return
+			}
 			imh.Errors = append(imh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
 			return
 		}
@@ -406,15 +419,63 @@ func (imh *manifestHandler) PutManifest(w http.ResponseWriter, r *http.Request)
 
 	w.Header().Set("Location", location)
 	w.Header().Set("Docker-Content-Digest", imh.Digest.String())
+	if subject := storage.ManifestSubject(manifest); subject != nil {
+		// Tell the client that the referrers index of the subject has
+		// been updated.
+		w.Header().Set("OCI-Subject", subject.Digest.String())
+	}
 	w.WriteHeader(http.StatusCreated)
 
 	dcontext.GetLogger(imh).Debug("Succeeded in putting manifest!")
 }
 
+// manifestPutErrors maps an error storing a manifest to the errors reported
+// to the client.
+func manifestPutErrors(err error) errcode.Errors {
+	// TODO(stevvooe): These error handling switches really need to be
+	// handled by an app global mapper.
+	if err == distribution.ErrUnsupported {
+		return errcode.Errors{errcode.ErrorCodeUnsupported}
+	}
+	if err == distribution.ErrAccessDenied {
+		return errcode.Errors{errcode.ErrorCodeDenied}
+	}
+
+	var errs errcode.Errors
+	switch err := err.(type) {
+	case distribution.ErrManifestVerification:
+		for _, verificationError := range err {
+			switch verificationError := verificationError.(type) {
+			case distribution.ErrManifestBlobUnknown:
+				errs = append(errs, v2.ErrorCodeManifestBlobUnknown.WithDetail(verificationError.Digest))
+			case distribution.ErrManifestNameInvalid:
+				errs = append(errs, v2.ErrorCodeNameInvalid.WithDetail(err))
+			case distribution.ErrManifestUnverified:
+				errs = append(errs, v2.ErrorCodeManifestUnverified)
+			case distribution.ErrManifestSubjectInvalid, distribution.ErrManifestLimitExceeded, distribution.ErrManifestMediaTypeInvalid:
+				errs = append(errs, v2.ErrorCodeManifestInvalid.WithDetail(verificationError.Error()))
+			default:
+				if verificationError == digest.ErrDigestInvalidFormat {
+					errs = append(errs, v2.ErrorCodeDigestInvalid)
+				} else {
+					errs = append(errs, errcode.ErrorCodeUnknown, verificationError)
+				}
+			}
+		}
+	case distribution.ErrQuotaExceeded:
+		errs = append(errs, quotaExceededError(err))
+	case errcode.Error:
+		errs = append(errs, err)
+	default:
+		errs = append(errs, errcode.ErrorCodeUnknown.WithDetail(err))
+	}
+	return errs
+}
+
 // applyResourcePolicy checks whether the resource class matches what has
 // been authorized and allowed by the policy configuration.
-func (imh *manifestHandler) applyResourcePolicy(manifest distribution.Manifest) error {
-	allowedClasses := imh.App.Config.Policy.Repository.Classes
+func (ctx *Context) applyResourcePolicy(manifest distribution.Manifest) error {
+	allowedClasses := ctx.App.Config.Policy.Repository.Classes
 	if len(allowedClasses) == 0 {
 		return nil
 	}
@@ -457,8 +518,8 @@ func (imh *manifestHandler) applyResourcePolicy(manifest distribution.Manifest)
 		return errcode.ErrorCodeDenied.WithMessage(fmt.Sprintf("registry does not allow %s manifest", class))
 	}
 
-	resources := auth.AuthorizedResources(imh)
-	n := imh.Repository.Named().Name()
+	resources := auth.AuthorizedResources(ctx)
+	n := ctx.Repository.Named().Name()
 
 	var foundResource bool
 	for _, r := range resources {
@@ -493,6 +554,10 @@ func (imh *manifestHandler) DeleteManifest(w http.ResponseWriter, r *http.Reques
 
 	if imh.Tag != "" {
 		dcontext.GetLogger(imh).Debug("DeleteImageTag")
+		if err := imh.checkTagsDelete(imh.Tag); err != nil {
+			imh.appendTagPolicyError(err)
+			return
+		}
 		tagService := imh.Repository.Tags(imh.Context)
 		if err := tagService.Untag(imh.Context, imh.Tag); err != nil {
 			switch err.(type) {
@@ -513,6 +578,20 @@ func (imh *manifestHandler) DeleteManifest(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	tagService := imh.Repository.Tags(imh)
+	if len(imh.immutableTags) > 0 {
+		// deleting the manifest removes its tags as well.
+		referencedTags, err := tagService.Lookup(imh, distribution.Descriptor{Digest: imh.Digest})
+		if err != nil {
+			imh.Errors = append(imh.Errors, err)
+			return
+		}
+		if err := imh.checkTagsDelete(referencedTags...); err != nil {
+			imh.appendTagPolicyError(err)
+			return
+		}
+	}
+
 	err = manifests.Delete(imh, imh.Digest)
 	if err != nil {
 		switch err {
@@ -532,7 +611,6 @@ func (imh *manifestHandler) DeleteManifest(w http.ResponseWriter, r *http.Reques
 		}
 	}
 
-	tagService := imh.Repository.Tags(imh)
 	referencedTags, err := tagService.Lookup(imh, distribution.Descriptor{Digest: imh.Digest})
 	if err != nil {
 		imh.Errors = append(imh.Errors, err)
@@ -548,3 +626,13 @@ func (imh *manifestHandler) DeleteManifest(w http.ResponseWriter, r *http.Reques
 
 	w.WriteHeader(http.StatusAccepted)
 }
+
+// appendTagPolicyError records an error returned while checking the
+// immutable tags policy.
+func (imh *manifestHandler) appendTagPolicyError(err error) {
+	if err, ok := err.(errcode.Error); ok {
+		imh.Errors = append(imh.Errors, err)
+		return
+	}
+	imh.Errors = append(imh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+}
@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/registry/api/errcode"
+	"github.com/distribution/distribution/v3/registry/storage"
+	"github.com/gorilla/handlers"
+)
+
+// quotaDispatcher constructs the quota status api endpoint.
+func quotaDispatcher(ctx *Context, r *http.Request) http.Handler {
+	quotaHandler := &quotaHandler{
+		Context: ctx,
+	}
+
+	return handlers.MethodHandler{
+		"GET": http.HandlerFunc(quotaHandler.GetQuota),
+	}
+}
+
+// quotaHandler reports the storage quotas applying to a repository.
+type quotaHandler struct {
+	*Context
+}
+
+type quotaAPIResponse struct {
+	Name   string                `json:"name"`
+	Quotas []storage.QuotaStatus `json:"quotas"`
+}
+
+// GetQuota returns the quotas covering the repository and their usage.
+func (qh *quotaHandler) GetQuota(w http.ResponseWriter, r *http.Request) {
+	quotas := []storage.QuotaStatus{}
+	if qh.App.quotas != nil {
+		statuses, err := qh.App.quotas.Status(qh, qh.Repository.Named().Name())
+		if err != nil {
+			qh.Errors = append(qh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+			return
+		}
+		quotas = append(quotas, statuses...)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(quotaAPIResponse{
+		Name:   qh.Repository.Named().Name(),
+		Quotas: quotas,
+	}); err != nil {
+		qh.Errors = append(qh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+}
+
+// quotaExceededError maps a quota violation to the error returned to
+// clients.
+func quotaExceededError(err distribution.ErrQuotaExceeded) errcode.Error {
+	return errcode.ErrorCodeDenied.WithMessage(err.Error()).WithDetail(map[string]interface{}{
+		"scope": err.Scope,
+		"limit": err.Limit,
+		"usage": err.Usage,
+		"size":  err.Size,
+	})
+}
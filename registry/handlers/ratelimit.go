@@ -0,0 +1,251 @@
+package handlers
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/distribution/distribution/v3/configuration"
+	dcontext "github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/registry/api/errcode"
+	v2 "github.com/distribution/distribution/v3/registry/api/v2"
+	"github.com/distribution/distribution/v3/registry/auth"
+	"github.com/distribution/distribution/v3/registry/ratelimit"
+)
+
+const (
+	// rateLimitKeyUser keeps buckets by authenticated user. Requests
+	// without one are not limited by user.
+	rateLimitKeyUser = "user"
+	// rateLimitKeyIP keeps buckets by client IP.
+	rateLimitKeyIP = "ip"
+	// rateLimitKeyRepository keeps buckets by repository.
+	rateLimitKeyRepository = "repository"
+
+	// rateLimitBudgetManifests costs a token per manifest request.
+	rateLimitBudgetManifests = "manifests"
+	// rateLimitBudgetBlobBytes costs a token per byte of blob downloaded
+	// or uploaded.
+	rateLimitBudgetBlobBytes = "blobbytes"
+	// rateLimitBudgetUploads costs a token per blob upload started.
+	rateLimitBudgetUploads = "uploads"
+)
+
+// rateLimit gives each user, client IP or repository a token bucket for a
+// budget.
+type rateLimit struct {
+	key    string
+	budget string
+	limit  ratelimit.Limit
+}
+
+// configureRateLimit sets up the rate limits, if any. It must be called once
+// redis is configured.
+func (app *App) configureRateLimit(configuration *configuration.Configuration) {
+	config := configuration.RateLimit
+	if len(config.Limits) == 0 {
+		return
+	}
+
+	if config.TrustedProxies < 0 {
+		panic(fmt.Sprintf("ratelimit: trustedproxies must not be negative, got %d", config.TrustedProxies))
+	}
+	app.trustedProxies = config.TrustedProxies
+
+	for i, rule := range config.Limits {
+		switch rule.Key {
+		case rateLimitKeyUser, rateLimitKeyIP, rateLimitKeyRepository:
+		default:
+			panic(fmt.Sprintf("ratelimit: limit %d: unknown key %q", i, rule.Key))
+		}
+		switch rule.Budget {
+		case rateLimitBudgetManifests, rateLimitBudgetBlobBytes, rateLimitBudgetUploads:
+		default:
+			panic(fmt.Sprintf("ratelimit: limit %d: unknown budget %q", i, rule.Budget))
+		}
+		limit := ratelimit.Limit{Rate: rule.Rate, Burst: rule.Burst}
+		if err := limit.Validate(); err != nil {
+			panic(fmt.Sprintf("ratelimit: limit %d: %v", i, err))
+		}
+		app.rateLimits = append(app.rateLimits, rateLimit{key: rule.Key, budget: rule.Budget, limit: limit})
+	}
+
+	switch config.Store {
+	case "", "memory":
+		app.rateLimitStore = ratelimit.NewMemoryStore()
+	case "redis":
+		if app.redis == nil {
+			panic("ratelimit: the redis store requires redis to be configured")
+		}
+		app.rateLimitStore = ratelimit.NewRedisStore(app.redis)
+	default:
+		panic(fmt.Sprintf("ratelimit: unknown store %q", config.Store))
+	}
+	dcontext.GetLogger(app).Infof("enforcing %d rate limits", len(app.rateLimits))
+}
+
+// rateLimitedRequest is a request covered by rate limits, whose blob bytes
+// are charged once it has been served.
+type rateLimitedRequest struct {
+	blobBytes []rateLimitBucket
+	body      *countingReadCloser
+}
+
+// rateLimitBucket is the bucket of a rate limit a request takes tokens from.
+type rateLimitBucket struct {
+	key   string
+	limit ratelimit.Limit
+}
+
+// limitRate takes tokens from the buckets of the rate limits covering the
+// request. If a bucket lacks tokens, it serves a TOOMANYREQUESTS error with a
+// Retry-After header and returns an error. Buckets which cannot be reached
+// do not limit the request.
+func (app *App) limitRate(w http.ResponseWriter, r *http.Request, ctx *Context) (*rateLimitedRequest, error) {
+	budgets := rateLimitBudgets(r)
+	if len(budgets) == 0 {
+		return nil, nil
+	}
+
+	limited := &rateLimitedRequest{}
+	var wait time.Duration
+	var exceeded rateLimit
+	for _, rl := range app.rateLimits {
+		if !budgets[rl.budget] {
+			continue
+		}
+		value := rateLimitKeyValue(ctx, r, rl.key)
+		if value == "" {
+			continue
+		}
+		bucket := rateLimitBucket{key: rl.budget + ":" + rl.key + ":" + value, limit: rl.limit}
+
+		// blob bytes are only known once the request has been served, so
+		// their bucket is only checked not to be in debt.
+		cost := 1.0
+		if rl.budget == rateLimitBudgetBlobBytes {
+			cost = 0
+			limited.blobBytes = append(limited.blobBytes, bucket)
+		}
+		bucketWait, err := app.rateLimitStore.Take(ctx, bucket.key, bucket.limit, cost)
+		if err != nil {
+			dcontext.GetLogger(ctx).Errorf("error checking rate limit: %v", err)
+			continue
+		}
+		if bucketWait > wait {
+			wait, exceeded = bucketWait, rl
+		}
+	}
+
+	if wait > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		ctx.Errors = append(ctx.Errors, errcode.ErrorCodeTooManyRequests.WithDetail(map[string]string{
+			"key":    exceeded.key,
+			"budget": exceeded.budget,
+		}))
+		if err := errcode.ServeJSON(w, ctx.Errors); err != nil {
+			dcontext.GetLogger(ctx).Errorf("error serving error json: %v (from %v)", err, ctx.Errors)
+		}
+		return nil, fmt.Errorf("%s rate limit by %s exceeded", exceeded.budget, exceeded.key)
+	}
+
+	if len(limited.blobBytes) > 0 {
+		limited.body = &countingReadCloser{ReadCloser: r.Body}
+		r.Body = limited.body
+	}
+	return limited, nil
+}
+
+// chargeRateLimits charges the blob bytes the request downloaded and uploaded.
+func (app *App) chargeRateLimits(ctx *Context, limited *rateLimitedRequest) {
+	if limited == nil || len(limited.blobBytes) == 0 {
+		return
+	}
+
+	written, _ := ctx.Value("http.response.written").(int64)
+	bytes := float64(written + limited.body.n)
+	if bytes == 0 {
+		return
+	}
+	for _, bucket := range limited.blobBytes {
+		if err := app.rateLimitStore.Charge(ctx, bucket.key, bucket.limit, bytes); err != nil {
+			dcontext.GetLogger(ctx).Errorf("error charging rate limit: %v", err)
+		}
+	}
+}
+
+// rateLimitBudgets returns the budgets the request draws from.
+func rateLimitBudgets(r *http.Request) map[string]bool {
+	switch {
+	case isRoute(r, v2.RouteNameManifest):
+		return map[string]bool{rateLimitBudgetManifests: true}
+	case isRoute(r, v2.RouteNameBlob) && (r.Method == http.MethodGet || r.Method == http.MethodHead):
+		return map[string]bool{rateLimitBudgetBlobBytes: true}
+	case isRoute(r, v2.RouteNameBlobUpload) && r.Method == http.MethodPost:
+		return map[string]bool{rateLimitBudgetUploads: true, rateLimitBudgetBlobBytes: true}
+	case isRoute(r, v2.RouteNameBlobUploadChunk) && (r.Method == http.MethodPatch || r.Method == http.MethodPut):
+		return map[string]bool{rateLimitBudgetBlobBytes: true}
+	}
+	return nil
+}
+
+// rateLimitKeyValue returns the user, client IP or repository of the request
+// the buckets of a limit are kept by, or an empty string if the request has
+// none, in which case the limit does not apply.
+func rateLimitKeyValue(ctx *Context, r *http.Request, key string) string {
+	switch key {
+	case rateLimitKeyUser:
+		return dcontext.GetStringValue(ctx, auth.UserNameKey)
+	case rateLimitKeyIP:
+		return rateLimitClientIP(r, ctx.App.trustedProxies)
+	case rateLimitKeyRepository:
+		return getName(ctx)
+	}
+	return ""
+}
+
+// rateLimitClientIP returns the IP of the client of the request. Without
+// trusted proxies, it is the address of the connection, as headers may be
+// forged by clients. Behind trusted proxies, each of which appends the
+// address it got the request from to the X-Forwarded-For header, it is the
+// entry appended by the farthest trusted proxy.
+func rateLimitClientIP(r *http.Request, trustedProxies int) string {
+	if trustedProxies > 0 {
+		var forwarded []string
+		for _, header := range r.Header.Values("X-Forwarded-For") {
+			for _, ip := range strings.Split(header, ",") {
+				forwarded = append(forwarded, strings.TrimSpace(ip))
+			}
+		}
+		if len(forwarded) > 0 {
+			i := len(forwarded) - trustedProxies
+			if i < 0 {
+				i = 0
+			}
+			return forwarded[i]
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// countingReadCloser counts the bytes read from the body of a request.
+type countingReadCloser struct {
+	io.ReadCloser
+	n int64
+}
+
+func (c *countingReadCloser) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,213 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/distribution/distribution/v3"
+	dcontext "github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/notifications"
+	"github.com/distribution/distribution/v3/reference"
+	"github.com/distribution/distribution/v3/registry/api/errcode"
+	v2 "github.com/distribution/distribution/v3/registry/api/v2"
+	"github.com/gorilla/handlers"
+)
+
+// repositoryDispatcher constructs the repository delete api endpoint.
+func repositoryDispatcher(ctx *Context, r *http.Request) http.Handler {
+	repositoryHandler := &repositoryHandler{
+		Context: ctx,
+	}
+
+	handler := handlers.MethodHandler{}
+	if !ctx.readOnly {
+		handler["DELETE"] = http.HandlerFunc(repositoryHandler.DeleteRepository)
+	}
+
+	return handler
+}
+
+// renameDispatcher constructs the repository rename api endpoint.
+func renameDispatcher(ctx *Context, r *http.Request) http.Handler {
+	repositoryHandler := &repositoryHandler{
+		Context: ctx,
+	}
+
+	handler := handlers.MethodHandler{}
+	if !ctx.readOnly {
+		handler["POST"] = http.HandlerFunc(repositoryHandler.RenameRepository)
+	}
+
+	return handler
+}
+
+// repositoryHandler removes and renames whole repositories.
+type repositoryHandler struct {
+	*Context
+}
+
+// DeleteRepository removes the repository, notifying the deletion of each of
+// its tags.
+func (rh *repositoryHandler) DeleteRepository(w http.ResponseWriter, r *http.Request) {
+	if rh.App.repoRemover == nil {
+		rh.Errors = append(rh.Errors, errcode.ErrorCodeUnsupported)
+		return
+	}
+
+	tags, err := rh.tags(rh.Repository)
+	if err != nil {
+		rh.Errors = append(rh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+	if err := rh.checkRepositoryTagsDelete(tags); err != nil {
+		rh.appendRepositoryError(err)
+		return
+	}
+
+	name := rh.Repository.Named()
+	if err := rh.RepositoryRemover.Remove(rh, name); err != nil {
+		rh.appendRepositoryError(err)
+		return
+	}
+
+	listener := rh.App.eventBridge(rh.Context, r)
+	for tag := range tags {
+		if err := listener.TagDeleted(name, tag); err != nil {
+			dcontext.GetLogger(rh).Errorf("error dispatching tag delete to listener: %v", err)
+		}
+	}
+
+	w.Header().Set("Content-Length", "0")
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// RenameRepository moves the repository to a new name. The tags of the
+// repository are notified as deleted from the old name and pushed to the new
+// one.
+func (rh *repositoryHandler) RenameRepository(w http.ResponseWriter, r *http.Request) {
+	to, err := reference.WithName(r.URL.Query().Get("to"))
+	if err != nil {
+		rh.Errors = append(rh.Errors, v2.ErrorCodeNameInvalid.WithDetail(err))
+		return
+	}
+
+	renamer, ok := rh.App.registry.(distribution.RepositoryRenamer)
+	if !ok {
+		rh.Errors = append(rh.Errors, errcode.ErrorCodeUnsupported)
+		return
+	}
+
+	tags, err := rh.tags(rh.Repository)
+	if err != nil {
+		rh.Errors = append(rh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+	if err := rh.checkRepositoryTagsDelete(tags); err != nil {
+		rh.appendRepositoryError(err)
+		return
+	}
+
+	from := rh.Repository.Named()
+	if err := renamer.Rename(rh, from, to); err != nil {
+		rh.appendRepositoryError(err)
+		return
+	}
+
+	listener := rh.App.eventBridge(rh.Context, r)
+	if err := rh.notifyRenamed(listener, from, to, tags); err != nil {
+		dcontext.GetLogger(rh).Errorf("error dispatching repository rename to listener: %v", err)
+	}
+
+	location, err := rh.urlBuilder.BuildTagsURL(to)
+	if err != nil {
+		dcontext.GetLogger(rh).Errorf("error building tags url: %v", err)
+	}
+
+	w.Header().Set("Location", location)
+	w.Header().Set("Content-Length", "0")
+	w.WriteHeader(http.StatusCreated)
+}
+
+// tags returns the tags of the repository with the digests they point to.
+func (rh *repositoryHandler) tags(repository distribution.Repository) (map[string]distribution.Descriptor, error) {
+	tagService := repository.Tags(rh)
+	all, err := tagService.All(rh)
+	if err != nil {
+		if _, ok := err.(distribution.ErrRepositoryUnknown); ok {
+			// a repository may hold layers without any tag
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	tags := make(map[string]distribution.Descriptor, len(all))
+	for _, tag := range all {
+		desc, err := tagService.Get(rh, tag)
+		if err != nil {
+			if _, ok := err.(distribution.ErrTagUnknown); ok {
+				continue
+			}
+			return nil, err
+		}
+		tags[tag] = desc
+	}
+	return tags, nil
+}
+
+// notifyRenamed dispatches the deletion of the tags under the old name of a
+// repository, their push under the new name and the deletion of the old
+// repository.
+func (rh *repositoryHandler) notifyRenamed(listener notifications.Listener, from, to reference.Named, tags map[string]distribution.Descriptor) error {
+	repository, err := rh.App.registry.Repository(rh, to)
+	if err != nil {
+		return err
+	}
+	manifests, err := repository.Manifests(rh)
+	if err != nil {
+		return err
+	}
+
+	for tag, desc := range tags {
+		if err := listener.TagDeleted(from, tag); err != nil {
+			return err
+		}
+		manifest, err := manifests.Get(rh, desc.Digest)
+		if err != nil {
+			return err
+		}
+		if err := listener.ManifestPushed(to, manifest, distribution.WithTag(tag)); err != nil {
+			return err
+		}
+	}
+
+	return listener.RepoDeleted(from)
+}
+
+// checkRepositoryTagsDelete returns a DENIED error if the repository holds
+// immutable tags, which removing the repository would delete.
+func (rh *repositoryHandler) checkRepositoryTagsDelete(tags map[string]distribution.Descriptor) error {
+	names := make([]string, 0, len(tags))
+	for tag := range tags {
+		names = append(names, tag)
+	}
+	return rh.checkTagsDelete(names...)
+}
+
+func (rh *repositoryHandler) appendRepositoryError(err error) {
+	if err == distribution.ErrUnsupported {
+		rh.Errors = append(rh.Errors, errcode.ErrorCodeUnsupported)
+		return
+	}
+
+	switch err := err.(type) {
+	case errcode.Error:
+		rh.Errors = append(rh.Errors, err)
+	case distribution.ErrRepositoryUnknown:
+		rh.Errors = append(rh.Errors, v2.ErrorCodeNameUnknown.WithDetail(err))
+	case distribution.ErrRepositoryExists:
+		rh.Errors = append(rh.Errors, errcode.ErrorCodeDenied.WithMessage(err.Error()))
+	case distribution.ErrQuotaExceeded:
+		rh.Errors = append(rh.Errors, quotaExceededError(err))
+	default:
+		rh.Errors = append(rh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+	}
+}
@@ -0,0 +1,252 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	dcontext "github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/registry/api/errcode"
+	v2 "github.com/distribution/distribution/v3/registry/api/v2"
+	"github.com/distribution/distribution/v3/registry/auth"
+	"github.com/distribution/distribution/v3/registry/auth/policy"
+	"github.com/distribution/distribution/v3/registry/storage"
+	"github.com/gorilla/handlers"
+	"github.com/gorilla/mux"
+)
+
+const (
+	// robotUsernamePrefix prefixes the name of robot accounts in the
+	// username of their credentials, telling them apart from the users of
+	// access controllers.
+	robotUsernamePrefix = "robot$"
+
+	// robotRealm is the realm of the challenge to robot account credentials
+	// which failed to authenticate.
+	robotRealm = "registry robot accounts"
+)
+
+// robotsDispatcher constructs the api endpoint listing and creating robot
+// accounts.
+func robotsDispatcher(ctx *Context, r *http.Request) http.Handler {
+	robotsHandler := &robotsHandler{
+		Context: ctx,
+	}
+
+	handler := handlers.MethodHandler{}
+	if ctx.App.robots != nil {
+		handler["GET"] = http.HandlerFunc(robotsHandler.ListRobots)
+		if !ctx.readOnly {
+			handler["POST"] = http.HandlerFunc(robotsHandler.CreateRobot)
+		}
+	}
+
+	return handler
+}
+
+// robotDispatcher constructs the api endpoint fetching and revoking a robot
+// account.
+func robotDispatcher(ctx *Context, r *http.Request) http.Handler {
+	robotsHandler := &robotsHandler{
+		Context: ctx,
+		Name:    mux.Vars(r)["robot"],
+	}
+
+	handler := handlers.MethodHandler{}
+	if ctx.App.robots != nil {
+		handler["GET"] = http.HandlerFunc(robotsHandler.GetRobot)
+		if !ctx.readOnly {
+			handler["DELETE"] = http.HandlerFunc(robotsHandler.DeleteRobot)
+		}
+	}
+
+	return handler
+}
+
+// robotsHandler manages the robot accounts of the registry.
+type robotsHandler struct {
+	*Context
+
+	// Name is the robot account of the request, if any.
+	Name string
+}
+
+// robotsAPIResponse is the response listing robot accounts.
+type robotsAPIResponse struct {
+	Robots []storage.RobotAccount `json:"robots"`
+}
+
+// createRobotRequest is the body of a request creating a robot account.
+type createRobotRequest struct {
+	Name         string     `json:"name"`
+	Repositories []string   `json:"repositories"`
+	Actions      []string   `json:"actions"`
+	Expires      *time.Time `json:"expires,omitempty"`
+}
+
+// createRobotResponse is the response to a request creating a robot
+// account, the only one to return its secret.
+type createRobotResponse struct {
+	storage.RobotAccount
+	Secret string `json:"secret"`
+}
+
+// ListRobots lists the robot accounts, without their secrets.
+func (rh *robotsHandler) ListRobots(w http.ResponseWriter, r *http.Request) {
+	accounts, err := rh.App.robots.List(rh)
+	if err != nil {
+		rh.Errors = append(rh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+	if accounts == nil {
+		accounts = []storage.RobotAccount{}
+	}
+
+	rh.serveJSON(w, http.StatusOK, robotsAPIResponse{Robots: accounts})
+}
+
+// CreateRobot creates a robot account and returns it with its secret.
+func (rh *robotsHandler) CreateRobot(w http.ResponseWriter, r *http.Request) {
+	var request createRobotRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		rh.Errors = append(rh.Errors, v2.ErrorCodeRobotInvalid.WithDetail(err.Error()))
+		return
+	}
+
+	account := storage.RobotAccount{
+		Name:         request.Name,
+		Repositories: request.Repositories,
+		Actions:      request.Actions,
+		Expires:      request.Expires,
+	}
+	secret, err := rh.App.robots.Create(rh, account)
+	if err != nil {
+		if invalid, ok := err.(storage.ErrRobotAccountInvalid); ok {
+			rh.Errors = append(rh.Errors, v2.ErrorCodeRobotInvalid.WithDetail(invalid.Reason))
+		} else if err == storage.ErrRobotAccountExists {
+			rh.Errors = append(rh.Errors, v2.ErrorCodeRobotInvalid.WithDetail(err.Error()))
+		} else {
+			rh.Errors = append(rh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		}
+		return
+	}
+
+	created, err := rh.App.robots.Get(rh, account.Name)
+	if err != nil {
+		rh.Errors = append(rh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+	dcontext.GetLogger(rh).Infof("created robot account %q", created.Name)
+
+	location, err := rh.urlBuilder.BuildRobotURL(created.Name)
+	if err != nil {
+		dcontext.GetLogger(rh).Errorf("error building robot url: %v", err)
+	}
+	w.Header().Set("Location", location)
+	rh.serveJSON(w, http.StatusCreated, createRobotResponse{RobotAccount: created, Secret: secret})
+}
+
+// GetRobot returns the robot account, without its secret.
+func (rh *robotsHandler) GetRobot(w http.ResponseWriter, r *http.Request) {
+	account, err := rh.App.robots.Get(rh, rh.Name)
+	if err != nil {
+		rh.appendRobotError(err)
+		return
+	}
+
+	rh.serveJSON(w, http.StatusOK, account)
+}
+
+// DeleteRobot revokes the robot account.
+func (rh *robotsHandler) DeleteRobot(w http.ResponseWriter, r *http.Request) {
+	if err := rh.App.robots.Delete(rh, rh.Name); err != nil {
+		rh.appendRobotError(err)
+		return
+	}
+	rh.App.robotPolicies.forget(rh.Name)
+	dcontext.GetLogger(rh).Infof("revoked robot account %q", rh.Name)
+
+	w.Header().Set("Content-Length", "0")
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (rh *robotsHandler) appendRobotError(err error) {
+	if err == storage.ErrRobotAccountUnknown {
+		rh.Errors = append(rh.Errors, v2.ErrorCodeRobotUnknown.WithDetail(map[string]string{"robot": rh.Name}))
+		return
+	}
+	rh.Errors = append(rh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+}
+
+func (rh *robotsHandler) serveJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		dcontext.GetLogger(rh).Errorf("error encoding robot account response: %v", err)
+	}
+}
+
+// robotAccount returns the name of the robot account the username of basic
+// authentication credentials designates, if any.
+func robotAccount(username string) (string, bool) {
+	if !strings.HasPrefix(username, robotUsernamePrefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(username, robotUsernamePrefix), true
+}
+
+// robotPolicies holds the policies compiled from the repositories and
+// actions of robot accounts, so that their patterns are compiled once rather
+// than on every request.
+type robotPolicies struct {
+	mu       sync.Mutex
+	policies map[string]robotPolicy
+}
+
+// robotPolicy is the policy of a robot account, created at the given time.
+// Robot accounts are not modified once created, but may be revoked and
+// created again with the same name.
+type robotPolicy struct {
+	created time.Time
+	policy  *policy.Policy
+}
+
+// allows reports whether the robot account grants the access. Robot accounts
+// only access repositories matching one of their glob patterns.
+func (rp *robotPolicies) allows(account storage.RobotAccount, access auth.Access) bool {
+	if access.Type != "repository" {
+		return false
+	}
+
+	rp.mu.Lock()
+	cached, ok := rp.policies[account.Name]
+	rp.mu.Unlock()
+	if !ok || !cached.created.Equal(account.Created) {
+		p, err := policy.New(policy.Config{Rules: []policy.RuleConfig{{
+			Users:        []string{account.Name},
+			Repositories: account.Repositories,
+			Actions:      account.Actions,
+		}}})
+		if err != nil {
+			return false
+		}
+		cached = robotPolicy{created: account.Created, policy: p}
+
+		rp.mu.Lock()
+		if rp.policies == nil {
+			rp.policies = make(map[string]robotPolicy)
+		}
+		rp.policies[account.Name] = cached
+		rp.mu.Unlock()
+	}
+	return cached.policy.Allows(account.Name, access)
+}
+
+// forget drops the policy of the revoked robot account.
+func (rp *robotPolicies) forget(name string) {
+	rp.mu.Lock()
+	delete(rp.policies, name)
+	rp.mu.Unlock()
+}
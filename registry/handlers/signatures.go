@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/configuration"
+	dcontext "github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/registry/api/errcode"
+	"github.com/distribution/distribution/v3/registry/signature"
+	"github.com/opencontainers/go-digest"
+)
+
+// signaturePolicy is the compiled form of a configuration.SignaturePolicy.
+type signaturePolicy struct {
+	repositories []*regexp.Regexp
+	verifier     *signature.Verifier
+	verifyOnPull bool
+}
+
+// newSignaturePolicies loads the keys and compiles the repository expressions
+// of the signature policies.
+func newSignaturePolicies(policies []configuration.SignaturePolicy) ([]signaturePolicy, error) {
+	compiled := make([]signaturePolicy, 0, len(policies))
+	for _, policy := range policies {
+		if len(policy.Repositories) == 0 || len(policy.Keys) == 0 {
+			return nil, fmt.Errorf("repositories and keys are required, got %d repositories with %d keys", len(policy.Repositories), len(policy.Keys))
+		}
+
+		repositories := make([]*regexp.Regexp, 0, len(policy.Repositories))
+		for _, repository := range policy.Repositories {
+			re, err := regexp.Compile("^(?:" + repository + ")$")
+			if err != nil {
+				return nil, err
+			}
+			repositories = append(repositories, re)
+		}
+
+		keys, err := signature.LoadPublicKeys(policy.Keys...)
+		if err != nil {
+			return nil, err
+		}
+		verifier, err := signature.NewVerifier(keys...)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %v", policy.Keys, err)
+		}
+
+		compiled = append(compiled, signaturePolicy{
+			repositories: repositories,
+			verifier:     verifier,
+			verifyOnPull: policy.VerifyOnPull,
+		})
+	}
+	return compiled, nil
+}
+
+// matches reports whether the policy applies to the repository.
+func (policy *signaturePolicy) matches(repo string) bool {
+	for _, re := range policy.repositories {
+		if re.MatchString(repo) {
+			return true
+		}
+	}
+	return false
+}
+
+// verifySignature checks that the manifest with the given digest is signed
+// as required by the signature policies of the repository, when it is pushed
+// or pulled with the tag. Signature manifests are exempt under the signature
+// tag of a manifest of the repository, as they hold the signatures
+// themselves. The manifest is read from the repository if it is nil. Each
+// check is recorded in the log.
+func (ctx *Context) verifySignature(tag string, dgst digest.Digest, manifest distribution.Manifest, pull bool) error {
+	repo := ctx.Repository.Named().Name()
+	var policies []signaturePolicy
+	for _, policy := range ctx.signatures {
+		if policy.matches(repo) && (!pull || policy.verifyOnPull) {
+			policies = append(policies, policy)
+		}
+	}
+	if len(policies) == 0 {
+		return nil
+	}
+
+	if signature.IsSignatureTag(tag) {
+		exempt, err := ctx.isSignatureManifest(tag, dgst, manifest)
+		if err != nil {
+			return err
+		}
+		if exempt {
+			return nil
+		}
+	}
+
+	action := "push"
+	if pull {
+		action = "pull"
+	}
+
+	for _, policy := range policies {
+		err := policy.verifier.Verify(ctx, ctx.Repository, dgst)
+		if err != nil && err != signature.ErrNotSigned {
+			return err
+		}
+
+		logger := dcontext.GetLoggerWithFields(ctx, map[interface{}]interface{}{
+			"audit":              "signature",
+			"signature.action":   action,
+			"signature.tag":      tag,
+			"signature.digest":   dgst,
+			"signature.verified": err == nil,
+		}, "audit", "signature.action", "signature.tag", "signature.digest", "signature.verified")
+		if err != nil {
+			logger.Warn("denied unsigned manifest")
+			return errcode.ErrorCodeDenied.WithMessage(fmt.Sprintf("manifest %s is not signed by a trusted key", dgst))
+		}
+		logger.Info("verified manifest signature")
+	}
+	return nil
+}
+
+// isSignatureManifest reports whether the manifest with the given digest is
+// a signature manifest stored under its signature tag.
+func (ctx *Context) isSignatureManifest(tag string, dgst digest.Digest, manifest distribution.Manifest) (bool, error) {
+	if manifest == nil {
+		manifests, err := ctx.Repository.Manifests(ctx)
+		if err != nil {
+			return false, err
+		}
+		manifest, err = manifests.Get(ctx, dgst)
+		if err != nil {
+			if _, ok := err.(distribution.ErrManifestUnknownRevision); ok {
+				return false, nil
+			}
+			return false, err
+		}
+	}
+	return signature.IsSignatureManifest(ctx, ctx.Repository, tag, manifest)
+}
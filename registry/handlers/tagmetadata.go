@@ -0,0 +1,327 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/manifest/manifestlist"
+	"github.com/distribution/distribution/v3/registry/api/errcode"
+	v2 "github.com/distribution/distribution/v3/registry/api/v2"
+	"github.com/gorilla/handlers"
+	"github.com/opencontainers/go-digest"
+)
+
+const (
+	tagSortName = "name"
+	tagSortTime = "time"
+)
+
+// tagMetadataDispatcher constructs the tag metadata api endpoint.
+func tagMetadataDispatcher(ctx *Context, r *http.Request) http.Handler {
+	tagMetadataHandler := &tagMetadataHandler{
+		Context: ctx,
+	}
+
+	return handlers.MethodHandler{
+		"GET": http.HandlerFunc(tagMetadataHandler.GetTagMetadata),
+	}
+}
+
+// tagMetadataHandler lists the tags of a repository along with the
+// manifests they point to.
+type tagMetadataHandler struct {
+	*Context
+}
+
+// tagMetadata describes a tag and the manifest it points to.
+type tagMetadata struct {
+	Name      string        `json:"name"`
+	Digest    digest.Digest `json:"digest"`
+	MediaType string        `json:"mediaType"`
+	Size      int64         `json:"size"`
+	ModTime   *time.Time    `json:"modTime,omitempty"`
+}
+
+type tagMetadataAPIResponse struct {
+	Name string        `json:"name"`
+	Tags []tagMetadata `json:"tags"`
+}
+
+// GetTagMetadata returns a page of tags of the repository with their
+// metadata, sorted by name or by the time they were last updated.
+func (th *tagMetadataHandler) GetTagMetadata(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	q := r.URL.Query()
+	sortBy := q.Get("sort")
+	if sortBy == "" {
+		sortBy = tagSortName
+	}
+	if sortBy != tagSortName && sortBy != tagSortTime {
+		th.Errors = append(th.Errors, errcode.ErrorCodeUnsupported.WithMessage(fmt.Sprintf("unsupported sort order %q", sortBy)))
+		return
+	}
+
+	maxEntries := -1
+	if n := q.Get("n"); n != "" {
+		var err error
+		maxEntries, err = strconv.Atoi(n)
+		if err != nil || maxEntries < 0 {
+			th.Errors = append(th.Errors, v2.ErrorCodePaginationNumberInvalid.WithDetail(map[string]string{"n": n}))
+			return
+		}
+	}
+
+	tagService := th.Repository.Tags(th)
+	provider, _ := tagService.(distribution.TagModTimeProvider)
+
+	var tags []string
+	var modTimes map[string]time.Time
+	var link string
+	var err error
+	if sortBy == tagSortTime {
+		tags, modTimes, link, err = th.pageByTime(r, tagService, provider, maxEntries)
+	} else {
+		tags, link, err = th.pageByName(r, tagService, maxEntries)
+	}
+	if err != nil {
+		th.appendTagError(err)
+		return
+	}
+
+	// only the tags of the page need their modification time when
+	// sorting by name
+	if modTimes == nil {
+		modTimes, err = tagModTimes(th, provider, tags)
+		if err != nil {
+			th.appendTagError(err)
+			return
+		}
+	}
+
+	manifests, err := th.Repository.Manifests(th)
+	if err != nil {
+		th.Errors = append(th.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+
+	entries := make([]tagMetadata, 0, len(tags))
+	for _, tag := range tags {
+		desc, err := tagService.Get(th, tag)
+		if err != nil {
+			if _, ok := err.(distribution.ErrTagUnknown); ok {
+				continue
+			}
+			th.appendTagError(err)
+			return
+		}
+
+		entry, err := th.describe(manifests, desc.Digest)
+		if err != nil {
+			th.Errors = append(th.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+			return
+		}
+		entry.Name = tag
+		if modTime, ok := modTimes[tag]; ok {
+			entry.ModTime = &modTime
+		}
+		entries = append(entries, entry)
+	}
+
+	if link != "" {
+		w.Header().Set("Link", link)
+	}
+	w.Header().Set("Content-Type", "application/json")
+
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(tagMetadataAPIResponse{
+		Name: th.Repository.Named().Name(),
+		Tags: entries,
+	}); err != nil {
+		th.Errors = append(th.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+}
+
+// pageByName returns a page of tags sorted by name, along with the link to
+// the next page, if any. Only the tags of the page are listed from tag
+// services which support it.
+func (th *tagMetadataHandler) pageByName(r *http.Request, tagService distribution.TagService, maxEntries int) ([]string, string, error) {
+	tags, err := listTags(th, tagService, r.URL.Query().Get("last"), maxEntries)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var link string
+	if maxEntries >= 0 && maxEntries < len(tags) {
+		if maxEntries > 0 {
+			// defined in `catalog.go`
+			link, err = createLinkEntry(r.URL.String(), maxEntries, tags[maxEntries-1])
+			if err != nil {
+				return nil, "", err
+			}
+		}
+		tags = tags[:maxEntries]
+	}
+	return tags, link, nil
+}
+
+// pageByTime returns a page of tags sorted by the time they were last
+// updated, most recent first, along with their modification times and the
+// link to the next page, if any. Ordering needs the modification time of
+// every tag. The link carries the modification time of the last tag of the
+// page, so that the next page resumes where that tag sorted even if it was
+// removed or updated since.
+func (th *tagMetadataHandler) pageByTime(r *http.Request, tagService distribution.TagService, provider distribution.TagModTimeProvider, maxEntries int) ([]string, map[string]time.Time, string, error) {
+	tags, err := tagService.All(th)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	modTimes, err := tagModTimes(th, provider, tags)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	if len(modTimes) == 0 && len(tags) > 0 {
+		return nil, nil, "", errcode.ErrorCodeUnsupported.WithMessage("tag modification times are not available")
+	}
+
+	// tags untagged since listing are left out
+	tags = tags[:0]
+	for tag := range modTimes {
+		tags = append(tags, tag)
+	}
+	before := func(ti time.Time, i string, tj time.Time, j string) bool {
+		if !ti.Equal(tj) {
+			return ti.After(tj)
+		}
+		return i < j
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		return before(modTimes[tags[i]], tags[i], modTimes[tags[j]], tags[j])
+	})
+
+	q := r.URL.Query()
+	if lastEntry := q.Get("last"); lastEntry != "" {
+		lastModTime, ok := modTimes[lastEntry]
+		if s := q.Get("lastmodtime"); s != "" {
+			lastModTime, err = time.Parse(time.RFC3339Nano, s)
+			if err != nil {
+				return nil, nil, "", errcode.ErrorCodeUnsupported.WithMessage(fmt.Sprintf("invalid lastmodtime %q", s))
+			}
+		} else if !ok {
+			return nil, nil, "", errcode.ErrorCodeUnsupported.WithMessage(fmt.Sprintf("tag %q is unknown, lastmodtime is required to resume after it", lastEntry))
+		}
+		tags = tags[sort.Search(len(tags), func(i int) bool {
+			return before(lastModTime, lastEntry, modTimes[tags[i]], tags[i])
+		}):]
+	}
+
+	var link string
+	if maxEntries >= 0 && maxEntries < len(tags) {
+		if maxEntries > 0 {
+			lastEntry := tags[maxEntries-1]
+			linkURL := *r.URL
+			q := linkURL.Query()
+			q.Set("lastmodtime", modTimes[lastEntry].Format(time.RFC3339Nano))
+			linkURL.RawQuery = q.Encode()
+			// defined in `catalog.go`
+			link, err = createLinkEntry(linkURL.String(), maxEntries, lastEntry)
+			if err != nil {
+				return nil, nil, "", err
+			}
+		}
+		tags = tags[:maxEntries]
+	}
+	return tags, modTimes, link, nil
+}
+
+// tagModTimes returns the modification times of the given tags, leaving out
+// the tags removed since they were listed. It returns no times if the tag
+// service does not report them.
+func tagModTimes(ctx context.Context, provider distribution.TagModTimeProvider, tags []string) (map[string]time.Time, error) {
+	modTimes := make(map[string]time.Time)
+	if provider == nil {
+		return modTimes, nil
+	}
+	for _, tag := range tags {
+		modTime, err := provider.ModTime(ctx, tag)
+		if err == distribution.ErrUnsupported {
+			break
+		}
+		if err != nil {
+			if _, ok := err.(distribution.ErrTagUnknown); ok {
+				// untagged since listing
+				continue
+			}
+			return nil, err
+		}
+		modTimes[tag] = modTime
+	}
+	return modTimes, nil
+}
+
+// describe returns the metadata of the manifest with the given digest. The
+// size includes the manifest and every blob it references, counting blobs
+// shared between the manifests of an index once.
+func (th *tagMetadataHandler) describe(manifests distribution.ManifestService, dgst digest.Digest) (tagMetadata, error) {
+	manifest, err := manifests.Get(th, dgst)
+	if err != nil {
+		return tagMetadata{}, err
+	}
+	mediaType, payload, err := manifest.Payload()
+	if err != nil {
+		return tagMetadata{}, err
+	}
+
+	seen := map[digest.Digest]struct{}{dgst: {}}
+	size := int64(len(payload))
+
+	var addReferences func(m distribution.Manifest) error
+	addReferences = func(m distribution.Manifest) error {
+		_, isList := m.(*manifestlist.DeserializedManifestList)
+		for _, ref := range m.References() {
+			if _, ok := seen[ref.Digest]; ok {
+				continue
+			}
+			seen[ref.Digest] = struct{}{}
+			size += ref.Size
+
+			if isList {
+				child, err := manifests.Get(th, ref.Digest)
+				if err != nil {
+					return err
+				}
+				if err := addReferences(child); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	if err := addReferences(manifest); err != nil {
+		return tagMetadata{}, err
+	}
+
+	return tagMetadata{
+		Digest:    dgst,
+		MediaType: mediaType,
+		Size:      size,
+	}, nil
+}
+
+func (th *tagMetadataHandler) appendTagError(err error) {
+	switch err := err.(type) {
+	case distribution.ErrRepositoryUnknown:
+		th.Errors = append(th.Errors, v2.ErrorCodeNameUnknown.WithDetail(map[string]string{"name": th.Repository.Named().Name()}))
+	case errcode.Error:
+		th.Errors = append(th.Errors, err)
+	default:
+		th.Errors = append(th.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+	}
+}
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"sort"
@@ -37,8 +38,21 @@ type tagsAPIResponse struct {
 func (th *tagsHandler) GetTags(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
 
-	tagService := th.Repository.Tags(th)
-	tags, err := tagService.All(th)
+	q := r.URL.Query()
+	lastEntry := q.Get("last")
+
+	// a negative maxEntries means that the user did not request `n` entries
+	maxEntries := -1
+	if n := q.Get("n"); n != "" {
+		var err error
+		maxEntries, err = strconv.Atoi(n)
+		if err != nil || maxEntries < 0 {
+			th.Errors = append(th.Errors, v2.ErrorCodePaginationNumberInvalid.WithDetail(map[string]string{"n": n}))
+			return
+		}
+	}
+
+	tags, err := listTags(th, th.Repository.Tags(th), lastEntry, maxEntries)
 	if err != nil {
 		switch err := err.(type) {
 		case distribution.ErrRepositoryUnknown:
@@ -51,39 +65,9 @@ func (th *tagsHandler) GetTags(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// do pagination if requested
-	q := r.URL.Query()
-	// get entries after latest, if any specified
-	if lastEntry := q.Get("last"); lastEntry != "" {
-		lastEntryIndex := sort.SearchStrings(tags, lastEntry)
-
-		// as`sort.SearchStrings` can return len(tags), if the
-		// specified `lastEntry` is not found, we need to
-		// ensure it does not panic when slicing.
-		if lastEntryIndex == len(tags) {
-			tags = []string{}
-		} else {
-			tags = tags[lastEntryIndex+1:]
-		}
-	}
-
-	// if no error, means that the user requested `n` entries
-	if n := q.Get("n"); n != "" {
-		maxEntries, err := strconv.Atoi(n)
-		if err != nil || maxEntries < 0 {
-			th.Errors = append(th.Errors, v2.ErrorCodePaginationNumberInvalid.WithDetail(map[string]string{"n": n}))
-			return
-		}
-
-		// if there is requested more than or
-		// equal to the amount of tags we have,
-		// then set the request to equal `len(tags)`.
-		// the reason for the `=`, is so the else
-		// clause will only activate if there
-		// are tags left the user needs.
-		if maxEntries >= len(tags) {
-			maxEntries = len(tags)
-		} else if maxEntries > 0 {
+	// only link to a next page if there are tags left the user needs.
+	if maxEntries >= 0 && maxEntries < len(tags) {
+		if maxEntries > 0 {
 			// defined in `catalog.go`
 			urlStr, err := createLinkEntry(r.URL.String(), maxEntries, tags[maxEntries-1])
 			if err != nil {
@@ -107,3 +91,35 @@ func (th *tagsHandler) GetTags(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 }
+
+// listTags returns the tags sorting after lastEntry, including one more than
+// maxEntries when there are further tags, so that the caller can tell
+// whether another page follows. A negative maxEntries returns every tag.
+func listTags(ctx context.Context, tagService distribution.TagService, lastEntry string, maxEntries int) ([]string, error) {
+	if lister, ok := tagService.(distribution.TagLister); ok {
+		n := maxEntries
+		if n >= 0 {
+			n++
+		}
+		tags, err := lister.List(ctx, lastEntry, n)
+		if err != distribution.ErrUnsupported {
+			return tags, err
+		}
+	}
+
+	tags, err := tagService.All(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// get entries after latest, if any specified
+	if lastEntry != "" {
+		lastEntryIndex := sort.SearchStrings(tags, lastEntry)
+		if lastEntryIndex < len(tags) && tags[lastEntryIndex] == lastEntry {
+			lastEntryIndex++
+		}
+		tags = tags[lastEntryIndex:]
+	}
+
+	return tags, nil
+}
@@ -0,0 +1,277 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/distribution/distribution/v3/configuration"
+	dcontext "github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/registry/api/errcode"
+	"github.com/distribution/distribution/v3/registry/auth"
+	"github.com/distribution/distribution/v3/registry/auth/token"
+	"github.com/distribution/distribution/v3/registry/storage"
+	"github.com/docker/libtrust"
+)
+
+const (
+	// defaultTokenIssuerPath is where the token endpoint is served by
+	// default. It matches the realm of the token access controller when
+	// autoredirect is set.
+	defaultTokenIssuerPath = "/auth/token"
+
+	// defaultTokenIssuerName is the issuer name inserted into tokens by
+	// default.
+	defaultTokenIssuerName = "registry-token-issuer"
+
+	// defaultTokenExpiration is how long issued tokens are valid by default.
+	defaultTokenExpiration = 5 * time.Minute
+)
+
+// tokenIssuer serves tokens trusted by the token access controller. It
+// authenticates the credentials of token requests with an access
+// controller, such as htpasswd, whose policy decides which of the requested
+// access to grant. Without a policy, tokens grant no access to its users.
+// Robot accounts are authenticated and authorized on their own, if enabled.
+type tokenIssuer struct {
+	issuer        *token.Issuer
+	path          string
+	realm         string
+	service       string
+	authenticator auth.CredentialAuthenticator
+	authorizer    auth.AccessAuthorizer
+	robots        *storage.RobotAccounts
+	robotPolicies *robotPolicies
+}
+
+// tokenResponse is the response to a token request, as expected by docker
+// clients and OAuth2 password grants alike.
+type tokenResponse struct {
+	Token       string `json:"token"`
+	AccessToken string `json:"access_token"`
+	ExpiresIn   int    `json:"expires_in"`
+	IssuedAt    string `json:"issued_at"`
+}
+
+// newTokenIssuer configures the authenticator and loads or generates the
+// signing key of the token issuer.
+func newTokenIssuer(config configuration.TokenIssuer) (*tokenIssuer, error) {
+	authType := config.Authenticator.Type()
+	if authType == "" {
+		return nil, errors.New("an authenticator is required")
+	}
+	if config.Service == "" {
+		return nil, errors.New("a service is required")
+	}
+
+	name := config.Issuer
+	if name == "" {
+		name = defaultTokenIssuerName
+	}
+
+	options := make(map[string]interface{}, len(config.Authenticator.Parameters())+1)
+	for k, v := range config.Authenticator.Parameters() {
+		options[k] = v
+	}
+	if _, ok := options["realm"]; !ok {
+		options["realm"] = name
+	}
+	realm, _ := options["realm"].(string)
+
+	accessController, err := auth.GetAccessController(authType, options)
+	if err != nil {
+		return nil, fmt.Errorf("unable to configure authenticator (%s): %v", authType, err)
+	}
+	authenticator, ok := accessController.(auth.CredentialAuthenticator)
+	if !ok {
+		return nil, fmt.Errorf("authenticator %q cannot authenticate credentials", authType)
+	}
+	authorizer, ok := accessController.(auth.AccessAuthorizer)
+	if !ok || !authorizer.HasPolicy() {
+		authorizer = nil
+	}
+
+	var signingKey libtrust.PrivateKey
+	if config.SigningKey != "" {
+		signingKey, err = libtrust.LoadKeyFile(config.SigningKey)
+	} else {
+		signingKey, err = libtrust.GenerateECP256PrivateKey()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to load signing key: %v", err)
+	}
+
+	expiration := config.Expiration
+	if expiration == 0 {
+		expiration = defaultTokenExpiration
+	}
+
+	path := config.Path
+	if path == "" {
+		path = defaultTokenIssuerPath
+	}
+
+	return &tokenIssuer{
+		issuer: &token.Issuer{
+			Issuer:     name,
+			SigningKey: signingKey,
+			Expiration: expiration,
+		},
+		path:          path,
+		realm:         realm,
+		service:       config.Service,
+		authenticator: authenticator,
+		authorizer:    authorizer,
+	}, nil
+}
+
+// accessControllerOptions returns the options of the token access controller
+// with the signing key of the issuer trusted, the issuer name defaulting to
+// that of the issuer and the realm to the token endpoint on the registry
+// host, if known.
+func (ti *tokenIssuer) accessControllerOptions(options map[string]interface{}, host string) map[string]interface{} {
+	withIssuer := make(map[string]interface{}, len(options)+3)
+	for k, v := range options {
+		withIssuer[k] = v
+	}
+	withIssuer["trustedkeys"] = []libtrust.PublicKey{ti.issuer.SigningKey.PublicKey()}
+	if _, ok := withIssuer["issuer"]; !ok {
+		withIssuer["issuer"] = ti.issuer.Issuer
+	}
+	if _, ok := withIssuer["realm"]; !ok && host != "" {
+		withIssuer["realm"] = strings.TrimSuffix(host, "/") + ti.path
+	}
+	return withIssuer
+}
+
+// ServeHTTP issues a token for the credentials of the request, given as
+// basic authentication for GET requests or as an OAuth2 password grant for
+// POST requests.
+func (ti *tokenIssuer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var (
+		username, password, service string
+		scopes                      []string
+	)
+	switch r.Method {
+	case http.MethodPost:
+		if grantType := r.PostFormValue("grant_type"); grantType != "password" {
+			if err := errcode.ServeJSON(w, errcode.ErrorCodeUnsupported.WithDetail(fmt.Sprintf("unsupported grant_type %q", grantType))); err != nil {
+				dcontext.GetLogger(ctx).Errorf("error serving error json: %v", err)
+			}
+			return
+		}
+		username, password = r.PostFormValue("username"), r.PostFormValue("password")
+		service = r.PostFormValue("service")
+		scopes = strings.Fields(r.PostFormValue("scope"))
+	default:
+		username, password, _ = r.BasicAuth()
+		service = r.URL.Query().Get("service")
+		scopes = r.URL.Query()["scope"]
+	}
+
+	if username == "" {
+		ti.challenge(ctx, w, auth.ErrInvalidCredential)
+		return
+	}
+	if service != ti.service {
+		if err := errcode.ServeJSON(w, errcode.ErrorCodeDenied.WithMessage(fmt.Sprintf("tokens are not issued for service %q", service))); err != nil {
+			dcontext.GetLogger(ctx).Errorf("error serving error json: %v", err)
+		}
+		return
+	}
+
+	var allows func(auth.Access) bool
+	if name, ok := robotAccount(username); ok && ti.robots != nil {
+		account, err := ti.robots.Authenticate(ctx, name, password)
+		if err != nil {
+			dcontext.GetLogger(ctx).Errorf("error authenticating robot account %q: %v", name, err)
+			ti.challenge(ctx, w, auth.ErrAuthenticationFailure)
+			return
+		}
+		allows = func(access auth.Access) bool {
+			return ti.robotPolicies.allows(account, access)
+		}
+	} else {
+		if err := ti.authenticator.AuthenticateUser(username, password); err != nil {
+			dcontext.GetLogger(ctx).Errorf("error authenticating user %q: %v", username, err)
+			ti.challenge(ctx, w, auth.ErrAuthenticationFailure)
+			return
+		}
+		allows = func(access auth.Access) bool {
+			return ti.authorizer != nil && ti.authorizer.AuthorizeUser(username, access)
+		}
+	}
+
+	requested := parseScopes(ctx, scopes)
+	var granted []auth.Access
+	for _, access := range requested {
+		if allows(access) {
+			granted = append(granted, access)
+		}
+	}
+
+	raw, err := ti.issuer.CreateJWT(username, service, granted)
+	if err != nil {
+		dcontext.GetLogger(ctx).Errorf("error creating token: %v", err)
+		if err := errcode.ServeJSON(w, errcode.ErrorCodeUnknown); err != nil {
+			dcontext.GetLogger(ctx).Errorf("error serving error json: %v", err)
+		}
+		return
+	}
+	dcontext.GetLoggerWithField(ctx, auth.UserNameKey, username).Infof("issued token granting %d of %d requested actions", len(granted), len(requested))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := json.NewEncoder(w).Encode(tokenResponse{
+		Token:       raw,
+		AccessToken: raw,
+		ExpiresIn:   int(ti.issuer.Expiration.Seconds()),
+		IssuedAt:    time.Now().UTC().Format(time.RFC3339),
+	}); err != nil {
+		dcontext.GetLogger(ctx).Errorf("error encoding token response: %v", err)
+	}
+}
+
+// challenge responds to a request which failed to authenticate with a basic
+// authentication challenge.
+func (ti *tokenIssuer) challenge(ctx context.Context, w http.ResponseWriter, err error) {
+	w.Header().Set("WWW-Authenticate", fmt.Sprintf("Basic realm=%q", ti.realm))
+	if err := errcode.ServeJSON(w, errcode.ErrorCodeUnauthorized.WithDetail(err.Error())); err != nil {
+		dcontext.GetLogger(ctx).Errorf("error serving error json: %v", err)
+	}
+}
+
+// parseScopes converts the scopes of a token request, such as
+// "repository:foo/bar:pull,push", into the requested access. Resource types
+// may carry a class, as in "repository(plugin):foo/bar:pull".
+func parseScopes(ctx context.Context, scopes []string) []auth.Access {
+	var requested []auth.Access
+	for _, scope := range scopes {
+		typeEnd, actionsStart := strings.Index(scope, ":"), strings.LastIndex(scope, ":")
+		if typeEnd < 0 || typeEnd == actionsStart {
+			dcontext.GetLogger(ctx).Infof("ignoring unsupported scope format %s", scope)
+			continue
+		}
+
+		resource := auth.Resource{
+			Type: scope[:typeEnd],
+			Name: scope[typeEnd+1 : actionsStart],
+		}
+		if i := strings.Index(resource.Type, "("); i > 0 && strings.HasSuffix(resource.Type, ")") {
+			resource.Type, resource.Class = resource.Type[:i], resource.Type[i+1:len(resource.Type)-1]
+		}
+
+		for _, action := range strings.Split(scope[actionsStart+1:], ",") {
+			if action != "" {
+				requested = append(requested, auth.Access{Resource: resource, Action: action})
+			}
+		}
+	}
+	return requested
+}
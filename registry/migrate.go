@@ -0,0 +1,75 @@
+package registry
+
+import (
+	"fmt"
+	"os"
+
+	dcontext "github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/registry/storage"
+	"github.com/distribution/distribution/v3/registry/storage/driver/factory"
+	"github.com/spf13/cobra"
+)
+
+var migrateFrom string
+var migrateTo string
+var migrateCheckpoint string
+var migrateConcurrency int
+var migrateIncremental bool
+
+// MigrateCmd is the cobra command that corresponds to the migrate subcommand
+var MigrateCmd = &cobra.Command{
+	Use:   "migrate --from <config> --to <config>",
+	Short: "`migrate` copies the registry storage between drivers",
+	Long: "`migrate` copies the registry storage from the driver configured in --from " +
+		"to the driver configured in --to. Content already present at the destination " +
+		"is skipped and a checkpoint allows resuming an interrupted migration. Run a " +
+		"final pass with --incremental while the source is read-only to also remove " +
+		"content deleted from the source since the previous pass.",
+	Run: func(cmd *cobra.Command, args []string) {
+		if migrateFrom == "" || migrateTo == "" {
+			fmt.Fprintln(os.Stderr, "both --from and --to must be specified")
+			cmd.Usage()
+			os.Exit(1)
+		}
+
+		srcConfig, err := resolveConfiguration([]string{migrateFrom})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "source configuration error: %v\n", err)
+			os.Exit(1)
+		}
+		dstConfig, err := resolveConfiguration([]string{migrateTo})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "destination configuration error: %v\n", err)
+			os.Exit(1)
+		}
+
+		src, err := factory.Create(srcConfig.Storage.Type(), srcConfig.Storage.Parameters())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to construct source %s driver: %v", srcConfig.Storage.Type(), err)
+			os.Exit(1)
+		}
+		dst, err := factory.Create(dstConfig.Storage.Type(), dstConfig.Storage.Parameters())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to construct destination %s driver: %v", dstConfig.Storage.Type(), err)
+			os.Exit(1)
+		}
+
+		ctx := dcontext.Background()
+		ctx, err = configureLogging(ctx, srcConfig)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "unable to configure logging with config: %s", err)
+			os.Exit(1)
+		}
+
+		report, err := storage.Migrate(ctx, src, dst, storage.MigrateOpts{
+			Concurrency: migrateConcurrency,
+			Checkpoint:  migrateCheckpoint,
+			Incremental: migrateIncremental,
+		})
+		emit("%d objects copied (%d bytes), %d skipped, %d removed", report.Copied, report.Bytes, report.Skipped, report.Removed)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to migrate: %v", err)
+			os.Exit(1)
+		}
+	},
+}
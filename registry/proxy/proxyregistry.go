@@ -118,6 +118,14 @@ func (pr *proxyingRegistry) Repositories(ctx context.Context, repos []string, la
 	return pr.embedded.Repositories(ctx, repos, last)
 }
 
+func (pr *proxyingRegistry) RepositoriesWithPrefix(ctx context.Context, prefix string, repos []string, last string) (n int, err error) {
+	lister, ok := pr.embedded.(distribution.RepositoryPrefixLister)
+	if !ok {
+		return 0, distribution.ErrUnsupported
+	}
+	return lister.RepositoriesWithPrefix(ctx, prefix, repos, last)
+}
+
 func (pr *proxyingRegistry) Repository(ctx context.Context, name reference.Named) (distribution.Repository, error) {
 	c := pr.authChallenger
 
@@ -14,6 +14,7 @@ type proxyTagService struct {
 }
 
 var _ distribution.TagService = proxyTagService{}
+var _ distribution.TagLister = proxyTagService{}
 
 // Get attempts to get the most recent digest for the tag by checking the remote
 // tag service first and then caching it locally.  If the remote is unavailable
@@ -61,6 +62,24 @@ func (pt proxyTagService) All(ctx context.Context) ([]string, error) {
 	return pt.localTags.All(ctx)
 }
 
+// List returns a page of the remote tags, falling back to the local tags
+// when the remote is unavailable.
+func (pt proxyTagService) List(ctx context.Context, last string, n int) ([]string, error) {
+	err := pt.authChallenger.tryEstablishChallenges(ctx)
+	if err == nil {
+		if lister, ok := pt.remoteTags.(distribution.TagLister); ok {
+			tags, err := lister.List(ctx, last, n)
+			if err == nil {
+				return tags, err
+			}
+		}
+	}
+	if lister, ok := pt.localTags.(distribution.TagLister); ok {
+		return lister.List(ctx, last, n)
+	}
+	return nil, distribution.ErrUnsupported
+}
+
 func (pt proxyTagService) Lookup(ctx context.Context, digest distribution.Descriptor) ([]string, error) {
 	return []string{}, distribution.ErrUnsupported
 }
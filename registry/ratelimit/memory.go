@@ -0,0 +1,72 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// memoryPurgeInterval is how often the memory store forgets the buckets
+// which have been refilled.
+const memoryPurgeInterval = time.Minute
+
+type memoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]*memoryBucket
+	purged  time.Time
+
+	// now returns the current time, replaced in tests.
+	now func() time.Time
+}
+
+type memoryBucket struct {
+	bucket
+	limit Limit
+}
+
+// NewMemoryStore returns a store keeping token buckets in memory, limiting
+// the clients of a single registry.
+func NewMemoryStore() Store {
+	return &memoryStore{
+		buckets: make(map[string]*memoryBucket),
+		now:     time.Now,
+	}
+}
+
+func (s *memoryStore) Take(ctx context.Context, key string, limit Limit, cost float64) (time.Duration, error) {
+	return seconds(s.take(key, limit, cost, false)), nil
+}
+
+func (s *memoryStore) Charge(ctx context.Context, key string, limit Limit, cost float64) error {
+	s.take(key, limit, cost, true)
+	return nil
+}
+
+func (s *memoryStore) take(key string, limit Limit, cost float64, force bool) float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if now.Sub(s.purged) > memoryPurgeInterval {
+		s.purge(unixSeconds(now))
+		s.purged = now
+	}
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &memoryBucket{bucket: bucket{tokens: limit.Burst, updated: unixSeconds(now)}}
+		s.buckets[key] = b
+	}
+	b.limit = limit
+	return b.take(limit, unixSeconds(now), cost, force)
+}
+
+// purge forgets the buckets which would be full at now, as they are in the
+// same state as new ones.
+func (s *memoryStore) purge(now float64) {
+	for key, b := range s.buckets {
+		if b.tokens+(now-b.updated)*b.limit.Rate >= b.limit.Burst {
+			delete(s.buckets, key)
+		}
+	}
+}
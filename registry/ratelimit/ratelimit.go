@@ -0,0 +1,79 @@
+// Package ratelimit provides token buckets limiting the rate at which clients
+// use the registry, kept in memory or in redis to share them between the
+// replicas of a registry.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+)
+
+// Limit configures a token bucket.
+type Limit struct {
+	// Rate is the number of tokens added to the bucket per second.
+	Rate float64
+	// Burst is the capacity of the bucket, which starts full.
+	Burst float64
+}
+
+// Validate checks that the bucket can be refilled and can hold at least one
+// token.
+func (l Limit) Validate() error {
+	if l.Rate <= 0 || math.IsInf(l.Rate, 0) || math.IsNaN(l.Rate) {
+		return fmt.Errorf("rate limit rate must be positive: %v", l.Rate)
+	}
+	if l.Burst < 1 || math.IsInf(l.Burst, 0) || math.IsNaN(l.Burst) {
+		return fmt.Errorf("rate limit burst must be at least 1: %v", l.Burst)
+	}
+	return nil
+}
+
+// Store keeps token buckets by key. Stores are safe for concurrent use.
+type Store interface {
+	// Take takes cost tokens from the bucket of key, if it holds them and
+	// is not empty, and returns zero. Otherwise it returns how long to
+	// wait before the bucket holds them. A cost of zero only checks that
+	// the bucket is not empty, which lets costs only known once a request
+	// has been served be charged afterwards.
+	Take(ctx context.Context, key string, limit Limit, cost float64) (time.Duration, error)
+
+	// Charge takes cost tokens from the bucket of key, leaving it in debt
+	// if it does not hold them.
+	Charge(ctx context.Context, key string, limit Limit, cost float64) error
+}
+
+// bucket is the state of a token bucket.
+type bucket struct {
+	tokens float64
+	// updated is when tokens was last refilled, in seconds since the epoch.
+	updated float64
+}
+
+// take refills the bucket at now and takes cost tokens from it, when forced
+// or when it holds them. It returns how long to wait, in seconds, before the
+// bucket holds them otherwise. The redis store implements the same logic in
+// a script.
+func (b *bucket) take(limit Limit, now, cost float64, force bool) float64 {
+	if now > b.updated {
+		b.tokens = math.Min(limit.Burst, b.tokens+(now-b.updated)*limit.Rate)
+		b.updated = now
+	}
+
+	if force || (b.tokens > 0 && b.tokens >= cost) {
+		b.tokens -= cost
+		return 0
+	}
+	return (math.Max(cost, 1) - b.tokens) / limit.Rate
+}
+
+// unixSeconds returns t in seconds since the epoch.
+func unixSeconds(t time.Time) float64 {
+	return float64(t.UnixNano()) / float64(time.Second)
+}
+
+// seconds converts a wait in seconds to a duration.
+func seconds(wait float64) time.Duration {
+	return time.Duration(wait * float64(time.Second))
+}
@@ -0,0 +1,92 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// checkStore exercises a store, whose clock is advanced with advance.
+func checkStore(t *testing.T, store Store, advance func(time.Duration)) {
+	ctx := context.Background()
+	limit := Limit{Rate: 2, Burst: 3}
+
+	take := func(key string, cost float64) time.Duration {
+		wait, err := store.Take(ctx, key, limit, cost)
+		if err != nil {
+			t.Fatalf("unexpected error taking tokens: %v", err)
+		}
+		return wait
+	}
+
+	// the bucket starts full
+	for i := 0; i < 3; i++ {
+		if wait := take("alice", 1); wait != 0 {
+			t.Fatalf("expected token %d to be available, got wait %v", i, wait)
+		}
+	}
+	if wait := take("alice", 1); wait != 500*time.Millisecond {
+		t.Fatalf("expected to wait for a token to be added, got %v", wait)
+	}
+
+	// buckets are independent
+	if wait := take("bob", 1); wait != 0 {
+		t.Fatalf("expected the bucket of another key to be full, got wait %v", wait)
+	}
+
+	advance(time.Second)
+	if wait := take("alice", 2); wait != 0 {
+		t.Fatalf("expected two tokens to be added, got wait %v", wait)
+	}
+
+	// charging leaves the bucket in debt, which checks report
+	if err := store.Charge(ctx, "alice", limit, 4); err != nil {
+		t.Fatalf("unexpected error charging tokens: %v", err)
+	}
+	if wait := take("alice", 0); wait != 2500*time.Millisecond {
+		t.Fatalf("expected to wait for the debt to be repaid, got %v", wait)
+	}
+	advance(2 * time.Second)
+	if wait := take("alice", 0); wait != 500*time.Millisecond {
+		t.Fatalf("expected to wait for the rest of the debt to be repaid, got %v", wait)
+	}
+
+	// buckets refill up to their burst
+	advance(time.Hour)
+	for i := 0; i < 3; i++ {
+		if wait := take("alice", 1); wait != 0 {
+			t.Fatalf("expected token %d to be available, got wait %v", i, wait)
+		}
+	}
+	if wait := take("alice", 1); wait == 0 {
+		t.Fatal("expected the bucket to hold no more than its burst")
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	store := NewMemoryStore().(*memoryStore)
+	now := time.Unix(1700000000, 0)
+	store.now = func() time.Time { return now }
+
+	checkStore(t, store, func(d time.Duration) { now = now.Add(d) })
+
+	// full buckets are forgotten
+	now = now.Add(time.Hour)
+	if _, err := store.Take(context.Background(), "carol", Limit{Rate: 1, Burst: 1}, 1); err != nil {
+		t.Fatal(err)
+	}
+	if len(store.buckets) != 1 {
+		t.Fatalf("expected full buckets to be purged, got %d buckets", len(store.buckets))
+	}
+}
+
+func TestLimitValidate(t *testing.T) {
+	if err := (Limit{Rate: 0.5, Burst: 1}).Validate(); err != nil {
+		t.Fatalf("unexpected error validating limit: %v", err)
+	}
+	for _, limit := range []Limit{{Rate: 0, Burst: 1}, {Rate: -1, Burst: 1}, {Rate: 1, Burst: 0.5}} {
+		if err := limit.Validate(); err == nil {
+			t.Errorf("expected an error validating %+v", limit)
+		}
+	}
+}
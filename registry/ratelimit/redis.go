@@ -0,0 +1,98 @@
+package ratelimit
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// redisKeyPrefix prefixes the keys of the token buckets in redis.
+const redisKeyPrefix = "ratelimit::"
+
+// takeScript refills the token bucket stored in the hash KEYS[1] and takes
+// tokens from it, like bucket.take. Its arguments are the rate and the burst
+// of the limit, the current time in seconds, the cost and whether to force
+// taking the tokens. It returns how long to wait in seconds, as a string so
+// that redis does not truncate it. The hash expires once the bucket would be
+// full again.
+var takeScript = redis.NewScript(1, `
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local cost = tonumber(ARGV[4])
+local force = ARGV[5] == "1"
+
+local state = redis.call("HMGET", KEYS[1], "tokens", "updated")
+local tokens = tonumber(state[1])
+local updated = tonumber(state[2])
+if tokens == nil or updated == nil then
+	tokens = burst
+	updated = now
+end
+if now > updated then
+	tokens = math.min(burst, tokens + (now - updated) * rate)
+	updated = now
+end
+
+local wait = 0
+if force or (tokens > 0 and tokens >= cost) then
+	tokens = tokens - cost
+else
+	wait = (math.max(cost, 1) - tokens) / rate
+end
+
+redis.call("HMSET", KEYS[1], "tokens", tostring(tokens), "updated", tostring(updated))
+redis.call("PEXPIRE", KEYS[1], math.ceil((burst - tokens) / rate * 1000) + 1000)
+return tostring(wait)
+`)
+
+type redisStore struct {
+	pool *redis.Pool
+
+	// now returns the current time, replaced in tests.
+	now func() time.Time
+}
+
+// NewRedisStore returns a store keeping token buckets in redis, limiting the
+// clients of all the registries sharing it. The clocks of the registries are
+// expected to be synchronized.
+func NewRedisStore(pool *redis.Pool) Store {
+	return &redisStore{pool: pool, now: time.Now}
+}
+
+func (s *redisStore) Take(ctx context.Context, key string, limit Limit, cost float64) (time.Duration, error) {
+	wait, err := s.take(key, limit, cost, false)
+	return seconds(wait), err
+}
+
+func (s *redisStore) Charge(ctx context.Context, key string, limit Limit, cost float64) error {
+	_, err := s.take(key, limit, cost, true)
+	return err
+}
+
+func (s *redisStore) take(key string, limit Limit, cost float64, force bool) (float64, error) {
+	conn := s.pool.Get()
+	defer conn.Close()
+
+	forceArg := "0"
+	if force {
+		forceArg = "1"
+	}
+	reply, err := redis.String(takeScript.Do(conn,
+		redisKeyPrefix+key,
+		formatFloat(limit.Rate),
+		formatFloat(limit.Burst),
+		formatFloat(unixSeconds(s.now())),
+		formatFloat(cost),
+		forceArg))
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseFloat(reply, 64)
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
@@ -0,0 +1,51 @@
+package ratelimit
+
+import (
+	"flag"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+var redisAddr string
+
+func init() {
+	flag.StringVar(&redisAddr, "test.registry.ratelimit.redis.addr", "", "configure the address of a test instance of redis")
+}
+
+// TestRedisStore exercises a live redis instance using the redis store.
+func TestRedisStore(t *testing.T) {
+	if redisAddr == "" {
+		// fallback to an environement variable
+		redisAddr = os.Getenv("TEST_REGISTRY_RATELIMIT_REDIS_ADDR")
+	}
+
+	if redisAddr == "" {
+		// skip if still not set
+		t.Skip("please set -test.registry.ratelimit.redis.addr to test rate limiting against redis")
+	}
+
+	pool := &redis.Pool{
+		Dial: func() (redis.Conn, error) {
+			return redis.Dial("tcp", redisAddr)
+		},
+		MaxIdle:   1,
+		MaxActive: 2,
+	}
+
+	// Clear the database
+	conn := pool.Get()
+	if _, err := conn.Do("FLUSHDB"); err != nil {
+		t.Fatalf("unexpected error flushing redis db: %v", err)
+	}
+	conn.Close()
+
+	store := NewRedisStore(pool).(*redisStore)
+	// whole seconds keep the waits exact
+	now := time.Unix(time.Now().Unix(), 0)
+	store.now = func() time.Time { return now }
+
+	checkStore(t, store, func(d time.Duration) { now = now.Add(d) })
+}
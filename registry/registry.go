@@ -256,14 +256,26 @@ func (registry *Registry) ListenAndServe() error {
 			tlsConf.GetCertificate = m.GetCertificate
 			tlsConf.NextProtos = append(tlsConf.NextProtos, acme.ALPNProto)
 		} else {
-			tlsConf.Certificates = make([]tls.Certificate, 1)
-			tlsConf.Certificates[0], err = tls.LoadX509KeyPair(config.HTTP.TLS.Certificate, config.HTTP.TLS.Key)
+			reloader, err := newTLSReloader(tlsConf, config.HTTP.TLS.Certificate, config.HTTP.TLS.Key, config.HTTP.TLS.ClientCAs, dcontext.GetLogger(registry.app))
 			if err != nil {
 				return err
 			}
+
+			interval := config.HTTP.TLS.ReloadInterval
+			if interval <= 0 {
+				interval = defaultTLSReloadInterval
+			}
+			hup := make(chan os.Signal, 1)
+			signal.Notify(hup, syscall.SIGHUP)
+			defer signal.Stop(hup)
+			stopReload := make(chan struct{})
+			defer close(stopReload)
+			go reloader.watch(interval, hup, stopReload)
 		}
 
-		if len(config.HTTP.TLS.ClientCAs) != 0 {
+		// the client CAs are served by the reloader along with the
+		// certificate, unless it comes from Let's Encrypt.
+		if len(config.HTTP.TLS.ClientCAs) != 0 && config.HTTP.TLS.LetsEncrypt.CacheFile != "" {
 			pool := x509.NewCertPool()
 
 			for _, ca := range config.HTTP.TLS.ClientCAs {
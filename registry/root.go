@@ -1,11 +1,14 @@
 package registry
 
 import (
+	"context"
 	"fmt"
 	"os"
 
+	"github.com/distribution/distribution/v3"
 	dcontext "github.com/distribution/distribution/v3/context"
 	"github.com/distribution/distribution/v3/registry/storage"
+	storagedriver "github.com/distribution/distribution/v3/registry/storage/driver"
 	"github.com/distribution/distribution/v3/registry/storage/driver/factory"
 	"github.com/distribution/distribution/v3/version"
 	"github.com/docker/libtrust"
@@ -19,6 +22,24 @@ func init() {
 	RootCmd.AddCommand(GCCmd)
 	GCCmd.Flags().BoolVarP(&dryRun, "dry-run", "d", false, "do everything except remove the blobs")
 	GCCmd.Flags().BoolVarP(&removeUntagged, "delete-untagged", "m", false, "delete manifests that are not currently referenced via tag")
+	RootCmd.AddCommand(DUCmd)
+	DUCmd.Flags().StringVarP(&duFormat, "format", "f", "table", "output format, either table or json")
+	RootCmd.AddCommand(FsckCmd)
+	FsckCmd.Flags().BoolVar(&fsckVerifyBlobs, "verify-blobs", false, "re-hash blob data and compare it to its digest")
+	FsckCmd.Flags().BoolVar(&fsckRepair, "repair", false, "remove dangling links and relink blobs referenced by manifests")
+	RootCmd.AddCommand(MigrateCmd)
+	MigrateCmd.Flags().StringVar(&migrateFrom, "from", "", "configuration of the source storage")
+	MigrateCmd.Flags().StringVar(&migrateTo, "to", "", "configuration of the destination storage")
+	MigrateCmd.Flags().StringVar(&migrateCheckpoint, "checkpoint", "", "file recording migrated blobs, used to resume an interrupted migration")
+	MigrateCmd.Flags().IntVarP(&migrateConcurrency, "concurrency", "c", 8, "number of objects copied in parallel")
+	MigrateCmd.Flags().BoolVar(&migrateIncremental, "incremental", false, "remove repository content deleted from the source since the previous pass")
+	RootCmd.AddCommand(ExportCmd)
+	ExportCmd.Flags().StringVarP(&exportOutput, "output", "o", "", "directory or tar archive to write the layout to")
+	ExportCmd.Flags().StringArrayVarP(&exportFilters, "filter", "f", nil, "repository or name:tag to export, may be repeated")
+	ExportCmd.Flags().BoolVar(&exportVerify, "verify", false, "verify the content of blobs against their digest")
+	RootCmd.AddCommand(ImportCmd)
+	ImportCmd.Flags().StringArrayVarP(&importFilters, "filter", "f", nil, "repository or name:tag to import, may be repeated")
+	ImportCmd.Flags().StringVarP(&importRepository, "repository", "r", "", "repository for manifests without a repository name in the layout")
 	RootCmd.Flags().BoolVarP(&showVersion, "version", "v", false, "show the version and exit")
 }
 
@@ -45,37 +66,13 @@ var GCCmd = &cobra.Command{
 	Short: "`garbage-collect` deletes layers not referenced by any manifests",
 	Long:  "`garbage-collect` deletes layers not referenced by any manifests",
 	Run: func(cmd *cobra.Command, args []string) {
-		config, err := resolveConfiguration(args)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "configuration error: %v\n", err)
-			cmd.Usage()
-			os.Exit(1)
-		}
-
-		driver, err := factory.Create(config.Storage.Type(), config.Storage.Parameters())
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "failed to construct %s driver: %v", config.Storage.Type(), err)
-			os.Exit(1)
-		}
-
-		ctx := dcontext.Background()
-		ctx, err = configureLogging(ctx, config)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "unable to configure logging with config: %s", err)
-			os.Exit(1)
-		}
-
 		k, err := libtrust.GenerateECP256PrivateKey()
 		if err != nil {
 			fmt.Fprint(os.Stderr, err)
 			os.Exit(1)
 		}
 
-		registry, err := storage.NewRegistry(ctx, driver, storage.Schema1SigningKey(k))
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "failed to construct registry: %v", err)
-			os.Exit(1)
-		}
+		ctx, driver, registry := openRegistry(cmd, args, storage.Schema1SigningKey(k))
 
 		err = storage.MarkAndSweep(ctx, driver, registry, storage.GCOpts{
 			DryRun:         dryRun,
@@ -87,3 +84,35 @@ var GCCmd = &cobra.Command{
 		}
 	},
 }
+
+// openRegistry constructs the storage driver and registry described by the
+// configuration passed on the command line, exiting on failure.
+func openRegistry(cmd *cobra.Command, args []string, options ...storage.RegistryOption) (context.Context, storagedriver.StorageDriver, distribution.Namespace) {
+	config, err := resolveConfiguration(args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "configuration error: %v\n", err)
+		cmd.Usage()
+		os.Exit(1)
+	}
+
+	driver, err := factory.Create(config.Storage.Type(), config.Storage.Parameters())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to construct %s driver: %v", config.Storage.Type(), err)
+		os.Exit(1)
+	}
+
+	ctx := dcontext.Background()
+	ctx, err = configureLogging(ctx, config)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to configure logging with config: %s", err)
+		os.Exit(1)
+	}
+
+	registry, err := storage.NewRegistry(ctx, driver, options...)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to construct registry: %v", err)
+		os.Exit(1)
+	}
+
+	return ctx, driver, registry
+}
@@ -0,0 +1,291 @@
+// Package signature verifies that manifests stored in a repository have been
+// signed by trusted keys.
+//
+// Signatures are stored in the repository alongside the manifest they sign,
+// in the simple signing format used by cosign: an OCI manifest whose layers
+// are signed payloads naming the digest of the signed manifest, with the
+// base64 encoded signature of each payload in the
+// "dev.cosignproject.cosign/signature" annotation of its layer. The
+// signature manifest is found either through the "sha256-<hex>.sig" tag or as
+// a referrer of the signed manifest.
+package signature
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/manifest/ocischema"
+	"github.com/opencontainers/go-digest"
+)
+
+const (
+	// SignatureAnnotation is the layer annotation holding the base64
+	// encoded signature of the layer.
+	SignatureAnnotation = "dev.cosignproject.cosign/signature"
+
+	// ArtifactType is the artifact type of signature manifests attached
+	// as referrers.
+	ArtifactType = "application/vnd.dev.cosign.artifact.sig.v1+json"
+	// SimpleSigningMediaType is the media type of the layers of signature
+	// manifests, which are the signed payloads.
+	SimpleSigningMediaType = "application/vnd.dev.cosign.simplesigning.v1+json"
+
+	// maxPayloadSize bounds the size of the signed payloads read from the
+	// repository.
+	maxPayloadSize = 1 << 20
+)
+
+// ErrNotSigned is returned when a manifest has no signature made by a
+// trusted key.
+var ErrNotSigned = errors.New("manifest is not signed by a trusted key")
+
+// SignatureTag returns the tag of the signature manifest of the manifest
+// with the given digest.
+func SignatureTag(dgst digest.Digest) string {
+	return strings.Replace(dgst.String(), ":", "-", 1) + ".sig"
+}
+
+// IsSignatureTag reports whether the tag names the signature manifest of
+// another manifest.
+func IsSignatureTag(tag string) bool {
+	_, ok := signedDigest(tag)
+	return ok
+}
+
+// signedDigest returns the digest of the manifest whose signature manifest
+// is named by the tag.
+func signedDigest(tag string) (digest.Digest, bool) {
+	if !strings.HasSuffix(tag, ".sig") {
+		return "", false
+	}
+	dgst := digest.Digest(strings.Replace(strings.TrimSuffix(tag, ".sig"), "-", ":", 1))
+	return dgst, dgst.Validate() == nil
+}
+
+// IsSignatureManifest reports whether the manifest tagged with the given tag
+// in the repository is the signature manifest of another manifest: the tag
+// must be the signature tag of a manifest stored in the repository, and the
+// manifest an OCI manifest whose layers are all signed simple signing
+// payloads. The signatures themselves are not verified.
+func IsSignatureManifest(ctx context.Context, repository distribution.Repository, tag string, manifest distribution.Manifest) (bool, error) {
+	dgst, ok := signedDigest(tag)
+	if !ok {
+		return false, nil
+	}
+
+	m, ok := manifest.(*ocischema.DeserializedManifest)
+	if !ok || len(m.Layers) == 0 {
+		return false, nil
+	}
+	for _, layer := range m.Layers {
+		if layer.MediaType != SimpleSigningMediaType {
+			return false, nil
+		}
+		if _, ok := layer.Annotations[SignatureAnnotation]; !ok {
+			return false, nil
+		}
+	}
+
+	manifests, err := repository.Manifests(ctx)
+	if err != nil {
+		return false, err
+	}
+	return manifests.Exists(ctx, dgst)
+}
+
+// payload is the simple signing payload signed for a manifest.
+type payload struct {
+	Critical struct {
+		Image struct {
+			DockerManifestDigest digest.Digest `json:"docker-manifest-digest"`
+		} `json:"image"`
+	} `json:"critical"`
+}
+
+// Verifier checks the signatures of manifests against a set of trusted
+// public keys.
+type Verifier struct {
+	keys []crypto.PublicKey
+}
+
+// NewVerifier returns a verifier trusting the given ECDSA and ed25519 public
+// keys.
+func NewVerifier(keys ...crypto.PublicKey) (*Verifier, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("no public keys")
+	}
+	for _, key := range keys {
+		switch key.(type) {
+		case *ecdsa.PublicKey, ed25519.PublicKey:
+		default:
+			return nil, fmt.Errorf("unsupported public key type %T", key)
+		}
+	}
+	return &Verifier{keys: keys}, nil
+}
+
+// LoadPublicKeys reads the PEM encoded public keys from the given files.
+func LoadPublicKeys(paths ...string) ([]crypto.PublicKey, error) {
+	var keys []crypto.PublicKey
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		for {
+			var block *pem.Block
+			block, data = pem.Decode(data)
+			if block == nil {
+				break
+			}
+			if block.Type != "PUBLIC KEY" {
+				continue
+			}
+			key, err := x509.ParsePKIXPublicKey(block.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", path, err)
+			}
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+// Verify checks that the manifest with the given digest has a signature
+// stored in the repository which one of the trusted keys verifies. It returns
+// ErrNotSigned if there is none.
+func (v *Verifier) Verify(ctx context.Context, repository distribution.Repository, dgst digest.Digest) error {
+	manifests, err := repository.Manifests(ctx)
+	if err != nil {
+		return err
+	}
+
+	candidates, err := signatureManifests(ctx, repository, manifests, dgst)
+	if err != nil {
+		return err
+	}
+
+	blobs := repository.Blobs(ctx)
+	for _, candidate := range candidates {
+		manifest, err := manifests.Get(ctx, candidate)
+		if err != nil {
+			if isUnknown(err) {
+				continue
+			}
+			return err
+		}
+		m, ok := manifest.(*ocischema.DeserializedManifest)
+		if !ok {
+			continue
+		}
+
+		for _, layer := range m.Layers {
+			verified, err := v.verifyLayer(ctx, blobs, layer, dgst)
+			if err != nil {
+				return err
+			}
+			if verified {
+				return nil
+			}
+		}
+	}
+	return ErrNotSigned
+}
+
+// signatureManifests returns the digests of the manifests which may hold
+// signatures of the manifest with the given digest.
+func signatureManifests(ctx context.Context, repository distribution.Repository, manifests distribution.ManifestService, dgst digest.Digest) ([]digest.Digest, error) {
+	var candidates []digest.Digest
+
+	desc, err := repository.Tags(ctx).Get(ctx, SignatureTag(dgst))
+	switch err.(type) {
+	case nil:
+		candidates = append(candidates, desc.Digest)
+	case distribution.ErrTagUnknown, distribution.ErrRepositoryUnknown:
+	default:
+		return nil, err
+	}
+
+	if lister, ok := manifests.(distribution.ManifestReferrersLister); ok {
+		referrers, err := lister.Referrers(ctx, dgst, ArtifactType)
+		if err != nil {
+			return nil, err
+		}
+		for _, referrer := range referrers {
+			candidates = append(candidates, referrer.Digest)
+		}
+	}
+
+	return candidates, nil
+}
+
+// verifyLayer reports whether the layer is a payload naming the manifest with
+// the given digest, signed by one of the trusted keys.
+func (v *Verifier) verifyLayer(ctx context.Context, blobs distribution.BlobProvider, layer distribution.Descriptor, dgst digest.Digest) (bool, error) {
+	encoded, ok := layer.Annotations[SignatureAnnotation]
+	if !ok || layer.Size > maxPayloadSize {
+		return false, nil
+	}
+	sig, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return false, nil
+	}
+
+	p, err := blobs.Get(ctx, layer.Digest)
+	if err != nil {
+		if err == distribution.ErrBlobUnknown {
+			return false, nil
+		}
+		return false, err
+	}
+
+	if !v.verifySignature(p, sig) {
+		return false, nil
+	}
+
+	var signed payload
+	if err := json.Unmarshal(p, &signed); err != nil {
+		return false, nil
+	}
+	return signed.Critical.Image.DockerManifestDigest == dgst, nil
+}
+
+// verifySignature reports whether one of the trusted keys verifies the
+// signature of the payload.
+func (v *Verifier) verifySignature(p, sig []byte) bool {
+	for _, key := range v.keys {
+		switch key := key.(type) {
+		case *ecdsa.PublicKey:
+			sum := sha256.Sum256(p)
+			if ecdsa.VerifyASN1(key, sum[:], sig) {
+				return true
+			}
+		case ed25519.PublicKey:
+			if ed25519.Verify(key, p, sig) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func isUnknown(err error) bool {
+	switch err.(type) {
+	case distribution.ErrManifestUnknownRevision, distribution.ErrManifestUnknown:
+		return true
+	}
+	return err == distribution.ErrBlobUnknown
+}
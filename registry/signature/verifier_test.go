@@ -0,0 +1,281 @@
+package signature
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/manifest/ocischema"
+	"github.com/distribution/distribution/v3/reference"
+	"github.com/distribution/distribution/v3/registry/storage"
+	"github.com/distribution/distribution/v3/registry/storage/cache/memory"
+	"github.com/distribution/distribution/v3/registry/storage/driver/inmemory"
+	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func newRepository(t *testing.T, name string) distribution.Repository {
+	ctx := context.Background()
+	registry, err := storage.NewRegistry(ctx, inmemory.New(), storage.BlobDescriptorCacheProvider(memory.NewInMemoryBlobDescriptorCacheProvider()))
+	if err != nil {
+		t.Fatalf("error creating registry: %v", err)
+	}
+	named, _ := reference.WithName(name)
+	repository, err := registry.Repository(ctx, named)
+	if err != nil {
+		t.Fatalf("error creating repository: %v", err)
+	}
+	return repository
+}
+
+// sign stores a signature of the manifest with the given digest, made with
+// the key, and returns the digest of the signature manifest. The signature
+// is attached as a referrer if subject is true, and tagged otherwise.
+func sign(t *testing.T, repository distribution.Repository, key crypto.Signer, dgst digest.Digest, subject bool) digest.Digest {
+	ctx := context.Background()
+	blobs := repository.Blobs(ctx)
+
+	payload := []byte(fmt.Sprintf(`{"critical":{"identity":{"docker-reference":"%s"},"image":{"docker-manifest-digest":"%s"},"type":"cosign container image signature"},"optional":null}`, repository.Named().Name(), dgst))
+	payloadDesc, err := blobs.Put(ctx, SimpleSigningMediaType, payload)
+	if err != nil {
+		t.Fatalf("error putting payload: %v", err)
+	}
+	payloadDesc.MediaType = SimpleSigningMediaType
+
+	var sig []byte
+	switch key.(type) {
+	case ed25519.PrivateKey:
+		sig, err = key.Sign(rand.Reader, payload, crypto.Hash(0))
+	default:
+		sum := sha256.Sum256(payload)
+		sig, err = key.Sign(rand.Reader, sum[:], crypto.SHA256)
+	}
+	if err != nil {
+		t.Fatalf("error signing payload: %v", err)
+	}
+	payloadDesc.Annotations = map[string]string{SignatureAnnotation: base64.StdEncoding.EncodeToString(sig)}
+
+	configDesc, err := blobs.Put(ctx, v1.MediaTypeImageConfig, []byte("{}"))
+	if err != nil {
+		t.Fatalf("error putting config: %v", err)
+	}
+
+	m := ocischema.Manifest{
+		Versioned: ocischema.SchemaVersion,
+		Config:    configDesc,
+		Layers:    []distribution.Descriptor{payloadDesc},
+	}
+	if subject {
+		m.ArtifactType = ArtifactType
+		m.Subject = &distribution.Descriptor{MediaType: v1.MediaTypeImageManifest, Digest: dgst, Size: 1}
+	}
+	manifest, err := ocischema.FromStruct(m)
+	if err != nil {
+		t.Fatalf("error creating signature manifest: %v", err)
+	}
+
+	manifests, err := repository.Manifests(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sigDigest, err := manifests.Put(ctx, manifest)
+	if err != nil {
+		t.Fatalf("error putting signature manifest: %v", err)
+	}
+
+	if !subject {
+		_, p, _ := manifest.Payload()
+		desc := distribution.Descriptor{MediaType: v1.MediaTypeImageManifest, Size: int64(len(p)), Digest: sigDigest}
+		if err := repository.Tags(ctx).Tag(ctx, SignatureTag(dgst), desc); err != nil {
+			t.Fatalf("error tagging signature: %v", err)
+		}
+	}
+	return sigDigest
+}
+
+func TestVerify(t *testing.T) {
+	ctx := context.Background()
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edPublic, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	untrustedKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	verifier, err := NewVerifier(&ecKey.PublicKey, edPublic)
+	if err != nil {
+		t.Fatalf("error creating verifier: %v", err)
+	}
+
+	for _, tc := range []struct {
+		name    string
+		key     crypto.Signer
+		subject bool
+		signed  digest.Digest
+		err     error
+	}{
+		{name: "tagged ecdsa signature", key: ecKey},
+		{name: "tagged ed25519 signature", key: edKey},
+		{name: "referrer signature", key: ecKey, subject: true},
+		{name: "untrusted key", key: untrustedKey, err: ErrNotSigned},
+		{name: "other manifest", key: ecKey, signed: digest.FromString("other"), err: ErrNotSigned},
+	} {
+		repository := newRepository(t, "foo/signed")
+		dgst := digest.FromString("manifest")
+
+		if err := verifier.Verify(ctx, repository, dgst); err != ErrNotSigned {
+			t.Fatalf("%s: expected %v before signing, got %v", tc.name, ErrNotSigned, err)
+		}
+
+		signed := tc.signed
+		if signed == "" {
+			signed = dgst
+		}
+		sigDigest := sign(t, repository, tc.key, signed, tc.subject)
+		if tc.signed != "" {
+			// tag the signature of the other manifest as if it signed
+			// this one
+			desc, err := repository.Tags(ctx).Get(ctx, SignatureTag(tc.signed))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if desc.Digest != sigDigest {
+				t.Fatalf("%s: unexpected signature digest %s", tc.name, desc.Digest)
+			}
+			if err := repository.Tags(ctx).Tag(ctx, SignatureTag(dgst), desc); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if err := verifier.Verify(ctx, repository, dgst); err != tc.err {
+			t.Fatalf("%s: expected %v, got %v", tc.name, tc.err, err)
+		}
+	}
+}
+
+func TestIsSignatureManifest(t *testing.T) {
+	ctx := context.Background()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repository := newRepository(t, "foo/signed")
+	manifests, err := repository.Manifests(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	configDesc, err := repository.Blobs(ctx).Put(ctx, v1.MediaTypeImageConfig, []byte("{}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	image, err := ocischema.FromStruct(ocischema.Manifest{Versioned: ocischema.SchemaVersion, Config: configDesc})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dgst, err := manifests.Put(ctx, image)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(dgst digest.Digest) distribution.Manifest {
+		m, err := manifests.Get(ctx, dgst)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return m
+	}
+	sig := get(sign(t, repository, key, dgst, false))
+	missing := digest.FromString("missing")
+	missingSig := get(sign(t, repository, key, missing, false))
+
+	for _, tc := range []struct {
+		name     string
+		tag      string
+		manifest distribution.Manifest
+		expected bool
+	}{
+		{name: "signature", tag: SignatureTag(dgst), manifest: sig, expected: true},
+		{name: "other tag", tag: "latest", manifest: sig},
+		{name: "image", tag: SignatureTag(dgst), manifest: image},
+		{name: "missing signed manifest", tag: SignatureTag(missing), manifest: missingSig},
+	} {
+		isSignature, err := IsSignatureManifest(ctx, repository, tc.tag, tc.manifest)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.name, err)
+		}
+		if isSignature != tc.expected {
+			t.Fatalf("%s: expected %v, got %v", tc.name, tc.expected, isSignature)
+		}
+	}
+}
+
+func TestLoadPublicKeys(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edPublic, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var paths []string
+	for i, key := range []crypto.PublicKey{&ecKey.PublicKey, edPublic} {
+		der, err := x509.MarshalPKIXPublicKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(t.TempDir(), fmt.Sprintf("key%d.pub", i))
+		if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+
+	keys, err := LoadPublicKeys(paths...)
+	if err != nil {
+		t.Fatalf("error loading keys: %v", err)
+	}
+	if len(keys) != 2 {
+		t.Fatalf("expected 2 keys, got %d", len(keys))
+	}
+	if _, err := NewVerifier(keys...); err != nil {
+		t.Fatalf("error creating verifier: %v", err)
+	}
+}
+
+func TestSignatureTag(t *testing.T) {
+	dgst := digest.FromString("manifest")
+	tag := SignatureTag(dgst)
+	if tag != "sha256-"+dgst.Encoded()+".sig" {
+		t.Fatalf("unexpected signature tag %q", tag)
+	}
+	if !IsSignatureTag(tag) {
+		t.Fatalf("expected %q to be a signature tag", tag)
+	}
+	for _, tag := range []string{"latest", "sha256-1234.sig", "v1.sig"} {
+		if IsSignatureTag(tag) {
+			t.Fatalf("expected %q not to be a signature tag", tag)
+		}
+	}
+}
@@ -71,6 +71,10 @@ func (bw *blobWriter) Commit(ctx context.Context, desc distribution.Descriptor)
 		return distribution.Descriptor{}, err
 	}
 
+	if err := bw.blobStore.checkQuota(ctx, canonical); err != nil {
+		return distribution.Descriptor{}, err
+	}
+
 	if err := bw.moveBlob(ctx, canonical); err != nil {
 		return distribution.Descriptor{}, err
 	}
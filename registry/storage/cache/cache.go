@@ -3,6 +3,7 @@
 package cache
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/distribution/distribution/v3"
@@ -16,6 +17,12 @@ type BlobDescriptorCacheProvider interface {
 	RepositoryScoped(repo string) (distribution.BlobDescriptorService, error)
 }
 
+// RepositoryClearer is implemented by providers able to drop every
+// descriptor scoped to a repository, such as when it is removed.
+type RepositoryClearer interface {
+	ClearRepository(ctx context.Context, repo string) error
+}
+
 // ValidateDescriptor provides a helper function to ensure that caches have
 // common criteria for admitting descriptors.
 func ValidateDescriptor(desc distribution.Descriptor) error {
@@ -19,6 +19,7 @@ func CheckBlobDescriptorCache(t *testing.T, provider cache.BlobDescriptorCachePr
 	checkBlobDescriptorCacheEmptyRepository(ctx, t, provider)
 	checkBlobDescriptorCacheSetAndRead(ctx, t, provider)
 	checkBlobDescriptorCacheClear(ctx, t, provider)
+	checkBlobDescriptorCacheClearRepository(ctx, t, provider)
 }
 
 func checkBlobDescriptorCacheEmptyRepository(ctx context.Context, t *testing.T, provider cache.BlobDescriptorCacheProvider) {
@@ -181,3 +182,51 @@ func checkBlobDescriptorCacheClear(ctx context.Context, t *testing.T, provider c
 		t.Fatalf("expected error statting deleted blob: %v", err)
 	}
 }
+
+func checkBlobDescriptorCacheClearRepository(ctx context.Context, t *testing.T, provider cache.BlobDescriptorCacheProvider) {
+	clearer, ok := provider.(cache.RepositoryClearer)
+	if !ok {
+		return
+	}
+
+	dgst := digest.Digest("sha256:cba1111111111111111111111111111111111111111111111111111111111111")
+	expected := distribution.Descriptor{
+		Digest:    dgst,
+		Size:      10,
+		MediaType: "application/octet-stream"}
+
+	for _, repo := range []string{"foo/cleared", "foo/kept"} {
+		cache, err := provider.RepositoryScoped(repo)
+		if err != nil {
+			t.Fatalf("unexpected error getting scoped cache: %v", err)
+		}
+		if err := cache.SetDescriptor(ctx, dgst, expected); err != nil {
+			t.Fatalf("error setting descriptor: %v", err)
+		}
+	}
+
+	if err := clearer.ClearRepository(ctx, "foo/cleared"); err != nil {
+		t.Fatalf("unexpected error clearing repository: %v", err)
+	}
+
+	cache, err := provider.RepositoryScoped("foo/cleared")
+	if err != nil {
+		t.Fatalf("unexpected error getting scoped cache: %v", err)
+	}
+	if _, err := cache.Stat(ctx, dgst); err != distribution.ErrBlobUnknown {
+		t.Fatalf("expected unknown blob error in cleared repository: %v", err)
+	}
+
+	cache, err = provider.RepositoryScoped("foo/kept")
+	if err != nil {
+		t.Fatalf("unexpected error getting scoped cache: %v", err)
+	}
+	if _, err := cache.Stat(ctx, dgst); err != nil {
+		t.Fatalf("unexpected error statting blob in other repository: %v", err)
+	}
+
+	// the global descriptor is kept for other repositories
+	if _, err := provider.Stat(ctx, dgst); err != nil {
+		t.Fatalf("unexpected error statting global descriptor: %v", err)
+	}
+}
@@ -40,6 +40,15 @@ func (imbdcp *inMemoryBlobDescriptorCacheProvider) RepositoryScoped(repo string)
 	}, nil
 }
 
+// ClearRepository drops the descriptors scoped to the repository.
+func (imbdcp *inMemoryBlobDescriptorCacheProvider) ClearRepository(ctx context.Context, repo string) error {
+	imbdcp.mu.Lock()
+	defer imbdcp.mu.Unlock()
+
+	delete(imbdcp.repositories, repo)
+	return nil
+}
+
 func (imbdcp *inMemoryBlobDescriptorCacheProvider) Stat(ctx context.Context, dgst digest.Digest) (distribution.Descriptor, error) {
 	return imbdcp.global.Stat(ctx, dgst)
 }
@@ -57,6 +57,17 @@ func (p *prometheusRepoCacheProvider) SetDescriptor(ctx context.Context, dgst di
 	return e
 }
 
+func (p *prometheusCacheProvider) ClearRepository(ctx context.Context, repo string) error {
+	clearer, ok := p.BlobDescriptorCacheProvider.(cache.RepositoryClearer)
+	if !ok {
+		return nil
+	}
+	start := time.Now()
+	e := clearer.ClearRepository(ctx, repo)
+	p.latencyTimer.WithValues("ClearRepository").UpdateSince(start)
+	return e
+}
+
 func (p *prometheusCacheProvider) RepositoryScoped(repo string) (distribution.BlobDescriptorService, error) {
 	s, err := p.BlobDescriptorCacheProvider.RepositoryScoped(repo)
 	if err != nil {
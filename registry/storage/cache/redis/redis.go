@@ -56,6 +56,31 @@ func (rbds *redisBlobDescriptorService) RepositoryScoped(repo string) (distribut
 	}, nil
 }
 
+// ClearRepository removes the repository membership and media types of the
+// blobs scoped to the repository.
+func (rbds *redisBlobDescriptorService) ClearRepository(ctx context.Context, repo string) error {
+	scoped := &repositoryScopedRedisBlobDescriptorService{
+		repo:     repo,
+		upstream: rbds,
+	}
+
+	conn := rbds.pool.Get()
+	defer conn.Close()
+
+	members, err := redis.Strings(conn.Do("SMEMBERS", scoped.repositoryBlobSetKey(repo)))
+	if err != nil {
+		return err
+	}
+
+	keys := []interface{}{scoped.repositoryBlobSetKey(repo)}
+	for _, member := range members {
+		keys = append(keys, scoped.blobDescriptorHashKey(digest.Digest(member)))
+	}
+
+	_, err = conn.Do("DEL", keys...)
+	return err
+}
+
 // Stat retrieves the descriptor data from the redis hash entry.
 func (rbds *redisBlobDescriptorService) Stat(ctx context.Context, dgst digest.Digest) (distribution.Descriptor, error) {
 	if err := dgst.Validate(); err != nil {
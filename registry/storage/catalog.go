@@ -3,11 +3,15 @@ package storage
 import (
 	"context"
 	"errors"
+	"fmt"
 	"io"
 	"path"
 	"strings"
 
+	"github.com/distribution/distribution/v3"
+	dcontext "github.com/distribution/distribution/v3/context"
 	"github.com/distribution/distribution/v3/reference"
+	"github.com/distribution/distribution/v3/registry/storage/cache"
 	"github.com/distribution/distribution/v3/registry/storage/driver"
 )
 
@@ -15,6 +19,14 @@ import (
 // Because it's a quite expensive operation, it should only be used when building up
 // an initial set of repositories.
 func (reg *registry) Repositories(ctx context.Context, repos []string, last string) (n int, err error) {
+	return reg.RepositoriesWithPrefix(ctx, "", repos, last)
+}
+
+// RepositoriesWithPrefix returns a list, or partial list, of the repositories
+// whose name starts with prefix. Only the part of the storage tree which may
+// hold such repositories is walked, and directories sorting before last are
+// skipped without being entered.
+func (reg *registry) RepositoriesWithPrefix(ctx context.Context, prefix string, repos []string, last string) (n int, err error) {
 	var finishedWalk bool
 	var foundRepos []string
 
@@ -27,9 +39,33 @@ func (reg *registry) Repositories(ctx context.Context, repos []string, last stri
 		return 0, err
 	}
 
-	err = reg.blobStore.driver.Walk(ctx, root, func(fileInfo driver.FileInfo) error {
+	// Start from the deepest directory containing every repository
+	// matching the prefix.
+	from := root
+	if dir := prefix[:strings.LastIndex(prefix, "/")+1]; dir != "" {
+		from = path.Join(root, dir)
+		if !strings.HasPrefix(from, root+"/") {
+			return 0, fmt.Errorf("invalid repository prefix %q", prefix)
+		}
+	}
+
+	err = reg.blobStore.driver.Walk(ctx, from, func(fileInfo driver.FileInfo) error {
+		if fileInfo.IsDir() {
+			repo := fileInfo.Path()[len(root)+1:]
+			if !strings.HasPrefix(repo, prefix) && !strings.HasPrefix(prefix, repo+"/") {
+				return driver.ErrSkipDir
+			}
+			// Directories sorting entirely before last, which cannot
+			// hold any further repositories, are not entered.
+			if last != "" && lessPath(repo, last) && !strings.HasPrefix(last, repo+"/") {
+				return driver.ErrSkipDir
+			}
+		}
+
 		err := handleRepository(fileInfo, root, last, func(repoPath string) error {
-			foundRepos = append(foundRepos, repoPath)
+			if strings.HasPrefix(repoPath, prefix) {
+				foundRepos = append(foundRepos, repoPath)
+			}
 			return nil
 		})
 		if err != nil {
@@ -73,12 +109,101 @@ func (reg *registry) Enumerate(ctx context.Context, ingester func(string) error)
 
 // Remove removes a repository from storage
 func (reg *registry) Remove(ctx context.Context, name reference.Named) error {
+	if !reg.deleteEnabled {
+		return distribution.ErrUnsupported
+	}
+	if reg.quotas != nil {
+		defer reg.quotas.invalidate(name.Name())
+	}
+	defer reg.clearRepositoryCache(ctx, name.Name())
+
+	err := NewVacuum(ctx, reg.driver).RemoveRepository(name.Name())
+	if _, ok := err.(driver.PathNotFoundError); ok {
+		return distribution.ErrRepositoryUnknown{Name: name.Name()}
+	}
+	return err
+}
+
+// Rename moves the manifests and layer links of a repository to a new name.
+// Uploads in progress are discarded, since their state is bound to the name
+// of the repository. Renaming is not atomic: content pushed to either
+// repository while it runs may be lost.
+func (reg *registry) Rename(ctx context.Context, from, to reference.Named) error {
+	if !reg.deleteEnabled {
+		return distribution.ErrUnsupported
+	}
+
 	root, err := pathFor(repositoriesRootPathSpec{})
 	if err != nil {
 		return err
 	}
-	repoDir := path.Join(root, name.Name())
-	return reg.driver.Delete(ctx, repoDir)
+	fromDir := path.Join(root, from.Name())
+	toDir := path.Join(root, to.Name())
+
+	for _, dir := range repositoryDirs {
+		_, err := reg.driver.Stat(ctx, path.Join(toDir, dir))
+		if err == nil {
+			return distribution.ErrRepositoryExists{Name: to.Name()}
+		}
+		if _, ok := err.(driver.PathNotFoundError); !ok {
+			return err
+		}
+	}
+
+	if reg.quotas != nil {
+		if err := reg.quotas.checkRename(ctx, from.Name(), to.Name()); err != nil {
+			return err
+		}
+		defer reg.quotas.invalidate(from.Name())
+		defer reg.quotas.invalidate(to.Name())
+	}
+	defer reg.clearRepositoryCache(ctx, from.Name())
+	defer reg.clearRepositoryCache(ctx, to.Name())
+
+	var moved bool
+	for _, dir := range []string{"_manifests", "_layers"} {
+		err := reg.moveDir(ctx, path.Join(fromDir, dir), path.Join(toDir, dir))
+		if err != nil {
+			if _, ok := err.(driver.PathNotFoundError); ok {
+				continue
+			}
+			return err
+		}
+		moved = true
+	}
+	if !moved {
+		return distribution.ErrRepositoryUnknown{Name: from.Name()}
+	}
+
+	return NewVacuum(ctx, reg.driver).RemoveRepository(from.Name())
+}
+
+// moveDir moves every file under the source directory to the same path
+// under the destination, since not every driver is able to move a directory
+// at once.
+func (reg *registry) moveDir(ctx context.Context, sourcePath, destPath string) error {
+	err := reg.driver.Walk(ctx, sourcePath, func(fileInfo driver.FileInfo) error {
+		if fileInfo.IsDir() {
+			return nil
+		}
+		return reg.driver.Move(ctx, fileInfo.Path(), destPath+strings.TrimPrefix(fileInfo.Path(), sourcePath))
+	})
+	if err != nil {
+		return err
+	}
+	return reg.driver.Delete(ctx, sourcePath)
+}
+
+// clearRepositoryCache drops the blob descriptors cached for a repository,
+// which may no longer hold the blobs.
+func (reg *registry) clearRepositoryCache(ctx context.Context, name string) {
+	clearer, ok := reg.blobDescriptorCacheProvider.(cache.RepositoryClearer)
+	if !ok {
+		return
+	}
+	if err := clearer.ClearRepository(ctx, name); err != nil {
+		dcontext.GetLogger(ctx).Errorf("error clearing blob descriptor cache of %s: %v", name, err)
+	}
 }
 
 // lessPath returns true if one path a is less than path b.
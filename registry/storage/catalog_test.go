@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"io"
 	"math/rand"
+	"path"
+	"reflect"
 	"testing"
 
 	"github.com/distribution/distribution/v3"
@@ -173,6 +175,89 @@ func TestCatalogInParts(t *testing.T) {
 	}
 }
 
+func TestCatalogWithPrefix(t *testing.T) {
+	env := setupFS(t)
+	lister := env.registry.(distribution.RepositoryPrefixLister)
+
+	for _, tc := range []struct {
+		prefix   string
+		expected []string
+	}{
+		{"foo/", []string{"foo/a", "foo/b", "foo/d/in"}},
+		{"foo", []string{"foo/a", "foo/b", "foo/d/in", "foo-bar/a", "foo-bar/b"}},
+		{"foo/d/", []string{"foo/d/in"}},
+		{"foo-bar/b", []string{"foo-bar/b"}},
+		{"te", []string{"test"}},
+		{"baz/", []string{}},
+	} {
+		p := make([]string, 50)
+		numFilled, err := lister.RepositoriesWithPrefix(env.ctx, tc.prefix, p, "")
+		if _, ok := err.(driver.PathNotFoundError); err != io.EOF && !ok {
+			t.Fatalf("unexpected error listing prefix %q: %v", tc.prefix, err)
+		}
+		if !reflect.DeepEqual(p[:numFilled], tc.expected) {
+			t.Errorf("unexpected repositories for prefix %q: %v != %v", tc.prefix, p[:numFilled], tc.expected)
+		}
+	}
+
+	// paging carries on within the prefix
+	p := make([]string, 2)
+	numFilled, err := lister.RepositoriesWithPrefix(env.ctx, "foo", p, "foo/b")
+	if err != nil || !reflect.DeepEqual(p[:numFilled], []string{"foo/d/in", "foo-bar/a"}) {
+		t.Errorf("unexpected second page for prefix: %v, %v", p[:numFilled], err)
+	}
+	numFilled, err = lister.RepositoriesWithPrefix(env.ctx, "foo", p, p[numFilled-1])
+	if err != io.EOF || !reflect.DeepEqual(p[:numFilled], []string{"foo-bar/b"}) {
+		t.Errorf("unexpected last page for prefix: %v, %v", p[:numFilled], err)
+	}
+
+	if _, err := lister.RepositoriesWithPrefix(env.ctx, "../", p, ""); err == nil {
+		t.Errorf("expected error for prefix outside of the repositories")
+	}
+}
+
+// listRecordingDriver records the directories listed while walking.
+type listRecordingDriver struct {
+	driver.StorageDriver
+	listed []string
+}
+
+func (d *listRecordingDriver) List(ctx context.Context, path string) ([]string, error) {
+	d.listed = append(d.listed, path)
+	return d.StorageDriver.List(ctx, path)
+}
+
+func (d *listRecordingDriver) Walk(ctx context.Context, path string, f driver.WalkFn) error {
+	return driver.WalkFallback(ctx, d, path, f)
+}
+
+func TestCatalogResumesAtLast(t *testing.T) {
+	env := setupFS(t)
+	d := &listRecordingDriver{StorageDriver: env.driver}
+	registry, err := NewRegistry(env.ctx, d)
+	if err != nil {
+		t.Fatalf("error creating registry: %v", err)
+	}
+
+	p := make([]string, 2)
+	numFilled, err := registry.Repositories(env.ctx, p, "foo/b")
+	if err != nil || !reflect.DeepEqual(p[:numFilled], []string{"foo/d/in", "foo-bar/a"}) {
+		t.Fatalf("unexpected page: %v, %v", p[:numFilled], err)
+	}
+
+	root, err := pathFor(repositoriesRootPathSpec{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, listed := range d.listed {
+		for _, skipped := range []string{"bar", "foo/a"} {
+			if listed == path.Join(root, skipped) {
+				t.Errorf("directory before last was walked: %s", listed)
+			}
+		}
+	}
+}
+
 func TestCatalogEnumerate(t *testing.T) {
 	env := setupFS(t)
 
@@ -322,3 +407,87 @@ func randomFilename(length int64) string {
 	}
 	return string(b)
 }
+
+func TestRemoveRepository(t *testing.T) {
+	ctx := context.Background()
+	cacheProvider := memory.NewInMemoryBlobDescriptorCacheProvider()
+	registry := createRegistry(t, inmemory.New(), BlobDescriptorCacheProvider(cacheProvider))
+
+	parent := makeRepository(t, registry, "remove/app")
+	nested := makeRepository(t, registry, "remove/app/nested")
+	image := uploadRandomSchema2Image(t, parent)
+	uploadRandomSchema2Image(t, nested)
+
+	remover := registry.(distribution.RepositoryRemover)
+	if err := remover.Remove(ctx, parent.Named()); err != nil {
+		t.Fatalf("unexpected error removing repository: %v", err)
+	}
+
+	// the cached descriptors of the repository are dropped too
+	parent = makeRepository(t, registry, "remove/app")
+	for dgst := range image.layers {
+		if _, err := parent.Blobs(ctx).Stat(ctx, dgst); err != distribution.ErrBlobUnknown {
+			t.Fatalf("expected layer %s to be unknown after removal: %v", dgst, err)
+		}
+	}
+
+	repos := make([]string, 10)
+	n, _ := registry.Repositories(ctx, repos, "")
+	if !reflect.DeepEqual(repos[:n], []string{"remove/app/nested"}) {
+		t.Fatalf("unexpected repositories after removal: %v", repos[:n])
+	}
+
+	if err := remover.Remove(ctx, parent.Named()); err == nil {
+		t.Fatal("expected error removing an unknown repository")
+	} else if _, ok := err.(distribution.ErrRepositoryUnknown); !ok {
+		t.Fatalf("unexpected error removing an unknown repository: %v", err)
+	}
+}
+
+func TestRenameRepository(t *testing.T) {
+	ctx := context.Background()
+	registry := createRegistry(t, inmemory.New(), BlobDescriptorCacheProvider(memory.NewInMemoryBlobDescriptorCacheProvider()))
+
+	source := makeRepository(t, registry, "rename/source")
+	image := uploadRandomSchema2Image(t, source)
+	if err := source.Tags(ctx).Tag(ctx, "latest", distribution.Descriptor{Digest: image.manifestDigest}); err != nil {
+		t.Fatalf("unexpected error tagging image: %v", err)
+	}
+	existing := makeRepository(t, registry, "rename/existing")
+	uploadRandomSchema2Image(t, existing)
+
+	renamer := registry.(distribution.RepositoryRenamer)
+	if err := renamer.Rename(ctx, source.Named(), existing.Named()); err == nil {
+		t.Fatal("expected error renaming to an existing repository")
+	} else if _, ok := err.(distribution.ErrRepositoryExists); !ok {
+		t.Fatalf("unexpected error renaming to an existing repository: %v", err)
+	}
+
+	destination := makeRepository(t, registry, "rename/destination")
+	if err := renamer.Rename(ctx, source.Named(), destination.Named()); err != nil {
+		t.Fatalf("unexpected error renaming repository: %v", err)
+	}
+
+	source = makeRepository(t, registry, "rename/source")
+	desc, err := destination.Tags(ctx).Get(ctx, "latest")
+	if err != nil || desc.Digest != image.manifestDigest {
+		t.Fatalf("unexpected tag after rename: %v, %v", desc, err)
+	}
+	if _, err := makeManifestService(t, destination).Get(ctx, image.manifestDigest); err != nil {
+		t.Fatalf("unexpected error getting renamed manifest: %v", err)
+	}
+	for dgst := range image.layers {
+		if _, err := destination.Blobs(ctx).Stat(ctx, dgst); err != nil {
+			t.Fatalf("unexpected error statting renamed layer %s: %v", dgst, err)
+		}
+		if _, err := source.Blobs(ctx).Stat(ctx, dgst); err != distribution.ErrBlobUnknown {
+			t.Fatalf("expected layer %s to be unknown to the old name: %v", dgst, err)
+		}
+	}
+
+	if err := renamer.Rename(ctx, source.Named(), source.Named()); err == nil {
+		t.Fatal("expected error renaming an unknown repository")
+	} else if _, ok := err.(distribution.ErrRepositoryUnknown); !ok {
+		t.Fatalf("unexpected error renaming an unknown repository: %v", err)
+	}
+}
@@ -0,0 +1,552 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/distribution/distribution/v3"
+	dcontext "github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/manifest/manifestlist"
+	"github.com/distribution/distribution/v3/reference"
+	"github.com/distribution/distribution/v3/registry/storage/driver"
+	"github.com/opencontainers/go-digest"
+)
+
+// FsckOpts contains options for the consistency check
+type FsckOpts struct {
+	// VerifyBlobs re-hashes the data of every blob and compares it to the
+	// digest it is stored under.
+	VerifyBlobs bool
+
+	// Repair removes dangling and invalid links and relinks blobs which are
+	// referenced by a manifest but missing from the repository.
+	Repair bool
+}
+
+// InconsistencyKind categorizes the problems found by Fsck.
+type InconsistencyKind string
+
+const (
+	// InvalidLink is a link file which cannot be parsed or which does not
+	// contain the digest of the directory it is stored in.
+	InvalidLink InconsistencyKind = "invalid-link"
+
+	// DanglingLayerLink is a link in a repository's _layers directory to a
+	// blob missing from the blob store.
+	DanglingLayerLink InconsistencyKind = "dangling-layer-link"
+
+	// DanglingRevisionLink is a manifest revision link to a blob missing
+	// from the blob store.
+	DanglingRevisionLink InconsistencyKind = "dangling-revision-link"
+
+	// DanglingTagLink is a tag whose current/link is missing or points to a
+	// manifest revision which does not exist.
+	DanglingTagLink InconsistencyKind = "dangling-tag-link"
+
+	// DanglingTagIndexLink is a tag index entry pointing to a manifest
+	// revision which does not exist.
+	DanglingTagIndexLink InconsistencyKind = "dangling-tag-index-link"
+
+	// MissingLayerLink is a blob referenced by a manifest which is present
+	// in the blob store but not linked into the repository.
+	MissingLayerLink InconsistencyKind = "missing-layer-link"
+
+	// MissingRevisionLink is a manifest referenced by a manifest list or
+	// image index which is present in the blob store but not linked as a
+	// revision of the repository.
+	MissingRevisionLink InconsistencyKind = "missing-revision-link"
+
+	// MissingBlob is a blob referenced by a manifest which is missing from
+	// the blob store. It cannot be repaired.
+	MissingBlob InconsistencyKind = "missing-blob"
+
+	// CorruptManifest is a manifest revision whose content cannot be
+	// parsed. It cannot be repaired.
+	CorruptManifest InconsistencyKind = "corrupt-manifest"
+
+	// CorruptBlob is blob data which does not match its digest. It is only
+	// detected when verifying blobs and cannot be repaired.
+	CorruptBlob InconsistencyKind = "corrupt-blob"
+)
+
+// Inconsistency describes a single problem found by Fsck.
+type Inconsistency struct {
+	Kind       InconsistencyKind `json:"kind"`
+	Repository string            `json:"repository,omitempty"`
+	Path       string            `json:"path"`
+	Digest     digest.Digest     `json:"digest,omitempty"`
+	Detail     string            `json:"detail,omitempty"`
+
+	// Repaired is set once the inconsistency has been repaired.
+	Repaired bool `json:"repaired"`
+
+	repair func(ctx context.Context) error
+}
+
+// FsckReport lists the inconsistencies found by Fsck.
+type FsckReport struct {
+	Repositories    int             `json:"repositories"`
+	Blobs           int             `json:"blobs"`
+	Inconsistencies []Inconsistency `json:"inconsistencies"`
+}
+
+// Unrepaired returns the number of inconsistencies which have not been
+// repaired.
+func (r FsckReport) Unrepaired() int {
+	count := 0
+	for _, inconsistency := range r.Inconsistencies {
+		if !inconsistency.Repaired {
+			count++
+		}
+	}
+	return count
+}
+
+// fsck holds the state of a single consistency check.
+type fsck struct {
+	driver    driver.StorageDriver
+	registry  distribution.Namespace
+	blobStore *blobStore
+	opts      FsckOpts
+
+	blobs  map[digest.Digest]struct{}
+	report FsckReport
+}
+
+// Fsck walks the storage layout described in paths.go and reports links
+// which are dangling or invalid, blobs referenced by manifests which are
+// missing and, optionally, blob data which does not match its digest. In
+// repair mode, dangling and invalid links are removed or rewritten and blobs
+// referenced by manifests are relinked into their repository.
+//
+// The registry must not be written to while a repair is in progress.
+func Fsck(ctx context.Context, storageDriver driver.StorageDriver, registry distribution.Namespace, opts FsckOpts) (FsckReport, error) {
+	f := &fsck{
+		driver:   storageDriver,
+		registry: registry,
+		blobStore: &blobStore{
+			driver:  storageDriver,
+			statter: &blobStatter{driver: storageDriver},
+		},
+		opts:  opts,
+		blobs: make(map[digest.Digest]struct{}),
+		report: FsckReport{
+			Inconsistencies: []Inconsistency{},
+		},
+	}
+
+	if err := f.checkBlobs(ctx); err != nil {
+		return FsckReport{}, fmt.Errorf("failed to check blobs: %v", err)
+	}
+
+	repositories, err := f.repositories(ctx)
+	if err != nil {
+		return FsckReport{}, fmt.Errorf("failed to enumerate repositories: %v", err)
+	}
+	for _, name := range repositories {
+		if err := f.checkRepository(ctx, name); err != nil {
+			return FsckReport{}, fmt.Errorf("failed to check repository %s: %v", name, err)
+		}
+	}
+	f.report.Repositories = len(repositories)
+	f.report.Blobs = len(f.blobs)
+
+	if opts.Repair {
+		for i := range f.report.Inconsistencies {
+			inconsistency := &f.report.Inconsistencies[i]
+			if inconsistency.repair == nil {
+				continue
+			}
+			dcontext.GetLogger(ctx).Infof("fsck: repairing %s %s", inconsistency.Kind, inconsistency.Path)
+			if err := inconsistency.repair(ctx); err != nil {
+				return f.report, fmt.Errorf("failed to repair %s %s: %v", inconsistency.Kind, inconsistency.Path, err)
+			}
+			inconsistency.Repaired = true
+		}
+	}
+
+	return f.report, nil
+}
+
+func (f *fsck) add(inconsistency Inconsistency) {
+	f.report.Inconsistencies = append(f.report.Inconsistencies, inconsistency)
+}
+
+// checkBlobs records the blobs present in the blob store, verifying their
+// content if requested.
+func (f *fsck) checkBlobs(ctx context.Context) error {
+	err := f.blobStore.Enumerate(ctx, func(dgst digest.Digest) error {
+		f.blobs[dgst] = struct{}{}
+		if !f.opts.VerifyBlobs {
+			return nil
+		}
+		return f.verifyBlob(ctx, dgst)
+	})
+	if _, ok := err.(driver.PathNotFoundError); ok {
+		return nil
+	}
+	return err
+}
+
+// verifyBlob re-hashes the data of a blob. Corrupt blobs are still
+// considered present so that the links to them are left alone.
+func (f *fsck) verifyBlob(ctx context.Context, dgst digest.Digest) error {
+	dataPath, err := f.blobStore.path(dgst)
+	if err != nil {
+		return err
+	}
+
+	rc, err := f.driver.Reader(ctx, dataPath, 0)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	verifier := dgst.Verifier()
+	if _, err := io.Copy(verifier, rc); err != nil {
+		return err
+	}
+	if !verifier.Verified() {
+		f.add(Inconsistency{
+			Kind:   CorruptBlob,
+			Path:   dataPath,
+			Digest: dgst,
+			Detail: "content does not match digest",
+		})
+	}
+	return nil
+}
+
+// repositories returns the names of all repositories, including those which
+// only hold layers.
+func (f *fsck) repositories(ctx context.Context) ([]string, error) {
+	root, err := pathFor(repositoriesRootPathSpec{})
+	if err != nil {
+		return nil, err
+	}
+
+	found := make(map[string]struct{})
+	err = f.driver.Walk(ctx, root, func(fileInfo driver.FileInfo) error {
+		if !fileInfo.IsDir() {
+			return nil
+		}
+
+		filePath := fileInfo.Path()
+		base := path.Base(filePath)
+		if !strings.HasPrefix(base, "_") {
+			return nil
+		}
+
+		if base == "_layers" || base == "_manifests" {
+			found[path.Dir(strings.TrimPrefix(filePath, root+"/"))] = struct{}{}
+		}
+		return driver.ErrSkipDir
+	})
+	if _, ok := err.(driver.PathNotFoundError); ok {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(found))
+	for name := range found {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (f *fsck) checkRepository(ctx context.Context, name string) error {
+	layers, err := f.checkLinks(ctx, name, layersPathSpec{name: name}, DanglingLayerLink, f.hasBlob)
+	if err != nil {
+		return err
+	}
+
+	revisions, err := f.checkLinks(ctx, name, manifestRevisionsPathSpec{name: name}, DanglingRevisionLink, f.hasBlob)
+	if err != nil {
+		return err
+	}
+
+	if err := f.checkTags(ctx, name, revisions); err != nil {
+		return err
+	}
+
+	return f.checkReferences(ctx, name, layers, revisions)
+}
+
+func (f *fsck) hasBlob(dgst digest.Digest) bool {
+	_, ok := f.blobs[dgst]
+	return ok
+}
+
+// checkLinks checks the <algorithm>/<hex digest>/link files below the
+// directory described by spec, returning the digests of the valid links.
+// Links for which exists returns false are reported as kind.
+func (f *fsck) checkLinks(ctx context.Context, name string, spec pathSpec, kind InconsistencyKind, exists func(digest.Digest) bool) (map[digest.Digest]struct{}, error) {
+	root, err := pathFor(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	valid := make(map[digest.Digest]struct{})
+	err = f.driver.Walk(ctx, root, func(fileInfo driver.FileInfo) error {
+		if fileInfo.IsDir() || path.Base(fileInfo.Path()) != "link" {
+			return nil
+		}
+
+		linkPath := fileInfo.Path()
+		linkDir := path.Dir(linkPath)
+		expected := digest.NewDigestFromHex(path.Base(path.Dir(linkDir)), path.Base(linkDir))
+
+		linked, err := f.blobStore.readlink(ctx, linkPath)
+		if err != nil && !isLinkParseError(err) {
+			return err
+		}
+		if err != nil || linked != expected {
+			detail := fmt.Sprintf("link does not contain its digest %s", expected)
+			if err != nil {
+				detail = err.Error()
+			}
+
+			inconsistency := Inconsistency{
+				Kind:       InvalidLink,
+				Repository: name,
+				Path:       linkPath,
+				Detail:     detail,
+				repair:     f.deleteRepair(linkDir),
+			}
+			if expected.Validate() == nil && exists(expected) {
+				// the directory still names an existing blob
+				inconsistency.Digest = expected
+				inconsistency.repair = f.linkRepair(linkPath, expected)
+				valid[expected] = struct{}{}
+			}
+			f.add(inconsistency)
+			return nil
+		}
+
+		if !exists(linked) {
+			f.add(Inconsistency{
+				Kind:       kind,
+				Repository: name,
+				Path:       linkPath,
+				Digest:     linked,
+				repair:     f.deleteRepair(linkDir),
+			})
+			return nil
+		}
+
+		valid[linked] = struct{}{}
+		return nil
+	})
+	if _, ok := err.(driver.PathNotFoundError); ok {
+		return valid, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return valid, nil
+}
+
+// checkTags checks that the current link and index entries of every tag
+// point to existing manifest revisions.
+func (f *fsck) checkTags(ctx context.Context, name string, revisions map[digest.Digest]struct{}) error {
+	tagsPath, err := pathFor(manifestTagsPathSpec{name: name})
+	if err != nil {
+		return err
+	}
+
+	tagPaths, err := f.driver.List(ctx, tagsPath)
+	if _, ok := err.(driver.PathNotFoundError); ok {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	sort.Strings(tagPaths)
+
+	hasRevision := func(dgst digest.Digest) bool {
+		_, ok := revisions[dgst]
+		return ok
+	}
+
+	for _, tagPath := range tagPaths {
+		tag := path.Base(tagPath)
+
+		currentPath, err := pathFor(manifestTagCurrentPathSpec{name: name, tag: tag})
+		if err != nil {
+			return err
+		}
+
+		current, err := f.blobStore.readlink(ctx, currentPath)
+		switch {
+		case err != nil:
+			if _, ok := err.(driver.PathNotFoundError); !ok && !isLinkParseError(err) {
+				return err
+			}
+			f.add(Inconsistency{
+				Kind:       DanglingTagLink,
+				Repository: name,
+				Path:       currentPath,
+				Detail:     fmt.Sprintf("tag %s: %v", tag, err),
+				repair:     f.deleteRepair(tagPath),
+			})
+			continue
+		case !hasRevision(current):
+			f.add(Inconsistency{
+				Kind:       DanglingTagLink,
+				Repository: name,
+				Path:       currentPath,
+				Digest:     current,
+				Detail:     fmt.Sprintf("tag %s", tag),
+				repair:     f.deleteRepair(tagPath),
+			})
+			continue
+		}
+
+		if _, err := f.checkLinks(ctx, name, manifestTagIndexPathSpec{name: name, tag: tag}, DanglingTagIndexLink, hasRevision); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkReferences checks that the blobs referenced by the manifests of the
+// repository are present and linked into it.
+func (f *fsck) checkReferences(ctx context.Context, name string, layers, revisions map[digest.Digest]struct{}) error {
+	if len(revisions) == 0 {
+		return nil
+	}
+
+	named, err := reference.WithName(name)
+	if err != nil {
+		return fmt.Errorf("failed to parse repo name %s: %v", name, err)
+	}
+	repository, err := f.registry.Repository(ctx, named)
+	if err != nil {
+		return fmt.Errorf("failed to construct repository: %v", err)
+	}
+	manifestService, err := repository.Manifests(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to construct manifest service: %v", err)
+	}
+
+	manifests := make([]digest.Digest, 0, len(revisions))
+	for dgst := range revisions {
+		manifests = append(manifests, dgst)
+	}
+	sort.Slice(manifests, func(i, j int) bool { return manifests[i] < manifests[j] })
+
+	for _, dgst := range manifests {
+		manifest, err := manifestService.Get(ctx, dgst)
+		if err != nil {
+			revisionPath, _ := pathFor(manifestRevisionPathSpec{name: name, revision: dgst})
+			f.add(Inconsistency{
+				Kind:       CorruptManifest,
+				Repository: name,
+				Path:       revisionPath,
+				Digest:     dgst,
+				Detail:     err.Error(),
+			})
+			continue
+		}
+
+		// the references of manifest lists and image indexes are manifests,
+		// which are linked as revisions rather than layers
+		_, isList := manifest.(*manifestlist.DeserializedManifestList)
+
+		for _, desc := range manifest.References() {
+			if _, ok := revisions[desc.Digest]; ok {
+				// manifests referenced by a manifest list
+				continue
+			}
+
+			if !f.hasBlob(desc.Digest) {
+				if len(desc.URLs) > 0 {
+					// foreign layers are not stored in the registry
+					continue
+				}
+				blobPath, _ := pathFor(blobDataPathSpec{digest: desc.Digest})
+				f.add(Inconsistency{
+					Kind:       MissingBlob,
+					Repository: name,
+					Path:       blobPath,
+					Digest:     desc.Digest,
+					Detail:     fmt.Sprintf("referenced by manifest %s", dgst),
+				})
+				continue
+			}
+
+			if isList {
+				revisionPath, err := pathFor(manifestRevisionLinkPathSpec{name: name, revision: desc.Digest})
+				if err != nil {
+					return err
+				}
+				f.add(Inconsistency{
+					Kind:       MissingRevisionLink,
+					Repository: name,
+					Path:       revisionPath,
+					Digest:     desc.Digest,
+					Detail:     fmt.Sprintf("referenced by manifest list %s", dgst),
+					repair:     f.linkRepair(revisionPath, desc.Digest),
+				})
+				revisions[desc.Digest] = struct{}{}
+				continue
+			}
+
+			if _, ok := layers[desc.Digest]; ok {
+				continue
+			}
+
+			linkPath, err := pathFor(layerLinkPathSpec{name: name, digest: desc.Digest})
+			if err != nil {
+				return err
+			}
+			f.add(Inconsistency{
+				Kind:       MissingLayerLink,
+				Repository: name,
+				Path:       linkPath,
+				Digest:     desc.Digest,
+				Detail:     fmt.Sprintf("referenced by manifest %s", dgst),
+				repair:     f.linkRepair(linkPath, desc.Digest),
+			})
+			layers[desc.Digest] = struct{}{}
+		}
+	}
+
+	return nil
+}
+
+func (f *fsck) deleteRepair(p string) func(context.Context) error {
+	return func(ctx context.Context) error {
+		err := f.driver.Delete(ctx, p)
+		if _, ok := err.(driver.PathNotFoundError); ok {
+			// already removed along with a parent
+			return nil
+		}
+		return err
+	}
+}
+
+func (f *fsck) linkRepair(linkPath string, dgst digest.Digest) func(context.Context) error {
+	return func(ctx context.Context) error {
+		return f.blobStore.link(ctx, linkPath, dgst)
+	}
+}
+
+// isLinkParseError returns true if err was returned for a link file whose
+// content is not a valid digest.
+func isLinkParseError(err error) bool {
+	switch err {
+	case digest.ErrDigestInvalidFormat, digest.ErrDigestInvalidLength, digest.ErrDigestUnsupported:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,227 @@
+package storage
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/manifest/manifestlist"
+	"github.com/distribution/distribution/v3/manifest/schema2"
+	"github.com/distribution/distribution/v3/registry/storage/driver/inmemory"
+	"github.com/opencontainers/go-digest"
+)
+
+func fsckKinds(report FsckReport) map[InconsistencyKind]int {
+	kinds := make(map[InconsistencyKind]int)
+	for _, inconsistency := range report.Inconsistencies {
+		kinds[inconsistency.Kind]++
+	}
+	return kinds
+}
+
+func TestFsckConsistent(t *testing.T) {
+	ctx := context.Background()
+	inmemoryDriver := inmemory.New()
+
+	registry := createRegistry(t, inmemoryDriver)
+	repo := makeRepository(t, registry, "fsck/clean")
+	image := uploadRandomSchema2Image(t, repo)
+	if err := repo.Tags(ctx).Tag(ctx, "latest", distribution.Descriptor{Digest: image.manifestDigest}); err != nil {
+		t.Fatalf("failed to tag manifest: %v", err)
+	}
+
+	report, err := Fsck(ctx, inmemoryDriver, registry, FsckOpts{VerifyBlobs: true})
+	if err != nil {
+		t.Fatalf("failed to check registry: %v", err)
+	}
+	if len(report.Inconsistencies) != 0 {
+		t.Fatalf("unexpected inconsistencies: %#v", report.Inconsistencies)
+	}
+	if report.Repositories != 1 {
+		t.Fatalf("unexpected number of repositories: %d", report.Repositories)
+	}
+}
+
+func TestFsckRepair(t *testing.T) {
+	ctx := context.Background()
+	inmemoryDriver := inmemory.New()
+
+	registry := createRegistry(t, inmemoryDriver)
+	repo := makeRepository(t, registry, "fsck/broken")
+	image := uploadRandomSchema2Image(t, repo)
+	if err := repo.Tags(ctx).Tag(ctx, "latest", distribution.Descriptor{Digest: image.manifestDigest}); err != nil {
+		t.Fatalf("failed to tag manifest: %v", err)
+	}
+
+	var layers []digest.Digest
+	for dgst := range image.layers {
+		layers = append(layers, dgst)
+	}
+
+	// unlink a layer referenced by the manifest
+	unlinked, err := pathFor(layerLinkPathSpec{name: "fsck/broken", digest: layers[0]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := inmemoryDriver.Delete(ctx, unlinked); err != nil {
+		t.Fatalf("failed to delete layer link: %v", err)
+	}
+
+	// corrupt the data of the other layer
+	corrupted, err := pathFor(blobDataPathSpec{digest: layers[1]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := inmemoryDriver.PutContent(ctx, corrupted, []byte("corrupted")); err != nil {
+		t.Fatalf("failed to corrupt blob: %v", err)
+	}
+
+	// link a blob which does not exist
+	missing := digest.FromString("missing")
+	dangling, err := pathFor(layerLinkPathSpec{name: "fsck/broken", digest: missing})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := inmemoryDriver.PutContent(ctx, dangling, []byte(missing)); err != nil {
+		t.Fatal(err)
+	}
+
+	// tag a manifest revision which does not exist
+	danglingTag, err := pathFor(manifestTagCurrentPathSpec{name: "fsck/broken", tag: "dangling"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := inmemoryDriver.PutContent(ctx, danglingTag, []byte(missing)); err != nil {
+		t.Fatal(err)
+	}
+
+	// write garbage into the tag index entry of the manifest
+	revision, err := pathFor(manifestTagIndexEntryLinkPathSpec{name: "fsck/broken", tag: "latest", revision: image.manifestDigest})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := inmemoryDriver.PutContent(ctx, revision, []byte("garbage")); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := Fsck(ctx, inmemoryDriver, registry, FsckOpts{VerifyBlobs: true})
+	if err != nil {
+		t.Fatalf("failed to check registry: %v", err)
+	}
+	expected := map[InconsistencyKind]int{
+		MissingLayerLink:  1,
+		CorruptBlob:       1,
+		DanglingLayerLink: 1,
+		DanglingTagLink:   1,
+		InvalidLink:       1,
+	}
+	if kinds := fsckKinds(report); !reflect.DeepEqual(kinds, expected) {
+		t.Fatalf("unexpected inconsistencies: %v != %v", kinds, expected)
+	}
+	if report.Unrepaired() != len(report.Inconsistencies) {
+		t.Fatalf("inconsistencies repaired without repair mode")
+	}
+
+	report, err = Fsck(ctx, inmemoryDriver, registry, FsckOpts{VerifyBlobs: true, Repair: true})
+	if err != nil {
+		t.Fatalf("failed to repair registry: %v", err)
+	}
+	// corrupt blobs are only reported
+	if report.Unrepaired() != 1 {
+		t.Fatalf("unexpected unrepaired inconsistencies: %#v", report.Inconsistencies)
+	}
+
+	report, err = Fsck(ctx, inmemoryDriver, registry, FsckOpts{VerifyBlobs: true})
+	if err != nil {
+		t.Fatalf("failed to check registry: %v", err)
+	}
+	expected = map[InconsistencyKind]int{CorruptBlob: 1}
+	if kinds := fsckKinds(report); !reflect.DeepEqual(kinds, expected) {
+		t.Fatalf("unexpected inconsistencies after repair: %v != %v", kinds, expected)
+	}
+
+	// the repaired repository serves the manifest and its layers again
+	manifestService := makeManifestService(t, repo)
+	if _, err := manifestService.Get(ctx, image.manifestDigest); err != nil {
+		t.Fatalf("failed to get manifest after repair: %v", err)
+	}
+	if _, err := repo.Blobs(ctx).Stat(ctx, layers[0]); err != nil {
+		t.Fatalf("layer not relinked: %v", err)
+	}
+	if _, err := repo.Tags(ctx).Lookup(ctx, distribution.Descriptor{Digest: image.manifestDigest}); err != nil {
+		t.Fatalf("failed to look up tags after repair: %v", err)
+	}
+	if _, err := repo.Tags(ctx).Get(ctx, "dangling"); err == nil {
+		t.Fatalf("dangling tag not removed")
+	}
+}
+
+func TestFsckRepairManifestListChild(t *testing.T) {
+	ctx := context.Background()
+	inmemoryDriver := inmemory.New()
+
+	registry := createRegistry(t, inmemoryDriver)
+	repo := makeRepository(t, registry, "fsck/list")
+	image := uploadRandomSchema2Image(t, repo)
+	manifestService := makeManifestService(t, repo)
+
+	_, payload, err := image.manifest.Payload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	list, err := manifestlist.FromDescriptors([]manifestlist.ManifestDescriptor{
+		{Descriptor: distribution.Descriptor{MediaType: schema2.MediaTypeManifest, Size: int64(len(payload)), Digest: image.manifestDigest}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	listDigest, err := manifestService.Put(ctx, list)
+	if err != nil {
+		t.Fatalf("failed to put manifest list: %v", err)
+	}
+	if err := repo.Tags(ctx).Tag(ctx, "latest", distribution.Descriptor{Digest: listDigest}); err != nil {
+		t.Fatalf("failed to tag manifest list: %v", err)
+	}
+
+	// unlink the revision of the child manifest
+	revision, err := pathFor(manifestRevisionPathSpec{name: "fsck/list", revision: image.manifestDigest})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := inmemoryDriver.Delete(ctx, revision); err != nil {
+		t.Fatalf("failed to delete revision: %v", err)
+	}
+
+	report, err := Fsck(ctx, inmemoryDriver, registry, FsckOpts{Repair: true})
+	if err != nil {
+		t.Fatalf("failed to repair registry: %v", err)
+	}
+	expected := map[InconsistencyKind]int{MissingRevisionLink: 1}
+	if kinds := fsckKinds(report); !reflect.DeepEqual(kinds, expected) {
+		t.Fatalf("unexpected inconsistencies: %v != %v", kinds, expected)
+	}
+	if report.Unrepaired() != 0 {
+		t.Fatalf("unexpected unrepaired inconsistencies: %#v", report.Inconsistencies)
+	}
+
+	// the child is linked as a revision, not as a layer
+	if _, err := manifestService.Get(ctx, image.manifestDigest); err != nil {
+		t.Fatalf("failed to get child manifest after repair: %v", err)
+	}
+	layerLink, err := pathFor(layerLinkPathSpec{name: "fsck/list", digest: image.manifestDigest})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := inmemoryDriver.Stat(ctx, layerLink); err == nil {
+		t.Fatalf("child manifest linked as a layer")
+	}
+
+	report, err = Fsck(ctx, inmemoryDriver, registry, FsckOpts{})
+	if err != nil {
+		t.Fatalf("failed to check registry: %v", err)
+	}
+	if len(report.Inconsistencies) != 0 {
+		t.Fatalf("unexpected inconsistencies after repair: %#v", report.Inconsistencies)
+	}
+}
@@ -60,6 +60,23 @@ func MarkAndSweep(ctx context.Context, storageDriver driver.StorageDriver, regis
 			return fmt.Errorf("unable to convert ManifestService into ManifestEnumerator")
 		}
 
+		// Untagged manifests are only removed once it is known whether they
+		// refer to a manifest which is kept.
+		var candidates []ManifestDel
+		marked := make(map[digest.Digest]struct{})
+		markManifest := func(dgst digest.Digest, manifest distribution.Manifest) {
+			// Mark the manifest's blob
+			emit("%s: marking manifest %s ", repoName, dgst)
+			markSet[dgst] = struct{}{}
+			marked[dgst] = struct{}{}
+
+			descriptors := manifest.References()
+			for _, descriptor := range descriptors {
+				markSet[descriptor.Digest] = struct{}{}
+				emit("%s: marking blob %s", repoName, descriptor.Digest)
+			}
+		}
+
 		err = manifestEnumerator.Enumerate(ctx, func(dgst digest.Digest) error {
 			if opts.RemoveUntagged {
 				// fetch all tags where this manifest is the latest one
@@ -68,7 +85,6 @@ func MarkAndSweep(ctx context.Context, storageDriver driver.StorageDriver, regis
 					return fmt.Errorf("failed to retrieve tags for digest %v: %v", dgst, err)
 				}
 				if len(tags) == 0 {
-					emit("manifest eligible for deletion: %s", dgst)
 					// fetch all tags from repository
 					// all of these tags could contain manifest in history
 					// which means that we need check (and delete) those references when deleting manifest
@@ -76,24 +92,16 @@ func MarkAndSweep(ctx context.Context, storageDriver driver.StorageDriver, regis
 					if err != nil {
 						return fmt.Errorf("failed to retrieve tags %v", err)
 					}
-					manifestArr = append(manifestArr, ManifestDel{Name: repoName, Digest: dgst, Tags: allTags})
+					candidates = append(candidates, ManifestDel{Name: repoName, Digest: dgst, Tags: allTags})
 					return nil
 				}
 			}
-			// Mark the manifest's blob
-			emit("%s: marking manifest %s ", repoName, dgst)
-			markSet[dgst] = struct{}{}
 
 			manifest, err := manifestService.Get(ctx, dgst)
 			if err != nil {
 				return fmt.Errorf("failed to retrieve manifest for digest %v: %v", dgst, err)
 			}
-
-			descriptors := manifest.References()
-			for _, descriptor := range descriptors {
-				markSet[descriptor.Digest] = struct{}{}
-				emit("%s: marking blob %s", repoName, descriptor.Digest)
-			}
+			markManifest(dgst, manifest)
 
 			return nil
 		})
@@ -104,10 +112,48 @@ func MarkAndSweep(ctx context.Context, storageDriver driver.StorageDriver, regis
 		//
 		// In these cases we can continue marking other manifests safely.
 		if _, ok := err.(driver.PathNotFoundError); ok {
-			return nil
+			err = nil
+		}
+		if err != nil {
+			return err
 		}
 
-		return err
+		// Keep untagged manifests referring to a kept manifest through their
+		// subject, such as signatures and attestations, along with the
+		// manifests referring to those in turn.
+		subjects := make(map[digest.Digest]digest.Digest)
+		manifests := make(map[digest.Digest]distribution.Manifest)
+		for _, candidate := range candidates {
+			manifest, err := manifestService.Get(ctx, candidate.Digest)
+			if err != nil {
+				return fmt.Errorf("failed to retrieve manifest for digest %v: %v", candidate.Digest, err)
+			}
+			manifests[candidate.Digest] = manifest
+			if subject := ManifestSubject(manifest); subject != nil {
+				subjects[candidate.Digest] = subject.Digest
+			}
+		}
+		for marking := true; marking; {
+			marking = false
+			remaining := candidates[:0]
+			for _, candidate := range candidates {
+				subject, ok := subjects[candidate.Digest]
+				if _, kept := marked[subject]; ok && kept {
+					markManifest(candidate.Digest, manifests[candidate.Digest])
+					marking = true
+					continue
+				}
+				remaining = append(remaining, candidate)
+			}
+			candidates = remaining
+		}
+
+		for _, candidate := range candidates {
+			emit("manifest eligible for deletion: %s", candidate.Digest)
+		}
+		manifestArr = append(manifestArr, candidates...)
+
+		return nil
 	})
 
 	if err != nil {
@@ -381,6 +381,54 @@ func TestDeletionHasEffect(t *testing.T) {
 	}
 }
 
+func TestGCKeepsReferrers(t *testing.T) {
+	ctx := context.Background()
+	inmemoryDriver := inmemory.New()
+
+	registry := createRegistry(t, inmemoryDriver)
+	repo := makeRepository(t, registry, "referrers")
+	manifestService := makeManifestService(t, repo)
+
+	tagged := uploadRandomSchema2Image(t, repo)
+	if err := repo.Tags(ctx).Tag(ctx, "latest", distribution.Descriptor{Digest: tagged.manifestDigest}); err != nil {
+		t.Fatalf("failed to tag manifest: %v", err)
+	}
+	untagged := uploadRandomSchema2Image(t, repo)
+
+	// a signature of the tagged image, and a signature of that signature
+	signature := putReferrer(t, repo, manifestDescriptor(t, repo, tagged.manifestDigest), "application/vnd.example.signature")
+	countersignature := putReferrer(t, repo, manifestDescriptor(t, repo, signature), "application/vnd.example.countersignature")
+	orphan := putReferrer(t, repo, manifestDescriptor(t, repo, untagged.manifestDigest), "application/vnd.example.signature")
+
+	err := MarkAndSweep(ctx, inmemoryDriver, registry, GCOpts{
+		DryRun:         false,
+		RemoveUntagged: true,
+	})
+	if err != nil {
+		t.Fatalf("Failed mark and sweep: %v", err)
+	}
+
+	manifests := allManifests(t, manifestService)
+	for _, dgst := range []digest.Digest{tagged.manifestDigest, signature, countersignature} {
+		if _, ok := manifests[dgst]; !ok {
+			t.Fatalf("manifest %s should have been kept", dgst)
+		}
+	}
+	for _, dgst := range []digest.Digest{untagged.manifestDigest, orphan} {
+		if _, ok := manifests[dgst]; ok {
+			t.Fatalf("manifest %s should have been removed", dgst)
+		}
+	}
+
+	referrers, err := manifestService.(distribution.ManifestReferrersLister).Referrers(ctx, untagged.manifestDigest, "")
+	if err != nil {
+		t.Fatalf("failed to list referrers: %v", err)
+	}
+	if len(referrers) != 0 {
+		t.Fatalf("removed referrers should not be listed: %v", referrers)
+	}
+}
+
 func getAnyKey(digests map[digest.Digest]io.ReadSeeker) (d digest.Digest) {
 	for d = range digests {
 		break
@@ -84,6 +84,10 @@ func (lbs *linkedBlobStore) ServeBlob(ctx context.Context, w http.ResponseWriter
 
 func (lbs *linkedBlobStore) Put(ctx context.Context, mediaType string, p []byte) (distribution.Descriptor, error) {
 	dgst := digest.FromBytes(p)
+	if err := lbs.checkQuota(ctx, distribution.Descriptor{Digest: dgst, Size: int64(len(p))}); err != nil {
+		return distribution.Descriptor{}, err
+	}
+
 	// Place the data in the blob store first.
 	desc, err := lbs.blobStore.Put(ctx, mediaType, p)
 	if err != nil {
@@ -229,6 +233,10 @@ func (lbs *linkedBlobStore) Delete(ctx context.Context, dgst digest.Digest) erro
 		return err
 	}
 
+	if lbs.quotasEnforced() {
+		lbs.registry.quotas.forget(lbs.repository.Named().Name(), dgst)
+	}
+
 	return nil
 }
 
@@ -292,6 +300,10 @@ func (lbs *linkedBlobStore) mount(ctx context.Context, sourceRepo reference.Name
 		stat = *sourceStat
 	}
 
+	if err := lbs.checkQuota(ctx, distribution.Descriptor{Digest: dgst, Size: stat.Size}); err != nil {
+		return distribution.Descriptor{}, err
+	}
+
 	desc := distribution.Descriptor{
 		Size: stat.Size,
 
@@ -357,9 +369,32 @@ func (lbs *linkedBlobStore) linkBlob(ctx context.Context, canonical distribution
 		}
 	}
 
+	if lbs.quotasEnforced() {
+		lbs.registry.quotas.record(lbs.repository.Named().Name(), canonical)
+	}
+
 	return nil
 }
 
+// quotasEnforced returns true if links made through this store count
+// against storage quotas. Only blobs linked under _layers are counted.
+func (lbs *linkedBlobStore) quotasEnforced() bool {
+	if lbs.registry == nil || lbs.registry.quotas == nil {
+		return false
+	}
+	_, isLayers := lbs.linkDirectoryPathSpec.(layersPathSpec)
+	return isLayers
+}
+
+// checkQuota returns ErrQuotaExceeded if linking desc into the repository
+// would take it over a storage quota.
+func (lbs *linkedBlobStore) checkQuota(ctx context.Context, desc distribution.Descriptor) error {
+	if !lbs.quotasEnforced() {
+		return nil
+	}
+	return lbs.registry.quotas.check(ctx, lbs.repository.Named().Name(), desc)
+}
+
 type linkedBlobStatter struct {
 	*blobStore
 	repository distribution.Repository
@@ -0,0 +1,99 @@
+package storage
+
+import (
+	"github.com/distribution/distribution/v3"
+)
+
+// ManifestLimits bounds the size and shape of pushed manifests. Zero values
+// leave the corresponding property unbounded, and empty media type lists
+// allow any media type.
+type ManifestLimits struct {
+	// PayloadSize is the maximum size in bytes of a manifest.
+	PayloadSize int64
+	// Layers is the maximum number of layers of an image manifest.
+	Layers int
+	// IndexEntries is the maximum number of manifests of a manifest list
+	// or image index.
+	IndexEntries int
+	// ImageSize is the maximum total size in bytes of the config and layers
+	// of an image manifest.
+	ImageSize int64
+	// LayerMediaTypes lists the allowed layer media types.
+	LayerMediaTypes []string
+	// ConfigMediaTypes lists the allowed config media types.
+	ConfigMediaTypes []string
+}
+
+// EnforceManifestLimits is a functional option for NewRegistry. It rejects
+// pushed manifests exceeding the limits.
+func EnforceManifestLimits(limits ManifestLimits) RegistryOption {
+	return func(registry *registry) error {
+		registry.manifestLimits = limits
+		return nil
+	}
+}
+
+// verifyPayload returns the errors of a manifest payload exceeding the
+// payload size limit.
+func (limits ManifestLimits) verifyPayload(payload []byte) distribution.ErrManifestVerification {
+	if limits.PayloadSize > 0 && int64(len(payload)) > limits.PayloadSize {
+		return distribution.ErrManifestVerification{
+			distribution.ErrManifestLimitExceeded{Limit: "payload size", Max: limits.PayloadSize, Value: int64(len(payload))},
+		}
+	}
+	return nil
+}
+
+// verifyImage returns the errors of an image manifest with the given config
+// and layers exceeding the limits.
+func (limits ManifestLimits) verifyImage(config distribution.Descriptor, layers []distribution.Descriptor) distribution.ErrManifestVerification {
+	var errs distribution.ErrManifestVerification
+
+	if limits.Layers > 0 && len(layers) > limits.Layers {
+		errs = append(errs, distribution.ErrManifestLimitExceeded{Limit: "layers", Max: int64(limits.Layers), Value: int64(len(layers))})
+	}
+
+	if limits.ImageSize > 0 {
+		size := config.Size
+		for _, layer := range layers {
+			size += layer.Size
+		}
+		if size > limits.ImageSize {
+			errs = append(errs, distribution.ErrManifestLimitExceeded{Limit: "image size", Max: limits.ImageSize, Value: size})
+		}
+	}
+
+	if !allowedMediaType(limits.ConfigMediaTypes, config.MediaType) {
+		errs = append(errs, distribution.ErrManifestMediaTypeInvalid{Kind: "config", MediaType: config.MediaType})
+	}
+	for _, layer := range layers {
+		if !allowedMediaType(limits.LayerMediaTypes, layer.MediaType) {
+			errs = append(errs, distribution.ErrManifestMediaTypeInvalid{Kind: "layer", MediaType: layer.MediaType})
+		}
+	}
+
+	return errs
+}
+
+// verifyIndex returns the errors of a manifest list or image index with the
+// given entries exceeding the limits.
+func (limits ManifestLimits) verifyIndex(entries []distribution.Descriptor) distribution.ErrManifestVerification {
+	if limits.IndexEntries > 0 && len(entries) > limits.IndexEntries {
+		return distribution.ErrManifestVerification{
+			distribution.ErrManifestLimitExceeded{Limit: "index entries", Max: int64(limits.IndexEntries), Value: int64(len(entries))},
+		}
+	}
+	return nil
+}
+
+func allowedMediaType(allowed []string, mediaType string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	for _, a := range allowed {
+		if a == mediaType {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,146 @@
+package storage
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/manifest/manifestlist"
+	"github.com/distribution/distribution/v3/manifest/ocischema"
+	"github.com/distribution/distribution/v3/manifest/schema2"
+	"github.com/distribution/distribution/v3/registry/storage/driver/inmemory"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func TestManifestLimits(t *testing.T) {
+	ctx := context.Background()
+	registry := createRegistry(t, inmemory.New(), EnforceManifestLimits(ManifestLimits{
+		Layers:           2,
+		IndexEntries:     1,
+		ImageSize:        10,
+		LayerMediaTypes:  []string{v1.MediaTypeImageLayerGzip, schema2.MediaTypeLayer},
+		ConfigMediaTypes: []string{v1.MediaTypeImageConfig, schema2.MediaTypeImageConfig},
+	}))
+	repo := makeRepository(t, registry, "test")
+	manifestService := makeManifestService(t, repo)
+	blobs := repo.Blobs(ctx)
+
+	put := func(mediaType string, p []byte) distribution.Descriptor {
+		desc, err := blobs.Put(ctx, mediaType, p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		desc.MediaType = mediaType
+		return desc
+	}
+	config := put(v1.MediaTypeImageConfig, []byte("{}"))
+	dockerConfig := put(schema2.MediaTypeImageConfig, []byte("{}"))
+	layer := put(v1.MediaTypeImageLayerGzip, []byte("layer"))
+	dockerLayer := put(schema2.MediaTypeLayer, []byte("layer"))
+	largeLayer := put(v1.MediaTypeImageLayerGzip, []byte("large layer"))
+	tarLayer := put(v1.MediaTypeImageLayer, []byte("tar"))
+	otherConfig := put("application/vnd.example.config", []byte("{}"))
+
+	oci := func(config distribution.Descriptor, layers ...distribution.Descriptor) distribution.Manifest {
+		m, err := ocischema.FromStruct(ocischema.Manifest{
+			Versioned: ocischema.SchemaVersion,
+			Config:    config,
+			Layers:    layers,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return m
+	}
+
+	accepted := oci(config, layer)
+	acceptedDigest, err := manifestService.Put(ctx, accepted)
+	if err != nil {
+		t.Fatalf("unexpected error putting manifest within the limits: %v", err)
+	}
+
+	docker, err := schema2.FromStruct(schema2.Manifest{
+		Versioned: schema2.SchemaVersion,
+		Config:    dockerConfig,
+		Layers:    []distribution.Descriptor{dockerLayer, dockerLayer, dockerLayer},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	index, err := manifestlist.FromDescriptors([]manifestlist.ManifestDescriptor{
+		{Descriptor: distribution.Descriptor{MediaType: v1.MediaTypeImageManifest, Size: 1, Digest: acceptedDigest}},
+		{Descriptor: distribution.Descriptor{MediaType: v1.MediaTypeImageManifest, Size: 1, Digest: acceptedDigest}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name     string
+		manifest distribution.Manifest
+		errs     distribution.ErrManifestVerification
+	}{
+		{
+			name:     "too many layers",
+			manifest: docker,
+			errs: distribution.ErrManifestVerification{
+				distribution.ErrManifestLimitExceeded{Limit: "layers", Max: 2, Value: 3},
+				distribution.ErrManifestLimitExceeded{Limit: "image size", Max: 10, Value: 17},
+			},
+		},
+		{
+			name:     "image too large",
+			manifest: oci(config, largeLayer),
+			errs: distribution.ErrManifestVerification{
+				distribution.ErrManifestLimitExceeded{Limit: "image size", Max: 10, Value: 13},
+			},
+		},
+		{
+			name:     "disallowed media types",
+			manifest: oci(otherConfig, tarLayer),
+			errs: distribution.ErrManifestVerification{
+				distribution.ErrManifestMediaTypeInvalid{Kind: "config", MediaType: "application/vnd.example.config"},
+				distribution.ErrManifestMediaTypeInvalid{Kind: "layer", MediaType: v1.MediaTypeImageLayer},
+			},
+		},
+		{
+			name:     "too many index entries",
+			manifest: index,
+			errs: distribution.ErrManifestVerification{
+				distribution.ErrManifestLimitExceeded{Limit: "index entries", Max: 1, Value: 2},
+			},
+		},
+	} {
+		_, err := manifestService.Put(ctx, tc.manifest)
+		errs, ok := err.(distribution.ErrManifestVerification)
+		if !ok {
+			t.Fatalf("%s: expected ErrManifestVerification, got %v", tc.name, err)
+		}
+		if !reflect.DeepEqual(errs, tc.errs) {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.errs, errs)
+		}
+	}
+}
+
+func TestManifestLimitsPayloadSize(t *testing.T) {
+	ctx := context.Background()
+	registry := createRegistry(t, inmemory.New(), EnforceManifestLimits(ManifestLimits{PayloadSize: 64}))
+	repo := makeRepository(t, registry, "test")
+	manifestService := makeManifestService(t, repo)
+
+	index, err := manifestlist.FromDescriptors(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, payload, _ := index.Payload()
+
+	_, err = manifestService.Put(ctx, index)
+	expected := distribution.ErrManifestVerification{
+		distribution.ErrManifestLimitExceeded{Limit: "payload size", Max: 64, Value: int64(len(payload))},
+	}
+	if !reflect.DeepEqual(err, expected) {
+		t.Fatalf("expected %v, got %v", expected, err)
+	}
+}
@@ -15,6 +15,7 @@ type manifestListHandler struct {
 	repository distribution.Repository
 	blobStore  distribution.BlobStore
 	ctx        context.Context
+	limits     ManifestLimits
 }
 
 var _ ManifestHandler = &manifestListHandler{}
@@ -67,6 +68,25 @@ func (ms *manifestListHandler) verifyManifest(ctx context.Context, mnfst manifes
 		return fmt.Errorf("unrecognized manifest list schema version %d", mnfst.SchemaVersion)
 	}
 
+	_, payload, err := mnfst.Payload()
+	if err != nil {
+		return err
+	}
+	if limitErrs := append(ms.limits.verifyPayload(payload), ms.limits.verifyIndex(mnfst.References())...); len(limitErrs) != 0 {
+		return limitErrs
+	}
+
+	if mnfst.Subject != nil {
+		if mnfst.MediaType == manifestlist.MediaTypeManifestList {
+			return distribution.ErrManifestVerification{
+				distribution.ErrManifestSubjectInvalid{Reason: "subject is not supported on manifest lists"},
+			}
+		}
+		if err := validateSubject(mnfst.Subject); err != nil {
+			return distribution.ErrManifestVerification{err}
+		}
+	}
+
 	if !skipDependencyVerification {
 		// This manifest service is different from the blob service
 		// returned by Blob. It uses a linked blob store to ensure that
@@ -129,24 +129,59 @@ func (ms *manifestStore) Get(ctx context.Context, dgst digest.Digest, options ..
 func (ms *manifestStore) Put(ctx context.Context, manifest distribution.Manifest, options ...distribution.ManifestServiceOption) (digest.Digest, error) {
 	dcontext.GetLogger(ms.ctx).Debug("(*manifestStore).Put")
 
+	if quotas := ms.repository.registry.quotas; quotas != nil {
+		if err := quotas.checkUsage(ctx, ms.repository.Named().Name()); err != nil {
+			return "", err
+		}
+	}
+
+	var handler ManifestHandler
 	switch manifest.(type) {
 	case *schema1.SignedManifest:
-		return ms.schema1Handler.Put(ctx, manifest, ms.skipDependencyVerification)
+		handler = ms.schema1Handler
 	case *schema2.DeserializedManifest:
-		return ms.schema2Handler.Put(ctx, manifest, ms.skipDependencyVerification)
+		handler = ms.schema2Handler
 	case *ocischema.DeserializedManifest:
-		return ms.ocischemaHandler.Put(ctx, manifest, ms.skipDependencyVerification)
+		handler = ms.ocischemaHandler
 	case *manifestlist.DeserializedManifestList:
-		return ms.manifestListHandler.Put(ctx, manifest, ms.skipDependencyVerification)
+		handler = ms.manifestListHandler
+	default:
+		return "", fmt.Errorf("unrecognized manifest type %T", manifest)
+	}
+
+	dgst, err := handler.Put(ctx, manifest, ms.skipDependencyVerification)
+	if err != nil {
+		return "", err
 	}
 
-	return "", fmt.Errorf("unrecognized manifest type %T", manifest)
+	if subject := ManifestSubject(manifest); subject != nil {
+		if err := ms.linkReferrer(ctx, subject.Digest, dgst); err != nil {
+			return "", err
+		}
+	}
+
+	return dgst, nil
 }
 
 // Delete removes the revision of the specified manifest.
 func (ms *manifestStore) Delete(ctx context.Context, dgst digest.Digest) error {
 	dcontext.GetLogger(ms.ctx).Debug("(*manifestStore).Delete")
-	return ms.blobStore.Delete(ctx, dgst)
+
+	// The manifest is fetched first to remove it from the referrers index
+	// of its subject.
+	var subject *distribution.Descriptor
+	if manifest, err := ms.Get(ctx, dgst); err == nil {
+		subject = ManifestSubject(manifest)
+	}
+
+	if err := ms.blobStore.Delete(ctx, dgst); err != nil {
+		return err
+	}
+
+	if subject != nil {
+		return ms.unlinkReferrer(ctx, subject.Digest, dgst)
+	}
+	return nil
 }
 
 func (ms *manifestStore) Enumerate(ctx context.Context, ingester func(digest.Digest) error) error {
@@ -0,0 +1,381 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	dcontext "github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/registry/storage/driver"
+	"github.com/opencontainers/go-digest"
+)
+
+// MigrateOpts contains options for migrating storage between drivers
+type MigrateOpts struct {
+	// Concurrency is the number of objects copied in parallel.
+	Concurrency int
+
+	// Checkpoint is the path of a local file recording the blobs which have
+	// been copied and verified, allowing an interrupted migration to resume
+	// without checking them again.
+	Checkpoint string
+
+	// Incremental removes repository content from the destination which no
+	// longer exists at the source, such as deleted tags. It is meant for a
+	// final pass while the source registry is read-only.
+	Incremental bool
+}
+
+// MigrateReport summarizes a migration.
+type MigrateReport struct {
+	Copied  int64
+	Skipped int64
+	Removed int64
+	Bytes   int64
+}
+
+// migration holds the state of a single migration.
+type migration struct {
+	src, dst driver.StorageDriver
+	opts     MigrateOpts
+
+	checkpointed map[string]int64
+	checkpointMu sync.Mutex
+	checkpoint   *bufio.Writer
+
+	report MigrateReport
+}
+
+// Migrate copies the registry tree from the src driver to the dst driver.
+// Uploads in progress are not copied. Blob data is immutable, so blobs
+// present at the destination with the expected digest are skipped, while
+// links and other small files are compared by content. The data of every
+// blob copied is read back from the destination and verified against its
+// digest.
+func Migrate(ctx context.Context, src, dst driver.StorageDriver, opts MigrateOpts) (MigrateReport, error) {
+	if opts.Concurrency < 1 {
+		opts.Concurrency = 1
+	}
+
+	m := &migration{
+		src:          src,
+		dst:          dst,
+		opts:         opts,
+		checkpointed: make(map[string]int64),
+	}
+
+	if opts.Checkpoint != "" {
+		fp, err := m.openCheckpoint(opts.Checkpoint)
+		if err != nil {
+			return MigrateReport{}, fmt.Errorf("failed to open checkpoint: %v", err)
+		}
+		defer fp.Close()
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	files := make(chan driver.FileInfo)
+	errs := make(chan error, opts.Concurrency+1)
+	sourcePaths := make(map[string]struct{})
+
+	var wg sync.WaitGroup
+	for i := 0; i < opts.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for fileInfo := range files {
+				if err := m.copy(ctx, fileInfo); err != nil {
+					errs <- fmt.Errorf("failed to copy %s: %v", fileInfo.Path(), err)
+					cancel()
+					return
+				}
+			}
+		}()
+	}
+
+	root := path.Join(storagePathRoot, storagePathVersion)
+	err := src.Walk(ctx, root, func(fileInfo driver.FileInfo) error {
+		if opts.Incremental {
+			sourcePaths[fileInfo.Path()] = struct{}{}
+		}
+
+		if fileInfo.IsDir() {
+			if path.Base(fileInfo.Path()) == "_uploads" {
+				return driver.ErrSkipDir
+			}
+			return nil
+		}
+
+		select {
+		case files <- fileInfo:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+	close(files)
+	wg.Wait()
+
+	select {
+	case copyErr := <-errs:
+		return m.report, copyErr
+	default:
+	}
+	if _, ok := err.(driver.PathNotFoundError); ok {
+		err = nil
+	}
+	if err != nil {
+		return m.report, fmt.Errorf("failed to walk source: %v", err)
+	}
+
+	if opts.Incremental {
+		if err := m.removeExtraneous(ctx, sourcePaths); err != nil {
+			return m.report, err
+		}
+	}
+
+	return m.report, m.flushCheckpoint()
+}
+
+// copy copies a single file unless it is already present at the destination.
+func (m *migration) copy(ctx context.Context, fileInfo driver.FileInfo) error {
+	filePath := fileInfo.Path()
+	dgst, isBlob := blobDataDigest(filePath)
+
+	if isBlob {
+		m.checkpointMu.Lock()
+		size, ok := m.checkpointed[filePath]
+		m.checkpointMu.Unlock()
+		if ok && size == fileInfo.Size() {
+			atomic.AddInt64(&m.report.Skipped, 1)
+			return nil
+		}
+	}
+
+	matches, err := m.matches(ctx, fileInfo, dgst, isBlob)
+	if err != nil {
+		return err
+	}
+
+	if !matches {
+		dcontext.GetLogger(ctx).Debugf("migrate: copying %s", filePath)
+		if err := m.transfer(ctx, filePath); err != nil {
+			return err
+		}
+		if isBlob {
+			ok, err := m.verify(ctx, filePath, dgst)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				return fmt.Errorf("content at destination does not match digest %s", dgst)
+			}
+		}
+		atomic.AddInt64(&m.report.Copied, 1)
+		atomic.AddInt64(&m.report.Bytes, fileInfo.Size())
+	} else {
+		atomic.AddInt64(&m.report.Skipped, 1)
+	}
+
+	if isBlob {
+		return m.recordCheckpoint(filePath, fileInfo.Size())
+	}
+	return nil
+}
+
+// matches returns true if the destination already holds the same content as
+// the source.
+func (m *migration) matches(ctx context.Context, fileInfo driver.FileInfo, dgst digest.Digest, isBlob bool) (bool, error) {
+	dstInfo, err := m.dst.Stat(ctx, fileInfo.Path())
+	if _, ok := err.(driver.PathNotFoundError); ok {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if dstInfo.IsDir() || dstInfo.Size() != fileInfo.Size() {
+		return false, nil
+	}
+
+	if isBlob {
+		return m.verify(ctx, fileInfo.Path(), dgst)
+	}
+
+	srcContent, err := m.src.GetContent(ctx, fileInfo.Path())
+	if err != nil {
+		return false, err
+	}
+	dstContent, err := m.dst.GetContent(ctx, fileInfo.Path())
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(srcContent, dstContent), nil
+}
+
+// transfer streams a file from the source to the destination.
+func (m *migration) transfer(ctx context.Context, filePath string) error {
+	rc, err := m.src.Reader(ctx, filePath, 0)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	fw, err := m.dst.Writer(ctx, filePath, false)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(fw, rc); err != nil {
+		fw.Cancel()
+		fw.Close()
+		return err
+	}
+	if err := fw.Commit(); err != nil {
+		fw.Close()
+		return err
+	}
+	return fw.Close()
+}
+
+// verify returns true if the content at the destination matches dgst.
+func (m *migration) verify(ctx context.Context, filePath string, dgst digest.Digest) (bool, error) {
+	rc, err := m.dst.Reader(ctx, filePath, 0)
+	if err != nil {
+		return false, err
+	}
+	defer rc.Close()
+
+	verifier := dgst.Verifier()
+	if _, err := io.Copy(verifier, rc); err != nil {
+		return false, err
+	}
+	return verifier.Verified(), nil
+}
+
+// removeExtraneous deletes repository files and directories from the
+// destination which are not present at the source. Blobs are left for
+// garbage collection.
+func (m *migration) removeExtraneous(ctx context.Context, sourcePaths map[string]struct{}) error {
+	root, err := pathFor(repositoriesRootPathSpec{})
+	if err != nil {
+		return err
+	}
+
+	var extraneous []string
+	err = m.dst.Walk(ctx, root, func(fileInfo driver.FileInfo) error {
+		if fileInfo.IsDir() && path.Base(fileInfo.Path()) == "_uploads" {
+			return driver.ErrSkipDir
+		}
+		if _, ok := sourcePaths[fileInfo.Path()]; ok {
+			return nil
+		}
+
+		// Remove whole directories, such as those of deleted tags, so
+		// that no empty directories are left behind.
+		extraneous = append(extraneous, fileInfo.Path())
+		if fileInfo.IsDir() {
+			return driver.ErrSkipDir
+		}
+		return nil
+	})
+	if _, ok := err.(driver.PathNotFoundError); ok {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to walk destination: %v", err)
+	}
+
+	for _, filePath := range extraneous {
+		dcontext.GetLogger(ctx).Infof("migrate: removing %s", filePath)
+		if err := m.dst.Delete(ctx, filePath); err != nil {
+			if _, ok := err.(driver.PathNotFoundError); !ok {
+				return fmt.Errorf("failed to remove %s: %v", filePath, err)
+			}
+		}
+		m.report.Removed++
+	}
+
+	return nil
+}
+
+// openCheckpoint loads the blobs recorded in the checkpoint file at p and
+// opens it for appending.
+func (m *migration) openCheckpoint(p string) (*os.File, error) {
+	fp, err := os.OpenFile(p, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	scanner := bufio.NewScanner(fp)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			// a partially written line from an interrupted migration
+			continue
+		}
+		size, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		m.checkpointed[fields[0]] = size
+	}
+	if err := scanner.Err(); err != nil {
+		fp.Close()
+		return nil, err
+	}
+
+	m.checkpoint = bufio.NewWriter(fp)
+	return fp, nil
+}
+
+func (m *migration) recordCheckpoint(filePath string, size int64) error {
+	if m.checkpoint == nil {
+		return nil
+	}
+
+	m.checkpointMu.Lock()
+	defer m.checkpointMu.Unlock()
+
+	m.checkpointed[filePath] = size
+	if _, err := fmt.Fprintf(m.checkpoint, "%s %d\n", filePath, size); err != nil {
+		return err
+	}
+	return m.checkpoint.Flush()
+}
+
+func (m *migration) flushCheckpoint() error {
+	if m.checkpoint == nil {
+		return nil
+	}
+
+	m.checkpointMu.Lock()
+	defer m.checkpointMu.Unlock()
+	return m.checkpoint.Flush()
+}
+
+// blobDataDigest returns the digest of the blob stored at filePath if it is
+// the data file of a blob.
+func blobDataDigest(filePath string) (digest.Digest, bool) {
+	blobsRoot, err := pathFor(blobsPathSpec{})
+	if err != nil {
+		return "", false
+	}
+	if !strings.HasPrefix(filePath, blobsRoot+"/") || path.Base(filePath) != "data" {
+		return "", false
+	}
+
+	dgst, err := digestFromPath(filePath)
+	if err != nil {
+		return "", false
+	}
+	return dgst, true
+}
@@ -0,0 +1,133 @@
+package storage
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/registry/storage/driver/inmemory"
+)
+
+func TestMigrate(t *testing.T) {
+	ctx := context.Background()
+	src := inmemory.New()
+	dst := inmemory.New()
+
+	tmpDir, err := ioutil.TempDir("", "migrate-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+	checkpoint := filepath.Join(tmpDir, "checkpoint")
+
+	srcRegistry := createRegistry(t, src)
+	srcRepo := makeRepository(t, srcRegistry, "migrate/me")
+	image := uploadRandomSchema2Image(t, srcRepo)
+	for _, tag := range []string{"latest", "stale"} {
+		if err := srcRepo.Tags(ctx).Tag(ctx, tag, distribution.Descriptor{Digest: image.manifestDigest}); err != nil {
+			t.Fatalf("failed to tag manifest: %v", err)
+		}
+	}
+
+	opts := MigrateOpts{Concurrency: 4, Checkpoint: checkpoint}
+	report, err := Migrate(ctx, src, dst, opts)
+	if err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+	if report.Copied == 0 || report.Skipped != 0 {
+		t.Fatalf("unexpected report for initial migration: %+v", report)
+	}
+
+	dstRegistry := createRegistry(t, dst)
+	dstRepo := makeRepository(t, dstRegistry, "migrate/me")
+	if _, err := makeManifestService(t, dstRepo).Get(ctx, image.manifestDigest); err != nil {
+		t.Fatalf("manifest not migrated: %v", err)
+	}
+	for dgst := range image.layers {
+		if _, err := dstRepo.Blobs(ctx).Stat(ctx, dgst); err != nil {
+			t.Fatalf("layer %s not migrated: %v", dgst, err)
+		}
+	}
+
+	// a second pass copies nothing
+	report, err = Migrate(ctx, src, dst, opts)
+	if err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+	if report.Copied != 0 {
+		t.Fatalf("unexpected copies on second pass: %+v", report)
+	}
+
+	// a final incremental pass picks up new content and deleted tags
+	update := uploadRandomSchema2Image(t, srcRepo)
+	if err := srcRepo.Tags(ctx).Tag(ctx, "latest", distribution.Descriptor{Digest: update.manifestDigest}); err != nil {
+		t.Fatalf("failed to tag manifest: %v", err)
+	}
+	if err := srcRepo.Tags(ctx).Untag(ctx, "stale"); err != nil {
+		t.Fatalf("failed to untag manifest: %v", err)
+	}
+
+	opts.Incremental = true
+	report, err = Migrate(ctx, src, dst, opts)
+	if err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+	if report.Copied == 0 || report.Removed == 0 {
+		t.Fatalf("unexpected report for incremental pass: %+v", report)
+	}
+
+	desc, err := dstRepo.Tags(ctx).Get(ctx, "latest")
+	if err != nil {
+		t.Fatalf("failed to get tag: %v", err)
+	}
+	if desc.Digest != update.manifestDigest {
+		t.Fatalf("tag not updated: %s != %s", desc.Digest, update.manifestDigest)
+	}
+	tags, err := dstRepo.Tags(ctx).All(ctx)
+	if err != nil {
+		t.Fatalf("failed to list tags: %v", err)
+	}
+	if len(tags) != 1 || tags[0] != "latest" {
+		t.Fatalf("unexpected tags after incremental pass: %v", tags)
+	}
+}
+
+func TestMigrateReplacesCorruptBlobs(t *testing.T) {
+	ctx := context.Background()
+	src := inmemory.New()
+	dst := inmemory.New()
+
+	srcRegistry := createRegistry(t, src)
+	srcRepo := makeRepository(t, srcRegistry, "migrate/corrupt")
+	image := uploadRandomSchema2Image(t, srcRepo)
+
+	if _, err := Migrate(ctx, src, dst, MigrateOpts{}); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+
+	// corrupt a blob at the destination without changing its size
+	var blobPath string
+	for dgst := range image.layers {
+		blobPath, _ = pathFor(blobDataPathSpec{digest: dgst})
+		break
+	}
+	content, err := dst.GetContent(ctx, blobPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content[0] ^= 0xff
+	if err := dst.PutContent(ctx, blobPath, content); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := Migrate(ctx, src, dst, MigrateOpts{})
+	if err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+	if report.Copied != 1 {
+		t.Fatalf("expected the corrupt blob to be copied again: %+v", report)
+	}
+}
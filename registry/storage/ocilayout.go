@@ -0,0 +1,742 @@
+package storage
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/distribution/distribution/v3"
+	dcontext "github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/manifest"
+	"github.com/distribution/distribution/v3/manifest/manifestlist"
+	"github.com/distribution/distribution/v3/manifest/schema1"
+	"github.com/distribution/distribution/v3/reference"
+	"github.com/distribution/distribution/v3/registry/storage/driver"
+	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// annotationImageName records the repository and tag of a manifest in the
+// index of an OCI image layout, as used by containerd.
+const annotationImageName = "io.containerd.image.name"
+
+// ExportOpts contains options for exporting repositories to an OCI image
+// layout
+type ExportOpts struct {
+	// Filters select the content to export, each either a repository name
+	// or a name:tag reference. Every tag of every repository is exported if
+	// no filters are given.
+	Filters []string
+
+	// Tarball writes the layout into a tar archive rather than a directory.
+	Tarball bool
+
+	// Verify re-hashes every blob read from storage and fails the export if
+	// its content does not match its digest.
+	Verify bool
+}
+
+// ImportOpts contains options for importing an OCI image layout
+type ImportOpts struct {
+	// Filters select the content to import, each either a repository name
+	// or a name:tag reference. Everything in the layout is imported if no
+	// filters are given.
+	Filters []string
+
+	// Repository is the repository to import manifests into which are not
+	// annotated with a repository name, such as those in layouts written by
+	// other tools.
+	Repository string
+}
+
+// LayoutReport summarizes an export or import.
+type LayoutReport struct {
+	Tags  int
+	Blobs int
+	Bytes int64
+}
+
+// Export writes the tagged manifests of the repositories of the registry,
+// along with the manifests and blobs they reference, into an OCI image
+// layout at dst. Each entry of the layout's index.json is annotated with its
+// tag and its repository name.
+func Export(ctx context.Context, registry distribution.Namespace, dst string, opts ExportOpts) (LayoutReport, error) {
+	filters, err := parseLayoutFilters(opts.Filters)
+	if err != nil {
+		return LayoutReport{}, err
+	}
+
+	var writer layoutWriter
+	if opts.Tarball {
+		writer, err = newTarLayoutWriter(dst)
+	} else {
+		writer, err = newDirLayoutWriter(dst)
+	}
+	if err != nil {
+		return LayoutReport{}, err
+	}
+
+	e := &layoutExporter{
+		registry: registry,
+		opts:     opts,
+		writer:   writer,
+		written:  make(map[digest.Digest]struct{}),
+	}
+
+	index, err := e.export(ctx, filters)
+	if err == nil {
+		err = e.writeIndex(index)
+	}
+	if closeErr := writer.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return e.report, err
+	}
+
+	return e.report, nil
+}
+
+type layoutExporter struct {
+	registry distribution.Namespace
+	opts     ExportOpts
+	writer   layoutWriter
+	written  map[digest.Digest]struct{}
+	report   LayoutReport
+}
+
+func (e *layoutExporter) export(ctx context.Context, filters []layoutFilter) ([]v1.Descriptor, error) {
+	var names []string
+	if len(filters) > 0 {
+		seen := make(map[string]struct{})
+		for _, filter := range filters {
+			if _, ok := seen[filter.name]; !ok {
+				seen[filter.name] = struct{}{}
+				names = append(names, filter.name)
+			}
+		}
+	} else {
+		repositoryEnumerator, ok := e.registry.(distribution.RepositoryEnumerator)
+		if !ok {
+			return nil, fmt.Errorf("unable to convert Namespace to RepositoryEnumerator")
+		}
+		err := repositoryEnumerator.Enumerate(ctx, func(name string) error {
+			names = append(names, name)
+			return nil
+		})
+		if _, ok := err.(driver.PathNotFoundError); err != nil && !ok {
+			return nil, fmt.Errorf("failed to enumerate repositories: %v", err)
+		}
+	}
+	sort.Strings(names)
+
+	index := []v1.Descriptor{}
+	for _, name := range names {
+		named, err := reference.WithName(name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse repo name %s: %v", name, err)
+		}
+		repository, err := e.registry.Repository(ctx, named)
+		if err != nil {
+			return nil, fmt.Errorf("failed to construct repository: %v", err)
+		}
+		manifestService, err := repository.Manifests(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to construct manifest service: %v", err)
+		}
+
+		tags, err := repository.Tags(ctx).All(ctx)
+		if err != nil {
+			if _, ok := err.(distribution.ErrRepositoryUnknown); ok && len(filters) == 0 {
+				// repositories without tags
+				continue
+			}
+			return nil, fmt.Errorf("failed to list tags of %s: %v", name, err)
+		}
+		sort.Strings(tags)
+
+		for _, tag := range tags {
+			if !matchLayoutFilters(filters, name, tag) {
+				continue
+			}
+
+			tagged, err := repository.Tags(ctx).Get(ctx, tag)
+			if err != nil {
+				return nil, fmt.Errorf("failed to resolve %s:%s: %v", name, tag, err)
+			}
+
+			dcontext.GetLogger(ctx).Infof("exporting %s:%s", name, tag)
+			desc, err := e.exportManifest(ctx, repository, manifestService, tagged.Digest)
+			if err != nil {
+				return nil, fmt.Errorf("failed to export %s:%s: %v", name, tag, err)
+			}
+			desc.Annotations = map[string]string{
+				v1.AnnotationRefName: tag,
+				annotationImageName:  name + ":" + tag,
+			}
+			index = append(index, desc)
+			e.report.Tags++
+		}
+	}
+
+	return index, nil
+}
+
+// exportManifest writes the manifest dgst along with everything it
+// references into the layout.
+func (e *layoutExporter) exportManifest(ctx context.Context, repository distribution.Repository, manifestService distribution.ManifestService, dgst digest.Digest) (v1.Descriptor, error) {
+	manifest, err := manifestService.Get(ctx, dgst)
+	if err != nil {
+		return v1.Descriptor{}, err
+	}
+	mediaType, payload, err := manifest.Payload()
+	if err != nil {
+		return v1.Descriptor{}, err
+	}
+	if dgst.Algorithm().FromBytes(payload) != dgst {
+		return v1.Descriptor{}, fmt.Errorf("content of manifest %s does not match its digest", dgst)
+	}
+
+	if list, ok := manifest.(*manifestlist.DeserializedManifestList); ok {
+		for _, child := range list.Manifests {
+			if _, err := e.exportManifest(ctx, repository, manifestService, child.Digest); err != nil {
+				return v1.Descriptor{}, err
+			}
+		}
+	} else {
+		for _, desc := range manifest.References() {
+			if err := e.exportBlob(ctx, repository, desc); err != nil {
+				return v1.Descriptor{}, err
+			}
+		}
+	}
+
+	if err := e.writeBlob(dgst, int64(len(payload)), bytes.NewReader(payload)); err != nil {
+		return v1.Descriptor{}, err
+	}
+
+	return v1.Descriptor{
+		MediaType: mediaType,
+		Digest:    dgst,
+		Size:      int64(len(payload)),
+	}, nil
+}
+
+func (e *layoutExporter) exportBlob(ctx context.Context, repository distribution.Repository, desc distribution.Descriptor) error {
+	if _, ok := e.written[desc.Digest]; ok {
+		return nil
+	}
+
+	blobs := repository.Blobs(ctx)
+	stat, err := blobs.Stat(ctx, desc.Digest)
+	if err == distribution.ErrBlobUnknown && len(desc.URLs) > 0 {
+		// foreign layers are not stored in the registry
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to stat blob %s: %v", desc.Digest, err)
+	}
+
+	rc, err := blobs.Open(ctx, desc.Digest)
+	if err != nil {
+		return fmt.Errorf("failed to open blob %s: %v", desc.Digest, err)
+	}
+	defer rc.Close()
+
+	var r io.Reader = rc
+	var verifier digest.Verifier
+	if e.opts.Verify {
+		verifier = desc.Digest.Verifier()
+		r = io.TeeReader(rc, verifier)
+	}
+
+	if err := e.writeBlob(desc.Digest, stat.Size, r); err != nil {
+		return err
+	}
+	if verifier != nil && !verifier.Verified() {
+		return fmt.Errorf("content of blob %s does not match its digest", desc.Digest)
+	}
+	return nil
+}
+
+func (e *layoutExporter) writeBlob(dgst digest.Digest, size int64, r io.Reader) error {
+	if _, ok := e.written[dgst]; ok {
+		return nil
+	}
+	if err := e.writer.writeBlob(dgst, size, r); err != nil {
+		return fmt.Errorf("failed to write blob %s: %v", dgst, err)
+	}
+	e.written[dgst] = struct{}{}
+	e.report.Blobs++
+	e.report.Bytes += size
+	return nil
+}
+
+func (e *layoutExporter) writeIndex(manifests []v1.Descriptor) error {
+	layout, err := json.Marshal(v1.ImageLayout{Version: v1.ImageLayoutVersion})
+	if err != nil {
+		return err
+	}
+	if err := e.writer.writeFile(v1.ImageLayoutFile, layout); err != nil {
+		return err
+	}
+
+	index := v1.Index{
+		MediaType: v1.MediaTypeImageIndex,
+		Manifests: manifests,
+	}
+	index.SchemaVersion = 2
+	content, err := json.MarshalIndent(index, "", "   ")
+	if err != nil {
+		return err
+	}
+	return e.writer.writeFile("index.json", content)
+}
+
+// layoutWriter writes the files of an OCI image layout.
+type layoutWriter interface {
+	writeBlob(dgst digest.Digest, size int64, r io.Reader) error
+	writeFile(name string, content []byte) error
+	Close() error
+}
+
+type dirLayoutWriter struct {
+	root string
+}
+
+func newDirLayoutWriter(root string) (*dirLayoutWriter, error) {
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, err
+	}
+	return &dirLayoutWriter{root: root}, nil
+}
+
+func (w *dirLayoutWriter) writeBlob(dgst digest.Digest, size int64, r io.Reader) error {
+	blobPath := filepath.Join(w.root, "blobs", dgst.Algorithm().String(), dgst.Hex())
+	if err := os.MkdirAll(filepath.Dir(blobPath), 0755); err != nil {
+		return err
+	}
+
+	// write into a temporary file first so that interrupted exports do not
+	// leave truncated blobs behind
+	fp, err := ioutil.TempFile(filepath.Dir(blobPath), "."+dgst.Hex())
+	if err != nil {
+		return err
+	}
+	n, err := io.Copy(fp, r)
+	if closeErr := fp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && n != size {
+		err = fmt.Errorf("wrote %d bytes, expected %d", n, size)
+	}
+	if err != nil {
+		os.Remove(fp.Name())
+		return err
+	}
+	return os.Rename(fp.Name(), blobPath)
+}
+
+func (w *dirLayoutWriter) writeFile(name string, content []byte) error {
+	return ioutil.WriteFile(filepath.Join(w.root, name), content, 0644)
+}
+
+func (w *dirLayoutWriter) Close() error {
+	return nil
+}
+
+type tarLayoutWriter struct {
+	fp *os.File
+	tw *tar.Writer
+}
+
+func newTarLayoutWriter(p string) (*tarLayoutWriter, error) {
+	fp, err := os.Create(p)
+	if err != nil {
+		return nil, err
+	}
+	return &tarLayoutWriter{fp: fp, tw: tar.NewWriter(fp)}, nil
+}
+
+func (w *tarLayoutWriter) writeBlob(dgst digest.Digest, size int64, r io.Reader) error {
+	err := w.tw.WriteHeader(&tar.Header{
+		Name:     "blobs/" + dgst.Algorithm().String() + "/" + dgst.Hex(),
+		Mode:     0644,
+		Size:     size,
+		Typeflag: tar.TypeReg,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w.tw, r)
+	return err
+}
+
+func (w *tarLayoutWriter) writeFile(name string, content []byte) error {
+	err := w.tw.WriteHeader(&tar.Header{
+		Name:     name,
+		Mode:     0644,
+		Size:     int64(len(content)),
+		Typeflag: tar.TypeReg,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = w.tw.Write(content)
+	return err
+}
+
+func (w *tarLayoutWriter) Close() error {
+	err := w.tw.Close()
+	if closeErr := w.fp.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// Import loads the manifests listed in the index.json of the OCI image
+// layout at src, which is either a directory or a tar archive, into the
+// registry. Manifest lists and OCI indexes are imported along with the
+// manifests they reference. The content of every blob and manifest is
+// verified against its digest.
+func Import(ctx context.Context, registry distribution.Namespace, src string, opts ImportOpts) (LayoutReport, error) {
+	filters, err := parseLayoutFilters(opts.Filters)
+	if err != nil {
+		return LayoutReport{}, err
+	}
+
+	fi, err := os.Stat(src)
+	if err != nil {
+		return LayoutReport{}, err
+	}
+
+	root := src
+	if !fi.IsDir() {
+		root, err = ioutil.TempDir("", "registry-import-")
+		if err != nil {
+			return LayoutReport{}, err
+		}
+		defer os.RemoveAll(root)
+
+		if err := extractLayout(src, root); err != nil {
+			return LayoutReport{}, fmt.Errorf("failed to extract %s: %v", src, err)
+		}
+	}
+
+	i := &layoutImporter{
+		registry: registry,
+		root:     root,
+		imported: make(map[string]struct{}),
+	}
+	err = i.importLayout(ctx, filters, opts.Repository)
+	return i.report, err
+}
+
+type layoutImporter struct {
+	registry distribution.Namespace
+	root     string
+	// blobs and manifests already imported, keyed by repository and digest
+	imported map[string]struct{}
+	report   LayoutReport
+}
+
+func (i *layoutImporter) importLayout(ctx context.Context, filters []layoutFilter, defaultRepository string) error {
+	content, err := ioutil.ReadFile(filepath.Join(i.root, v1.ImageLayoutFile))
+	if err != nil {
+		return fmt.Errorf("not an OCI image layout: %v", err)
+	}
+	var layout v1.ImageLayout
+	if err := json.Unmarshal(content, &layout); err != nil {
+		return fmt.Errorf("invalid %s: %v", v1.ImageLayoutFile, err)
+	}
+	if layout.Version != v1.ImageLayoutVersion {
+		return fmt.Errorf("unsupported image layout version %q", layout.Version)
+	}
+
+	content, err = ioutil.ReadFile(filepath.Join(i.root, "index.json"))
+	if err != nil {
+		return err
+	}
+	var index v1.Index
+	if err := json.Unmarshal(content, &index); err != nil {
+		return fmt.Errorf("invalid index.json: %v", err)
+	}
+
+	for _, desc := range index.Manifests {
+		name, tag := defaultRepository, desc.Annotations[v1.AnnotationRefName]
+		if imageName, ok := desc.Annotations[annotationImageName]; ok {
+			ref, err := reference.Parse(imageName)
+			if err != nil {
+				return fmt.Errorf("invalid image name %q: %v", imageName, err)
+			}
+			named, ok := ref.(reference.Named)
+			if !ok {
+				return fmt.Errorf("invalid image name %q", imageName)
+			}
+			name = named.Name()
+			if tagged, ok := ref.(reference.Tagged); ok {
+				tag = tagged.Tag()
+			}
+		}
+		if name == "" {
+			return fmt.Errorf("no repository given for manifest %s", desc.Digest)
+		}
+		if !matchLayoutFilters(filters, name, tag) {
+			continue
+		}
+
+		named, err := reference.WithName(name)
+		if err != nil {
+			return fmt.Errorf("failed to parse repo name %s: %v", name, err)
+		}
+		repository, err := i.registry.Repository(ctx, named)
+		if err != nil {
+			return fmt.Errorf("failed to construct repository: %v", err)
+		}
+		manifestService, err := repository.Manifests(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to construct manifest service: %v", err)
+		}
+
+		dcontext.GetLogger(ctx).Infof("importing %s@%s", name, desc.Digest)
+		if err := i.importManifest(ctx, repository, manifestService, desc); err != nil {
+			return fmt.Errorf("failed to import %s@%s: %v", name, desc.Digest, err)
+		}
+
+		if tag != "" {
+			err := repository.Tags(ctx).Tag(ctx, tag, distribution.Descriptor{
+				MediaType: desc.MediaType,
+				Digest:    desc.Digest,
+				Size:      desc.Size,
+			})
+			if err != nil {
+				return fmt.Errorf("failed to tag %s:%s: %v", name, tag, err)
+			}
+			i.report.Tags++
+		}
+	}
+
+	return nil
+}
+
+func (i *layoutImporter) importManifest(ctx context.Context, repository distribution.Repository, manifestService distribution.ManifestService, desc v1.Descriptor) error {
+	key := repository.Named().Name() + "@" + desc.Digest.String()
+	if _, ok := i.imported[key]; ok {
+		return nil
+	}
+
+	payload, err := i.readBlob(desc.Digest)
+	if err != nil {
+		return err
+	}
+
+	// The media types of descriptors are not always reliable, such as
+	// those of manifest list entries, so prefer the one in the content.
+	var versioned manifest.Versioned
+	if err := json.Unmarshal(payload, &versioned); err != nil {
+		return err
+	}
+	mediaType := versioned.MediaType
+	if versioned.SchemaVersion == 1 {
+		mediaType = schema1.MediaTypeSignedManifest
+	} else if mediaType == "" {
+		mediaType = desc.MediaType
+	}
+
+	m, _, err := distribution.UnmarshalManifest(mediaType, payload)
+	if err != nil {
+		return err
+	}
+
+	if list, ok := m.(*manifestlist.DeserializedManifestList); ok {
+		for _, child := range list.Manifests {
+			err := i.importManifest(ctx, repository, manifestService, v1.Descriptor{
+				MediaType: child.MediaType,
+				Digest:    child.Digest,
+				Size:      child.Size,
+			})
+			if err != nil {
+				return err
+			}
+		}
+	} else {
+		for _, ref := range m.References() {
+			if err := i.importBlob(ctx, repository, ref); err != nil {
+				return err
+			}
+		}
+	}
+
+	dgst, err := manifestService.Put(ctx, m)
+	if err != nil {
+		return err
+	}
+	if dgst != desc.Digest {
+		return fmt.Errorf("manifest stored as %s", dgst)
+	}
+
+	i.imported[key] = struct{}{}
+	i.report.Blobs++
+	i.report.Bytes += int64(len(payload))
+	return nil
+}
+
+func (i *layoutImporter) importBlob(ctx context.Context, repository distribution.Repository, desc distribution.Descriptor) error {
+	key := repository.Named().Name() + "@" + desc.Digest.String()
+	if _, ok := i.imported[key]; ok {
+		return nil
+	}
+
+	blobs := repository.Blobs(ctx)
+	if _, err := blobs.Stat(ctx, desc.Digest); err == nil {
+		i.imported[key] = struct{}{}
+		return nil
+	} else if err != distribution.ErrBlobUnknown {
+		return err
+	}
+
+	fp, err := os.Open(i.blobPath(desc.Digest))
+	if os.IsNotExist(err) && len(desc.URLs) > 0 {
+		// foreign layers are not part of the layout
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer fp.Close()
+
+	bw, err := blobs.Create(ctx)
+	if err != nil {
+		return err
+	}
+	n, err := io.Copy(bw, fp)
+	if err != nil {
+		bw.Cancel(ctx)
+		return err
+	}
+	// the blob writer verifies the content against the digest
+	if _, err := bw.Commit(ctx, distribution.Descriptor{
+		MediaType: desc.MediaType,
+		Digest:    desc.Digest,
+		Size:      n,
+	}); err != nil {
+		bw.Cancel(ctx)
+		return fmt.Errorf("failed to import blob %s: %v", desc.Digest, err)
+	}
+
+	i.imported[key] = struct{}{}
+	i.report.Blobs++
+	i.report.Bytes += n
+	return nil
+}
+
+// readBlob returns the content of a blob in the layout after verifying it.
+func (i *layoutImporter) readBlob(dgst digest.Digest) ([]byte, error) {
+	if err := dgst.Validate(); err != nil {
+		return nil, err
+	}
+	content, err := ioutil.ReadFile(i.blobPath(dgst))
+	if err != nil {
+		return nil, err
+	}
+	if dgst.Algorithm().FromBytes(content) != dgst {
+		return nil, fmt.Errorf("content of %s does not match its digest", dgst)
+	}
+	return content, nil
+}
+
+func (i *layoutImporter) blobPath(dgst digest.Digest) string {
+	return filepath.Join(i.root, "blobs", dgst.Algorithm().String(), dgst.Hex())
+}
+
+// extractLayout extracts the regular files of the tar archive at src into
+// the directory root.
+func extractLayout(src, root string) error {
+	fp, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer fp.Close()
+
+	tr := tar.NewReader(fp)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		name := filepath.Clean(filepath.FromSlash(hdr.Name))
+		if filepath.IsAbs(name) || name == ".." || strings.HasPrefix(name, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("invalid path %q in archive", hdr.Name)
+		}
+
+		target := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		out, err := os.Create(target)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(out, tr)
+		if closeErr := out.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// layoutFilter selects a repository, or a single tag within it.
+type layoutFilter struct {
+	name string
+	tag  string
+}
+
+func parseLayoutFilters(filters []string) ([]layoutFilter, error) {
+	var parsed []layoutFilter
+	for _, filter := range filters {
+		ref, err := reference.Parse(filter)
+		if err != nil {
+			return nil, fmt.Errorf("invalid filter %q: %v", filter, err)
+		}
+		named, ok := ref.(reference.Named)
+		if !ok {
+			return nil, fmt.Errorf("invalid filter %q: no repository name", filter)
+		}
+
+		f := layoutFilter{name: named.Name()}
+		if tagged, ok := ref.(reference.Tagged); ok {
+			f.tag = tagged.Tag()
+		}
+		parsed = append(parsed, f)
+	}
+	return parsed, nil
+}
+
+func matchLayoutFilters(filters []layoutFilter, name, tag string) bool {
+	if len(filters) == 0 {
+		return true
+	}
+	for _, filter := range filters {
+		if filter.name == name && (filter.tag == "" || filter.tag == tag) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,209 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/manifest/manifestlist"
+	"github.com/distribution/distribution/v3/registry/storage/driver/inmemory"
+	"github.com/distribution/distribution/v3/testutil"
+	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func TestExportImportLayout(t *testing.T) {
+	ctx := context.Background()
+
+	tmpDir, err := ioutil.TempDir("", "ocilayout-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	registry := createRegistry(t, inmemory.New())
+	repo := makeRepository(t, registry, "export/image")
+	image := uploadSmallSchema2Image(t, repo)
+
+	other := uploadSmallSchema2Image(t, repo)
+	list, err := testutil.MakeManifestList(registry.BlobStatter(), []digest.Digest{image.manifestDigest, other.manifestDigest})
+	if err != nil {
+		t.Fatalf("failed to make manifest list: %v", err)
+	}
+	listDigest, err := makeManifestService(t, repo).Put(ctx, list)
+	if err != nil {
+		t.Fatalf("failed to put manifest list: %v", err)
+	}
+
+	tags := map[string]digest.Digest{
+		"latest": image.manifestDigest,
+		"multi":  listDigest,
+	}
+	for tag, dgst := range tags {
+		if err := repo.Tags(ctx).Tag(ctx, tag, distribution.Descriptor{Digest: dgst}); err != nil {
+			t.Fatalf("failed to tag manifest: %v", err)
+		}
+	}
+
+	for _, tarball := range []bool{false, true} {
+		layoutPath := filepath.Join(tmpDir, "layout")
+		if tarball {
+			layoutPath += ".tar"
+		}
+
+		report, err := Export(ctx, registry, layoutPath, ExportOpts{Tarball: tarball, Verify: true})
+		if err != nil {
+			t.Fatalf("failed to export: %v", err)
+		}
+		if report.Tags != 2 {
+			t.Fatalf("unexpected number of tags exported: %d", report.Tags)
+		}
+
+		imported := createRegistry(t, inmemory.New())
+		report, err = Import(ctx, imported, layoutPath, ImportOpts{})
+		if err != nil {
+			t.Fatalf("failed to import: %v", err)
+		}
+		if report.Tags != 2 {
+			t.Fatalf("unexpected number of tags imported: %d", report.Tags)
+		}
+
+		importedRepo := makeRepository(t, imported, "export/image")
+		for tag, dgst := range tags {
+			desc, err := importedRepo.Tags(ctx).Get(ctx, tag)
+			if err != nil {
+				t.Fatalf("failed to get imported tag %s: %v", tag, err)
+			}
+			if desc.Digest != dgst {
+				t.Fatalf("unexpected digest for imported tag %s: %s != %s", tag, desc.Digest, dgst)
+			}
+		}
+
+		manifestService := makeManifestService(t, importedRepo)
+		manifest, err := manifestService.Get(ctx, listDigest)
+		if err != nil {
+			t.Fatalf("failed to get imported manifest list: %v", err)
+		}
+		if _, ok := manifest.(*manifestlist.DeserializedManifestList); !ok {
+			t.Fatalf("unexpected manifest type %T", manifest)
+		}
+		if _, err := manifestService.Get(ctx, other.manifestDigest); err != nil {
+			t.Fatalf("manifest referenced by list not imported: %v", err)
+		}
+		for dgst := range other.layers {
+			if _, err := importedRepo.Blobs(ctx).Stat(ctx, dgst); err != nil {
+				t.Fatalf("layer %s not imported: %v", dgst, err)
+			}
+		}
+	}
+}
+
+func TestExportLayoutFilters(t *testing.T) {
+	ctx := context.Background()
+
+	tmpDir, err := ioutil.TempDir("", "ocilayout-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	registry := createRegistry(t, inmemory.New())
+	for _, name := range []string{"filter/a", "filter/b"} {
+		repo := makeRepository(t, registry, name)
+		image := uploadSmallSchema2Image(t, repo)
+		for _, tag := range []string{"1", "2"} {
+			if err := repo.Tags(ctx).Tag(ctx, tag, distribution.Descriptor{Digest: image.manifestDigest}); err != nil {
+				t.Fatalf("failed to tag manifest: %v", err)
+			}
+		}
+	}
+
+	if _, err := Export(ctx, registry, tmpDir, ExportOpts{Filters: []string{"filter/a:2", "filter/b"}}); err != nil {
+		t.Fatalf("failed to export: %v", err)
+	}
+
+	content, err := ioutil.ReadFile(filepath.Join(tmpDir, "index.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var index v1.Index
+	if err := json.Unmarshal(content, &index); err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, desc := range index.Manifests {
+		names = append(names, desc.Annotations[annotationImageName])
+	}
+	expected := []string{"filter/a:2", "filter/b:1", "filter/b:2"}
+	if len(names) != len(expected) {
+		t.Fatalf("unexpected manifests exported: %v", names)
+	}
+	for i := range expected {
+		if names[i] != expected[i] {
+			t.Fatalf("unexpected manifests exported: %v", names)
+		}
+	}
+
+	// a layout without repository names is imported into the given one
+	for i := range index.Manifests {
+		delete(index.Manifests[i].Annotations, annotationImageName)
+	}
+	content, err = json.Marshal(index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(tmpDir, "index.json"), content, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	imported := createRegistry(t, inmemory.New())
+	if _, err := Import(ctx, imported, tmpDir, ImportOpts{}); err == nil {
+		t.Fatal("expected import without repository name to fail")
+	}
+	if _, err := Import(ctx, imported, tmpDir, ImportOpts{Repository: "filter/c"}); err != nil {
+		t.Fatalf("failed to import: %v", err)
+	}
+	tags, err := makeRepository(t, imported, "filter/c").Tags(ctx).All(ctx)
+	if err != nil {
+		t.Fatalf("failed to list tags: %v", err)
+	}
+	if len(tags) != 2 {
+		t.Fatalf("unexpected tags imported: %v", tags)
+	}
+}
+
+// uploadSmallSchema2Image uploads a schema2 image with small layers, for
+// tests which copy content around and do not need realistic layer sizes.
+func uploadSmallSchema2Image(t *testing.T, repository distribution.Repository) image {
+	layers := make(map[digest.Digest]io.ReadSeeker)
+	var digests []digest.Digest
+	for i := 0; i < 2; i++ {
+		content := make([]byte, 1024)
+		if _, err := rand.Read(content); err != nil {
+			t.Fatalf("%v", err)
+		}
+		dgst := digest.FromBytes(content)
+		layers[dgst] = bytes.NewReader(content)
+		digests = append(digests, dgst)
+	}
+
+	manifest, err := testutil.MakeSchema2Manifest(repository, digests)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	manifestDigest := uploadImage(t, repository, image{manifest: manifest, layers: layers})
+	return image{
+		manifest:       manifest,
+		manifestDigest: manifestDigest,
+		layers:         layers,
+	}
+}
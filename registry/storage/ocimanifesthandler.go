@@ -18,6 +18,7 @@ type ocischemaManifestHandler struct {
 	blobStore    distribution.BlobStore
 	ctx          context.Context
 	manifestURLs manifestURLs
+	limits       ManifestLimits
 }
 
 var _ ManifestHandler = &ocischemaManifestHandler{}
@@ -69,6 +70,14 @@ func (ms *ocischemaManifestHandler) verifyManifest(ctx context.Context, mnfst oc
 		return fmt.Errorf("unrecognized manifest schema version %d", mnfst.Manifest.SchemaVersion)
 	}
 
+	if err := ms.verifyLimits(mnfst); err != nil {
+		return err
+	}
+
+	if err := validateSubject(mnfst.Subject); err != nil {
+		return distribution.ErrManifestVerification{err}
+	}
+
 	if skipDependencyVerification {
 		return nil
 	}
@@ -141,3 +150,19 @@ func (ms *ocischemaManifestHandler) verifyManifest(ctx context.Context, mnfst oc
 
 	return nil
 }
+
+// verifyLimits checks the manifest against the size and shape limits of the
+// registry.
+func (ms *ocischemaManifestHandler) verifyLimits(mnfst ocischema.DeserializedManifest) error {
+	_, payload, err := mnfst.Payload()
+	if err != nil {
+		return err
+	}
+
+	errs := ms.limits.verifyPayload(payload)
+	errs = append(errs, ms.limits.verifyImage(mnfst.Config, mnfst.Layers)...)
+	if len(errs) != 0 {
+		return errs
+	}
+	return nil
+}
@@ -34,6 +34,8 @@ const (
 //							-> current/link
 // 							-> index
 //								-> <algorithm>/<hex digest>/link
+// 						referrers/<subject digest path>
+//							-> <algorithm>/<hex digest>/link
 // 					-> _layers/
 // 						<layer links to blob store>
 // 					-> _uploads/<id>
@@ -42,6 +44,8 @@ const (
 // 						hashstates/<algorithm>/<offset>
 //			-> blob/<algorithm>
 //				<split directory content addressable storage>
+//			-> robots/<name>
+//			-> robots/_lastused/<name>
 //
 // The storage backend layout is broken up into a content-addressable blob
 // store and repositories. The content-addressable blob store holds most data
@@ -65,7 +69,9 @@ const (
 // implied as to the ordering of changes to a manifest. The tag store provides
 // support for name, tag lookups of manifests, using "current/link" under a
 // named tag directory. An index is maintained to support deletions of all
-// revisions of a given manifest tag.
+// revisions of a given manifest tag. The referrers store indexes manifests by
+// the digest of their subject, linking each referrer under the directory of
+// the manifest it refers to.
 //
 // We cover the path formats implemented by this path mapper below.
 //
@@ -84,6 +90,11 @@ const (
 // 	manifestTagIndexEntryPathSpec:         <root>/v2/repositories/<name>/_manifests/tags/<tag>/index/<algorithm>/<hex digest>/
 // 	manifestTagIndexEntryLinkPathSpec:     <root>/v2/repositories/<name>/_manifests/tags/<tag>/index/<algorithm>/<hex digest>/link
 //
+//	Referrers:
+//
+// 	manifestReferrersPathSpec:      <root>/v2/repositories/<name>/_manifests/referrers/<algorithm>/<hex digest>/
+// 	manifestReferrerLinkPathSpec:   <root>/v2/repositories/<name>/_manifests/referrers/<algorithm>/<hex digest>/<algorithm>/<hex digest>/link
+//
 // 	Blobs:
 //
 // 	layerLinkPathSpec:            <root>/v2/repositories/<name>/_layers/<algorithm>/<hex digest>/link
@@ -102,6 +113,12 @@ const (
 // 	blobDataPathSpec:               <root>/v2/blobs/<algorithm>/<first two hex bytes of digest>/<hex digest>/data
 // 	blobMediaTypePathSpec:               <root>/v2/blobs/<algorithm>/<first two hex bytes of digest>/<hex digest>/data
 //
+//	Robot Accounts:
+//
+//	robotAccountsPathSpec:          <root>/v2/robots/
+//	robotAccountPathSpec:           <root>/v2/robots/<name>
+//	robotAccountLastUsedPathSpec:   <root>/v2/robots/_lastused/<name>
+//
 // For more information on the semantic meaning of each path and their
 // contents, please see the path spec documentation.
 func pathFor(spec pathSpec) (string, error) {
@@ -193,6 +210,29 @@ func pathFor(spec pathSpec) (string, error) {
 		}
 
 		return path.Join(root, path.Join(components...)), nil
+	case manifestReferrersPathSpec:
+		components, err := digestPathComponents(v.subject, false)
+		if err != nil {
+			return "", err
+		}
+
+		return path.Join(append(append(repoPrefix, v.name, "_manifests", "referrers"), components...)...), nil
+	case manifestReferrerLinkPathSpec:
+		root, err := pathFor(manifestReferrersPathSpec{
+			name:    v.name,
+			subject: v.subject,
+		})
+
+		if err != nil {
+			return "", err
+		}
+
+		components, err := digestPathComponents(v.referrer, false)
+		if err != nil {
+			return "", err
+		}
+
+		return path.Join(root, path.Join(components...), "link"), nil
 	case layerLinkPathSpec:
 		components, err := digestPathComponents(v.digest, false)
 		if err != nil {
@@ -242,6 +282,12 @@ func pathFor(spec pathSpec) (string, error) {
 		return path.Join(append(repoPrefix, v.name, "_uploads", v.id, "hashstates", string(v.alg), offset)...), nil
 	case repositoriesRootPathSpec:
 		return path.Join(repoPrefix...), nil
+	case robotAccountsPathSpec:
+		return path.Join(append(rootPrefix, "robots")...), nil
+	case robotAccountPathSpec:
+		return path.Join(append(rootPrefix, "robots", v.name)...), nil
+	case robotAccountLastUsedPathSpec:
+		return path.Join(append(rootPrefix, "robots", "_lastused", v.name)...), nil
 	default:
 		// TODO(sday): This is an internal error. Ensure it doesn't escape (panic?).
 		return "", fmt.Errorf("unknown path spec: %#v", v)
@@ -338,6 +384,26 @@ type manifestTagIndexEntryLinkPathSpec struct {
 
 func (manifestTagIndexEntryLinkPathSpec) pathSpec() {}
 
+// manifestReferrersPathSpec describes the directory holding the links to the
+// manifests whose subject is the given manifest.
+type manifestReferrersPathSpec struct {
+	name    string
+	subject digest.Digest
+}
+
+func (manifestReferrersPathSpec) pathSpec() {}
+
+// manifestReferrerLinkPathSpec describes the link to a manifest referring to
+// the subject manifest. The contents of this file should just be the digest
+// of the referrer.
+type manifestReferrerLinkPathSpec struct {
+	name     string
+	subject  digest.Digest
+	referrer digest.Digest
+}
+
+func (manifestReferrerLinkPathSpec) pathSpec() {}
+
 // layersPathSpec contains the path for the layers inside a repo
 type layersPathSpec struct {
 	name string
@@ -436,6 +502,28 @@ type repositoriesRootPathSpec struct {
 
 func (repositoriesRootPathSpec) pathSpec() {}
 
+// robotAccountsPathSpec describes the directory holding robot accounts.
+type robotAccountsPathSpec struct{}
+
+func (robotAccountsPathSpec) pathSpec() {}
+
+// robotAccountPathSpec describes the path of the file holding a robot
+// account, with the hash of its secret.
+type robotAccountPathSpec struct {
+	name string
+}
+
+func (robotAccountPathSpec) pathSpec() {}
+
+// robotAccountLastUsedPathSpec describes the path of the file holding the
+// time a robot account was last used. It is kept apart from the robot
+// account, which is never rewritten once created.
+type robotAccountLastUsedPathSpec struct {
+	name string
+}
+
+func (robotAccountLastUsedPathSpec) pathSpec() {}
+
 // digestPathComponents provides a consistent path breakdown for a given
 // digest. For a generic digest, it will be as follows:
 //
@@ -0,0 +1,358 @@
+package storage
+
+import (
+	"context"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/distribution/distribution/v3"
+	dcontext "github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/registry/storage/driver"
+	"github.com/opencontainers/go-digest"
+)
+
+// QuotaLimit describes a storage quota. Scope names either a single
+// repository or, when it ends with a "/", every repository beneath that
+// namespace prefix.
+type QuotaLimit struct {
+	Scope string
+	Limit int64
+}
+
+// QuotaStatus reports the current usage of a quota scope.
+type QuotaStatus struct {
+	Scope string `json:"scope"`
+	Limit int64  `json:"limit"`
+	Usage int64  `json:"usage"`
+}
+
+// QuotaEnforcer tracks the storage used by repositories and namespaces that
+// have a quota configured. Usage is the total size of the unique blobs linked
+// under the _layers directories of the repositories in a scope. It is computed
+// from storage the first time a scope is needed and then kept up to date as
+// blobs are linked and unlinked through the registry.
+//
+// Changes made behind the back of this instance, such as by other registry
+// replicas or an offline garbage collection, are only picked up once the
+// scope is recomputed. Concurrent pushes into the same scope may overshoot a
+// quota by at most the size of the blobs in flight.
+type QuotaEnforcer struct {
+	blobStore *blobStore
+	limits    []QuotaLimit
+
+	mu    sync.Mutex
+	usage map[string]*quotaUsage
+}
+
+// quotaUsage holds the blobs counted against a single scope.
+type quotaUsage struct {
+	blobs map[digest.Digest]int64
+	total int64
+}
+
+// NewQuotaEnforcer returns a QuotaEnforcer applying limits to the content
+// stored with the given driver.
+func NewQuotaEnforcer(storageDriver driver.StorageDriver, limits []QuotaLimit) *QuotaEnforcer {
+	limits = append([]QuotaLimit(nil), limits...)
+	sort.Slice(limits, func(i, j int) bool {
+		return limits[i].Scope < limits[j].Scope
+	})
+
+	return &QuotaEnforcer{
+		blobStore: &blobStore{
+			driver:  storageDriver,
+			statter: &blobStatter{driver: storageDriver},
+		},
+		limits: limits,
+		usage:  make(map[string]*quotaUsage),
+	}
+}
+
+// EnforceQuotas returns a functional option for NewRegistry. It rejects
+// content that would take a repository or namespace over its quota.
+func EnforceQuotas(q *QuotaEnforcer) RegistryOption {
+	return func(registry *registry) error {
+		registry.quotas = q
+		return nil
+	}
+}
+
+// Status returns the quotas applying to the named repository along with
+// their current usage.
+func (q *QuotaEnforcer) Status(ctx context.Context, name string) ([]QuotaStatus, error) {
+	var statuses []QuotaStatus
+	for _, limit := range q.limitsFor(name) {
+		usage, err := q.scopeUsage(ctx, limit.Scope)
+		if err != nil {
+			return nil, err
+		}
+
+		q.mu.Lock()
+		total := usage.total
+		q.mu.Unlock()
+
+		statuses = append(statuses, QuotaStatus{
+			Scope: limit.Scope,
+			Limit: limit.Limit,
+			Usage: total,
+		})
+	}
+
+	return statuses, nil
+}
+
+// check returns ErrQuotaExceeded if linking desc into the named repository
+// would exceed any quota covering it.
+func (q *QuotaEnforcer) check(ctx context.Context, name string, desc distribution.Descriptor) error {
+	for _, limit := range q.limitsFor(name) {
+		usage, err := q.scopeUsage(ctx, limit.Scope)
+		if err != nil {
+			return err
+		}
+
+		q.mu.Lock()
+		_, linked := usage.blobs[desc.Digest]
+		total := usage.total
+		q.mu.Unlock()
+
+		if !linked && total+desc.Size > limit.Limit {
+			return distribution.ErrQuotaExceeded{
+				Scope: limit.Scope,
+				Limit: limit.Limit,
+				Usage: total,
+				Size:  desc.Size,
+			}
+		}
+	}
+
+	return nil
+}
+
+// checkUsage returns ErrQuotaExceeded if the named repository is already
+// over any of its quotas, such as after a quota has been lowered.
+func (q *QuotaEnforcer) checkUsage(ctx context.Context, name string) error {
+	return q.check(ctx, name, distribution.Descriptor{})
+}
+
+// checkRename returns ErrQuotaExceeded if moving the blobs linked into the
+// repository from into the repository to would exceed any quota covering to.
+// Quotas covering both repositories are unaffected by the move.
+func (q *QuotaEnforcer) checkRename(ctx context.Context, from, to string) error {
+	var source *quotaUsage
+	for _, limit := range q.limitsFor(to) {
+		if quotaScopeContains(limit.Scope, from) {
+			continue
+		}
+
+		if source == nil {
+			var err error
+			source, err = q.computeUsage(ctx, from)
+			if err != nil {
+				return err
+			}
+		}
+
+		usage, err := q.scopeUsage(ctx, limit.Scope)
+		if err != nil {
+			return err
+		}
+
+		var size int64
+		q.mu.Lock()
+		for dgst, blobSize := range source.blobs {
+			if _, linked := usage.blobs[dgst]; !linked {
+				size += blobSize
+			}
+		}
+		total := usage.total
+		q.mu.Unlock()
+
+		if total+size > limit.Limit {
+			return distribution.ErrQuotaExceeded{
+				Scope: limit.Scope,
+				Limit: limit.Limit,
+				Usage: total,
+				Size:  size,
+			}
+		}
+	}
+
+	return nil
+}
+
+// record accounts for a blob that has been linked into the named repository.
+func (q *QuotaEnforcer) record(name string, desc distribution.Descriptor) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for scope, usage := range q.usage {
+		if !quotaScopeContains(scope, name) {
+			continue
+		}
+		if _, ok := usage.blobs[desc.Digest]; ok {
+			continue
+		}
+		usage.blobs[desc.Digest] = desc.Size
+		usage.total += desc.Size
+	}
+}
+
+// forget accounts for a blob that has been unlinked from the named
+// repository. Namespace scopes are invalidated since the blob may still be
+// linked into other repositories of the namespace.
+func (q *QuotaEnforcer) forget(name string, dgst digest.Digest) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for scope, usage := range q.usage {
+		if !quotaScopeContains(scope, name) {
+			continue
+		}
+		if isQuotaNamespace(scope) {
+			delete(q.usage, scope)
+			continue
+		}
+		if size, ok := usage.blobs[dgst]; ok {
+			delete(usage.blobs, dgst)
+			usage.total -= size
+		}
+	}
+}
+
+// invalidate drops the cached usage of every scope containing the named
+// repository, forcing it to be recomputed from storage.
+func (q *QuotaEnforcer) invalidate(name string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for scope := range q.usage {
+		if quotaScopeContains(scope, name) {
+			delete(q.usage, scope)
+		}
+	}
+}
+
+// limitsFor returns the quotas covering the named repository.
+func (q *QuotaEnforcer) limitsFor(name string) []QuotaLimit {
+	var limits []QuotaLimit
+	for _, limit := range q.limits {
+		if quotaScopeContains(limit.Scope, name) {
+			limits = append(limits, limit)
+		}
+	}
+	return limits
+}
+
+// scopeUsage returns the usage of scope, computing it from storage if it
+// is not yet known.
+func (q *QuotaEnforcer) scopeUsage(ctx context.Context, scope string) (*quotaUsage, error) {
+	q.mu.Lock()
+	usage, ok := q.usage[scope]
+	q.mu.Unlock()
+	if ok {
+		return usage, nil
+	}
+
+	usage, err := q.computeUsage(ctx, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if existing, ok := q.usage[scope]; ok {
+		// another request computed the usage in the meantime
+		return existing, nil
+	}
+	q.usage[scope] = usage
+
+	return usage, nil
+}
+
+// computeUsage walks the repositories within scope and sums up the sizes of
+// the unique blobs linked under their _layers directories.
+func (q *QuotaEnforcer) computeUsage(ctx context.Context, scope string) (*quotaUsage, error) {
+	usage := &quotaUsage{
+		blobs: make(map[digest.Digest]int64),
+	}
+
+	root, err := pathFor(repositoriesRootPathSpec{})
+	if err != nil {
+		return nil, err
+	}
+
+	walkRoot := path.Join(root, scope)
+	if !isQuotaNamespace(scope) {
+		walkRoot, err = pathFor(layersPathSpec{name: scope})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = q.blobStore.driver.Walk(ctx, walkRoot, func(fileInfo driver.FileInfo) error {
+		filePath := fileInfo.Path()
+		base := path.Base(filePath)
+
+		if fileInfo.IsDir() {
+			if base == "_layers" {
+				// Only count the layers of repositories within the
+				// namespace, not those of the namespace itself.
+				if !quotaScopeContains(scope, path.Dir(filePath[len(root)+1:])) {
+					return driver.ErrSkipDir
+				}
+			} else if strings.HasPrefix(base, "_") {
+				return driver.ErrSkipDir
+			}
+			return nil
+		}
+
+		if base != "link" {
+			return nil
+		}
+
+		dgst, err := q.blobStore.readlink(ctx, filePath)
+		if err != nil {
+			dcontext.GetLogger(ctx).Warnf("quota: ignoring unreadable link %s: %v", filePath, err)
+			return nil
+		}
+		if _, ok := usage.blobs[dgst]; ok {
+			return nil
+		}
+
+		desc, err := q.blobStore.statter.Stat(ctx, dgst)
+		if err != nil {
+			if err == distribution.ErrBlobUnknown {
+				// dangling link, nothing is stored for it
+				return nil
+			}
+			return err
+		}
+
+		usage.blobs[dgst] = desc.Size
+		usage.total += desc.Size
+		return nil
+	})
+	if err != nil {
+		if _, ok := err.(driver.PathNotFoundError); !ok {
+			return nil, err
+		}
+	}
+
+	return usage, nil
+}
+
+// isQuotaNamespace returns true if scope names a namespace prefix rather
+// than a single repository.
+func isQuotaNamespace(scope string) bool {
+	return strings.HasSuffix(scope, "/")
+}
+
+// quotaScopeContains returns true if the named repository falls within scope.
+func quotaScopeContains(scope, name string) bool {
+	if isQuotaNamespace(scope) {
+		return strings.HasPrefix(name, scope)
+	}
+	return scope == name
+}
@@ -0,0 +1,191 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/reference"
+	"github.com/distribution/distribution/v3/registry/storage/driver/inmemory"
+	"github.com/opencontainers/go-digest"
+)
+
+func uploadQuotaBlob(ctx context.Context, t *testing.T, ns distribution.Namespace, repoName string, content []byte) (distribution.Descriptor, error) {
+	t.Helper()
+
+	named, err := reference.WithName(repoName)
+	if err != nil {
+		t.Fatalf("unexpected error parsing name: %v", err)
+	}
+	repo, err := ns.Repository(ctx, named)
+	if err != nil {
+		t.Fatalf("unexpected error getting repository: %v", err)
+	}
+
+	wr, err := repo.Blobs(ctx).Create(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error creating upload: %v", err)
+	}
+	if _, err := io.Copy(wr, bytes.NewReader(content)); err != nil {
+		t.Fatalf("unexpected error writing upload: %v", err)
+	}
+
+	desc, err := wr.Commit(ctx, distribution.Descriptor{Digest: digest.FromBytes(content)})
+	if err != nil {
+		wr.Cancel(ctx)
+	}
+	return desc, err
+}
+
+func expectQuotaUsage(ctx context.Context, t *testing.T, quotas *QuotaEnforcer, name, scope string, expected int64) {
+	t.Helper()
+
+	statuses, err := quotas.Status(ctx, name)
+	if err != nil {
+		t.Fatalf("unexpected error getting quota status: %v", err)
+	}
+	for _, status := range statuses {
+		if status.Scope == scope {
+			if status.Usage != expected {
+				t.Fatalf("unexpected usage for %s: %d != %d", scope, status.Usage, expected)
+			}
+			return
+		}
+	}
+	t.Fatalf("no quota status reported for scope %s", scope)
+}
+
+func TestRepositoryQuota(t *testing.T) {
+	ctx := context.Background()
+	d := inmemory.New()
+	quotas := NewQuotaEnforcer(d, []QuotaLimit{{Scope: "foo/bar", Limit: 10}})
+	registry, err := NewRegistry(ctx, d, EnableDelete, EnforceQuotas(quotas))
+	if err != nil {
+		t.Fatalf("error creating registry: %v", err)
+	}
+
+	first := []byte("abcdef")
+	desc, err := uploadQuotaBlob(ctx, t, registry, "foo/bar", first)
+	if err != nil {
+		t.Fatalf("unexpected error uploading blob within quota: %v", err)
+	}
+	expectQuotaUsage(ctx, t, quotas, "foo/bar", "foo/bar", 6)
+
+	_, err = uploadQuotaBlob(ctx, t, registry, "foo/bar", []byte("ghijkl"))
+	if qerr, ok := err.(distribution.ErrQuotaExceeded); !ok {
+		t.Fatalf("expected quota exceeded error, got %v", err)
+	} else if qerr.Scope != "foo/bar" || qerr.Usage != 6 || qerr.Size != 6 || qerr.Limit != 10 {
+		t.Fatalf("unexpected quota error: %#v", qerr)
+	}
+
+	// content that is already linked does not count twice
+	if _, err := uploadQuotaBlob(ctx, t, registry, "foo/bar", first); err != nil {
+		t.Fatalf("unexpected error re-uploading linked blob: %v", err)
+	}
+
+	// other repositories are not limited
+	if _, err := uploadQuotaBlob(ctx, t, registry, "foo/baz", []byte("0123456789abc")); err != nil {
+		t.Fatalf("unexpected error uploading to unlimited repository: %v", err)
+	}
+
+	named, _ := reference.WithName("foo/bar")
+	repo, err := registry.Repository(ctx, named)
+	if err != nil {
+		t.Fatalf("unexpected error getting repository: %v", err)
+	}
+	if err := repo.Blobs(ctx).Delete(ctx, desc.Digest); err != nil {
+		t.Fatalf("unexpected error deleting blob: %v", err)
+	}
+	expectQuotaUsage(ctx, t, quotas, "foo/bar", "foo/bar", 0)
+
+	if _, err := uploadQuotaBlob(ctx, t, registry, "foo/bar", []byte("ghijkl")); err != nil {
+		t.Fatalf("unexpected error uploading blob after delete: %v", err)
+	}
+}
+
+func TestNamespaceQuota(t *testing.T) {
+	ctx := context.Background()
+	d := inmemory.New()
+
+	// content pushed before quotas were enabled is accounted for
+	unlimited, err := NewRegistry(ctx, d)
+	if err != nil {
+		t.Fatalf("error creating registry: %v", err)
+	}
+	shared := []byte("shared")
+	if _, err := uploadQuotaBlob(ctx, t, unlimited, "team/a", shared); err != nil {
+		t.Fatalf("unexpected error uploading blob: %v", err)
+	}
+
+	quotas := NewQuotaEnforcer(d, []QuotaLimit{{Scope: "team/", Limit: 10}})
+	registry, err := NewRegistry(ctx, d, EnforceQuotas(quotas))
+	if err != nil {
+		t.Fatalf("error creating registry: %v", err)
+	}
+	expectQuotaUsage(ctx, t, quotas, "team/b", "team/", 6)
+
+	// the same blob in another repository of the namespace is deduplicated
+	if _, err := uploadQuotaBlob(ctx, t, registry, "team/b", shared); err != nil {
+		t.Fatalf("unexpected error uploading shared blob: %v", err)
+	}
+	expectQuotaUsage(ctx, t, quotas, "team/b", "team/", 6)
+
+	if _, err := uploadQuotaBlob(ctx, t, registry, "team/b", []byte("unique")); err == nil {
+		t.Fatal("expected namespace quota to be exceeded")
+	} else if _, ok := err.(distribution.ErrQuotaExceeded); !ok {
+		t.Fatalf("expected quota exceeded error, got %v", err)
+	}
+
+	// repositories sharing the prefix without the separator are not covered
+	if _, err := uploadQuotaBlob(ctx, t, registry, "teams/c", []byte("0123456789abc")); err != nil {
+		t.Fatalf("unexpected error uploading outside namespace: %v", err)
+	}
+}
+
+func TestRenameQuota(t *testing.T) {
+	ctx := context.Background()
+	d := inmemory.New()
+	quotas := NewQuotaEnforcer(d, []QuotaLimit{{Scope: "small/repo", Limit: 10}, {Scope: "team/", Limit: 10}})
+	registry, err := NewRegistry(ctx, d, EnableDelete, EnforceQuotas(quotas))
+	if err != nil {
+		t.Fatalf("error creating registry: %v", err)
+	}
+	renamer := registry.(distribution.RepositoryRenamer)
+
+	desc, err := uploadQuotaBlob(ctx, t, registry, "other/repo", []byte("0123456789abc"))
+	if err != nil {
+		t.Fatalf("unexpected error uploading blob: %v", err)
+	}
+
+	from, _ := reference.WithName("other/repo")
+	to, _ := reference.WithName("small/repo")
+	err = renamer.Rename(ctx, from, to)
+	if qerr, ok := err.(distribution.ErrQuotaExceeded); !ok {
+		t.Fatalf("expected quota exceeded error, got %v", err)
+	} else if qerr.Scope != "small/repo" || qerr.Usage != 0 || qerr.Size != 13 || qerr.Limit != 10 {
+		t.Fatalf("unexpected quota error: %#v", qerr)
+	}
+
+	// the source is left untouched
+	source, err := registry.Repository(ctx, from)
+	if err != nil {
+		t.Fatalf("unexpected error getting repository: %v", err)
+	}
+	if _, err := source.Blobs(ctx).Stat(ctx, desc.Digest); err != nil {
+		t.Fatalf("unexpected error statting blob after rejected rename: %v", err)
+	}
+	expectQuotaUsage(ctx, t, quotas, "small/repo", "small/repo", 0)
+
+	// moving within a namespace does not change its usage
+	if _, err := uploadQuotaBlob(ctx, t, registry, "team/a", []byte("abcdef")); err != nil {
+		t.Fatalf("unexpected error uploading blob within quota: %v", err)
+	}
+	from, _ = reference.WithName("team/a")
+	to, _ = reference.WithName("team/b")
+	if err := renamer.Rename(ctx, from, to); err != nil {
+		t.Fatalf("unexpected error renaming within namespace: %v", err)
+	}
+	expectQuotaUsage(ctx, t, quotas, "team/b", "team/", 6)
+}
@@ -0,0 +1,167 @@
+package storage
+
+import (
+	"context"
+	"path"
+	"sort"
+
+	"github.com/distribution/distribution/v3"
+	dcontext "github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/manifest/manifestlist"
+	"github.com/distribution/distribution/v3/manifest/ocischema"
+	"github.com/distribution/distribution/v3/registry/storage/driver"
+	"github.com/opencontainers/go-digest"
+)
+
+var _ distribution.ManifestReferrersLister = &manifestStore{}
+
+// ManifestSubject returns the subject of the manifest, or nil if it has none.
+func ManifestSubject(manifest distribution.Manifest) *distribution.Descriptor {
+	switch m := manifest.(type) {
+	case *ocischema.DeserializedManifest:
+		return m.Subject
+	case *manifestlist.DeserializedManifestList:
+		return m.Subject
+	}
+	return nil
+}
+
+// validateSubject returns an error if the subject of a manifest is set but
+// does not describe a manifest.
+func validateSubject(subject *distribution.Descriptor) error {
+	if subject == nil {
+		return nil
+	}
+	if err := subject.Digest.Validate(); err != nil {
+		return distribution.ErrManifestSubjectInvalid{Reason: err.Error()}
+	}
+	if subject.Size <= 0 {
+		return distribution.ErrManifestSubjectInvalid{Reason: "size must be set"}
+	}
+	if subject.MediaType == "" {
+		return distribution.ErrManifestSubjectInvalid{Reason: "mediaType must be set"}
+	}
+	return nil
+}
+
+// linkReferrer adds the referrer to the referrers index of its subject.
+func (ms *manifestStore) linkReferrer(ctx context.Context, subject, referrer digest.Digest) error {
+	linkPath, err := pathFor(manifestReferrerLinkPathSpec{
+		name:     ms.repository.Named().Name(),
+		subject:  subject,
+		referrer: referrer,
+	})
+	if err != nil {
+		return err
+	}
+
+	return ms.blobStore.link(ctx, linkPath, referrer)
+}
+
+// unlinkReferrer removes the referrer from the referrers index of its
+// subject.
+func (ms *manifestStore) unlinkReferrer(ctx context.Context, subject, referrer digest.Digest) error {
+	linkPath, err := pathFor(manifestReferrerLinkPathSpec{
+		name:     ms.repository.Named().Name(),
+		subject:  subject,
+		referrer: referrer,
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := ms.blobStore.driver.Delete(ctx, path.Dir(linkPath)); err != nil {
+		if _, ok := err.(driver.PathNotFoundError); !ok {
+			return err
+		}
+	}
+	return nil
+}
+
+// Referrers returns descriptors of the manifests in the repository whose
+// subject is the given manifest, sorted by digest. The artifact type of a
+// referrer is its artifactType field, falling back to the media type of its
+// config for image manifests.
+func (ms *manifestStore) Referrers(ctx context.Context, subject digest.Digest, artifactType string) ([]distribution.Descriptor, error) {
+	rootPath, err := pathFor(manifestReferrersPathSpec{
+		name:    ms.repository.Named().Name(),
+		subject: subject,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	referrers := make([]distribution.Descriptor, 0)
+	err = ms.blobStore.driver.Walk(ctx, rootPath, func(fileInfo driver.FileInfo) error {
+		if fileInfo.IsDir() || path.Base(fileInfo.Path()) != "link" {
+			return nil
+		}
+
+		dgst, err := ms.blobStore.readlink(ctx, fileInfo.Path())
+		if err != nil {
+			return err
+		}
+
+		desc, err := ms.referrerDescriptor(ctx, dgst)
+		if err != nil {
+			switch err.(type) {
+			case distribution.ErrManifestUnknownRevision:
+				// the referrer has been deleted, such as by the
+				// garbage collector
+				dcontext.GetLogger(ctx).Debugf("skipping unknown referrer %s of %s", dgst, subject)
+				return nil
+			}
+			return err
+		}
+
+		if artifactType == "" || desc.ArtifactType == artifactType {
+			referrers = append(referrers, desc)
+		}
+		return nil
+	})
+	if err != nil {
+		if _, ok := err.(driver.PathNotFoundError); !ok {
+			return nil, err
+		}
+	}
+
+	sort.Slice(referrers, func(i, j int) bool {
+		return referrers[i].Digest < referrers[j].Digest
+	})
+
+	return referrers, nil
+}
+
+// referrerDescriptor returns the descriptor of a referrer as listed in the
+// referrers index.
+func (ms *manifestStore) referrerDescriptor(ctx context.Context, dgst digest.Digest) (distribution.Descriptor, error) {
+	manifest, err := ms.Get(ctx, dgst)
+	if err != nil {
+		return distribution.Descriptor{}, err
+	}
+
+	mediaType, payload, err := manifest.Payload()
+	if err != nil {
+		return distribution.Descriptor{}, err
+	}
+
+	desc := distribution.Descriptor{
+		MediaType: mediaType,
+		Size:      int64(len(payload)),
+		Digest:    dgst,
+	}
+
+	switch m := manifest.(type) {
+	case *ocischema.DeserializedManifest:
+		desc.ArtifactType = m.ArtifactType
+		if desc.ArtifactType == "" {
+			desc.ArtifactType = m.Config.MediaType
+		}
+		desc.Annotations = m.Annotations
+	case *manifestlist.DeserializedManifestList:
+		desc.ArtifactType = m.ArtifactType
+		desc.Annotations = m.Annotations
+	}
+
+	return desc, nil
+}
@@ -0,0 +1,151 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/manifest/ocischema"
+	"github.com/distribution/distribution/v3/registry/storage/driver/inmemory"
+	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+const mediaTypeEmptyJSON = "application/vnd.oci.empty.v1+json"
+
+// manifestDescriptor returns the descriptor of a stored manifest.
+func manifestDescriptor(t *testing.T, repository distribution.Repository, dgst digest.Digest) distribution.Descriptor {
+	manifest, err := makeManifestService(t, repository).Get(context.Background(), dgst)
+	if err != nil {
+		t.Fatalf("failed to get manifest: %v", err)
+	}
+	mediaType, payload, err := manifest.Payload()
+	if err != nil {
+		t.Fatalf("failed to get payload: %v", err)
+	}
+	return distribution.Descriptor{MediaType: mediaType, Size: int64(len(payload)), Digest: dgst}
+}
+
+// putReferrer stores an artifact manifest of the given type referring to
+// subject.
+func putReferrer(t *testing.T, repository distribution.Repository, subject distribution.Descriptor, artifactType string) digest.Digest {
+	ctx := context.Background()
+
+	config, err := repository.Blobs(ctx).Put(ctx, mediaTypeEmptyJSON, []byte("{}"))
+	if err != nil {
+		t.Fatalf("failed to put config: %v", err)
+	}
+	layer, err := repository.Blobs(ctx).Put(ctx, "application/octet-stream", []byte(artifactType))
+	if err != nil {
+		t.Fatalf("failed to put layer: %v", err)
+	}
+
+	manifest, err := ocischema.FromStruct(ocischema.Manifest{
+		Versioned:    ocischema.SchemaVersion,
+		ArtifactType: artifactType,
+		Config:       config,
+		Layers:       []distribution.Descriptor{layer},
+		Subject:      &subject,
+		Annotations:  map[string]string{"type": artifactType},
+	})
+	if err != nil {
+		t.Fatalf("failed to make manifest: %v", err)
+	}
+
+	dgst, err := makeManifestService(t, repository).Put(ctx, manifest)
+	if err != nil {
+		t.Fatalf("failed to put referrer: %v", err)
+	}
+	return dgst
+}
+
+func TestReferrers(t *testing.T) {
+	ctx := context.Background()
+
+	registry := createRegistry(t, inmemory.New())
+	repo := makeRepository(t, registry, "referrers/image")
+	image := uploadRandomSchema2Image(t, repo)
+	subject := manifestDescriptor(t, repo, image.manifestDigest)
+
+	signature := putReferrer(t, repo, subject, "application/vnd.example.signature")
+	sbom := putReferrer(t, repo, subject, "application/vnd.example.sbom")
+
+	manifestService := makeManifestService(t, repo)
+	lister := manifestService.(distribution.ManifestReferrersLister)
+
+	referrers, err := lister.Referrers(ctx, subject.Digest, "")
+	if err != nil {
+		t.Fatalf("failed to list referrers: %v", err)
+	}
+	if len(referrers) != 2 {
+		t.Fatalf("unexpected number of referrers: %d", len(referrers))
+	}
+	for _, referrer := range referrers {
+		if referrer.MediaType != v1.MediaTypeImageManifest {
+			t.Fatalf("unexpected media type: %s", referrer.MediaType)
+		}
+		if referrer.Annotations["type"] != referrer.ArtifactType {
+			t.Fatalf("unexpected annotations for %s: %v", referrer.ArtifactType, referrer.Annotations)
+		}
+	}
+
+	referrers, err = lister.Referrers(ctx, subject.Digest, "application/vnd.example.sbom")
+	if err != nil {
+		t.Fatalf("failed to list referrers: %v", err)
+	}
+	if len(referrers) != 1 || referrers[0].Digest != sbom {
+		t.Fatalf("unexpected filtered referrers: %v", referrers)
+	}
+
+	// a manifest without referrers has an empty index
+	referrers, err = lister.Referrers(ctx, sbom, "")
+	if err != nil {
+		t.Fatalf("failed to list referrers: %v", err)
+	}
+	if referrers == nil || len(referrers) != 0 {
+		t.Fatalf("unexpected referrers: %v", referrers)
+	}
+
+	// deleting a referrer removes it from the index
+	if err := manifestService.Delete(ctx, signature); err != nil {
+		t.Fatalf("failed to delete referrer: %v", err)
+	}
+	referrers, err = lister.Referrers(ctx, subject.Digest, "")
+	if err != nil {
+		t.Fatalf("failed to list referrers: %v", err)
+	}
+	if len(referrers) != 1 || referrers[0].Digest != sbom {
+		t.Fatalf("unexpected referrers after delete: %v", referrers)
+	}
+}
+
+func TestReferrersInvalidSubject(t *testing.T) {
+	registry := createRegistry(t, inmemory.New())
+	repo := makeRepository(t, registry, "referrers/invalid")
+
+	for _, subject := range []distribution.Descriptor{
+		{MediaType: v1.MediaTypeImageManifest, Size: 1, Digest: "sha256:invalid"},
+		{MediaType: v1.MediaTypeImageManifest, Digest: digest.FromString("subject")},
+		{Size: 1, Digest: digest.FromString("subject")},
+	} {
+		subject := subject
+		manifest, err := ocischema.FromStruct(ocischema.Manifest{
+			Versioned: ocischema.SchemaVersion,
+			Config:    distribution.Descriptor{MediaType: mediaTypeEmptyJSON, Size: 2, Digest: digest.FromString("{}")},
+			Layers:    []distribution.Descriptor{},
+			Subject:   &subject,
+		})
+		if err != nil {
+			t.Fatalf("failed to make manifest: %v", err)
+		}
+
+		_, err = makeManifestService(t, repo).Put(context.Background(), manifest)
+		verificationErrs, ok := err.(distribution.ErrManifestVerification)
+		if !ok || len(verificationErrs) != 1 {
+			t.Fatalf("expected verification error for subject %v, got %v", subject, err)
+		}
+		if _, ok := verificationErrs[0].(distribution.ErrManifestSubjectInvalid); !ok {
+			t.Fatalf("unexpected error for subject %v: %v", subject, err)
+		}
+	}
+}
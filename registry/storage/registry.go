@@ -3,6 +3,7 @@ package storage
 import (
 	"context"
 	"regexp"
+	"sync"
 
 	"github.com/distribution/distribution/v3"
 	"github.com/distribution/distribution/v3/reference"
@@ -24,6 +25,10 @@ type registry struct {
 	schema1SigningKey            libtrust.PrivateKey
 	blobDescriptorServiceFactory distribution.BlobDescriptorServiceFactory
 	manifestURLs                 manifestURLs
+	manifestLimits               ManifestLimits
+	quotas                       *QuotaEnforcer
+	isImmutableTag               func(repository, tag string) bool
+	tagLocks                     tagLocks
 	driver                       storagedriver.StorageDriver
 }
 
@@ -89,6 +94,15 @@ func Schema1SigningKey(key libtrust.PrivateKey) RegistryOption {
 	}
 }
 
+// ImmutableTags returns a functional option for NewRegistry. Tags for which
+// isImmutable returns true cannot be moved to another manifest once set.
+func ImmutableTags(isImmutable func(repository, tag string) bool) RegistryOption {
+	return func(registry *registry) error {
+		registry.isImmutableTag = isImmutable
+		return nil
+	}
+}
+
 // BlobDescriptorServiceFactory returns a functional option for NewRegistry. It sets the
 // factory to create BlobDescriptorServiceFactory middleware.
 func BlobDescriptorServiceFactory(factory distribution.BlobDescriptorServiceFactory) RegistryOption {
@@ -189,6 +203,49 @@ func (reg *registry) BlobStatter() distribution.BlobStatter {
 	return reg.statter
 }
 
+// tagLocks serializes the updates of individual tags within the registry.
+type tagLocks struct {
+	mu    sync.Mutex
+	locks map[string]*tagLock
+}
+
+// tagLock is the lock of a single tag, released from tagLocks once no
+// update holds or waits for it.
+type tagLock struct {
+	sync.Mutex
+	refs int
+}
+
+// lock locks the tag of the repository and returns the function unlocking
+// it.
+func (l *tagLocks) lock(repository, tag string) func() {
+	key := repository + ":" + tag
+
+	l.mu.Lock()
+	if l.locks == nil {
+		l.locks = make(map[string]*tagLock)
+	}
+	tl, ok := l.locks[key]
+	if !ok {
+		tl = &tagLock{}
+		l.locks[key] = tl
+	}
+	tl.refs++
+	l.mu.Unlock()
+
+	tl.Lock()
+	return func() {
+		tl.Unlock()
+
+		l.mu.Lock()
+		tl.refs--
+		if tl.refs == 0 {
+			delete(l.locks, key)
+		}
+		l.mu.Unlock()
+	}
+}
+
 // repository provides name-scoped access to various services.
 type repository struct {
 	*registry
@@ -276,17 +333,20 @@ func (repo *repository) Manifests(ctx context.Context, options ...distribution.M
 			repository:   repo,
 			blobStore:    blobStore,
 			manifestURLs: repo.registry.manifestURLs,
+			limits:       repo.registry.manifestLimits,
 		},
 		manifestListHandler: &manifestListHandler{
 			ctx:        ctx,
 			repository: repo,
 			blobStore:  blobStore,
+			limits:     repo.registry.manifestLimits,
 		},
 		ocischemaHandler: &ocischemaManifestHandler{
 			ctx:          ctx,
 			repository:   repo,
 			blobStore:    blobStore,
 			manifestURLs: repo.registry.manifestURLs,
+			limits:       repo.registry.manifestLimits,
 		},
 	}
 
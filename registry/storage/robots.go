@@ -0,0 +1,405 @@
+package storage
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/distribution/distribution/v3/registry/storage/driver"
+)
+
+// robotLastUsedInterval is how often the last use of a robot account is
+// written back to storage, so that busy robots do not cause a write per
+// request.
+const robotLastUsedInterval = time.Minute
+
+// robotAuthCacheTTL is how long a successful authentication of a robot
+// account is cached, so that requests do not read the robot account from
+// storage each time. A robot account revoked through another registry
+// instance may authenticate for up to this long.
+const robotAuthCacheTTL = 10 * time.Second
+
+var (
+	// ErrRobotAccountUnknown is returned when a robot account does not exist.
+	ErrRobotAccountUnknown = errors.New("robot account unknown")
+
+	// ErrRobotAccountExists is returned when creating a robot account with
+	// the name of an existing one.
+	ErrRobotAccountExists = errors.New("robot account already exists")
+
+	// ErrRobotAccountAuthentication is returned when a robot account secret
+	// does not match, or the robot account has expired.
+	ErrRobotAccountAuthentication = errors.New("robot account authentication failure")
+
+	// RobotAccountNameRegexp matches valid robot account names.
+	RobotAccountNameRegexp = regexp.MustCompile(`[a-z0-9]+(?:[._-][a-z0-9]+)*`)
+
+	anchoredRobotAccountNameRegexp = regexp.MustCompile(`^` + RobotAccountNameRegexp.String() + `$`)
+)
+
+// ErrRobotAccountInvalid is returned when creating a robot account with an
+// invalid name, repository pattern or action.
+type ErrRobotAccountInvalid struct {
+	Name   string
+	Reason string
+}
+
+func (err ErrRobotAccountInvalid) Error() string {
+	return fmt.Sprintf("invalid robot account %q: %s", err.Name, err.Reason)
+}
+
+// RobotAccount is a named credential meant for automation, limited to the
+// repositories matching its patterns and to its actions.
+type RobotAccount struct {
+	// Name identifies the robot account.
+	Name string `json:"name"`
+
+	// Repositories lists glob patterns of the repositories the robot
+	// account may access. "*" matches within a path component, "**" across
+	// them.
+	Repositories []string `json:"repositories"`
+
+	// Actions lists the actions the robot account may perform on the
+	// repositories, such as pull, push and delete, or "*" for all of them.
+	Actions []string `json:"actions"`
+
+	// Created is the time the robot account was created.
+	Created time.Time `json:"created"`
+
+	// Expires is the time after which the robot account can no longer
+	// authenticate. The robot account never expires if nil.
+	Expires *time.Time `json:"expires,omitempty"`
+
+	// LastUsed is the time the robot account last authenticated, to within
+	// a minute. It is nil if the robot account was never used.
+	LastUsed *time.Time `json:"lastUsed,omitempty"`
+}
+
+// Expired reports whether the robot account has expired at the given time.
+func (account *RobotAccount) Expired(now time.Time) bool {
+	return account.Expires != nil && !now.Before(*account.Expires)
+}
+
+// robotAccountRecord is the stored form of a robot account. It is written
+// once when the robot account is created; its last use is stored apart.
+type robotAccountRecord struct {
+	RobotAccount
+	// SecretHash is the hex encoded SHA-256 hash of the secret. Secrets
+	// are random, so a fast hash is enough to protect them.
+	SecretHash string `json:"secretHash"`
+}
+
+// RobotAccounts stores robot accounts in the registry storage.
+//
+// Creating and revoking robot accounts is serialized within the registry,
+// but not across registry instances sharing the storage.
+type RobotAccounts struct {
+	driver driver.StorageDriver
+
+	// mu serializes the creation and deletion of robot accounts.
+	mu sync.Mutex
+
+	// cacheMu protects cache and revocations.
+	cacheMu sync.Mutex
+	cache   map[string]cachedRobotAccount
+	// revocations counts the robot accounts deleted, so that an
+	// authentication racing with a deletion is not cached.
+	revocations uint64
+}
+
+// cachedRobotAccount records a successful authentication of a robot account.
+type cachedRobotAccount struct {
+	secretHash string
+	account    RobotAccount
+	expires    time.Time
+}
+
+// NewRobotAccounts returns the robot accounts stored with the given driver.
+func NewRobotAccounts(storageDriver driver.StorageDriver) *RobotAccounts {
+	return &RobotAccounts{
+		driver: storageDriver,
+		cache:  make(map[string]cachedRobotAccount),
+	}
+}
+
+// Create stores a new robot account and returns its secret, which is not
+// stored and cannot be retrieved later.
+func (ra *RobotAccounts) Create(ctx context.Context, account RobotAccount) (string, error) {
+	if !anchoredRobotAccountNameRegexp.MatchString(account.Name) {
+		return "", ErrRobotAccountInvalid{Name: account.Name, Reason: "invalid name"}
+	}
+	for _, repository := range account.Repositories {
+		if repository == "" {
+			return "", ErrRobotAccountInvalid{Name: account.Name, Reason: "empty repository pattern"}
+		}
+	}
+	for _, action := range account.Actions {
+		switch action {
+		case "pull", "push", "delete", "*":
+		default:
+			return "", ErrRobotAccountInvalid{Name: account.Name, Reason: fmt.Sprintf("unknown action %q", action)}
+		}
+	}
+
+	ra.mu.Lock()
+	defer ra.mu.Unlock()
+
+	if _, err := ra.get(ctx, account.Name); err == nil {
+		return "", ErrRobotAccountExists
+	} else if err != ErrRobotAccountUnknown {
+		return "", err
+	}
+
+	secretBytes := make([]byte, 32)
+	if _, err := rand.Read(secretBytes); err != nil {
+		return "", err
+	}
+	secret := base64.RawURLEncoding.EncodeToString(secretBytes)
+
+	// the last use of a revoked robot account of the same name may have
+	// been recorded after it was deleted
+	if err := ra.deleteLastUsed(ctx, account.Name); err != nil {
+		return "", err
+	}
+
+	account.Created = time.Now().UTC()
+	account.LastUsed = nil
+	if err := ra.put(ctx, robotAccountRecord{RobotAccount: account, SecretHash: hashRobotSecret(secret)}); err != nil {
+		return "", err
+	}
+	return secret, nil
+}
+
+// Get returns the robot account with the given name.
+func (ra *RobotAccounts) Get(ctx context.Context, name string) (RobotAccount, error) {
+	record, err := ra.get(ctx, name)
+	if err != nil {
+		return RobotAccount{}, err
+	}
+	return ra.withLastUsed(ctx, record.RobotAccount)
+}
+
+// List returns the robot accounts, sorted by name.
+func (ra *RobotAccounts) List(ctx context.Context) ([]RobotAccount, error) {
+	root, err := pathFor(robotAccountsPathSpec{})
+	if err != nil {
+		return nil, err
+	}
+
+	paths, err := ra.driver.List(ctx, root)
+	if err != nil {
+		if _, ok := err.(driver.PathNotFoundError); ok {
+			return nil, nil
+		}
+		return nil, err
+	}
+	sort.Strings(paths)
+
+	accounts := make([]RobotAccount, 0, len(paths))
+	for _, p := range paths {
+		name := path.Base(p)
+		if !anchoredRobotAccountNameRegexp.MatchString(name) {
+			// the directory of the last uses
+			continue
+		}
+		record, err := ra.get(ctx, name)
+		if err == ErrRobotAccountUnknown {
+			// deleted while listing
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		account, err := ra.withLastUsed(ctx, record.RobotAccount)
+		if err != nil {
+			return nil, err
+		}
+		accounts = append(accounts, account)
+	}
+	return accounts, nil
+}
+
+// Delete revokes the robot account with the given name.
+func (ra *RobotAccounts) Delete(ctx context.Context, name string) error {
+	if !anchoredRobotAccountNameRegexp.MatchString(name) {
+		return ErrRobotAccountUnknown
+	}
+	p, err := pathFor(robotAccountPathSpec{name: name})
+	if err != nil {
+		return err
+	}
+
+	ra.mu.Lock()
+	defer ra.mu.Unlock()
+
+	ra.cacheMu.Lock()
+	delete(ra.cache, name)
+	ra.revocations++
+	ra.cacheMu.Unlock()
+
+	if err := ra.driver.Delete(ctx, p); err != nil {
+		if _, ok := err.(driver.PathNotFoundError); ok {
+			return ErrRobotAccountUnknown
+		}
+		return err
+	}
+	return ra.deleteLastUsed(ctx, name)
+}
+
+// Authenticate checks the secret of the robot account with the given name
+// and returns the robot account, recording its use. Successful
+// authentications are cached for robotAuthCacheTTL.
+func (ra *RobotAccounts) Authenticate(ctx context.Context, name, secret string) (RobotAccount, error) {
+	secretHash := hashRobotSecret(secret)
+	now := time.Now().UTC()
+
+	ra.cacheMu.Lock()
+	cached, ok := ra.cache[name]
+	revocations := ra.revocations
+	ra.cacheMu.Unlock()
+
+	var account RobotAccount
+	if ok && now.Before(cached.expires) && subtle.ConstantTimeCompare([]byte(cached.secretHash), []byte(secretHash)) == 1 {
+		account = cached.account
+	} else {
+		record, err := ra.get(ctx, name)
+		if err == ErrRobotAccountUnknown {
+			return RobotAccount{}, ErrRobotAccountAuthentication
+		} else if err != nil {
+			return RobotAccount{}, err
+		}
+
+		if subtle.ConstantTimeCompare([]byte(record.SecretHash), []byte(secretHash)) != 1 {
+			return RobotAccount{}, ErrRobotAccountAuthentication
+		}
+
+		account, err = ra.withLastUsed(ctx, record.RobotAccount)
+		if err != nil {
+			return RobotAccount{}, err
+		}
+		cached = cachedRobotAccount{secretHash: secretHash, expires: now.Add(robotAuthCacheTTL)}
+	}
+
+	if account.Expired(now) {
+		return RobotAccount{}, ErrRobotAccountAuthentication
+	}
+
+	if account.LastUsed == nil || now.Sub(*account.LastUsed) >= robotLastUsedInterval {
+		if err := ra.putLastUsed(ctx, name, now); err != nil {
+			return RobotAccount{}, err
+		}
+		account.LastUsed = &now
+	}
+
+	cached.account = account
+	ra.cacheMu.Lock()
+	defer ra.cacheMu.Unlock()
+	if ra.revocations != revocations {
+		// a robot account was revoked meanwhile, possibly this one
+		return account, nil
+	}
+	for name, entry := range ra.cache {
+		if !now.Before(entry.expires) {
+			delete(ra.cache, name)
+		}
+	}
+	ra.cache[name] = cached
+	return account, nil
+}
+
+func (ra *RobotAccounts) get(ctx context.Context, name string) (robotAccountRecord, error) {
+	if !anchoredRobotAccountNameRegexp.MatchString(name) {
+		return robotAccountRecord{}, ErrRobotAccountUnknown
+	}
+	p, err := pathFor(robotAccountPathSpec{name: name})
+	if err != nil {
+		return robotAccountRecord{}, err
+	}
+
+	content, err := ra.driver.GetContent(ctx, p)
+	if err != nil {
+		if _, ok := err.(driver.PathNotFoundError); ok {
+			return robotAccountRecord{}, ErrRobotAccountUnknown
+		}
+		return robotAccountRecord{}, err
+	}
+
+	var record robotAccountRecord
+	if err := json.Unmarshal(content, &record); err != nil {
+		return robotAccountRecord{}, fmt.Errorf("invalid robot account %q: %v", name, err)
+	}
+	return record, nil
+}
+
+func (ra *RobotAccounts) put(ctx context.Context, record robotAccountRecord) error {
+	p, err := pathFor(robotAccountPathSpec{name: record.Name})
+	if err != nil {
+		return err
+	}
+	content, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return ra.driver.PutContent(ctx, p, content)
+}
+
+// withLastUsed returns the robot account with the time it was last used, if
+// it was ever used.
+func (ra *RobotAccounts) withLastUsed(ctx context.Context, account RobotAccount) (RobotAccount, error) {
+	p, err := pathFor(robotAccountLastUsedPathSpec{name: account.Name})
+	if err != nil {
+		return RobotAccount{}, err
+	}
+
+	content, err := ra.driver.GetContent(ctx, p)
+	if err != nil {
+		if _, ok := err.(driver.PathNotFoundError); ok {
+			return account, nil
+		}
+		return RobotAccount{}, err
+	}
+
+	lastUsed, err := time.Parse(time.RFC3339Nano, string(content))
+	if err != nil {
+		return RobotAccount{}, fmt.Errorf("invalid last use of robot account %q: %v", account.Name, err)
+	}
+	account.LastUsed = &lastUsed
+	return account, nil
+}
+
+func (ra *RobotAccounts) putLastUsed(ctx context.Context, name string, lastUsed time.Time) error {
+	p, err := pathFor(robotAccountLastUsedPathSpec{name: name})
+	if err != nil {
+		return err
+	}
+	return ra.driver.PutContent(ctx, p, []byte(lastUsed.Format(time.RFC3339Nano)))
+}
+
+func (ra *RobotAccounts) deleteLastUsed(ctx context.Context, name string) error {
+	p, err := pathFor(robotAccountLastUsedPathSpec{name: name})
+	if err != nil {
+		return err
+	}
+	if err := ra.driver.Delete(ctx, p); err != nil {
+		if _, ok := err.(driver.PathNotFoundError); ok {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+func hashRobotSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
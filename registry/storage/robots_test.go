@@ -0,0 +1,197 @@
+package storage
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/distribution/distribution/v3/registry/storage/driver"
+	"github.com/distribution/distribution/v3/registry/storage/driver/inmemory"
+)
+
+func TestRobotAccounts(t *testing.T) {
+	ctx := context.Background()
+	robots := NewRobotAccounts(inmemory.New())
+
+	if accounts, err := robots.List(ctx); err != nil || len(accounts) != 0 {
+		t.Fatalf("expected no robot accounts, got %v, %v", accounts, err)
+	}
+
+	for _, invalid := range []RobotAccount{
+		{Name: "CI"},
+		{Name: "ci/build"},
+		{Name: "ci", Repositories: []string{""}},
+		{Name: "ci", Actions: []string{"pull", "admin"}},
+	} {
+		if _, err := robots.Create(ctx, invalid); err == nil {
+			t.Fatalf("expected an error creating robot account %+v", invalid)
+		} else if _, ok := err.(ErrRobotAccountInvalid); !ok {
+			t.Fatalf("expected an invalid robot account error, got %v", err)
+		}
+	}
+
+	secret, err := robots.Create(ctx, RobotAccount{
+		Name:         "ci",
+		Repositories: []string{"foo/**"},
+		Actions:      []string{"pull", "push"},
+	})
+	if err != nil {
+		t.Fatalf("error creating robot account: %v", err)
+	}
+	if _, err := robots.Create(ctx, RobotAccount{Name: "ci"}); err != ErrRobotAccountExists {
+		t.Fatalf("expected %v, got %v", ErrRobotAccountExists, err)
+	}
+
+	account, err := robots.Get(ctx, "ci")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if account.Created.IsZero() || account.LastUsed != nil {
+		t.Fatalf("unexpected robot account %+v", account)
+	}
+
+	if _, err := robots.Authenticate(ctx, "ci", "wrong"); err != ErrRobotAccountAuthentication {
+		t.Fatalf("expected %v, got %v", ErrRobotAccountAuthentication, err)
+	}
+	if _, err := robots.Authenticate(ctx, "unknown", secret); err != ErrRobotAccountAuthentication {
+		t.Fatalf("expected %v, got %v", ErrRobotAccountAuthentication, err)
+	}
+	account, err = robots.Authenticate(ctx, "ci", secret)
+	if err != nil {
+		t.Fatalf("error authenticating robot account: %v", err)
+	}
+	if account.LastUsed == nil {
+		t.Fatal("expected the last use to be recorded")
+	}
+	if stored, err := robots.Get(ctx, "ci"); err != nil || stored.LastUsed == nil || !stored.LastUsed.Equal(*account.LastUsed) {
+		t.Fatalf("expected the last use to be stored, got %+v, %v", stored, err)
+	}
+
+	expired := time.Now().Add(-time.Minute)
+	expiredSecret, err := robots.Create(ctx, RobotAccount{Name: "old", Expires: &expired})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := robots.Authenticate(ctx, "old", expiredSecret); err != ErrRobotAccountAuthentication {
+		t.Fatalf("expected expired robot account to fail authentication, got %v", err)
+	}
+
+	accounts, err := robots.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(accounts) != 2 || accounts[0].Name != "ci" || accounts[1].Name != "old" {
+		t.Fatalf("unexpected robot accounts %+v", accounts)
+	}
+
+	if err := robots.Delete(ctx, "ci"); err != nil {
+		t.Fatalf("error deleting robot account: %v", err)
+	}
+	if err := robots.Delete(ctx, "ci"); err != ErrRobotAccountUnknown {
+		t.Fatalf("expected %v, got %v", ErrRobotAccountUnknown, err)
+	}
+	if _, err := robots.Authenticate(ctx, "ci", secret); err != ErrRobotAccountAuthentication {
+		t.Fatalf("expected revoked robot account to fail authentication, got %v", err)
+	}
+
+	// a use recorded concurrently with the revocation neither restores the
+	// robot account nor carries over to one created with the same name
+	if err := robots.putLastUsed(ctx, "ci", time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := robots.Get(ctx, "ci"); err != ErrRobotAccountUnknown {
+		t.Fatalf("expected %v, got %v", ErrRobotAccountUnknown, err)
+	}
+	if _, err := robots.Authenticate(ctx, "ci", secret); err != ErrRobotAccountAuthentication {
+		t.Fatalf("expected revoked robot account to fail authentication, got %v", err)
+	}
+	accounts, err = robots.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(accounts) != 1 || accounts[0].Name != "old" {
+		t.Fatalf("unexpected robot accounts %+v", accounts)
+	}
+	if _, err := robots.Create(ctx, RobotAccount{Name: "ci"}); err != nil {
+		t.Fatal(err)
+	}
+	if account, err := robots.Get(ctx, "ci"); err != nil || account.LastUsed != nil {
+		t.Fatalf("expected the recreated robot account not to have been used, got %+v, %v", account, err)
+	}
+}
+
+func TestRobotAccountsConcurrentCreate(t *testing.T) {
+	ctx := context.Background()
+	robots := NewRobotAccounts(slowPutDriver{inmemory.New()})
+
+	var wg sync.WaitGroup
+	errs := make([]error, 8)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = robots.Create(ctx, RobotAccount{Name: "ci"})
+		}(i)
+	}
+	wg.Wait()
+
+	created := 0
+	for _, err := range errs {
+		switch err {
+		case nil:
+			created++
+		case ErrRobotAccountExists:
+		default:
+			t.Fatalf("unexpected error creating robot account: %v", err)
+		}
+	}
+	if created != 1 {
+		t.Fatalf("expected the robot account to be created once, got %d", created)
+	}
+}
+
+// countingGetDriver counts the calls to GetContent.
+type countingGetDriver struct {
+	driver.StorageDriver
+	gets *int64
+}
+
+func (d countingGetDriver) GetContent(ctx context.Context, path string) ([]byte, error) {
+	atomic.AddInt64(d.gets, 1)
+	return d.StorageDriver.GetContent(ctx, path)
+}
+
+func TestRobotAccountsAuthenticateCache(t *testing.T) {
+	ctx := context.Background()
+	var gets int64
+	robots := NewRobotAccounts(countingGetDriver{StorageDriver: inmemory.New(), gets: &gets})
+
+	secret, err := robots.Create(ctx, RobotAccount{Name: "ci"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := robots.Authenticate(ctx, "ci", secret); err != nil {
+		t.Fatalf("error authenticating robot account: %v", err)
+	}
+
+	atomic.StoreInt64(&gets, 0)
+	if _, err := robots.Authenticate(ctx, "ci", secret); err != nil {
+		t.Fatalf("error authenticating robot account: %v", err)
+	}
+	if n := atomic.LoadInt64(&gets); n != 0 {
+		t.Fatalf("expected a cached authentication not to read storage, got %d reads", n)
+	}
+
+	if _, err := robots.Authenticate(ctx, "ci", "wrong"); err != ErrRobotAccountAuthentication {
+		t.Fatalf("expected %v, got %v", ErrRobotAccountAuthentication, err)
+	}
+
+	if err := robots.Delete(ctx, "ci"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := robots.Authenticate(ctx, "ci", secret); err != ErrRobotAccountAuthentication {
+		t.Fatalf("expected revoked robot account to fail authentication, got %v", err)
+	}
+}
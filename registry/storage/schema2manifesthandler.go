@@ -24,6 +24,7 @@ type schema2ManifestHandler struct {
 	blobStore    distribution.BlobStore
 	ctx          context.Context
 	manifestURLs manifestURLs
+	limits       ManifestLimits
 }
 
 var _ ManifestHandler = &schema2ManifestHandler{}
@@ -75,6 +76,10 @@ func (ms *schema2ManifestHandler) verifyManifest(ctx context.Context, mnfst sche
 		return fmt.Errorf("unrecognized manifest schema version %d", mnfst.Manifest.SchemaVersion)
 	}
 
+	if err := ms.verifyLimits(mnfst); err != nil {
+		return err
+	}
+
 	if skipDependencyVerification {
 		return nil
 	}
@@ -142,3 +147,19 @@ func (ms *schema2ManifestHandler) verifyManifest(ctx context.Context, mnfst sche
 
 	return nil
 }
+
+// verifyLimits checks the manifest against the size and shape limits of the
+// registry.
+func (ms *schema2ManifestHandler) verifyLimits(mnfst schema2.DeserializedManifest) error {
+	_, payload, err := mnfst.Payload()
+	if err != nil {
+		return err
+	}
+
+	errs := ms.limits.verifyPayload(payload)
+	errs = append(errs, ms.limits.verifyImage(mnfst.Config, mnfst.Layers)...)
+	if len(errs) != 0 {
+		return errs
+	}
+	return nil
+}
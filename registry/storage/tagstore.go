@@ -4,6 +4,7 @@ import (
 	"context"
 	"path"
 	"sort"
+	"time"
 
 	"github.com/distribution/distribution/v3"
 	storagedriver "github.com/distribution/distribution/v3/registry/storage/driver"
@@ -11,6 +12,8 @@ import (
 )
 
 var _ distribution.TagService = &tagStore{}
+var _ distribution.TagModTimeProvider = &tagStore{}
+var _ distribution.TagLister = &tagStore{}
 
 // tagStore provides methods to manage manifest tags in a backend storage driver.
 // This implementation uses the same on-disk layout as the (now deleted) tag
@@ -55,11 +58,57 @@ func (ts *tagStore) All(ctx context.Context) ([]string, error) {
 	return tags, nil
 }
 
+// List returns up to n tags sorting after last. Tags up to last are dropped
+// before sorting, so only the remainder of the listing is ordered.
+func (ts *tagStore) List(ctx context.Context, last string, n int) ([]string, error) {
+	var tags []string
+	if n == 0 {
+		return tags, nil
+	}
+
+	pathSpec, err := pathFor(manifestTagPathSpec{
+		name: ts.repository.Named().Name(),
+	})
+	if err != nil {
+		return tags, err
+	}
+
+	entries, err := ts.blobStore.driver.List(ctx, pathSpec)
+	if err != nil {
+		switch err := err.(type) {
+		case storagedriver.PathNotFoundError:
+			return tags, distribution.ErrRepositoryUnknown{Name: ts.repository.Named().Name()}
+		default:
+			return tags, err
+		}
+	}
+
+	for _, entry := range entries {
+		_, filename := path.Split(entry)
+		if filename > last {
+			tags = append(tags, filename)
+		}
+	}
+
+	sort.Strings(tags)
+	if n > 0 && n < len(tags) {
+		tags = tags[:n]
+	}
+
+	return tags, nil
+}
+
 // Tag tags the digest with the given tag, updating the the store to point at
 // the current tag. The digest must point to a manifest.
+//
+// An immutable tag already pointing to another manifest is not moved, and
+// ErrTagImmutable is returned. The check and the update of immutable tags
+// are serialized within the registry, but not across registry instances
+// sharing the storage.
 func (ts *tagStore) Tag(ctx context.Context, tag string, desc distribution.Descriptor) error {
+	name := ts.repository.Named().Name()
 	currentPath, err := pathFor(manifestTagCurrentPathSpec{
-		name: ts.repository.Named().Name(),
+		name: name,
 		tag:  tag,
 	})
 
@@ -67,6 +116,22 @@ func (ts *tagStore) Tag(ctx context.Context, tag string, desc distribution.Descr
 		return err
 	}
 
+	if ts.repository.isImmutableTag != nil && ts.repository.isImmutableTag(name, tag) {
+		unlock := ts.repository.tagLocks.lock(name, tag)
+		defer unlock()
+
+		current, err := ts.Get(ctx, tag)
+		switch err.(type) {
+		case nil:
+			if current.Digest != desc.Digest {
+				return distribution.ErrTagImmutable{Tag: tag, Digest: current.Digest}
+			}
+		case distribution.ErrTagUnknown:
+		default:
+			return err
+		}
+	}
+
 	lbs := ts.linkedBlobStore(ctx, tag)
 
 	// Link into the index
@@ -102,6 +167,31 @@ func (ts *tagStore) Get(ctx context.Context, tag string) (distribution.Descripto
 	return distribution.Descriptor{Digest: revision}, nil
 }
 
+// ModTime returns the time at which the tag was last pointed at a manifest,
+// which is the modification time of its current link.
+func (ts *tagStore) ModTime(ctx context.Context, tag string) (time.Time, error) {
+	currentPath, err := pathFor(manifestTagCurrentPathSpec{
+		name: ts.repository.Named().Name(),
+		tag:  tag,
+	})
+
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	fileInfo, err := ts.blobStore.driver.Stat(ctx, currentPath)
+	if err != nil {
+		switch err.(type) {
+		case storagedriver.PathNotFoundError:
+			return time.Time{}, distribution.ErrTagUnknown{Tag: tag}
+		}
+
+		return time.Time{}, err
+	}
+
+	return fileInfo.ModTime(), nil
+}
+
 // Untag removes the tag association
 func (ts *tagStore) Untag(ctx context.Context, tag string) error {
 	tagPath, err := pathFor(manifestTagPathSpec{
@@ -2,13 +2,18 @@ package storage
 
 import (
 	"context"
+	"fmt"
 	"reflect"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/distribution/distribution/v3"
 	"github.com/distribution/distribution/v3/manifest"
 	"github.com/distribution/distribution/v3/manifest/schema2"
 	"github.com/distribution/distribution/v3/reference"
+	"github.com/distribution/distribution/v3/registry/storage/driver"
 	"github.com/distribution/distribution/v3/registry/storage/driver/inmemory"
 	digest "github.com/opencontainers/go-digest"
 )
@@ -91,6 +96,85 @@ func TestTagStoreTag(t *testing.T) {
 	}
 }
 
+func TestTagStoreImmutableTag(t *testing.T) {
+	ctx := context.Background()
+	reg, err := NewRegistry(ctx, slowPutDriver{inmemory.New()}, ImmutableTags(func(repository, tag string) bool {
+		return repository == "a/b" && strings.HasPrefix(tag, "v")
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	repoRef, _ := reference.WithName("a/b")
+	repo, err := reg.Repository(ctx, repoRef)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tags := repo.Tags(ctx)
+
+	first := distribution.Descriptor{Digest: "sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"}
+	second := distribution.Descriptor{Digest: "sha256:bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"}
+
+	if err := tags.Tag(ctx, "v1", first); err != nil {
+		t.Fatal(err)
+	}
+	if err := tags.Tag(ctx, "v1", first); err != nil {
+		t.Fatalf("unexpected error tagging the same manifest again: %v", err)
+	}
+	err = tags.Tag(ctx, "v1", second)
+	if _, ok := err.(distribution.ErrTagImmutable); !ok {
+		t.Fatalf("expected ErrTagImmutable moving an immutable tag, got %v", err)
+	}
+	if err := tags.Tag(ctx, "latest", first); err != nil {
+		t.Fatal(err)
+	}
+	if err := tags.Tag(ctx, "latest", second); err != nil {
+		t.Fatalf("unexpected error moving a mutable tag: %v", err)
+	}
+
+	// concurrent updates of a new immutable tag only set it once
+	descs := make([]distribution.Descriptor, 16)
+	for i := range descs {
+		descs[i] = distribution.Descriptor{Digest: digest.FromString(fmt.Sprintf("manifest %d", i))}
+	}
+	var wg sync.WaitGroup
+	errs := make([]error, len(descs))
+	for i := range descs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = tags.Tag(ctx, "v2", descs[i])
+		}(i)
+	}
+	wg.Wait()
+
+	current, err := tags.Get(ctx, "v2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, err := range errs {
+		if descs[i].Digest == current.Digest {
+			if err != nil {
+				t.Fatalf("unexpected error setting the tag: %v", err)
+			}
+			continue
+		}
+		if _, ok := err.(distribution.ErrTagImmutable); !ok {
+			t.Fatalf("expected ErrTagImmutable for %s, got %v", descs[i].Digest, err)
+		}
+	}
+}
+
+// slowPutDriver delays writes, widening the window between reading a tag and
+// updating it.
+type slowPutDriver struct {
+	driver.StorageDriver
+}
+
+func (d slowPutDriver) PutContent(ctx context.Context, path string, content []byte) error {
+	time.Sleep(time.Millisecond)
+	return d.StorageDriver.PutContent(ctx, path, content)
+}
+
 func TestTagStoreUnTag(t *testing.T) {
 	env := testTagStore(t)
 	tags := env.ts
@@ -119,6 +203,40 @@ func TestTagStoreUnTag(t *testing.T) {
 	}
 }
 
+func TestTagStoreModTime(t *testing.T) {
+	env := testTagStore(t)
+	tags := env.ts.(distribution.TagModTimeProvider)
+	ctx := env.ctx
+	desc := distribution.Descriptor{Digest: "sha256:bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"}
+
+	if _, err := tags.ModTime(ctx, "latest"); err == nil {
+		t.Error("expected error getting modification time of unknown tag")
+	}
+
+	if err := env.ts.Tag(ctx, "latest", desc); err != nil {
+		t.Fatal(err)
+	}
+	first, err := tags.ModTime(ctx, "latest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.IsZero() {
+		t.Error("expected modification time of tag")
+	}
+
+	time.Sleep(time.Millisecond)
+	if err := env.ts.Tag(ctx, "latest", desc); err != nil {
+		t.Fatal(err)
+	}
+	second, err := tags.ModTime(ctx, "latest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !second.After(first) {
+		t.Errorf("expected modification time to be updated when retagging: %v <= %v", second, first)
+	}
+}
+
 func TestTagStoreAll(t *testing.T) {
 	env := testTagStore(t)
 	tagStore := env.ts
@@ -166,6 +284,63 @@ func TestTagStoreAll(t *testing.T) {
 
 }
 
+func TestTagStoreList(t *testing.T) {
+	ctx := context.Background()
+	reg, err := NewRegistry(ctx, inmemory.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	repoRef, _ := reference.WithName("a/b")
+	repo, err := reg.Repository(ctx, repoRef)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tagStore := repo.Tags(ctx)
+
+	lister, ok := tagStore.(distribution.TagLister)
+	if !ok {
+		t.Fatal("tag store does not implement TagLister")
+	}
+
+	if _, err := lister.List(ctx, "", -1); err == nil {
+		t.Fatal("expected error listing tags of an unknown repository")
+	} else if _, ok := err.(distribution.ErrRepositoryUnknown); !ok {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, tag := range []string{"e", "c", "a", "d", "b", "v1", "v1.0", "v1-rc", "v10"} {
+		desc := distribution.Descriptor{Digest: "sha256:eeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeee"}
+		if err := tagStore.Tag(ctx, tag, desc); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tc := range []struct {
+		last     string
+		n        int
+		expected []string
+	}{
+		{"", -1, []string{"a", "b", "c", "d", "e", "v1", "v1-rc", "v1.0", "v10"}},
+		{"", 2, []string{"a", "b"}},
+		{"b", 2, []string{"c", "d"}},
+		{"bb", -1, []string{"c", "d", "e", "v1", "v1-rc", "v1.0", "v10"}},
+		{"d", 2, []string{"e", "v1"}},
+		{"e", 1, []string{"v1"}},
+		{"v1", 2, []string{"v1-rc", "v1.0"}},
+		{"v1.0", 5, []string{"v10"}},
+		{"v10", 1, nil},
+		{"a", 0, nil},
+	} {
+		tags, err := lister.List(ctx, tc.last, tc.n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(tags) != len(tc.expected) || (len(tags) > 0 && !reflect.DeepEqual(tags, tc.expected)) {
+			t.Errorf("List(%q, %d) = %v, expected %v", tc.last, tc.n, tags, tc.expected)
+		}
+	}
+}
+
 func TestTagLookup(t *testing.T) {
 	env := testTagStore(t)
 	tagStore := env.ts
@@ -0,0 +1,184 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/reference"
+	"github.com/distribution/distribution/v3/registry/storage/driver"
+	"github.com/opencontainers/go-digest"
+)
+
+// RepositoryUsage describes the storage used by a single repository.
+type RepositoryUsage struct {
+	Name string `json:"name"`
+
+	// Blobs is the number of distinct blobs referenced by the repository.
+	Blobs int `json:"blobs"`
+
+	// LogicalSize is the size of all blobs referenced by the repository,
+	// regardless of whether other repositories reference them as well.
+	LogicalSize int64 `json:"logicalSize"`
+
+	// UniqueSize is the size of the blobs referenced by this repository
+	// only. This is the space freed by deleting the repository.
+	UniqueSize int64 `json:"uniqueSize"`
+
+	// SharedSize is the size of the blobs also referenced by other
+	// repositories.
+	SharedSize int64 `json:"sharedSize"`
+}
+
+// UsageReport describes the storage used by a registry.
+type UsageReport struct {
+	Repositories []RepositoryUsage `json:"repositories"`
+
+	// Blobs is the number of distinct blobs referenced by any repository.
+	Blobs int `json:"blobs"`
+
+	// LogicalSize is the sum of the logical sizes of all repositories.
+	LogicalSize int64 `json:"logicalSize"`
+
+	// TotalSize is the deduplicated size of all referenced blobs, which is
+	// the storage actually consumed by them.
+	TotalSize int64 `json:"totalSize"`
+}
+
+// DiskUsage computes the storage used by each repository of the registry.
+// A repository references its manifests and the blobs they refer to, which
+// is the content kept alive by garbage collection. Referenced blobs missing
+// from storage do not count towards usage.
+func DiskUsage(ctx context.Context, registry distribution.Namespace) (UsageReport, error) {
+	repositoryEnumerator, ok := registry.(distribution.RepositoryEnumerator)
+	if !ok {
+		return UsageReport{}, fmt.Errorf("unable to convert Namespace to RepositoryEnumerator")
+	}
+
+	statter := registry.BlobStatter()
+
+	// sizes of every blob seen so far, -1 for blobs missing from storage
+	sizes := make(map[digest.Digest]int64)
+	// number of repositories referencing each blob
+	refCounts := make(map[digest.Digest]int)
+	repositories := make(map[string]map[digest.Digest]struct{})
+
+	addReference := func(referenced map[digest.Digest]struct{}, dgst digest.Digest) error {
+		if _, ok := referenced[dgst]; ok {
+			return nil
+		}
+		referenced[dgst] = struct{}{}
+		refCounts[dgst]++
+
+		if _, ok := sizes[dgst]; ok {
+			return nil
+		}
+		desc, err := statter.Stat(ctx, dgst)
+		switch err {
+		case nil:
+			sizes[dgst] = desc.Size
+		case distribution.ErrBlobUnknown:
+			sizes[dgst] = -1
+		default:
+			return fmt.Errorf("failed to stat blob %s: %v", dgst, err)
+		}
+		return nil
+	}
+
+	err := repositoryEnumerator.Enumerate(ctx, func(repoName string) error {
+		named, err := reference.WithName(repoName)
+		if err != nil {
+			return fmt.Errorf("failed to parse repo name %s: %v", repoName, err)
+		}
+		repository, err := registry.Repository(ctx, named)
+		if err != nil {
+			return fmt.Errorf("failed to construct repository: %v", err)
+		}
+
+		manifestService, err := repository.Manifests(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to construct manifest service: %v", err)
+		}
+
+		manifestEnumerator, ok := manifestService.(distribution.ManifestEnumerator)
+		if !ok {
+			return fmt.Errorf("unable to convert ManifestService into ManifestEnumerator")
+		}
+
+		referenced := make(map[digest.Digest]struct{})
+		repositories[repoName] = referenced
+
+		err = manifestEnumerator.Enumerate(ctx, func(dgst digest.Digest) error {
+			if err := addReference(referenced, dgst); err != nil {
+				return err
+			}
+
+			manifest, err := manifestService.Get(ctx, dgst)
+			if err != nil {
+				return fmt.Errorf("failed to retrieve manifest for digest %v: %v", dgst, err)
+			}
+
+			for _, descriptor := range manifest.References() {
+				if err := addReference(referenced, descriptor.Digest); err != nil {
+					return err
+				}
+			}
+
+			return nil
+		})
+
+		// Repositories without a _manifests directory, such as those
+		// only holding unfinished uploads, do not reference anything.
+		if _, ok := err.(driver.PathNotFoundError); ok {
+			return nil
+		}
+
+		return err
+	})
+	if _, ok := err.(driver.PathNotFoundError); ok {
+		// an empty registry without any repositories
+		err = nil
+	}
+	if err != nil {
+		return UsageReport{}, fmt.Errorf("failed to compute usage: %v", err)
+	}
+
+	report := UsageReport{
+		Repositories: make([]RepositoryUsage, 0, len(repositories)),
+	}
+	for name, referenced := range repositories {
+		usage := RepositoryUsage{Name: name}
+		for dgst := range referenced {
+			size := sizes[dgst]
+			if size < 0 {
+				continue
+			}
+
+			usage.Blobs++
+			usage.LogicalSize += size
+			if refCounts[dgst] > 1 {
+				usage.SharedSize += size
+			} else {
+				usage.UniqueSize += size
+			}
+		}
+
+		report.Repositories = append(report.Repositories, usage)
+		report.LogicalSize += usage.LogicalSize
+	}
+
+	for _, size := range sizes {
+		if size < 0 {
+			continue
+		}
+		report.Blobs++
+		report.TotalSize += size
+	}
+
+	sort.Slice(report.Repositories, func(i, j int) bool {
+		return report.Repositories[i].Name < report.Repositories[j].Name
+	})
+
+	return report, nil
+}
@@ -0,0 +1,104 @@
+package storage
+
+import (
+	"io"
+	"testing"
+
+	"github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/registry/storage/driver/inmemory"
+	"github.com/opencontainers/go-digest"
+)
+
+func TestDiskUsage(t *testing.T) {
+	ctx := context.Background()
+	inmemoryDriver := inmemory.New()
+
+	registry := createRegistry(t, inmemoryDriver)
+	blobstatter := registry.BlobStatter()
+
+	first := makeRepository(t, registry, "first")
+	second := makeRepository(t, registry, "second")
+	makeRepository(t, registry, "empty")
+
+	shared := uploadRandomSchema2Image(t, first)
+	unique := uploadRandomSchema2Image(t, second)
+	// pushing the same image to a second repository shares all its blobs
+	for _, rs := range shared.layers {
+		if _, err := rs.Seek(0, io.SeekStart); err != nil {
+			t.Fatalf("failed to rewind layer: %v", err)
+		}
+	}
+	uploadImage(t, second, shared)
+
+	blobs := func(im image) map[digest.Digest]int64 {
+		sizes := make(map[digest.Digest]int64)
+		for _, dgst := range append([]digest.Digest{im.manifestDigest}, referencedDigests(im)...) {
+			desc, err := blobstatter.Stat(ctx, dgst)
+			if err != nil {
+				t.Fatalf("failed to stat blob %s: %v", dgst, err)
+			}
+			sizes[dgst] = desc.Size
+		}
+		return sizes
+	}
+
+	var sharedSize, uniqueSize int64
+	sharedBlobs := blobs(shared)
+	for _, size := range sharedBlobs {
+		sharedSize += size
+	}
+	// blobs of the second image not already in the first one, such as its
+	// layers, while the empty config blob is shared
+	uniqueBlobs := blobs(unique)
+	for dgst, size := range uniqueBlobs {
+		if _, ok := sharedBlobs[dgst]; !ok {
+			uniqueSize += size
+		}
+	}
+
+	report, err := DiskUsage(ctx, registry)
+	if err != nil {
+		t.Fatalf("failed to compute disk usage: %v", err)
+	}
+
+	if len(report.Repositories) != 2 {
+		t.Fatalf("unexpected repositories in report: %#v", report.Repositories)
+	}
+
+	firstUsage, secondUsage := report.Repositories[0], report.Repositories[1]
+	if firstUsage.Name != "first" || secondUsage.Name != "second" {
+		t.Fatalf("unexpected repository order: %s, %s", firstUsage.Name, secondUsage.Name)
+	}
+
+	if firstUsage.LogicalSize != sharedSize {
+		t.Errorf("unexpected logical size for first: %d != %d", firstUsage.LogicalSize, sharedSize)
+	}
+	if firstUsage.UniqueSize != 0 || firstUsage.SharedSize != sharedSize {
+		t.Errorf("unexpected unique/shared size for first: %d/%d", firstUsage.UniqueSize, firstUsage.SharedSize)
+	}
+
+	if secondUsage.LogicalSize != sharedSize+uniqueSize {
+		t.Errorf("unexpected logical size for second: %d != %d", secondUsage.LogicalSize, sharedSize+uniqueSize)
+	}
+	if secondUsage.UniqueSize != uniqueSize || secondUsage.SharedSize != sharedSize {
+		t.Errorf("unexpected unique/shared size for second: %d/%d", secondUsage.UniqueSize, secondUsage.SharedSize)
+	}
+
+	if report.LogicalSize != 2*sharedSize+uniqueSize {
+		t.Errorf("unexpected total logical size: %d != %d", report.LogicalSize, 2*sharedSize+uniqueSize)
+	}
+	if report.TotalSize != sharedSize+uniqueSize {
+		t.Errorf("unexpected deduplicated size: %d != %d", report.TotalSize, sharedSize+uniqueSize)
+	}
+	if report.Blobs != len(sharedBlobs)+len(uniqueBlobs)-1 {
+		t.Errorf("unexpected number of blobs: %d", report.Blobs)
+	}
+}
+
+func referencedDigests(im image) []digest.Digest {
+	var digests []digest.Digest
+	for _, desc := range im.manifest.References() {
+		digests = append(digests, desc.Digest)
+	}
+	return digests
+}
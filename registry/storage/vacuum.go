@@ -14,6 +14,10 @@ import (
 // storage systems.
 // https://en.wikipedia.org/wiki/Consistency_model
 
+// repositoryDirs are the directories holding the content of a repository,
+// as opposed to the repositories nested under its name.
+var repositoryDirs = []string{"_manifests", "_layers", "_uploads"}
+
 // NewVacuum creates a new Vacuum
 func NewVacuum(ctx context.Context, driver driver.StorageDriver) Vacuum {
 	return Vacuum{
@@ -84,8 +88,8 @@ func (v Vacuum) RemoveManifest(name string, dgst digest.Digest, tags []string) e
 	return v.driver.Delete(v.ctx, manifestPath)
 }
 
-// RemoveRepository removes a repository directory from the
-// filesystem
+// RemoveRepository removes the manifests, layer links and uploads of a
+// repository. Repositories nested under its name are left in place.
 func (v Vacuum) RemoveRepository(repoName string) error {
 	rootForRepository, err := pathFor(repositoriesRootPathSpec{})
 	if err != nil {
@@ -93,9 +97,20 @@ func (v Vacuum) RemoveRepository(repoName string) error {
 	}
 	repoDir := path.Join(rootForRepository, repoName)
 	dcontext.GetLogger(v.ctx).Infof("Deleting repo: %s", repoDir)
-	err = v.driver.Delete(v.ctx, repoDir)
-	if err != nil {
-		return err
+
+	var removed bool
+	for _, dir := range repositoryDirs {
+		err = v.driver.Delete(v.ctx, path.Join(repoDir, dir))
+		if err != nil {
+			if _, ok := err.(driver.PathNotFoundError); ok {
+				continue
+			}
+			return err
+		}
+		removed = true
+	}
+	if !removed {
+		return driver.PathNotFoundError{Path: repoDir}
 	}
 
 	return nil
@@ -0,0 +1,174 @@
+package registry
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	dcontext "github.com/distribution/distribution/v3/context"
+)
+
+// defaultTLSReloadInterval is how often the TLS files are checked for
+// changes, unless configured otherwise.
+const defaultTLSReloadInterval = 30 * time.Second
+
+// tlsReloader serves the TLS certificate, key and client CAs of the registry,
+// loading them again when their files change or when the registry receives
+// SIGHUP. Connections established with the previous material are kept. A
+// failed reload is logged and the previous material kept.
+type tlsReloader struct {
+	certFile  string
+	keyFile   string
+	clientCAs []string
+	// base is the configuration of the listener, which the configuration
+	// of each connection is cloned from.
+	base *tls.Config
+	// logger is the logger of the registry application.
+	logger dcontext.Logger
+
+	mu   sync.RWMutex
+	cert *tls.Certificate
+	pool *x509.CertPool
+	// files identifies the versions of the files the material was loaded
+	// from, to detect changes.
+	files map[string]fileVersion
+}
+
+// fileVersion identifies a version of a file.
+type fileVersion struct {
+	modTime time.Time
+	size    int64
+}
+
+// newTLSReloader loads the certificate, key and client CAs and configures
+// base to serve them.
+func newTLSReloader(base *tls.Config, certFile, keyFile string, clientCAs []string, logger dcontext.Logger) (*tlsReloader, error) {
+	r := &tlsReloader{
+		certFile:  certFile,
+		keyFile:   keyFile,
+		clientCAs: clientCAs,
+		base:      base,
+		logger:    logger,
+	}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+
+	base.GetCertificate = r.getCertificate
+	if len(clientCAs) != 0 {
+		base.ClientAuth = tls.RequireAndVerifyClientCert
+		base.GetConfigForClient = r.getConfigForClient
+	}
+	return r, nil
+}
+
+// reload loads the certificate, key and client CAs. The previous material is
+// kept when any of them fails to load.
+func (r *tlsReloader) reload() error {
+	files := make(map[string]fileVersion)
+	for _, path := range append([]string{r.certFile, r.keyFile}, r.clientCAs...) {
+		version, err := statFile(path)
+		if err != nil {
+			return err
+		}
+		files[path] = version
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+
+	var pool *x509.CertPool
+	if len(r.clientCAs) != 0 {
+		pool = x509.NewCertPool()
+		for _, ca := range r.clientCAs {
+			caPem, err := os.ReadFile(ca)
+			if err != nil {
+				return err
+			}
+
+			if ok := pool.AppendCertsFromPEM(caPem); !ok {
+				return fmt.Errorf("could not add CA to pool")
+			}
+		}
+
+		for _, subj := range pool.Subjects() {
+			r.logger.Debugf("CA Subject: %s", string(subj))
+		}
+	}
+
+	r.mu.Lock()
+	r.cert = &cert
+	r.pool = pool
+	r.files = files
+	r.mu.Unlock()
+	return nil
+}
+
+// changed reports whether any of the files changed since they were loaded.
+func (r *tlsReloader) changed() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for path, loaded := range r.files {
+		version, err := statFile(path)
+		if err != nil || version != loaded {
+			return true
+		}
+	}
+	return false
+}
+
+// watch reloads the material when the files change, checking them every
+// interval, or when a signal is received from hup, until stop is closed.
+func (r *tlsReloader) watch(interval time.Duration, hup <-chan os.Signal, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-hup:
+			r.logger.Info("reloading TLS certificate on SIGHUP")
+		case <-ticker.C:
+			if !r.changed() {
+				continue
+			}
+			r.logger.Info("reloading TLS certificate after its files changed")
+		}
+
+		if err := r.reload(); err != nil {
+			r.logger.Errorf("error reloading TLS certificate, keeping the previous one: %v", err)
+		}
+	}
+}
+
+func (r *tlsReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+func (r *tlsReloader) getConfigForClient(*tls.ClientHelloInfo) (*tls.Config, error) {
+	r.mu.RLock()
+	pool := r.pool
+	r.mu.RUnlock()
+
+	config := r.base.Clone()
+	config.GetConfigForClient = nil
+	config.ClientCAs = pool
+	return config, nil
+}
+
+func statFile(path string) (fileVersion, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return fileVersion{}, err
+	}
+	return fileVersion{modTime: fi.ModTime(), size: fi.Size()}, nil
+}
@@ -0,0 +1,257 @@
+package registry
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	dcontext "github.com/distribution/distribution/v3/context"
+)
+
+// writeCertificate writes a self-signed certificate for 127.0.0.1 with the
+// given common name and its key to certFile and keyFile.
+func writeCertificate(t *testing.T, certFile, keyFile, commonName string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeFile(t, certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+	if keyFile != "" {
+		writeFile(t, keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+	}
+}
+
+// writeFile writes the file with a modification time later than its
+// previous one, so that the change is detected whatever the resolution of
+// the file system timestamps.
+func writeFile(t *testing.T, path string, data []byte) {
+	modTime := time.Now()
+	if fi, err := os.Stat(path); err == nil && !fi.ModTime().Before(modTime) {
+		modTime = fi.ModTime().Add(time.Second)
+	}
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func commonName(t *testing.T, cert *tls.Certificate) string {
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return leaf.Subject.CommonName
+}
+
+func TestTLSReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "server.crt")
+	keyFile := filepath.Join(dir, "server.key")
+	caFile := filepath.Join(dir, "ca.crt")
+	writeCertificate(t, certFile, keyFile, "first")
+	writeCertificate(t, caFile, "", "first-ca")
+
+	base := &tls.Config{MinVersion: tls.VersionTLS12}
+	reloader, err := newTLSReloader(base, certFile, keyFile, []string{caFile}, dcontext.GetLogger(dcontext.Background()))
+	if err != nil {
+		t.Fatalf("unexpected error creating reloader: %v", err)
+	}
+	if base.ClientAuth != tls.RequireAndVerifyClientCert {
+		t.Fatalf("expected client certificates to be required, got %v", base.ClientAuth)
+	}
+
+	checkMaterial := func(expectedCert, expectedCA string) {
+		t.Helper()
+		cert, err := base.GetCertificate(&tls.ClientHelloInfo{})
+		if err != nil {
+			t.Fatalf("unexpected error getting certificate: %v", err)
+		}
+		if name := commonName(t, cert); name != expectedCert {
+			t.Fatalf("expected certificate %q, got %q", expectedCert, name)
+		}
+		config, err := base.GetConfigForClient(&tls.ClientHelloInfo{})
+		if err != nil {
+			t.Fatalf("unexpected error getting client config: %v", err)
+		}
+		if config.MinVersion != tls.VersionTLS12 || config.ClientAuth != tls.RequireAndVerifyClientCert {
+			t.Fatalf("expected the client config to be cloned from the base config, got %+v", config)
+		}
+		subjects := config.ClientCAs.Subjects()
+		if len(subjects) != 1 {
+			t.Fatalf("expected one client CA, got %d", len(subjects))
+		}
+		var name pkix.RDNSequence
+		if _, err := asn1.Unmarshal(subjects[0], &name); err != nil {
+			t.Fatal(err)
+		}
+		var subject pkix.Name
+		subject.FillFromRDNSequence(&name)
+		if subject.CommonName != expectedCA {
+			t.Fatalf("expected client CA %q, got %q", expectedCA, subject.CommonName)
+		}
+	}
+	checkMaterial("first", "first-ca")
+	if reloader.changed() {
+		t.Fatal("expected the files not to have changed")
+	}
+
+	stop := make(chan struct{})
+	go reloader.watch(10*time.Millisecond, nil, stop)
+
+	eventually := func(check func() bool) bool {
+		for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+			if check() {
+				return true
+			}
+		}
+		return false
+	}
+	servedCert := func(expected string) func() bool {
+		return func() bool {
+			cert, _ := base.GetCertificate(&tls.ClientHelloInfo{})
+			return commonName(t, cert) == expected
+		}
+	}
+
+	// changed files are reloaded
+	writeCertificate(t, certFile, keyFile, "second")
+	writeCertificate(t, caFile, "", "second-ca")
+	if !eventually(servedCert("second")) {
+		t.Fatal("timed out waiting for the certificate to be reloaded")
+	}
+	if !eventually(func() bool { return !reloader.changed() }) {
+		t.Fatal("timed out waiting for the client CAs to be reloaded")
+	}
+	checkMaterial("second", "second-ca")
+
+	// a failed reload keeps the previous material
+	writeFile(t, keyFile, []byte("not a key"))
+	time.Sleep(100 * time.Millisecond)
+	checkMaterial("second", "second-ca")
+
+	close(stop)
+
+	// SIGHUP reloads the files before their next check
+	hup := make(chan os.Signal, 1)
+	stop = make(chan struct{})
+	defer close(stop)
+	go reloader.watch(time.Hour, hup, stop)
+
+	writeCertificate(t, certFile, keyFile, "third")
+	hup <- syscall.SIGHUP
+	if !eventually(servedCert("third")) {
+		t.Fatal("timed out waiting for the certificate to be reloaded on SIGHUP")
+	}
+}
+
+func TestTLSReloaderServesConnections(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "server.crt")
+	keyFile := filepath.Join(dir, "server.key")
+	writeCertificate(t, certFile, keyFile, "first")
+
+	base := &tls.Config{MinVersion: tls.VersionTLS12}
+	reloader, err := newTLSReloader(base, certFile, keyFile, nil, dcontext.GetLogger(dcontext.Background()))
+	if err != nil {
+		t.Fatalf("unexpected error creating reloader: %v", err)
+	}
+	if base.GetConfigForClient != nil || base.ClientAuth != tls.NoClientCert {
+		t.Fatal("expected no client certificates to be requested")
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln = tls.NewListener(ln, base)
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				buf := make([]byte, 1)
+				for {
+					if _, err := conn.Read(buf); err != nil {
+						return
+					}
+					if _, err := conn.Write(buf); err != nil {
+						return
+					}
+				}
+			}()
+		}
+	}()
+
+	dial := func() (*tls.Conn, string) {
+		conn, err := tls.Dial("tcp", ln.Addr().String(), &tls.Config{InsecureSkipVerify: true})
+		if err != nil {
+			t.Fatalf("unexpected error connecting: %v", err)
+		}
+		return conn, conn.ConnectionState().PeerCertificates[0].Subject.CommonName
+	}
+	echo := func(conn *tls.Conn) error {
+		if _, err := conn.Write([]byte("x")); err != nil {
+			return err
+		}
+		_, err := conn.Read(make([]byte, 1))
+		return err
+	}
+
+	first, name := dial()
+	defer first.Close()
+	if name != "first" {
+		t.Fatalf("expected certificate %q, got %q", "first", name)
+	}
+
+	writeCertificate(t, certFile, keyFile, "second")
+	if err := reloader.reload(); err != nil {
+		t.Fatalf("unexpected error reloading: %v", err)
+	}
+
+	second, name := dial()
+	defer second.Close()
+	if name != "second" {
+		t.Fatalf("expected certificate %q after reload, got %q", "second", name)
+	}
+	if err := echo(first); err != nil {
+		t.Fatalf("expected the connection established before the reload to be kept: %v", err)
+	}
+}
@@ -2,6 +2,7 @@ package distribution
 
 import (
 	"context"
+	"time"
 
 	"github.com/opencontainers/go-digest"
 )
@@ -35,3 +36,19 @@ type TagManifestsProvider interface {
 	// includes currently linked digest. There is no ordering guaranteed
 	ManifestDigests(ctx context.Context, tag string) ([]digest.Digest, error)
 }
+
+// TagModTimeProvider provides the time at which tags were last updated.
+type TagModTimeProvider interface {
+	// ModTime returns the time at which the tag was last pointed at a
+	// manifest.
+	ModTime(ctx context.Context, tag string) (time.Time, error)
+}
+
+// TagLister lists the tags of a repository a page at a time, without
+// loading every tag of the repository.
+type TagLister interface {
+	// List returns up to n tags sorting lexically after last, in lexical
+	// order. An empty last starts from the first tag, and a negative n
+	// returns every remaining tag.
+	List(ctx context.Context, last string, n int) ([]string, error)
+}